@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
 	"math"
 	"strings"
 	"sync"
@@ -15,6 +16,7 @@ import (
 	"git.sr.ht/~rjarry/aerc/lib/hooks"
 	"git.sr.ht/~rjarry/aerc/lib/log"
 	"git.sr.ht/~rjarry/aerc/lib/marker"
+	"git.sr.ht/~rjarry/aerc/lib/outbox"
 	"git.sr.ht/~rjarry/aerc/lib/pama"
 	"git.sr.ht/~rjarry/aerc/lib/sort"
 	"git.sr.ht/~rjarry/aerc/lib/state"
@@ -30,15 +32,22 @@ var _ ProvidesMessages = (*AccountView)(nil)
 
 var WorkerMessages = make(chan types.WorkerMessage, 2048)
 
+// NewMessageHandler, if passed to Init, is called on the main goroutine for
+// every new message received in a folder, right after the mail-received hook.
+type NewMessageHandler func(*AccountView, *lib.MessageStore, *models.MessageInfo)
+
 type AccountView struct {
 	sync.Mutex
 	acct    *config.AccountConfig
 	dirlist DirectoryLister
 	labels  []string
+	// folders advertised by the backend with a special-use role
+	roles   map[models.Role]string
 	grid    *ui.Grid
 	tab     *ui.Tab
 	msglist *MessageList
 	worker  *types.Worker
+	undo    *lib.UndoStack
 	state   state.AccountState
 	newConn bool // True if this is a first run after a new connection/reconnection
 
@@ -60,6 +69,9 @@ type AccountView struct {
 
 	// Reconnection with exponential backoff
 	reconnectRetries int
+
+	// Messages waiting to be sent
+	outbox *outbox.Outbox
 }
 
 func (acct *AccountView) UiConfig() *config.UIConfig {
@@ -73,7 +85,9 @@ func NewAccountView(
 	acct *config.AccountConfig, deferLoop chan struct{},
 ) (*AccountView, error) {
 	view := &AccountView{
-		acct: acct,
+		acct:  acct,
+		undo:  lib.NewUndoStack(),
+		roles: make(map[models.Role]string),
 	}
 
 	worker, err := worker.NewWorker(acct.Source, acct.Name, WorkerMessages)
@@ -102,6 +116,7 @@ func NewAccountView(
 
 	worker.PostAction(context.TODO(), &types.Configure{Config: acct}, nil)
 	worker.PostAction(context.TODO(), &types.Connect{}, nil)
+	view.openOutbox()
 	view.SetStatus(state.ConnectionActivity("Connecting..."))
 	if acct.CheckMail.Minutes() > 0 {
 		view.CheckMailTimer(acct.CheckMail)
@@ -199,6 +214,12 @@ func (acct *AccountView) Directories() DirectoryLister {
 	return acct.dirlist
 }
 
+// UndoStack returns the operations performed on messages of this account that
+// can be undone.
+func (acct *AccountView) UndoStack() *lib.UndoStack {
+	return acct.undo
+}
+
 func (acct *AccountView) SetDirectories(d DirectoryLister) {
 	if acct.grid != nil {
 		acct.grid.ReplaceChild(acct.dirlist, d)
@@ -293,6 +314,11 @@ func (acct *AccountView) newStore(name string) *lib.MessageStore {
 				msg := fmt.Sprintf("mail-received hook: %s", err)
 				PushError(msg)
 			}
+			if aerc.newMessage != nil {
+				if store, ok := acct.dirlist.MsgStore(name); ok {
+					aerc.newMessage(acct, store, msg)
+				}
+			}
 		}, func() {
 			acct.worker.Debugf("Invoking directory-change hook")
 			if uiConf.NewMessageBell {
@@ -376,6 +402,7 @@ func (acct *AccountView) newStore(name string) *lib.MessageStore {
 		},
 	)
 	store.Configure(acct.SortCriteria(uiConf))
+	store.SetUndoStack(acct.undo)
 	store.SetMarker(marker.New(store))
 	return store
 }
@@ -390,13 +417,15 @@ func (acct *AccountView) onMessage(msg types.WorkerMessage) {
 			acct.SetStatus(state.ConnectionActivity("Listing mailboxes..."))
 			log.Infof("[%s] connected.", acct.acct.Name)
 			acct.SetStatus(state.SetConnected(true))
+			acct.startOutbox()
 			log.Tracef("[%s] Listing mailboxes...", acct.acct.Name)
-			acct.worker.PostAction(context.TODO(), &types.ListDirectories{}, nil)
+			acct.listDirectories()
 		case *types.Disconnect:
 			acct.dirlist.ClearList()
 			acct.msglist.SetStore(nil)
 			log.Infof("[%s] disconnected.", acct.acct.Name)
 			acct.SetStatus(state.SetConnected(false))
+			acct.stopOutbox()
 		case *types.OpenDirectory:
 			acct.dirlist.Update(msg)
 			if store, ok := acct.dirlist.SelectedMsgStore(); ok {
@@ -417,6 +446,7 @@ func (acct *AccountView) onMessage(msg types.WorkerMessage) {
 			acct.dirlist.Update(msg)
 		case *types.RemoveDirectory:
 			acct.dirlist.Update(msg)
+			acct.setRole("", resp.Directory)
 		case *types.FetchMessageHeaders:
 			if acct.newConn {
 				acct.checkMailOnStartup()
@@ -451,6 +481,7 @@ func (acct *AccountView) onMessage(msg types.WorkerMessage) {
 			store = acct.newStore(msg.Dir.Name)
 		}
 		acct.dirlist.SetMsgStore(msg.Dir, store)
+		acct.setRole(msg.Dir.Role, msg.Dir.Name)
 	case *types.DirectoryInfo:
 		acct.dirlist.Update(msg)
 	case *types.DirectoryContents:
@@ -528,22 +559,20 @@ func (acct *AccountView) onMessage(msg types.WorkerMessage) {
 	case *types.ConnError:
 		log.Errorf("[%s] connection error: %v", acct.acct.Name, msg.Error)
 		acct.SetStatus(state.SetConnected(false))
+		acct.stopOutbox()
 		acct.PushError(msg.Error)
 		acct.msglist.SetStore(nil)
-		// Exponential backoff: 1.8^retries seconds, capped at ReconnectMaxWait
-		var wait time.Duration
-		if acct.reconnectRetries > 0 {
-			backoff := math.Pow(1.8, float64(acct.reconnectRetries))
-			wait = time.Duration(backoff) * time.Second
-			maxWait := acct.acct.ReconnectMaxWait
-			if wait > maxWait {
-				wait = maxWait
-			}
+		acct.scheduleReconnect()
+	case *types.Offline:
+		log.Warnf("[%s] offline: %v", acct.acct.Name, msg.Error)
+		acct.SetStatus(state.SetConnected(false))
+		acct.SetStatus(state.ConnectionActivity("Offline"))
+		acct.stopOutbox()
+		if acct.Store() == nil {
+			// messages are served from the local store until reconnected
+			acct.listDirectories()
 		}
-		acct.reconnectRetries++
-		time.AfterFunc(wait, func() {
-			acct.worker.PostAction(context.TODO(), &types.Reconnect{}, nil)
-		})
+		acct.scheduleReconnect()
 	case *types.Error:
 		log.Errorf("[%s] unexpected error: %v", acct.acct.Name, msg.Error)
 		acct.PushError(msg.Error)
@@ -552,6 +581,24 @@ func (acct *AccountView) onMessage(msg types.WorkerMessage) {
 	acct.setTitle()
 }
 
+// scheduleReconnect retries to connect with an exponential backoff:
+// 1.8^retries seconds, capped at ReconnectMaxWait.
+func (acct *AccountView) scheduleReconnect() {
+	var wait time.Duration
+	if acct.reconnectRetries > 0 {
+		backoff := math.Pow(1.8, float64(acct.reconnectRetries))
+		wait = time.Duration(backoff) * time.Second
+		maxWait := acct.acct.ReconnectMaxWait
+		if wait > maxWait {
+			wait = maxWait
+		}
+	}
+	acct.reconnectRetries++
+	time.AfterFunc(wait, func() {
+		acct.worker.PostAction(context.TODO(), &types.Reconnect{}, nil)
+	})
+}
+
 func (acct *AccountView) ensurePositive(val int, name string) int {
 	if val < 0 {
 		acct.worker.Errorf("Unexpected negative value (%d) for %s", val, name)
@@ -952,3 +999,53 @@ func (acct *AccountView) setTitle() {
 	}
 	acct.tab.SetTitle(buf.String())
 }
+
+// RoleDirectory returns the folder which the backend reports with the given
+// special-use role, if any.
+func (acct *AccountView) RoleDirectory(role models.Role) (string, bool) {
+	dir, ok := acct.roles[role]
+	return dir, ok
+}
+
+// ArchiveFolder returns the destination of :archive, see
+// config.AccountConfig.ArchiveFolder.
+func (acct *AccountView) ArchiveFolder() string {
+	return acct.acct.ArchiveFolder(acct.roles)
+}
+
+// PostponeFolder returns the folder where postponed messages are saved, see
+// config.AccountConfig.PostponeFolder.
+func (acct *AccountView) PostponeFolder() string {
+	return acct.acct.PostponeFolder(acct.roles)
+}
+
+// CopyToFolders returns the folders where sent messages are copied, see
+// config.AccountConfig.CopyToFolders.
+func (acct *AccountView) CopyToFolders() []string {
+	return acct.acct.CopyToFolders(acct.roles)
+}
+
+// JunkFolder returns the folder where spam is moved, see
+// config.AccountConfig.JunkFolder.
+func (acct *AccountView) JunkFolder() string {
+	return acct.acct.JunkFolder(acct.roles)
+}
+
+// setRole records the special-use role of a folder. Any previous role of
+// the folder is forgotten, an empty role removes it.
+func (acct *AccountView) setRole(role models.Role, dir string) {
+	maps.DeleteFunc(acct.roles, func(_ models.Role, d string) bool {
+		return d == dir
+	})
+	if role != "" {
+		acct.roles[role] = dir
+	}
+}
+
+// listDirectories lists the folders again. Their roles are forgotten until
+// they are reported in the listing so that the roles which disappeared do
+// not linger.
+func (acct *AccountView) listDirectories() {
+	clear(acct.roles)
+	acct.worker.PostAction(context.TODO(), &types.ListDirectories{}, nil)
+}
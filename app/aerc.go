@@ -31,6 +31,7 @@ type Aerc struct {
 	cmd         func(string, *config.AccountConfig, *models.MessageInfo) error
 	cmdHistory  lib.History
 	complete    func(ctx context.Context, cmd string) ([]opt.Completion, string)
+	newMessage  NewMessageHandler
 	focused     ui.Interactive
 	grid        *ui.Grid
 	simulating  int
@@ -43,7 +44,7 @@ type Aerc struct {
 	beep        func()
 	dialog      ui.DrawableInteractive
 
-	Crypto crypto.Provider
+	Crypto *crypto.Providers
 }
 
 func (aerc Aerc) CmdHistory() lib.History {
@@ -57,10 +58,10 @@ type Choice struct {
 }
 
 func (aerc *Aerc) Init(
-	crypto crypto.Provider,
+	crypto *crypto.Providers,
 	cmd func(string, *config.AccountConfig, *models.MessageInfo) error,
 	complete func(ctx context.Context, cmd string) ([]opt.Completion, string), cmdHistory lib.History,
-	deferLoop chan struct{},
+	newMessage NewMessageHandler, deferLoop chan struct{},
 ) {
 	tabs := ui.NewTabs(func(d ui.Drawable) *config.UIConfig {
 		acct := aerc.account(d)
@@ -89,6 +90,7 @@ func (aerc *Aerc) Init(
 	aerc.cmd = cmd
 	aerc.cmdHistory = cmdHistory
 	aerc.complete = complete
+	aerc.newMessage = newMessage
 	aerc.grid = grid
 	aerc.statusbar = statusbar
 	aerc.statusline = statusline
@@ -171,6 +173,10 @@ func (aerc *Aerc) HandleMessage(msg types.WorkerMessage) {
 	if acct, ok := aerc.accounts[msg.Account()]; ok {
 		acct.onMessage(msg)
 	}
+	if _, ok := aerc.SelectedTabContent().(*UnifiedView); ok {
+		// the unified view is not notified of the store updates
+		ui.Invalidate()
+	}
 }
 
 func (aerc *Aerc) Invalidate() {
@@ -258,6 +264,9 @@ func (aerc *Aerc) getBindings() *config.KeyBindings {
 	case *AccountView:
 		binds := config.Binds().MessageList.ForAccount(selectedAccountName)
 		return binds.ForFolder(view.SelectedDirectory())
+	case *UnifiedView:
+		binds := config.Binds().MessageList.ForAccount(selectedAccountName)
+		return binds.ForFolder(view.SelectedDirectory())
 	case *AccountWizard:
 		return config.Binds().AccountWizard
 	case *Composer:
@@ -520,6 +529,8 @@ func (aerc *Aerc) account(d ui.Drawable) *AccountView {
 		return tab
 	case *MessageViewer:
 		return tab.SelectedAccount()
+	case *UnifiedView:
+		return tab.SelectedAccount()
 	case *Composer:
 		return tab.Account()
 	}
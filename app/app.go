@@ -20,12 +20,12 @@ import (
 var aerc Aerc
 
 func Init(
-	crypto crypto.Provider,
+	crypto *crypto.Providers,
 	cmd func(string, *config.AccountConfig, *models.MessageInfo) error,
 	complete func(ctx context.Context, cmd string) ([]opt.Completion, string), history lib.History,
-	deferLoop chan struct{},
+	newMessage NewMessageHandler, deferLoop chan struct{},
 ) {
-	aerc.Init(crypto, cmd, complete, history, deferLoop)
+	aerc.Init(crypto, cmd, complete, history, newMessage, deferLoop)
 }
 
 func Drawable() ui.DrawableInteractive      { return &aerc }
@@ -95,6 +95,10 @@ func RegisterChoices(choices []Choice)         { aerc.RegisterChoices(choices) }
 func RegisterPrompt(prompt string, cmd string) { aerc.RegisterPrompt(prompt, cmd) }
 
 func CryptoProvider() crypto.Provider { return aerc.Crypto }
+
+func AccountCryptoProvider(acct *config.AccountConfig) crypto.Provider {
+	return aerc.Crypto.For(acct)
+}
 func DecryptKeys(keys []openpgp.Key, symmetric bool) (b []byte, err error) {
 	return aerc.DecryptKeys(keys, symmetric)
 }
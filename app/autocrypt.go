@@ -0,0 +1,195 @@
+package app
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/emersion/go-message"
+	"github.com/emersion/go-message/mail"
+
+	"git.sr.ht/~rjarry/aerc/config"
+	"git.sr.ht/~rjarry/aerc/lib"
+	"git.sr.ht/~rjarry/aerc/lib/crypto"
+	"git.sr.ht/~rjarry/aerc/lib/crypto/autocrypt"
+	"git.sr.ht/~rjarry/aerc/lib/log"
+	"git.sr.ht/~rjarry/aerc/lib/xdg"
+)
+
+var (
+	autocryptLock   sync.Mutex
+	autocryptStores = make(map[string]*autocrypt.Store)
+)
+
+func autocryptStore(acct *config.AccountConfig) (*autocrypt.Store, error) {
+	if s, ok := autocryptStores[acct.Name]; ok {
+		return s, nil
+	}
+	s, err := autocrypt.Open(
+		xdg.DataPath("aerc", "autocrypt", acct.Name+".json"))
+	if err != nil {
+		return nil, err
+	}
+	autocryptStores[acct.Name] = s
+	return s, nil
+}
+
+// autocryptHeaders returns the Autocrypt headers of a message whose addr is
+// among addrs, indexed by address. Addresses with several headers are
+// discarded.
+func autocryptHeaders(
+	h *mail.Header, key string, addrs []*mail.Address,
+) map[string]*autocrypt.Header {
+	headers := make(map[string]*autocrypt.Header)
+	discarded := make(map[string]bool)
+	for _, value := range h.Values(key) {
+		ah, err := autocrypt.Parse(value)
+		if err != nil {
+			log.Debugf("invalid %s header: %v", key, err)
+			continue
+		}
+		found := false
+		for _, addr := range addrs {
+			if strings.EqualFold(addr.Address, ah.Addr) {
+				found = true
+				break
+			}
+		}
+		if !found || discarded[ah.Addr] {
+			continue
+		}
+		if _, ok := headers[ah.Addr]; ok {
+			delete(headers, ah.Addr)
+			discarded[ah.Addr] = true
+			continue
+		}
+		headers[ah.Addr] = ah
+	}
+	return headers
+}
+
+// updateAutocrypt records the Autocrypt and Autocrypt-Gossip headers of
+// a viewed message and imports the new keys into the keyring. Only the user
+// IDs matching the address the keys were received for are imported.
+func updateAutocrypt(acct *config.AccountConfig, msg lib.MessageView) {
+	info := msg.MessageInfo()
+	if !acct.Autocrypt || acct.CryptoProvider == "smime" ||
+		info == nil || info.Envelope == nil || info.RFC822Headers == nil ||
+		len(info.Envelope.From) != 1 {
+		return
+	}
+	if bs := info.BodyStructure; bs != nil &&
+		bs.MIMEType == "multipart" && bs.MIMESubType == "report" {
+		return
+	}
+	env := info.Envelope
+
+	var gossip *mail.Header
+	if md := msg.MessageDetails(); md != nil && md.IsEncrypted {
+		// the message has already been decrypted, this returns
+		// immediately
+		msg.FetchFull(func(r io.Reader) {
+			if mr, err := mail.CreateReader(r); err == nil {
+				gossip = &mr.Header
+			}
+		})
+	}
+
+	autocryptLock.Lock()
+	defer autocryptLock.Unlock()
+
+	store, err := autocryptStore(acct)
+	if err != nil {
+		log.Errorf("autocrypt: %v", err)
+		return
+	}
+	keys := make(map[string][]byte)
+	from := env.From[0].Address
+	headers := autocryptHeaders(info.RFC822Headers, "Autocrypt", env.From)
+	if key := store.Update(from, env.Date, headers[strings.ToLower(from)]); key != nil {
+		keys[from] = key
+	}
+	if gossip != nil {
+		rcpts := append(append([]*mail.Address{}, env.To...), env.Cc...)
+		for addr, h := range autocryptHeaders(gossip, "Autocrypt-Gossip", rcpts) {
+			if key := store.UpdateGossip(addr, env.Date, h); key != nil {
+				keys[addr] = key
+			}
+		}
+	}
+	for addr, key := range keys {
+		key, err := autocrypt.FilterKey(key, addr)
+		if err == nil {
+			err = AccountCryptoProvider(acct).ImportKeys(bytes.NewReader(key))
+		}
+		if err != nil {
+			log.Warnf("autocrypt: failed to import key of %s: %v", addr, err)
+		}
+	}
+	if err := store.Save(); err != nil {
+		log.Errorf("autocrypt: %v", err)
+	}
+}
+
+// withAutocrypt adds an Autocrypt header with the key of the sender to
+// a copy of the header of an outgoing message.
+func withAutocrypt(
+	acct *config.AccountConfig, provider crypto.Provider, header *mail.Header,
+) (*mail.Header, error) {
+	from, err := header.AddressList("from")
+	if err != nil {
+		return nil, err
+	}
+	if len(from) == 0 {
+		return header, nil
+	}
+	signer := acct.PgpKeyId
+	if signer == "" {
+		signer = from[0].Address
+	}
+	keyId, err := provider.GetSignerKeyId(signer)
+	if err != nil {
+		return nil, err
+	}
+	r, err := provider.ExportKey(keyId)
+	if err != nil {
+		return nil, err
+	}
+	key, err := autocrypt.Dearmor(r)
+	if err != nil {
+		return nil, err
+	}
+	h := autocrypt.Header{
+		Addr:          strings.ToLower(from[0].Address),
+		PreferEncrypt: acct.PgpOpportunisticEncrypt,
+		KeyData:       key,
+	}
+	copied := mail.Header{Header: message.Header{Header: header.Header.Header.Copy()}}
+	copied.Set("Autocrypt", h.Format())
+	return &copied, nil
+}
+
+// addAutocryptGossip adds Autocrypt-Gossip headers for the recipients of an
+// encrypted message whose key is known.
+func addAutocryptGossip(
+	acct *config.AccountConfig, header *mail.Header, rcpts []string,
+) error {
+	autocryptLock.Lock()
+	defer autocryptLock.Unlock()
+
+	store, err := autocryptStore(acct)
+	if err != nil {
+		return err
+	}
+	for _, rcpt := range rcpts {
+		addr := strings.ToLower(rcpt)
+		peer, ok := store.Peers[addr]
+		if !ok || len(peer.Key()) == 0 {
+			continue
+		}
+		h := autocrypt.Header{Addr: addr, KeyData: peer.Key()}
+		header.Add("Autocrypt-Gossip", h.Format())
+	}
+	return nil
+}
@@ -23,6 +23,7 @@ import (
 	"git.sr.ht/~rjarry/aerc/completer"
 	"git.sr.ht/~rjarry/aerc/config"
 	"git.sr.ht/~rjarry/aerc/lib"
+	"git.sr.ht/~rjarry/aerc/lib/crypto"
 	"git.sr.ht/~rjarry/aerc/lib/format"
 	"git.sr.ht/~rjarry/aerc/lib/log"
 	"git.sr.ht/~rjarry/aerc/lib/send"
@@ -59,6 +60,7 @@ type Composer struct {
 	attachKey           bool
 	editHeaders         bool
 	centeredLayoutWidth int
+	keyLookups          map[string]bool
 
 	layout    HeaderLayout
 	focusable []ui.MouseableDrawableInteractive
@@ -66,6 +68,8 @@ type Composer struct {
 	sent      bool
 	archive   string
 
+	patchReview bool
+
 	recalledFrom string
 	postponed    bool
 
@@ -348,8 +352,12 @@ func (c *Composer) SetAttachKey(attach bool) error {
 			return err
 		}
 	}
+	mimeType, ext := "application/pgp-keys", ".asc"
+	if c.acctConfig.CryptoProvider == "smime" {
+		mimeType, ext = "application/pem-certificate-chain", ".pem"
+	}
 	if !attach {
-		name := c.crypto.signKey + ".asc"
+		name := c.crypto.signKey + ext
 		found := false
 		for _, a := range c.attachments {
 			if a.Name() == name {
@@ -372,19 +380,19 @@ func (c *Composer) SetAttachKey(attach bool) error {
 			} else {
 				s = c.acctConfig.From.Address
 			}
-			c.crypto.signKey, err = CryptoProvider().GetSignerKeyId(s)
+			c.crypto.signKey, err = c.cryptoProvider().GetSignerKeyId(s)
 			if err != nil {
 				return err
 			}
 		}
 
-		r, err := CryptoProvider().ExportKey(c.crypto.signKey)
+		r, err := c.cryptoProvider().ExportKey(c.crypto.signKey)
 		if err != nil {
 			return err
 		}
 
 		newPart, err := lib.NewPart(
-			"application/pgp-keys",
+			mimeType,
 			map[string]string{"charset": "UTF-8"},
 			r,
 		)
@@ -394,7 +402,7 @@ func (c *Composer) SetAttachKey(attach bool) error {
 		c.attachments = append(c.attachments,
 			lib.NewPartAttachment(
 				newPart,
-				c.crypto.signKey+".asc",
+				c.crypto.signKey+ext,
 			),
 		)
 
@@ -461,7 +469,7 @@ func (c *Composer) updateCrypto() error {
 		c.crypto = newCryptoStatus(uiConfig)
 	}
 	if c.sign {
-		cp := CryptoProvider()
+		cp := c.cryptoProvider()
 		s, err := c.Signer()
 		if err != nil {
 			return errors.Wrap(err, "Signer")
@@ -510,6 +518,36 @@ func (c *Composer) writeEml(reader io.Reader) error {
 	return c.email.Sync()
 }
 
+// SetContents replaces the message body. Like setContents, it must be called
+// before the first Draw() call.
+func (c *Composer) SetContents(reader io.Reader) error {
+	c.Lock()
+	defer c.Unlock()
+	return c.setContents(reader)
+}
+
+// SetPatchReview marks the message as a patch review. The quoted diff hunks
+// without comments are trimmed with TrimQuotedHunks before sending.
+func (c *Composer) SetPatchReview(review bool) {
+	c.patchReview = review
+}
+
+// TrimQuotedHunks removes the quoted diff hunks without comments from the
+// message body of a patch review. It does nothing for other messages.
+func (c *Composer) TrimQuotedHunks() error {
+	c.Lock()
+	defer c.Unlock()
+	if !c.patchReview {
+		return nil
+	}
+	body, err := c.GetBody()
+	if err != nil {
+		return err
+	}
+	text := templates.TrimQuotedHunks(body.String())
+	return c.setContents(strings.NewReader(text))
+}
+
 // Note: this does not reload the editor. You must call this before the first
 // Draw() call.
 func (c *Composer) setContents(reader io.Reader) error {
@@ -955,6 +993,11 @@ func getRecipientsEmail(c *Composer) ([]string, error) {
 	return results, nil
 }
 
+// cryptoProvider returns the provider used to sign and encrypt the message.
+func (c *Composer) cryptoProvider() crypto.Provider {
+	return AccountCryptoProvider(c.acctConfig)
+}
+
 func (c *Composer) Signer() (string, error) {
 	signer := ""
 
@@ -980,6 +1023,16 @@ func (c *Composer) Signer() (string, error) {
 }
 
 func (c *Composer) WriteMessage(header *mail.Header, writer io.Writer) error {
+	autocrypt := c.acctConfig.Autocrypt && c.acctConfig.CryptoProvider != "smime"
+	if autocrypt {
+		h, err := withAutocrypt(c.acctConfig, c.cryptoProvider(), header)
+		if err != nil {
+			log.Warnf("autocrypt: %v", err)
+		} else {
+			header = h
+		}
+	}
+
 	if c.sign || c.encrypt {
 
 		var signedHeader mail.Header
@@ -1011,12 +1064,19 @@ func (c *Composer) WriteMessage(header *mail.Header, writer io.Writer) error {
 				rcpts = append(rcpts, signer)
 			}
 
-			cleartext, err = CryptoProvider().Encrypt(&buf, rcpts, signer, DecryptKeys, header)
+			if autocrypt && len(rcpts) > 1 {
+				err := addAutocryptGossip(c.acctConfig, &signedHeader, rcpts)
+				if err != nil {
+					log.Warnf("autocrypt: %v", err)
+				}
+			}
+
+			cleartext, err = c.cryptoProvider().Encrypt(&buf, rcpts, signer, DecryptKeys, header)
 			if err != nil {
 				return err
 			}
 		} else {
-			cleartext, err = CryptoProvider().Sign(&buf, signer, DecryptKeys, header)
+			cleartext, err = c.cryptoProvider().Sign(&buf, signer, DecryptKeys, header)
 			if err != nil {
 				return err
 			}
@@ -1282,6 +1342,9 @@ func (c *Composer) termClosed(err error) {
 			}
 			return
 		}
+		// keep the Message-Id unless the From address was changed
+		from := extractHumanHeaderValue("from", c.header)
+		msgid := c.header.Get("message-id")
 		// delete previous headers first
 		for _, h := range c.headerOrder() {
 			c.delEditor(h)
@@ -1293,6 +1356,9 @@ func (c *Composer) termClosed(err error) {
 				c.addEditor(hf.Key(), hf.Value(), false)
 			}
 		}
+		if msgid != "" && extractHumanHeaderValue("from", c.header) == from {
+			c.header.Set("message-id", msgid)
+		}
 	}
 
 	// prepare review window
@@ -1628,6 +1694,7 @@ func (he *headerEditor) loadValue() {
 // storeValue writes the current state back to the underlying header.
 // errors are ignored
 func (he *headerEditor) storeValue() {
+	prev := extractHumanHeaderValue(he.name, he.header)
 	val := he.input.String()
 	switch strings.ToLower(he.name) {
 	case "to", "from", "cc", "bcc":
@@ -1647,7 +1714,11 @@ func (he *headerEditor) storeValue() {
 	default:
 		he.header.SetText(he.name, val)
 	}
-	if strings.ToLower(he.name) == "from" {
+	// the Message-Id hostname may depend on the From address, keep
+	// a Message-Id which was set before (e.g. to thread a patch series)
+	// as long as the From address is not changed
+	if strings.ToLower(he.name) == "from" &&
+		extractHumanHeaderValue(he.name, he.header) != prev {
 		he.header.Del("message-id")
 	}
 }
@@ -1964,7 +2035,7 @@ func (c *Composer) checkEncryptionKeys(_ string) bool {
 	}
 	var mk []string
 	for _, rcpt := range rcpts {
-		key, err := CryptoProvider().GetKeyId(rcpt)
+		key, err := c.cryptoProvider().GetKeyId(rcpt)
 		if err != nil || key == "" {
 			mk = append(mk, rcpt)
 		}
@@ -1974,6 +2045,7 @@ func (c *Composer) checkEncryptionKeys(_ string) bool {
 	switch {
 	case len(mk) > 0:
 		c.SetEncrypt(false)
+		c.lookupKeys(mk)
 		st := fmt.Sprintf("Cannot encrypt, missing keys: %s", strings.Join(mk, ", "))
 		if c.Config().PgpOpportunisticEncrypt {
 			switch c.Config().PgpErrorLevel {
@@ -0,0 +1,72 @@
+package app
+
+import (
+	"testing"
+
+	"git.sr.ht/~rjarry/aerc/config"
+	"github.com/emersion/go-message/mail"
+)
+
+func newTestComposer(h *mail.Header) *Composer {
+	uiConfig := &config.UIConfig{}
+	return &Composer{
+		header:     h,
+		acctConfig: &config.AccountConfig{},
+		editors: map[string]*headerEditor{
+			"from": newHeaderEditor("From", h, uiConfig),
+		},
+	}
+}
+
+func TestComposer_PrepareHeaderThreading(t *testing.T) {
+	from := []*mail.Address{{Name: "John Doe", Address: "john@example.com"}}
+
+	// a series of two messages, the second one replies to the first one
+	first := new(mail.Header)
+	first.SetAddressList("from", from)
+	if err := first.GenerateMessageIDWithHostname("example.com"); err != nil {
+		t.Fatal(err)
+	}
+	msgid, _ := first.MessageID()
+	second := new(mail.Header)
+	second.SetAddressList("from", from)
+	second.SetMsgIDList("in-reply-to", []string{msgid})
+	second.SetMsgIDList("references", []string{msgid})
+
+	h1, err := newTestComposer(first).PrepareHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, err := newTestComposer(second).PrepareHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent, _ := h1.MessageID()
+	if sent != msgid {
+		t.Errorf("Message-Id was changed from %q to %q", msgid, sent)
+	}
+	if parents, _ := h2.MsgIDList("in-reply-to"); len(parents) != 1 || parents[0] != sent {
+		t.Errorf("In-Reply-To %v does not match the first message %q", parents, sent)
+	}
+	if id, _ := h2.MessageID(); id == "" || id == sent {
+		t.Errorf("unexpected Message-Id %q for the second message", id)
+	}
+}
+
+func TestComposer_PrepareHeaderFromChanged(t *testing.T) {
+	h := new(mail.Header)
+	h.SetAddressList("from", []*mail.Address{{Address: "john@example.com"}})
+	if err := h.GenerateMessageIDWithHostname("example.com"); err != nil {
+		t.Fatal(err)
+	}
+	msgid, _ := h.MessageID()
+
+	c := newTestComposer(h)
+	c.editors["from"].input.Set("jane@example.org")
+	if _, err := c.PrepareHeader(); err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := h.MessageID(); id == msgid {
+		t.Errorf("Message-Id %q was kept after changing From", id)
+	}
+}
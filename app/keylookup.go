@@ -0,0 +1,92 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"git.sr.ht/~rjarry/aerc/lib/crypto/keylookup"
+	"git.sr.ht/~rjarry/aerc/lib/log"
+	"git.sr.ht/~rjarry/aerc/lib/ui"
+)
+
+// lookupKeys searches the configured key lookup sources for the keys of
+// recipients missing from the keyring. The user is asked to confirm the
+// import of every key found. Each address is only searched once per
+// composer.
+func (c *Composer) lookupKeys(rcpts []string) {
+	sources := c.acctConfig.PgpKeyLookup
+	if len(sources) == 0 || c.acctConfig.CryptoProvider == "smime" {
+		return
+	}
+	if c.keyLookups == nil {
+		c.keyLookups = make(map[string]bool)
+	}
+	var pending []string
+	for _, rcpt := range rcpts {
+		if !c.keyLookups[rcpt] {
+			c.keyLookups[rcpt] = true
+			pending = append(pending, rcpt)
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+	go func() {
+		defer log.PanicHandler()
+		var keys []*keylookup.Key
+		for _, rcpt := range pending {
+			key, err := keylookup.Lookup(context.Background(), sources, rcpt)
+			if err != nil {
+				log.Debugf("key lookup for %s: %v", rcpt, err)
+				continue
+			}
+			keys = append(keys, key)
+		}
+		if len(keys) > 0 {
+			ui.QueueFunc(func() { c.confirmKeys(keys, false) })
+		}
+	}()
+}
+
+// confirmKeys asks the user to import keys one after the other and refreshes
+// the encryption status once done if any key was imported.
+func (c *Composer) confirmKeys(keys []*keylookup.Key, imported bool) {
+	if len(keys) == 0 {
+		if imported {
+			c.SetEncrypt(true)
+		}
+		return
+	}
+	key := keys[0]
+	prompt := fmt.Sprintf("Import the key found on %s?\n\n%s\n%s",
+		key.Source, key.UserId, formatFingerprint(key.Fingerprint))
+	AddDialog(NewSelectorDialog(
+		"Import key", prompt, []string{"No", "Yes"}, 0,
+		c.acct.UiConfig(),
+		func(option string, _ error) {
+			CloseDialog()
+			if option == "Yes" {
+				err := c.cryptoProvider().ImportKeys(bytes.NewReader(key.Data))
+				if err != nil {
+					PushError(fmt.Sprintf("Failed to import key: %v", err))
+				} else {
+					imported = true
+				}
+			}
+			c.confirmKeys(keys[1:], imported)
+		},
+	))
+}
+
+// formatFingerprint splits a hexadecimal fingerprint in groups of four
+// characters.
+func formatFingerprint(fpr string) string {
+	var groups []string
+	for len(fpr) > 4 {
+		groups = append(groups, fpr[:4])
+		fpr = fpr[4:]
+	}
+	return strings.Join(append(groups, fpr), " ")
+}
@@ -65,6 +65,7 @@ func NewMessageViewer(
 		return &MessageViewer{acct: acct}, nil
 	}
 	info := msg.MessageInfo()
+	go updateAutocrypt(acct.AccountConfig(), msg)
 	viewerConfig := config.Viewer().ForEnvelope(info.Envelope)
 	hf := HeaderLayoutFilter{
 		layout: HeaderLayout(viewerConfig.HeaderLayout),
@@ -0,0 +1,194 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-message/mail"
+	"github.com/emersion/go-message/textproto"
+
+	"git.sr.ht/~rjarry/aerc/lib/hooks"
+	"git.sr.ht/~rjarry/aerc/lib/log"
+	"git.sr.ht/~rjarry/aerc/lib/outbox"
+	"git.sr.ht/~rjarry/aerc/lib/send"
+	"git.sr.ht/~rjarry/aerc/lib/state"
+	"git.sr.ht/~rjarry/aerc/lib/ui"
+	"git.sr.ht/~rjarry/aerc/models"
+	"git.sr.ht/~rjarry/aerc/worker/types"
+)
+
+// Outbox returns the local queue of messages waiting to be sent from this
+// account. It may be nil if the outbox could not be opened.
+func (acct *AccountView) Outbox() *outbox.Outbox {
+	return acct.outbox
+}
+
+func (acct *AccountView) openOutbox() {
+	path := acct.acct.Outbox
+	if path == "" {
+		path = outbox.DefaultPath(acct.acct.Name)
+	}
+	box, err := outbox.Open(path)
+	if err != nil {
+		log.Errorf("[%s] outbox: %v", acct.acct.Name, err)
+		return
+	}
+	box.OnChange(func() {
+		n := box.Len()
+		ui.QueueFunc(func() {
+			acct.SetStatus(state.Outbox(n))
+		})
+	})
+	acct.outbox = box
+	acct.SetStatus(state.Outbox(box.Len()))
+}
+
+// startOutbox begins delivering queued messages. It must only be called once
+// the worker is connected since messages may need to be copied to folders of
+// this account.
+func (acct *AccountView) startOutbox() {
+	if acct.outbox == nil {
+		return
+	}
+	acct.outbox.Start(acct.deliverQueued, func(msg *outbox.Message, err error) {
+		log.Errorf("[%s] outbox: %s: %v", acct.acct.Name, msg.Key, err)
+		acct.PushError(fmt.Errorf("sending %q failed, retrying in %s: %w",
+			msg.Header.Get("Subject"),
+			outbox.RetryDelay(msg.Attempts+1), err))
+	})
+}
+
+func (acct *AccountView) stopOutbox() {
+	if acct.outbox != nil {
+		acct.outbox.Stop()
+	}
+}
+
+func (acct *AccountView) deliverQueued(msg *outbox.Message, body io.Reader) error {
+	// the account state is only accessed from the main goroutine
+	connected := make(chan bool, 1)
+	ui.QueueFunc(func() { connected <- acct.state.Connected })
+	if !<-connected {
+		return errors.New("account is not connected")
+	}
+	outgoing, err := acct.acct.Outgoing.ConnectionString()
+	if err != nil {
+		return err
+	}
+	if outgoing == "" {
+		return errors.New("No outgoing mail transport configured for this account")
+	}
+	uri, err := url.Parse(outgoing)
+	if err != nil {
+		return err
+	}
+	from := msg.From
+	if from == nil {
+		from = acct.acct.From
+	}
+
+	if acct.acct.SendAsUTC {
+		msg.Header.SetDate(time.Now().UTC())
+	} else {
+		msg.Header.SetDate(time.Now())
+	}
+	var buf bytes.Buffer
+	if err := textproto.WriteHeader(&buf, msg.Header.Header.Header); err != nil {
+		return err
+	}
+	if _, err := io.Copy(&buf, body); err != nil {
+		return err
+	}
+	raw := buf.Bytes()
+
+	err = sendRaw(acct.worker, uri, acct.acct.Params["smtp-domain"],
+		from, msg.Rcpts, acct.acct.Name, msg.CopyTo, msg.RequestDSN, raw)
+	if err != nil && !send.IsTemporary(err) {
+		// Retrying will not help. Give the message back to the user.
+		// the folder roles are only accessed from the main goroutine
+		postpone := make(chan string, 1)
+		ui.QueueFunc(func() { postpone <- acct.PostponeFolder() })
+		dest := <-postpone
+		if aerr := acct.appendSync(dest, models.SeenFlag|models.DraftFlag, raw); aerr != nil {
+			log.Errorf("[%s] outbox: %s: %v", acct.acct.Name, dest, aerr)
+			return err
+		}
+		acct.PushError(fmt.Errorf("sending %q failed: %w. Message saved to %s",
+			msg.Header.Get("Subject"), err, dest))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Debugf("[%s] outbox: sent %s", acct.acct.Name, msg.Key)
+
+	if !strings.HasPrefix(uri.Scheme, "jmap") {
+		for _, dest := range msg.CopyTo {
+			if err := acct.appendSync(dest, models.SeenFlag, raw); err != nil {
+				acct.PushError(fmt.Errorf(
+					"message sent, but copying to %s failed: %w",
+					dest, err))
+			}
+		}
+	}
+
+	acct.PushStatus("Queued message sent.", 10*time.Second)
+	err = hooks.RunHook(&hooks.MailSent{
+		Account: acct.acct.Name,
+		Backend: acct.acct.Backend,
+		Header:  &msg.Header,
+	})
+	if err != nil {
+		log.Errorf("failed to trigger mail-sent hook: %v", err)
+		acct.PushError(fmt.Errorf("[hook.mail-sent] failed: %w", err))
+	}
+	return nil
+}
+
+// appendSync stores a message in a folder and waits for the worker to
+// complete the operation.
+func (acct *AccountView) appendSync(dest string, flags models.Flags, raw []byte) error {
+	acct.worker.PostAction(context.TODO(), &types.CreateDirectory{
+		Directory: dest,
+		Quiet:     true,
+	}, nil)
+	errCh := make(chan error, 1)
+	acct.worker.PostAction(context.TODO(), &types.AppendMessage{
+		Destination: dest,
+		Flags:       flags,
+		Date:        time.Now(),
+		Reader:      bytes.NewReader(raw),
+		Length:      len(raw),
+	}, func(msg types.WorkerMessage) {
+		switch msg := msg.(type) {
+		case *types.Done:
+			errCh <- nil
+		case *types.Error:
+			errCh <- msg.Error
+		}
+	})
+	return <-errCh
+}
+
+func sendRaw(
+	worker *types.Worker, uri *url.URL, domain string,
+	from *mail.Address, rcpts []*mail.Address, account string,
+	copyTo []string, requestDSN bool, raw []byte,
+) error {
+	sender, err := send.NewSender(worker, uri, domain, from, rcpts,
+		account, copyTo, requestDSN)
+	if err != nil {
+		return err
+	}
+	if _, err := sender.Write(raw); err != nil {
+		sender.Close()
+		return err
+	}
+	return sender.Close()
+}
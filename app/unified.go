@@ -0,0 +1,546 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"git.sr.ht/~rjarry/aerc/config"
+	"git.sr.ht/~rjarry/aerc/lib"
+	"git.sr.ht/~rjarry/aerc/lib/log"
+	"git.sr.ht/~rjarry/aerc/lib/state"
+	"git.sr.ht/~rjarry/aerc/lib/ui"
+	"git.sr.ht/~rjarry/aerc/models"
+	"git.sr.ht/~rjarry/aerc/worker/types"
+	"git.sr.ht/~rockorager/vaxis"
+)
+
+// interval at which the status of the default folders is checked when it is
+// not the folder open in their account
+var unifiedCheckInterval = time.Minute
+
+// UnifiedView merges the messages of the default folder of several accounts
+// into a single list sorted by date. Actions on the selected message are
+// performed by its account.
+type UnifiedView struct {
+	Scrollable
+	accounts []*AccountView
+	spinner  *Spinner
+	ticker   *time.Ticker
+	height   int
+	selected unifiedMessage
+	// position of the selected message when it was last found in the list
+	selectedIndex int
+
+	// default folders listed by date, independently of the sort order and
+	// threading of their message store
+	listings map[*AccountView]*unifiedListing
+	listed   uint64
+
+	// merged messages, only rebuilt when a store or a listing changes or
+	// when more messages are needed
+	msgs     []unifiedMessage
+	limit    int
+	total    int
+	stores   map[*AccountView]*lib.MessageStore
+	versions map[*AccountView]uint64
+	merged   uint64
+}
+
+// unifiedListing is the list of messages of the default folder of an account
+// sorted by date, in reverse display order like the message stores.
+type unifiedListing struct {
+	uids    []models.UID
+	loaded  bool
+	pending bool
+	// state of the folder and its store when the listing was requested
+	info models.DirectoryInfo
+	size int
+}
+
+type unifiedMessage struct {
+	acct *AccountView
+	uid  models.UID
+}
+
+// unifiedSource is the list of messages of an account in display order.
+type unifiedSource struct {
+	acct     *AccountView
+	uids     []models.UID
+	messages map[models.UID]*models.MessageInfo
+}
+
+func NewUnifiedView(accounts []*AccountView) *UnifiedView {
+	u := &UnifiedView{
+		accounts: accounts,
+		spinner:  NewSpinner(config.Ui()),
+		ticker:   time.NewTicker(unifiedCheckInterval),
+		listings: make(map[*AccountView]*unifiedListing),
+	}
+	u.spinner.Start()
+	go func() {
+		defer log.PanicHandler()
+		for range u.ticker.C {
+			ui.QueueFunc(u.checkMail)
+		}
+	}()
+	return u
+}
+
+func (u *UnifiedView) Invalidate() {
+	ui.Invalidate()
+}
+
+func (u *UnifiedView) Focus(focus bool) {
+	// no effect for the UnifiedView
+}
+
+func (u *UnifiedView) Close() {
+	u.ticker.Stop()
+	u.spinner.Stop()
+}
+
+// checkMail requests the status of the default folders which are not open in
+// their account. Imap servers only report changes of the selected folder and
+// the status reported for the others may be outdated. The default folders
+// are listed again when their status changes.
+func (u *UnifiedView) checkMail() {
+	for _, acct := range u.accounts {
+		if acct.AccountConfig().Backend != "imap" || !acct.state.Connected ||
+			acct.dirlist.Selected() == acct.acct.Default {
+			continue
+		}
+		acct.worker.PostAction(context.TODO(), &types.CheckMail{
+			Directories: []string{acct.acct.Default},
+		}, nil)
+	}
+}
+
+// folderInfo returns the last known status of the default folder of an
+// account.
+func (u *UnifiedView) folderInfo(acct *AccountView) models.DirectoryInfo {
+	var info models.DirectoryInfo
+	if dir := acct.dirlist.Directory(acct.acct.Default); dir != nil {
+		info.Exists = dir.Exists
+		info.Recent = dir.Recent
+		info.Unseen = dir.Unseen
+	}
+	return info
+}
+
+// stale returns true if the listing needs to be requested again because the
+// folder or its store changed since.
+func (l *unifiedListing) stale(info models.DirectoryInfo, size int) bool {
+	if l.pending {
+		return false
+	}
+	return !l.loaded || l.size != size || l.info.Exists != info.Exists ||
+		l.info.Recent != info.Recent || l.info.Unseen != info.Unseen
+}
+
+// list requests the messages of the default folder of an account sorted by
+// date if its listing is outdated.
+func (u *UnifiedView) list(acct *AccountView, store *lib.MessageStore) *unifiedListing {
+	l, ok := u.listings[acct]
+	if !ok {
+		l = new(unifiedListing)
+		u.listings[acct] = l
+	}
+	info, size := u.folderInfo(acct), len(store.Uids())
+	if !l.stale(info, size) {
+		return l
+	}
+	l.pending = true
+	l.info = info
+	l.size = size
+	acct.worker.PostAction(context.TODO(), &types.FetchDirectoryContents{
+		Directory: acct.acct.Default,
+		SortCriteria: []*types.SortCriterion{
+			{Field: types.SortDate, Reverse: !config.Ui().ReverseOrder},
+		},
+	}, func(msg types.WorkerMessage) {
+		switch msg := msg.(type) {
+		case *types.DirectoryContents:
+			l.uids = msg.Uids
+			l.loaded = true
+			u.listed++
+			return
+		case *types.Error:
+			log.Errorf("[%s] all inboxes: %v", acct.Name(), msg.Error)
+		case *types.Done, *types.Unsupported, *types.Cancelled:
+		default:
+			return
+		}
+		// an empty listing is displayed on errors
+		l.loaded = true
+		l.pending = false
+		ui.Invalidate()
+	})
+	return l
+}
+
+func (u *UnifiedView) store(acct *AccountView) *lib.MessageStore {
+	store, _ := acct.dirlist.MsgStore(acct.acct.Default)
+	return store
+}
+
+// Stores returns the message stores of the default folder of the accounts,
+// if they are open.
+func (u *UnifiedView) Stores() map[*AccountView]*lib.MessageStore {
+	stores := make(map[*AccountView]*lib.MessageStore)
+	for _, acct := range u.accounts {
+		if store := u.store(acct); store != nil {
+			stores[acct] = store
+		}
+	}
+	return stores
+}
+
+// changed returns true if one of the stores changed since the messages were
+// last merged.
+func (u *UnifiedView) changed() bool {
+	if u.listed != u.merged {
+		return true
+	}
+	for _, acct := range u.accounts {
+		store := u.store(acct)
+		if store != u.stores[acct] ||
+			(store != nil && store.Version() != u.versions[acct]) {
+			return true
+		}
+	}
+	return false
+}
+
+// messages returns at least limit messages of all accounts sorted by date,
+// unless there are less messages or their headers are still being fetched.
+// The default folders are listed again when they change and the headers of
+// the next messages to list are fetched as needed.
+func (u *UnifiedView) messages(limit int) []unifiedMessage {
+	for _, acct := range u.accounts {
+		if store := u.store(acct); store != nil {
+			u.list(acct, store)
+		}
+	}
+	if !u.changed() && limit <= u.limit {
+		return u.msgs
+	}
+	u.stores = make(map[*AccountView]*lib.MessageStore)
+	u.versions = make(map[*AccountView]uint64)
+	u.merged = u.listed
+	u.total = 0
+	var sources []*unifiedSource
+	for _, acct := range u.accounts {
+		store := u.store(acct)
+		if store == nil {
+			continue
+		}
+		u.stores[acct] = store
+		u.versions[acct] = store.Version()
+		src := &unifiedSource{acct: acct, messages: store.Messages}
+		if l := u.listings[acct]; l != nil {
+			// the listings are in reverse display order
+			for i := len(l.uids) - 1; i >= 0; i-- {
+				src.uids = append(src.uids, l.uids[i])
+			}
+		}
+		u.total += len(src.uids)
+		sources = append(sources, src)
+	}
+	newestFirst := !config.Ui().ReverseOrder
+	msgs, missing := mergeMessages(sources, limit, newestFirst, max(u.height, 1))
+	for i, uids := range missing {
+		if len(uids) > 0 {
+			u.stores[sources[i].acct].FetchHeaders(uids, nil)
+		}
+	}
+	u.msgs = msgs
+	u.limit = limit
+	return msgs
+}
+
+// mergeMessages merges the messages of the sources by date up to limit
+// messages. The dates are read from the headers of the messages, which are
+// expected to be listed by date in each source. The merge stops at the first message whose headers are unknown. Up to
+// fetch messages without headers are returned for each such source.
+func mergeMessages(
+	sources []*unifiedSource, limit int, newestFirst bool, fetch int,
+) ([]unifiedMessage, [][]models.UID) {
+	var msgs []unifiedMessage
+	missing := make([][]models.UID, len(sources))
+	pos := make([]int, len(sources))
+	for len(msgs) < limit {
+		best := -1
+		blocked := false
+		var bestDate time.Time
+		for i, src := range sources {
+			// skip the messages which could not be fetched
+			for pos[i] < len(src.uids) {
+				msg := src.messages[src.uids[pos[i]]]
+				if msg == nil || msg.Envelope != nil || msg.Error == nil {
+					break
+				}
+				pos[i]++
+			}
+			if pos[i] >= len(src.uids) {
+				continue
+			}
+			msg := src.messages[src.uids[pos[i]]]
+			if msg == nil || msg.Envelope == nil {
+				missing[i] = src.missing(pos[i], fetch)
+				blocked = true
+				continue
+			}
+			date := msg.Envelope.Date
+			if date.IsZero() {
+				date = msg.InternalDate
+			}
+			if best < 0 ||
+				(newestFirst && date.After(bestDate)) ||
+				(!newestFirst && date.Before(bestDate)) {
+				best, bestDate = i, date
+			}
+		}
+		if blocked || best < 0 {
+			break
+		}
+		src := sources[best]
+		msgs = append(msgs, unifiedMessage{acct: src.acct, uid: src.uids[pos[best]]})
+		pos[best]++
+	}
+	return msgs, missing
+}
+
+// missing returns up to n messages without headers from position start.
+func (s *unifiedSource) missing(start, n int) []models.UID {
+	var uids []models.UID
+	for _, uid := range s.uids[start:] {
+		if len(uids) >= n {
+			break
+		}
+		msg := s.messages[uid]
+		if msg == nil || (msg.Envelope == nil && msg.Error == nil) {
+			uids = append(uids, uid)
+		}
+	}
+	return uids
+}
+
+// selectedPosition returns the index of the selected message. If it is not
+// listed anymore, the message at its previous position is selected.
+func (u *UnifiedView) selectedPosition(msgs []unifiedMessage) int {
+	if len(msgs) == 0 {
+		return -1
+	}
+	for i, m := range msgs {
+		if m == u.selected {
+			u.selectedIndex = i
+			return i
+		}
+	}
+	i := min(max(u.selectedIndex, 0), len(msgs)-1)
+	u.selectMessage(msgs[i], i)
+	return i
+}
+
+func (u *UnifiedView) selectMessage(m unifiedMessage, index int) {
+	u.selected = m
+	u.selectedIndex = index
+}
+
+// NextPrev moves the selection by delta messages.
+func (u *UnifiedView) NextPrev(delta int) {
+	msgs := u.messages(u.selectedIndex + max(delta, 0) + u.height)
+	i := u.selectedPosition(msgs)
+	if i < 0 {
+		return
+	}
+	i = min(max(i+delta, 0), len(msgs)-1)
+	u.selectMessage(msgs[i], i)
+	u.Invalidate()
+}
+
+// Select selects the message at index. Negative indexes count from the end
+// of the list.
+func (u *UnifiedView) Select(index int) {
+	limit := index + 1
+	if index < 0 {
+		// all messages are needed to find the end of the list
+		limit = math.MaxInt
+	}
+	msgs := u.messages(limit)
+	if len(msgs) == 0 {
+		return
+	}
+	if index < 0 {
+		index = len(msgs) + index
+	}
+	index = min(max(index, 0), len(msgs)-1)
+	u.selectMessage(msgs[index], index)
+	u.Invalidate()
+}
+
+func (u *UnifiedView) Height() int {
+	return u.height
+}
+
+func (u *UnifiedView) Store() *lib.MessageStore {
+	if u.selected.acct == nil {
+		return nil
+	}
+	return u.store(u.selected.acct)
+}
+
+func (u *UnifiedView) SelectedAccount() *AccountView {
+	return u.selected.acct
+}
+
+func (u *UnifiedView) SelectedDirectory() string {
+	if u.selected.acct == nil {
+		return ""
+	}
+	return u.selected.acct.acct.Default
+}
+
+func (u *UnifiedView) SelectedMessage() (*models.MessageInfo, error) {
+	store := u.Store()
+	if store == nil {
+		return nil, errors.New("no message selected")
+	}
+	msg := store.Messages[u.selected.uid]
+	if msg == nil {
+		return nil, errors.New("message not loaded")
+	}
+	return msg, nil
+}
+
+// MarkedMessages returns the marked messages of the account of the selected
+// message.
+func (u *UnifiedView) MarkedMessages() ([]models.UID, error) {
+	if store := u.Store(); store != nil {
+		return store.Marker().Marked(), nil
+	}
+	return nil, errors.New("no store available")
+}
+
+func (u *UnifiedView) Draw(ctx *ui.Context) {
+	u.height = ctx.Height()
+	uiConfig := config.Ui()
+	ctx.Fill(0, 0, ctx.Width(), ctx.Height(), ' ',
+		uiConfig.GetStyle(config.STYLE_MSGLIST_DEFAULT))
+
+	msgs := u.messages(max(u.selectedIndex, u.Scroll()) + u.height)
+	if u.total == 0 {
+		if u.loading() {
+			u.spinner.Start()
+			u.spinner.Draw(ctx)
+		} else {
+			u.spinner.Stop()
+			msg := uiConfig.EmptyMessage
+			ctx.Printf((ctx.Width()/2)-(len(msg)/2), 0,
+				uiConfig.GetStyle(config.STYLE_MSGLIST_DEFAULT), "%s", msg)
+		}
+		return
+	}
+
+	selected := u.selectedPosition(msgs)
+	u.SetOffset(uiConfig.MsglistScrollOffset)
+	u.UpdateScroller(u.height, u.total)
+	if selected >= 0 {
+		u.EnsureScroll(selected)
+	}
+	msgs = u.messages(u.Scroll() + u.height)
+
+	textWidth := ctx.Width()
+	if u.NeedScrollbar() {
+		textWidth -= 1
+	}
+	if textWidth <= 0 {
+		return
+	}
+
+	getRowStyle := func(t *ui.Table, r int) vaxis.Style {
+		params, _ := t.Rows[r].Priv.(messageRowParams)
+		if r+u.Scroll() == selected {
+			return params.uiConfig.MsgComposedStyleSelected(
+				config.STYLE_MSGLIST_DEFAULT, params.styles,
+				params.headers)
+		}
+		return params.uiConfig.MsgComposedStyle(
+			config.STYLE_MSGLIST_DEFAULT, params.styles,
+			params.headers)
+	}
+	table := ui.NewTable(
+		u.height,
+		uiConfig.UnifiedColumns,
+		uiConfig.ColumnSeparator,
+		nil,
+		getRowStyle,
+	)
+	rows := 0
+	if u.Scroll() < len(msgs) {
+		for _, m := range msgs[u.Scroll():] {
+			data := state.NewDataSetter()
+			data.SetAccount(m.acct.acct)
+			data.SetFolder(m.acct.Directories().Directory(m.acct.acct.Default))
+			rows++
+			if addMessage(u.stores[m.acct], m.uid, &table, data, uiConfig) {
+				break
+			}
+		}
+	}
+	table.Draw(ctx.Subcontext(0, 0, textWidth, ctx.Height()))
+
+	// the headers of the next messages are being fetched
+	if rows < u.height && u.Scroll()+rows < u.total {
+		u.spinner.Start()
+		u.spinner.Draw(ctx.Subcontext(0, rows, textWidth, 1))
+	} else {
+		u.spinner.Stop()
+	}
+
+	if u.NeedScrollbar() {
+		scrollbarCtx := ctx.Subcontext(textWidth, 0, 1, ctx.Height())
+		u.drawScrollbar(scrollbarCtx)
+	}
+}
+
+func (u *UnifiedView) drawScrollbar(ctx *ui.Context) {
+	uiConfig := config.Ui()
+	gutterStyle := uiConfig.GetStyle(config.STYLE_MSGLIST_GUTTER)
+	pillStyle := uiConfig.GetStyle(config.STYLE_MSGLIST_PILL)
+
+	// gutter
+	ctx.Fill(0, 0, 1, ctx.Height(), ' ', gutterStyle)
+
+	// pill
+	pillSize := int(math.Ceil(float64(ctx.Height()) * u.PercentVisible()))
+	pillOffset := int(math.Floor(float64(ctx.Height()) * u.PercentScrolled()))
+	ctx.Fill(0, pillOffset, 1, pillSize, ' ', pillStyle)
+}
+
+// loading returns true while the default folder of an account has not been
+// listed yet.
+func (u *UnifiedView) loading() bool {
+	for _, acct := range u.accounts {
+		l := u.listings[acct]
+		if u.store(acct) == nil || l == nil || !l.loaded {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *UnifiedView) MouseEvent(localX int, localY int, event vaxis.Event) {
+	if event, ok := event.(vaxis.Mouse); ok {
+		switch event.Button {
+		case vaxis.MouseLeftButton:
+			u.Select(localY + u.Scroll())
+		case vaxis.MouseWheelDown:
+			u.NextPrev(1)
+		case vaxis.MouseWheelUp:
+			u.NextPrev(-1)
+		}
+	}
+}
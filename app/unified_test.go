@@ -0,0 +1,148 @@
+package app
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"git.sr.ht/~rjarry/aerc/models"
+)
+
+func newTestSource(acct *AccountView, dates map[models.UID]time.Time, uids ...models.UID) *unifiedSource {
+	src := &unifiedSource{
+		acct:     acct,
+		uids:     uids,
+		messages: make(map[models.UID]*models.MessageInfo),
+	}
+	for _, uid := range uids {
+		date, ok := dates[uid]
+		if !ok {
+			src.messages[uid] = nil
+			continue
+		}
+		src.messages[uid] = &models.MessageInfo{
+			Uid:      uid,
+			Envelope: &models.Envelope{Date: date},
+		}
+	}
+	return src
+}
+
+func TestMergeMessages(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	a, b := new(AccountView), new(AccountView)
+
+	t.Run("newest first", func(t *testing.T) {
+		sources := []*unifiedSource{
+			newTestSource(a, map[models.UID]time.Time{"a1": day(5), "a2": day(2)}, "a1", "a2"),
+			newTestSource(b, map[models.UID]time.Time{"b1": day(4), "b2": day(3)}, "b1", "b2"),
+		}
+		msgs, _ := mergeMessages(sources, 10, true, 10)
+		expected := []unifiedMessage{{a, "a1"}, {b, "b1"}, {b, "b2"}, {a, "a2"}}
+		if len(msgs) != len(expected) {
+			t.Fatalf("expected %v, got %v", expected, msgs)
+		}
+		for i := range expected {
+			if msgs[i] != expected[i] {
+				t.Errorf("message %d: expected %v, got %v", i, expected[i], msgs[i])
+			}
+		}
+	})
+
+	t.Run("oldest first", func(t *testing.T) {
+		sources := []*unifiedSource{
+			newTestSource(a, map[models.UID]time.Time{"a1": day(2), "a2": day(5)}, "a1", "a2"),
+			newTestSource(b, map[models.UID]time.Time{"b1": day(3)}, "b1"),
+		}
+		msgs, _ := mergeMessages(sources, 10, false, 10)
+		expected := []unifiedMessage{{a, "a1"}, {b, "b1"}, {a, "a2"}}
+		if len(msgs) != len(expected) {
+			t.Fatalf("expected %v, got %v", expected, msgs)
+		}
+		for i := range expected {
+			if msgs[i] != expected[i] {
+				t.Errorf("message %d: expected %v, got %v", i, expected[i], msgs[i])
+			}
+		}
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		sources := []*unifiedSource{
+			newTestSource(a, map[models.UID]time.Time{"a1": day(5), "a2": day(2)}, "a1", "a2"),
+			newTestSource(b, map[models.UID]time.Time{"b1": day(4)}, "b1", "b2", "b3"),
+		}
+		msgs, missing := mergeMessages(sources, 2, true, 10)
+		if len(msgs) != 2 {
+			t.Errorf("expected 2 messages, got %v", msgs)
+		}
+		if len(missing[1]) != 0 {
+			t.Errorf("unexpected headers to fetch: %v", missing[1])
+		}
+	})
+
+	t.Run("missing headers", func(t *testing.T) {
+		sources := []*unifiedSource{
+			newTestSource(a, map[models.UID]time.Time{"a1": day(5), "a2": day(2)}, "a1", "a2"),
+			newTestSource(b, map[models.UID]time.Time{"b1": day(4)}, "b1", "b2", "b3", "b4"),
+		}
+		msgs, missing := mergeMessages(sources, 10, true, 2)
+		expected := []unifiedMessage{{a, "a1"}, {b, "b1"}}
+		if len(msgs) != len(expected) {
+			t.Fatalf("expected %v, got %v", expected, msgs)
+		}
+		if len(missing[0]) != 0 {
+			t.Errorf("unexpected headers to fetch: %v", missing[0])
+		}
+		if len(missing[1]) != 2 || missing[1][0] != "b2" || missing[1][1] != "b3" {
+			t.Errorf("expected to fetch [b2 b3], got %v", missing[1])
+		}
+	})
+
+	t.Run("internal date", func(t *testing.T) {
+		src := newTestSource(a, map[models.UID]time.Time{"a1": day(2)}, "a1")
+		other := newTestSource(b, map[models.UID]time.Time{"b1": {}}, "b1")
+		other.messages["b1"].InternalDate = day(3)
+		msgs, _ := mergeMessages([]*unifiedSource{src, other}, 10, true, 10)
+		expected := []unifiedMessage{{b, "b1"}, {a, "a1"}}
+		if len(msgs) != len(expected) || msgs[0] != expected[0] {
+			t.Errorf("expected %v, got %v", expected, msgs)
+		}
+	})
+
+	t.Run("fetch errors", func(t *testing.T) {
+		src := newTestSource(a, map[models.UID]time.Time{"a1": day(5), "a3": day(2)}, "a1", "a2", "a3")
+		src.messages["a2"] = &models.MessageInfo{Uid: "a2", Error: errors.New("failed")}
+		msgs, missing := mergeMessages([]*unifiedSource{src}, 10, true, 10)
+		expected := []unifiedMessage{{a, "a1"}, {a, "a3"}}
+		if len(msgs) != len(expected) {
+			t.Fatalf("expected %v, got %v", expected, msgs)
+		}
+		if len(missing[0]) != 0 {
+			t.Errorf("unexpected headers to fetch: %v", missing[0])
+		}
+	})
+}
+
+func TestUnifiedListingStale(t *testing.T) {
+	info := models.DirectoryInfo{Exists: 3, Unseen: 1}
+	l := &unifiedListing{}
+	if !l.stale(info, 3) {
+		t.Error("a listing which was never loaded must be requested")
+	}
+	l = &unifiedListing{loaded: true, info: info, size: 3}
+	if l.stale(info, 3) {
+		t.Error("unexpected stale listing")
+	}
+	if !l.stale(models.DirectoryInfo{Exists: 4, Unseen: 2}, 3) {
+		t.Error("a new message in the folder must be listed")
+	}
+	if !l.stale(info, 2) {
+		t.Error("a message removed from the store must be listed")
+	}
+	l.pending = true
+	if l.stale(models.DirectoryInfo{Exists: 4}, 2) {
+		t.Error("a listing must not be requested while another is pending")
+	}
+}
@@ -0,0 +1,315 @@
+package account
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"git.sr.ht/~rjarry/aerc/app"
+	"git.sr.ht/~rjarry/aerc/commands"
+	"git.sr.ht/~rjarry/aerc/config"
+	"git.sr.ht/~rjarry/aerc/lib"
+	"git.sr.ht/~rjarry/aerc/lib/log"
+	"git.sr.ht/~rjarry/aerc/lib/ui"
+	"git.sr.ht/~rjarry/aerc/models"
+	"git.sr.ht/~rjarry/aerc/worker/types"
+	"git.sr.ht/~rjarry/go-opt/v2"
+)
+
+type ApplyRules struct{}
+
+func init() {
+	commands.Register(ApplyRules{})
+}
+
+func (ApplyRules) Description() string {
+	return "Apply the rules from rules.conf to the selected message(s)."
+}
+
+func (ApplyRules) Context() commands.CommandContext {
+	return commands.MESSAGE_LIST
+}
+
+func (ApplyRules) Aliases() []string {
+	return []string{"apply-rules"}
+}
+
+func (ApplyRules) Execute(args []string) error {
+	pm, ok := app.SelectedTabContent().(app.ProvidesMessages)
+	if !ok {
+		pm = app.SelectedAccount()
+	}
+	acct := pm.SelectedAccount()
+	if acct == nil {
+		return errors.New("No account selected")
+	}
+	store := pm.Store()
+	if store == nil {
+		return errors.New("Cannot perform action. Messages still loading")
+	}
+	if len(config.Rules()) == 0 {
+		return errors.New("No rules defined in rules.conf")
+	}
+	uids, err := commands.MarkedOrSelected(pm)
+	if err != nil {
+		return err
+	}
+	applyRules(acct, store, uids, true, func(matched int, err error) {
+		if err != nil {
+			app.PushError("apply-rules: " + err.Error())
+			return
+		}
+		store.Marker().ClearVisualMark()
+		app.PushStatus(fmt.Sprintf("Rules matched %d message(s)", matched),
+			10*time.Second)
+	})
+	return nil
+}
+
+// Backends without server-side filtering on which the rules are applied
+// automatically to new messages.
+var autoRulesBackends = []string{"maildir", "maildirpp", "mbox", "notmuch"}
+
+// Delay to gather new messages arriving in bursts before applying the rules.
+const newMessagesDelay = 500 * time.Millisecond
+
+// New messages waiting for the rules to be applied, per folder. Only
+// accessed from the main goroutine.
+var newMessages = make(map[*lib.MessageStore][]models.UID)
+
+// QueueNewMessage applies the rules to a new message of a folder, along with
+// the other messages arriving at the same time. The rule actions cannot be
+// undone.
+func QueueNewMessage(
+	acct *app.AccountView, store *lib.MessageStore, msg *models.MessageInfo,
+) {
+	if len(config.Rules()) == 0 ||
+		!slices.Contains(autoRulesBackends, acct.AccountConfig().Backend) {
+		return
+	}
+	uids, pending := newMessages[store]
+	newMessages[store] = append(uids, msg.Uid)
+	if pending {
+		return
+	}
+	time.AfterFunc(newMessagesDelay, func() {
+		ui.QueueFunc(func() {
+			uids := newMessages[store]
+			delete(newMessages, store)
+			applyRules(acct, store, uids, false, func(matched int, err error) {
+				if err != nil {
+					app.PushError("rules: " + err.Error())
+				} else if matched > 0 {
+					log.Debugf("rules: %s/%s: matched %d new message(s)",
+						acct.Name(), store.Name, matched)
+				}
+			})
+		})
+	})
+}
+
+// rulesRun applies the rules in order to a set of messages of a folder.
+type rulesRun struct {
+	acct  *app.AccountView
+	store *lib.MessageStore
+	rules []*config.RuleConfig
+	// whether the actions can be undone
+	undo bool
+	// messages not yet moved away or stopped by a rule
+	pending []models.UID
+	matched map[models.UID]bool
+	done    func(int, error)
+}
+
+func applyRules(
+	acct *app.AccountView, store *lib.MessageStore, uids []models.UID,
+	undo bool, done func(matched int, err error),
+) {
+	r := &rulesRun{
+		acct:    acct,
+		store:   store,
+		undo:    undo,
+		pending: uids,
+		matched: make(map[models.UID]bool),
+		done:    done,
+	}
+	for _, rule := range config.Rules() {
+		if rule.AppliesTo(acct.Name(), store.Name) {
+			r.rules = append(r.rules, rule)
+		}
+	}
+	r.next()
+}
+
+func (r *rulesRun) next() {
+	if len(r.rules) == 0 || len(r.pending) == 0 {
+		r.done(len(r.matched), nil)
+		return
+	}
+	rule := r.rules[0]
+	r.rules = r.rules[1:]
+
+	if strings.TrimSpace(rule.Match) == "" {
+		r.apply(rule, r.pending)
+		return
+	}
+	criteria, err := parseMatch(rule.Match)
+	if err != nil {
+		r.done(len(r.matched), fmt.Errorf("[%s]: %w", rule.Name, err))
+		return
+	}
+	var results []models.UID
+	r.acct.Worker().PostAction(context.TODO(), &types.SearchDirectory{
+		Directory: r.store.Name,
+		Criteria:  criteria,
+	}, func(msg types.WorkerMessage) {
+		switch msg := msg.(type) {
+		case *types.SearchResults:
+			results = msg.Uids
+		case *types.Done:
+			var uids []models.UID
+			for _, uid := range r.pending {
+				if slices.Contains(results, uid) {
+					uids = append(uids, uid)
+				}
+			}
+			r.apply(rule, uids)
+		case *types.Error:
+			r.done(len(r.matched), fmt.Errorf("[%s]: %w", rule.Name, msg.Error))
+		case *types.Unsupported:
+			r.done(len(r.matched),
+				fmt.Errorf("[%s]: %w", rule.Name, types.ErrUnsupported))
+		}
+	})
+}
+
+// apply runs the actions of a rule on the matched messages and then
+// continues with the next rule. Messages are moved last, after all other
+// actions have been requested to the worker.
+func (r *rulesRun) apply(rule *config.RuleConfig, uids []models.UID) {
+	if len(uids) == 0 {
+		r.next()
+		return
+	}
+	log.Debugf("rules: [%s] matched %v", rule.Name, uids)
+	for _, uid := range uids {
+		r.matched[uid] = true
+	}
+	var err error
+	r.record(func() { err = r.runActions(rule, uids) })
+	if err != nil {
+		r.done(len(r.matched), fmt.Errorf("[%s]: %w", rule.Name, err))
+		return
+	}
+	if rule.Stop || rule.Move != "" {
+		r.pending = slices.DeleteFunc(r.pending, func(uid models.UID) bool {
+			return slices.Contains(uids, uid)
+		})
+	}
+	if rule.Move == "" || rule.Move == r.store.Name {
+		r.next()
+		return
+	}
+	r.record(func() {
+		r.store.Move(uids, rule.Move, false, nil, func(msg types.WorkerMessage) {
+			switch msg := msg.(type) {
+			case *types.Done:
+				r.next()
+			case *types.Error:
+				r.done(len(r.matched), fmt.Errorf("[%s]: %w", rule.Name, msg.Error))
+			}
+		})
+	})
+}
+
+// record starts the operations of fn. They are only recorded in the undo
+// stack of the account if the rules were applied with :apply-rules.
+func (r *rulesRun) record(fn func()) {
+	if r.undo {
+		fn()
+	} else {
+		r.acct.UndoStack().Ignore(fn)
+	}
+}
+
+func (r *rulesRun) runActions(rule *config.RuleConfig, uids []models.UID) error {
+	report := func(msg types.WorkerMessage) {
+		if msg, ok := msg.(*types.Error); ok {
+			app.PushError(fmt.Sprintf("rules: [%s]: %v", rule.Name, msg.Error))
+		}
+	}
+	flag := func(names []string, enable bool) error {
+		for _, name := range names {
+			f, ok := flagValues[strings.ToLower(name)]
+			if !ok {
+				return fmt.Errorf("%q unknown flag", name)
+			}
+			r.store.Flag(uids, f, enable, report)
+		}
+		return nil
+	}
+	if err := flag(rule.Flag, true); err != nil {
+		return err
+	}
+	if err := flag(rule.Unflag, false); err != nil {
+		return err
+	}
+	if rule.MarkRead {
+		r.store.Flag(uids, models.SeenFlag, true, report)
+	}
+	if rule.Label != "" {
+		var add, remove []string
+		for _, l := range strings.Fields(rule.Label) {
+			if tag, ok := strings.CutPrefix(l, "-"); ok {
+				remove = append(remove, tag)
+			} else {
+				add = append(add, strings.TrimPrefix(l, "+"))
+			}
+		}
+		r.store.ModifyLabels(uids, add, remove, nil, report)
+	}
+	if rule.Pipe != "" {
+		r.pipe(rule, uids)
+	}
+	if rule.Copy != "" {
+		r.store.Copy(uids, rule.Copy, false, nil, report)
+	}
+	return nil
+}
+
+// pipe feeds each message to the rule pipe command.
+func (r *rulesRun) pipe(rule *config.RuleConfig, uids []models.UID) {
+	r.store.FetchFull(context.TODO(), uids, func(fm *types.FullMessage) {
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, fm.Content.Reader); err != nil {
+			app.PushError(fmt.Sprintf("rules: [%s]: %v", rule.Name, err))
+			return
+		}
+		go func() {
+			defer log.PanicHandler()
+			cmd := exec.Command("sh", "-c", rule.Pipe)
+			cmd.Stdin = &buf
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				log.Errorf("rules: [%s]: %s: %v: %s",
+					rule.Name, rule.Pipe, err, out)
+				app.PushError(fmt.Sprintf("rules: [%s]: %v", rule.Name, err))
+			}
+		}()
+	})
+}
+
+// parseMatch parses the :search options of a rule.
+func parseMatch(match string) (*types.SearchCriteria, error) {
+	var s SearchFilter
+	if err := opt.ArgsToStruct(opt.LexArgs("search "+match), &s); err != nil {
+		return nil, err
+	}
+	return s.criteria()
+}
@@ -1,8 +1,6 @@
 package account
 
 import (
-	"errors"
-
 	"git.sr.ht/~rjarry/aerc/app"
 	"git.sr.ht/~rjarry/aerc/commands"
 	"git.sr.ht/~rjarry/aerc/lib/state"
@@ -29,20 +27,24 @@ func (Clear) Aliases() []string {
 }
 
 func (c Clear) Execute(args []string) error {
-	acct := app.SelectedAccount()
-	if acct == nil {
-		return errors.New("No account selected")
-	}
-	store := acct.Store()
-	if store == nil {
-		return errors.New("Cannot perform action. Messages still loading")
+	stores, err := selectedStores()
+	if err != nil {
+		return err
 	}
 
+	for acct, store := range stores {
+		store.ApplyClear()
+		acct.SetStatus(state.SearchFilterClear())
+	}
 	if c.Selected {
-		defer store.Select("")
+		if u, ok := app.SelectedTabContent().(*app.UnifiedView); ok {
+			u.Select(0)
+		} else {
+			for _, store := range stores {
+				store.Select("")
+			}
+		}
 	}
-	store.ApplyClear()
-	acct.SetStatus(state.SearchFilterClear())
 
 	return nil
 }
@@ -0,0 +1,316 @@
+package account
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"git.sr.ht/~rjarry/aerc/app"
+	"git.sr.ht/~rjarry/aerc/commands"
+	"git.sr.ht/~rjarry/aerc/lib/log"
+	"git.sr.ht/~rjarry/aerc/lib/xdg"
+	"git.sr.ht/~rjarry/aerc/models"
+	"git.sr.ht/~rjarry/aerc/worker/types"
+)
+
+type ImportFolder struct {
+	Account     string `opt:"account" complete:"CompleteAccount" desc:"Source account."`
+	Source      string `opt:"src" complete:"CompleteSource" desc:"Source folder."`
+	Destination string `opt:"dst" complete:"CompleteDestination" desc:"Destination folder."`
+}
+
+func init() {
+	commands.Register(ImportFolder{})
+}
+
+func (ImportFolder) Description() string {
+	return "Import all messages from a folder of another account to a folder of the current account."
+}
+
+func (ImportFolder) Context() commands.CommandContext {
+	return commands.MESSAGE_LIST
+}
+
+func (ImportFolder) Aliases() []string {
+	return []string{"import-folder"}
+}
+
+func (*ImportFolder) CompleteAccount(arg string) []string {
+	return commands.FilterList(app.AccountNames(), arg, nil)
+}
+
+func (i *ImportFolder) CompleteSource(arg string) []string {
+	acct, err := app.Account(i.Account)
+	if err != nil {
+		return nil
+	}
+	return commands.FilterList(acct.Directories().List(), arg, nil)
+}
+
+func (*ImportFolder) CompleteDestination(arg string) []string {
+	return commands.GetFolders(arg)
+}
+
+// number of messages fetched and appended at once
+const importBatchSize = 50
+
+func (i ImportFolder) Execute(args []string) error {
+	dst := app.SelectedAccount()
+	if dst == nil {
+		return errors.New("No account selected")
+	}
+	src, err := app.Account(i.Account)
+	if err != nil {
+		return err
+	}
+	if src == dst && i.Source == i.Destination {
+		return errors.New("Source and destination folders are the same")
+	}
+	// the imap backend selects the folders it fetches messages from and
+	// only tracks changes in the selected one
+	if src.AccountConfig().Backend == "imap" &&
+		src.SelectedDirectory() != i.Source {
+		return fmt.Errorf("Open %s in account %s to import it",
+			i.Source, src.Name())
+	}
+
+	statePath := xdg.StatePath("aerc", "import-folder", importStateName(
+		src.Name(), i.Source, dst.Name(), i.Destination))
+
+	go func() {
+		defer log.PanicHandler()
+		progress := func(imported, total int) {
+			app.PushStatus(fmt.Sprintf("Importing %s/%s to %s: %d of %d",
+				src.Name(), i.Source, i.Destination, imported, total),
+				10*time.Second)
+		}
+		imported, total, err := i.importFolder(src.Worker(), dst.Worker(),
+			statePath, progress)
+		if err != nil {
+			log.Errorf("%s: %v", args[0], err)
+			app.PushError(fmt.Sprintf(
+				"%s: %v (imported %d of %d, run again to resume)",
+				args[0], err, imported, total))
+			return
+		}
+		msg := fmt.Sprintf("%s: imported %d messages from %s/%s to %s.",
+			args[0], imported, src.Name(), i.Source, i.Destination)
+		log.Debugf(msg)
+		app.PushSuccess(msg)
+	}()
+
+	return nil
+}
+
+// importFolder appends the messages of the source folder to the destination
+// folder by batches. The UIDs of the imported messages are recorded in the
+// statePath file so that an interrupted import can be resumed. progress is
+// called after each batch.
+func (i ImportFolder) importFolder(
+	src, dst *types.Worker, statePath string, progress func(int, int),
+) (int, int, error) {
+	// uids of source messages already imported by a previous run
+	done, err := readImportState(statePath)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// unlike FetchDirectoryContents, this does not reset the message
+	// list of the source folder
+	res, err := workerRequest(src, &types.SearchDirectory{
+		Directory: i.Source,
+		Criteria:  &types.SearchCriteria{},
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	var uids []models.UID
+	var imported, total int
+	for _, msg := range res {
+		if results, ok := msg.(*types.SearchResults); ok {
+			for _, uid := range results.Uids {
+				total++
+				if done[uid] {
+					imported++
+				} else {
+					uids = append(uids, uid)
+				}
+			}
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(statePath), 0o700); err != nil {
+		return imported, total, err
+	}
+	state, err := os.OpenFile(statePath,
+		os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return imported, total, err
+	}
+	defer state.Close()
+
+	_, err = workerRequest(dst, &types.CreateDirectory{
+		Directory: i.Destination,
+		Quiet:     true,
+	})
+	if err != nil {
+		return imported, total, err
+	}
+
+	for len(uids) > 0 {
+		batch := uids[:min(importBatchSize, len(uids))]
+		uids = uids[len(batch):]
+
+		infos := make(map[models.UID]*models.MessageInfo)
+		res, err := workerRequest(src, &types.FetchMessageHeaders{
+			Directory: i.Source,
+			Uids:      batch,
+		})
+		if err != nil {
+			return imported, total, err
+		}
+		for _, msg := range res {
+			if info, ok := msg.(*types.MessageInfo); ok && info.Info != nil {
+				infos[info.Info.Uid] = info.Info
+			}
+		}
+
+		res, err = workerRequest(src, &types.FetchFullMessages{
+			Directory: i.Source,
+			Uids:      batch,
+		})
+		if err != nil {
+			return imported, total, err
+		}
+		for _, msg := range res {
+			full, ok := msg.(*types.FullMessage)
+			if !ok {
+				continue
+			}
+			var buf bytes.Buffer
+			if _, err := io.Copy(&buf, full.Content.Reader); err != nil {
+				return imported, total, err
+			}
+			am := &types.AppendMessage{
+				Destination: i.Destination,
+				Date:        time.Now(),
+				Reader:      &buf,
+				Length:      buf.Len(),
+			}
+			if info, ok := infos[full.Content.Uid]; ok {
+				am.Flags = info.Flags
+				switch {
+				case !info.InternalDate.IsZero():
+					am.Date = info.InternalDate
+				case info.Envelope != nil && !info.Envelope.Date.IsZero():
+					am.Date = info.Envelope.Date
+				}
+			}
+			if _, err := workerRequest(dst, am); err != nil {
+				return imported, total, err
+			}
+			if _, err := fmt.Fprintln(state, full.Content.Uid); err != nil {
+				return imported, total, err
+			}
+			imported++
+		}
+		progress(imported, total)
+	}
+
+	if imported < total {
+		return imported, total, fmt.Errorf("%d messages could not be fetched",
+			total-imported)
+	}
+	// the import is complete, running it again will start over
+	state.Close()
+	if err := os.Remove(statePath); err != nil {
+		log.Warnf("failed to remove import state: %v", err)
+	}
+	return imported, total, nil
+}
+
+// maximum duration of a single worker request
+var importTimeout = 5 * time.Minute
+
+// workerRequest posts msg to a worker and returns its responses once done.
+// The request is cancelled if it does not complete within importTimeout.
+func workerRequest(
+	worker *types.Worker, msg types.WorkerMessage,
+) ([]types.WorkerMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), importTimeout)
+	defer cancel()
+
+	// the callback runs on the main goroutine and may still be called
+	// after a timeout
+	var lock sync.Mutex
+	var responses []types.WorkerMessage
+	done := make(chan error, 1)
+	finish := func(err error) {
+		// only the first error is reported, never block the main loop
+		select {
+		case done <- err:
+		default:
+		}
+	}
+	worker.PostAction(ctx, msg, func(res types.WorkerMessage) {
+		switch res := res.(type) {
+		case *types.Done:
+			finish(nil)
+		case *types.Error:
+			finish(res.Error)
+		case *types.Unsupported:
+			finish(errors.New("unsupported by the account backend"))
+		case *types.Cancelled:
+			finish(errors.New("cancelled"))
+		default:
+			lock.Lock()
+			responses = append(responses, res)
+			lock.Unlock()
+		}
+	})
+	select {
+	case err := <-done:
+		lock.Lock()
+		defer lock.Unlock()
+		return responses, err
+	case <-ctx.Done():
+		return nil, errors.New("timed out")
+	}
+}
+
+func importStateName(srcAcct, srcFolder, dstAcct, dstFolder string) string {
+	name := strings.Join([]string{srcAcct, srcFolder, dstAcct, dstFolder}, "_")
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':':
+			return '_'
+		}
+		return r
+	}, name) + ".txt"
+}
+
+func readImportState(path string) (map[models.UID]bool, error) {
+	done := make(map[models.UID]bool)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return done, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			done[models.UID(line)] = true
+		}
+	}
+	return done, scanner.Err()
+}
@@ -0,0 +1,202 @@
+package account
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"git.sr.ht/~rjarry/aerc/models"
+	"git.sr.ht/~rjarry/aerc/worker/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// importBackend serves the requests of :import-folder from memory.
+type importBackend struct {
+	sync.Mutex
+	worker   *types.Worker
+	uids     []models.UID
+	batches  []int
+	appended []string
+	// appending this message fails
+	fail string
+}
+
+func newImportBackend(t *testing.T, n int) *importBackend {
+	t.Helper()
+	messages := make(chan types.WorkerMessage, 64)
+	b := &importBackend{worker: types.NewWorker("test", messages)}
+	for i := 1; i <= n; i++ {
+		b.uids = append(b.uids, models.UID(fmt.Sprintf("%d", i)))
+	}
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	// worker goroutine
+	go func() {
+		for {
+			select {
+			case action := <-b.worker.Actions():
+				b.handle(action)
+			case <-done:
+				return
+			}
+		}
+	}()
+	// main goroutine calling the callbacks
+	go func() {
+		for {
+			select {
+			case msg := <-messages:
+				b.worker.ProcessMessage(msg)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return b
+}
+
+func (b *importBackend) handle(action types.WorkerMessage) {
+	b.Lock()
+	defer b.Unlock()
+	switch msg := action.(type) {
+	case *types.SearchDirectory:
+		b.worker.PostMessage(&types.SearchResults{
+			Message:   types.RespondTo(msg),
+			Directory: msg.Directory,
+			Uids:      b.uids,
+		}, nil)
+	case *types.FetchMessageHeaders:
+		for _, uid := range msg.Uids {
+			b.worker.PostMessage(&types.MessageInfo{
+				Message: types.RespondTo(msg),
+				Info: &models.MessageInfo{
+					Uid:          uid,
+					Flags:        models.SeenFlag,
+					InternalDate: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+				},
+			}, nil)
+		}
+	case *types.FetchFullMessages:
+		b.batches = append(b.batches, len(msg.Uids))
+		for _, uid := range msg.Uids {
+			b.worker.PostMessage(&types.FullMessage{
+				Message: types.RespondTo(msg),
+				Content: &models.FullMessage{
+					Uid:    uid,
+					Reader: strings.NewReader("message " + string(uid)),
+				},
+			}, nil)
+		}
+	case *types.AppendMessage:
+		body, _ := io.ReadAll(msg.Reader)
+		if string(body) == b.fail {
+			b.worker.PostMessage(&types.Error{
+				Message: types.RespondTo(msg),
+				Error:   errors.New("disk full"),
+			}, nil)
+			return
+		}
+		b.appended = append(b.appended, string(body))
+	}
+	b.worker.PostMessage(&types.Done{Message: types.RespondTo(action)}, nil)
+}
+
+func TestImportFolder_Batches(t *testing.T) {
+	b := newImportBackend(t, 2*importBatchSize+20)
+	statePath := filepath.Join(t.TempDir(), "state.txt")
+	var progress []int
+
+	i := ImportFolder{Source: "INBOX", Destination: "Archive"}
+	imported, total, err := i.importFolder(b.worker, b.worker, statePath,
+		func(imported, _ int) { progress = append(progress, imported) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2*importBatchSize+20, imported)
+	assert.Equal(t, 2*importBatchSize+20, total)
+	assert.Equal(t, []int{importBatchSize, importBatchSize, 20}, b.batches)
+	assert.Equal(t, []int{importBatchSize, 2 * importBatchSize, 2*importBatchSize + 20}, progress)
+	assert.Len(t, b.appended, imported)
+	// a complete import starts over the next time
+	_, err = os.Stat(statePath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestImportFolder_Resume(t *testing.T) {
+	b := newImportBackend(t, 10)
+	b.fail = "message 6"
+	statePath := filepath.Join(t.TempDir(), "state.txt")
+	i := ImportFolder{Source: "INBOX", Destination: "Archive"}
+
+	imported, total, err := i.importFolder(b.worker, b.worker, statePath,
+		func(int, int) {})
+	assert.Error(t, err)
+	assert.Equal(t, 5, imported)
+	assert.Equal(t, 10, total)
+	done, err := readImportState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[models.UID]bool{
+		"1": true, "2": true, "3": true, "4": true, "5": true,
+	}, done)
+
+	b.fail = ""
+	b.appended = nil
+	imported, total, err = i.importFolder(b.worker, b.worker, statePath,
+		func(int, int) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 10, imported)
+	assert.Equal(t, 10, total)
+	assert.Equal(t, []string{
+		"message 6", "message 7", "message 8", "message 9", "message 10",
+	}, b.appended)
+}
+
+func TestImportFolder_State(t *testing.T) {
+	assert.Equal(t, "work_INBOX_Lists_home_Archive_2024.txt",
+		importStateName("work", "INBOX/Lists", "home", "Archive:2024"))
+
+	dir := t.TempDir()
+	done, err := readImportState(filepath.Join(dir, "missing.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, done)
+
+	path := filepath.Join(dir, "state.txt")
+	if err := os.WriteFile(path, []byte("1\n\n3\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	done, err = readImportState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[models.UID]bool{"1": true, "3": true}, done)
+}
+
+func TestImportFolder_Timeout(t *testing.T) {
+	defer func(timeout time.Duration) { importTimeout = timeout }(importTimeout)
+	importTimeout = 10 * time.Millisecond
+
+	messages := make(chan types.WorkerMessage, 1)
+	worker := types.NewWorker("test", messages)
+	_, err := workerRequest(worker, &types.FetchDirectoryContents{})
+	assert.EqualError(t, err, "timed out")
+
+	// the request is cancelled and late responses are ignored
+	action := <-worker.Actions()
+	assert.Error(t, action.Context().Err())
+	worker.PostMessage(&types.DirectoryContents{
+		Message: types.RespondTo(action),
+	}, nil)
+	worker.ProcessMessage(<-messages)
+}
@@ -49,6 +49,17 @@ func (NextPrevMsg) Aliases() []string {
 }
 
 func (np NextPrevMsg) Execute(args []string) error {
+	if u, ok := app.SelectedTabContent().(*app.UnifiedView); ok {
+		n := np.Amount
+		if np.Percent {
+			n = int(float64(u.Height()) * (float64(n) / 100.0))
+		}
+		if args[0] == "prev-message" || args[0] == "prev" {
+			n = -n
+		}
+		u.NextPrev(n)
+		return nil
+	}
 	acct := app.SelectedAccount()
 	if acct == nil {
 		return errors.New("No account selected")
@@ -9,6 +9,7 @@ import (
 
 	"git.sr.ht/~rjarry/aerc/app"
 	"git.sr.ht/~rjarry/aerc/commands"
+	"git.sr.ht/~rjarry/aerc/lib"
 	"git.sr.ht/~rjarry/aerc/lib/log"
 	"git.sr.ht/~rjarry/aerc/lib/parse"
 	"git.sr.ht/~rjarry/aerc/lib/state"
@@ -24,6 +25,7 @@ type SearchFilter struct {
 	Body         bool                 `opt:"-b" desc:"Search in the body of the messages."`
 	All          bool                 `opt:"-a" desc:"Search in the entire text of the messages."`
 	UseExtension bool                 `opt:"-e" desc:"Use custom search backend extension."`
+	Query        bool                 `opt:"-q" desc:"Interpret the terms as a boolean query."`
 	Headers      textproto.MIMEHeader `opt:"-H" action:"ParseHeader" metavar:"<header>:<value>" desc:"Search for messages with the specified header."`
 	WithFlags    models.Flags         `opt:"-x" action:"ParseFlag" complete:"CompleteFlag" desc:"Search messages with specified flag."`
 	WithoutFlags models.Flags         `opt:"-X" action:"ParseNotFlag" complete:"CompleteFlag" desc:"Search messages without specified flag."`
@@ -155,17 +157,8 @@ func (s *SearchFilter) ParseDate(arg string) error {
 	return nil
 }
 
-func (s SearchFilter) Execute(args []string) error {
-	acct := app.SelectedAccount()
-	if acct == nil {
-		return errors.New("No account selected")
-	}
-	store := acct.Store()
-	if store == nil {
-		return errors.New("Cannot perform action. Messages still loading")
-	}
-
-	criteria := types.SearchCriteria{
+func (s *SearchFilter) criteria() (*types.SearchCriteria, error) {
+	criteria := &types.SearchCriteria{
 		WithFlags:    s.WithFlags,
 		WithoutFlags: s.WithoutFlags,
 		From:         s.From,
@@ -179,34 +172,90 @@ func (s SearchFilter) Execute(args []string) error {
 		Terms:        []string{s.Terms},
 		UseExtension: s.UseExtension,
 	}
+	if s.Query && s.Terms != "" {
+		op := types.QuerySubject
+		switch {
+		case s.All:
+			op = types.QueryText
+		case s.Body:
+			op = types.QueryBody
+		}
+		query, err := types.ParseQuery(s.Terms, op)
+		if err != nil {
+			return nil, fmt.Errorf("invalid query: %w", err)
+		}
+		criteria.Query = query
+		criteria.Terms = nil
+		criteria.SearchBody = false
+		criteria.SearchAll = false
+	}
+	return criteria, nil
+}
+
+func (s SearchFilter) Execute(args []string) error {
+	stores, err := selectedStores()
+	if err != nil {
+		return err
+	}
+
+	criteria, err := s.criteria()
+	if err != nil {
+		return err
+	}
 
 	if args[0] == "filter" {
 		if len(args[1:]) == 0 {
 			return Clear{}.Execute([]string{"clear"})
 		}
-		acct.SetStatus(state.FilterActivity("Filtering..."), state.Search(""))
-		store.SetFilter(&criteria)
-		cb := func(msg types.WorkerMessage) {
-			if _, ok := msg.(*types.Done); ok {
-				acct.SetStatus(state.FilterResult(strings.Join(args, " ")))
-				log.Tracef("Filter results: %v", store.Uids())
+		for acct, store := range stores {
+			acct.SetStatus(state.FilterActivity("Filtering..."), state.Search(""))
+			store.SetFilter(criteria)
+			cb := func(msg types.WorkerMessage) {
+				if _, ok := msg.(*types.Done); ok {
+					acct.SetStatus(state.FilterResult(strings.Join(args, " ")))
+					log.Tracef("Filter results: %v", store.Uids())
+				}
 			}
+			store.Sort(store.GetCurrentSortCriteria(), cb)
 		}
-		store.Sort(store.GetCurrentSortCriteria(), cb)
 	} else {
-		acct.SetStatus(state.Search("Searching..."))
-		cb := func(uids []models.UID) {
-			acct.SetStatus(state.Search(strings.Join(args, " ")))
-			log.Tracef("Search results: %v", uids)
-			store.ApplySearch(uids)
-			// TODO: Remove when stores have multiple OnUpdate handlers
-			ui.Invalidate()
+		for acct, store := range stores {
+			acct.SetStatus(state.Search("Searching..."))
+			cb := func(uids []models.UID) {
+				acct.SetStatus(state.Search(strings.Join(args, " ")))
+				log.Tracef("Search results: %v", uids)
+				store.ApplySearch(uids)
+				// TODO: Remove when stores have multiple OnUpdate handlers
+				ui.Invalidate()
+			}
+			store.Search(criteria, cb)
 		}
-		store.Search(&criteria, cb)
 	}
 	return nil
 }
 
+// selectedStores returns the message stores displayed in the selected tab:
+// the default folders of all accounts in the unified view, or the current
+// folder of the selected account.
+func selectedStores() (map[*app.AccountView]*lib.MessageStore, error) {
+	if u, ok := app.SelectedTabContent().(*app.UnifiedView); ok {
+		stores := u.Stores()
+		if len(stores) == 0 {
+			return nil, errors.New("Cannot perform action. Messages still loading")
+		}
+		return stores, nil
+	}
+	acct := app.SelectedAccount()
+	if acct == nil {
+		return nil, errors.New("No account selected")
+	}
+	store := acct.Store()
+	if store == nil {
+		return nil, errors.New("Cannot perform action. Messages still loading")
+	}
+	return map[*app.AccountView]*lib.MessageStore{acct: store}, nil
+}
+
 func handleXGMEXTComplete(arg string) []string {
 	prefixes := []string{"from:", "to:", "deliveredto:", "cc:", "bcc:"}
 	for _, prefix := range prefixes {
@@ -28,6 +28,10 @@ func (SelectMessage) Aliases() []string {
 }
 
 func (s SelectMessage) Execute(args []string) error {
+	if u, ok := app.SelectedTabContent().(*app.UnifiedView); ok {
+		u.Select(s.Index)
+		return nil
+	}
 	acct := app.SelectedAccount()
 	if acct == nil {
 		return errors.New("No account selected")
@@ -0,0 +1,54 @@
+package account
+
+import (
+	"errors"
+	"time"
+
+	"git.sr.ht/~rjarry/aerc/app"
+	"git.sr.ht/~rjarry/aerc/commands"
+)
+
+type Undo struct{}
+
+func init() {
+	commands.Register(Undo{})
+}
+
+func (Undo) Description() string {
+	return "Revert the last move, archive, delete, flag or label change."
+}
+
+func (Undo) Context() commands.CommandContext {
+	return commands.MESSAGE_LIST
+}
+
+func (Undo) Aliases() []string {
+	return []string{"undo"}
+}
+
+func (Undo) Execute(args []string) error {
+	acct := app.SelectedAccount()
+	if acct == nil {
+		return errors.New("No account selected")
+	}
+	entry, err := acct.UndoStack().Pop()
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return errors.New("Nothing to undo")
+	}
+	entry.Run(acct.Worker(), func(err error) {
+		if err != nil {
+			app.PushError("undo " + entry.Description + ": " + err.Error())
+			return
+		}
+		// Messages may have been moved back into the current folder.
+		// Reload it to get their new UIDs.
+		if dir := acct.Directories().Selected(); dir != "" {
+			acct.Directories().Open(dir, "", 0, nil, true)
+		}
+		app.PushStatus("Undone: "+entry.Description, 10*time.Second)
+	})
+	return nil
+}
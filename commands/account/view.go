@@ -38,11 +38,15 @@ func (v ViewMessage) Execute(args []string) error {
 	if acct == nil {
 		return errors.New("No account selected")
 	}
-	if acct.Messages().Empty() {
-		return nil
+	var store *lib.MessageStore
+	var msg *models.MessageInfo
+	if u, ok := app.SelectedTabContent().(*app.UnifiedView); ok {
+		store = u.Store()
+		msg, _ = u.SelectedMessage()
+	} else if !acct.Messages().Empty() {
+		store = acct.Messages().Store()
+		msg = acct.Messages().Selected()
 	}
-	store := acct.Messages().Store()
-	msg := acct.Messages().Selected()
 	if msg == nil {
 		return nil
 	}
@@ -0,0 +1,59 @@
+package commands
+
+import (
+	"git.sr.ht/~rjarry/aerc/app"
+	"git.sr.ht/~rjarry/aerc/config"
+)
+
+const allInboxesTitle = "All Inboxes"
+
+type AllInboxes struct {
+	Accounts []string `opt:"..." required:"false" metavar:"<account>..." complete:"CompleteAccount" desc:"Account name."`
+}
+
+func init() {
+	Register(AllInboxes{})
+}
+
+func (AllInboxes) Description() string {
+	return "Open a tab listing the messages of the default folder of several accounts."
+}
+
+func (AllInboxes) Context() CommandContext {
+	return GLOBAL
+}
+
+func (AllInboxes) Aliases() []string {
+	return []string{"all-inboxes"}
+}
+
+func (*AllInboxes) CompleteAccount(arg string) []string {
+	return FilterList(app.AccountNames(), arg, nil)
+}
+
+func (a AllInboxes) Execute(args []string) error {
+	names := a.Accounts
+	if len(names) == 0 {
+		if app.SelectTab(allInboxesTitle) {
+			return nil
+		}
+		for _, acct := range config.Accounts {
+			names = append(names, acct.Name)
+		}
+	}
+	var accounts []*app.AccountView
+	for _, name := range names {
+		acct, err := app.Account(name)
+		if err != nil {
+			return err
+		}
+		accounts = append(accounts, acct)
+	}
+	view := app.NewUnifiedView(accounts)
+	if app.SelectTab(allInboxesTitle) {
+		app.ReplaceTab(app.SelectedTabContent(), view, allInboxesTitle, true)
+	} else {
+		app.NewTab(view, allInboxesTitle)
+	}
+	return nil
+}
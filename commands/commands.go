@@ -49,6 +49,8 @@ func CurrentContext() CommandContext {
 		} else {
 			context |= COMPOSE_EDIT
 		}
+	case *app.UnifiedView:
+		context |= MESSAGE_LIST
 	case *app.MessageViewer:
 		context |= MESSAGE_VIEWER
 	case *app.Terminal:
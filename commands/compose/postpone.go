@@ -53,10 +53,9 @@ func (p Postpone) Execute(args []string) error {
 		return errors.New("No tab selected")
 	}
 	composer, _ := tab.Content.(*app.Composer)
-	config := composer.Config()
 	tabName := tab.Name
 
-	targetFolder := config.Postpone
+	targetFolder := composer.Account().PostponeFolder()
 	if composer.RecalledFrom() != "" {
 		targetFolder = composer.RecalledFrom()
 	}
@@ -16,8 +16,11 @@ import (
 	"git.sr.ht/~rjarry/aerc/commands"
 	"git.sr.ht/~rjarry/aerc/commands/mode"
 	"git.sr.ht/~rjarry/aerc/commands/msg"
+	"git.sr.ht/~rjarry/aerc/config"
 	"git.sr.ht/~rjarry/aerc/lib/hooks"
 	"git.sr.ht/~rjarry/aerc/lib/log"
+	"git.sr.ht/~rjarry/aerc/lib/outbox"
+	"git.sr.ht/~rjarry/aerc/lib/parse"
 	"git.sr.ht/~rjarry/aerc/lib/send"
 	"git.sr.ht/~rjarry/aerc/models"
 	"git.sr.ht/~rjarry/aerc/worker/types"
@@ -33,6 +36,8 @@ type Send struct {
 	NoCopyToReplied bool `opt:"-R" desc:"Do not save sent message to current folder."`
 
 	RequestDSN bool `opt:"--dsn" desc:"Request full delivery status notification (including success)."`
+
+	At time.Time `opt:"-S,--send-at" action:"ParseAt" metavar:"<time>" desc:"Schedule the message to be sent later."`
 }
 
 func init() {
@@ -72,6 +77,15 @@ func (o *Send) ParseCopyTo(arg string) error {
 	return nil
 }
 
+func (s *Send) ParseAt(arg string) error {
+	t, err := parse.SendTime(arg, time.Now())
+	if err != nil {
+		return err
+	}
+	s.At = t
+	return nil
+}
+
 func (s Send) Execute(args []string) error {
 	tab := app.SelectedTab()
 	if tab == nil {
@@ -84,10 +98,15 @@ func (s Send) Execute(args []string) error {
 		return err
 	}
 
+	err = composer.TrimQuotedHunks()
+	if err != nil {
+		return errors.Wrap(err, "TrimQuotedHunks")
+	}
+
 	config := composer.Config()
 
 	if len(s.CopyTo) == 0 {
-		s.CopyTo = config.CopyTo
+		s.CopyTo = composer.Account().CopyToFolders()
 	}
 	copyToReplied := config.CopyToReplied || (s.CopyToReplied && !s.NoCopyToReplied)
 
@@ -138,6 +157,18 @@ func (s Send) Execute(args []string) error {
 	log.Debugf("send config rcpts: %s", rcpts)
 	log.Debugf("send config domain: %s", domain)
 
+	doSend := func() {
+		if s.At.IsZero() {
+			sendHelper(composer, header, uri, domain, from, rcpts,
+				tab.Name, s.CopyTo, s.Archive, copyToReplied,
+				s.RequestDSN)
+		} else {
+			scheduleHelper(composer, header, s.At, from, rcpts,
+				tab.Name, s.CopyTo, s.Archive, copyToReplied,
+				s.RequestDSN)
+		}
+	}
+
 	warnSubject := composer.ShouldWarnSubject()
 	warnAttachment := composer.ShouldWarnAttachment()
 	if warnSubject || warnAttachment {
@@ -155,10 +186,7 @@ func (s Send) Execute(args []string) error {
 			msg+" Abort send? [Y/n] ",
 			func(text string) {
 				if text == "n" || text == "N" {
-					sendHelper(composer, header, uri, domain,
-						from, rcpts, tab.Name, s.CopyTo,
-						s.Archive, copyToReplied,
-						s.RequestDSN)
+					doSend()
 				}
 			}, func(ctx context.Context, cmd string) ([]opt.Completion, string) {
 				var comps []opt.Completion
@@ -172,8 +200,7 @@ func (s Send) Execute(args []string) error {
 
 		app.PushPrompt(prompt)
 	} else {
-		sendHelper(composer, header, uri, domain, from, rcpts, tab.Name,
-			s.CopyTo, s.Archive, copyToReplied, s.RequestDSN)
+		doSend()
 	}
 
 	return nil
@@ -186,13 +213,37 @@ func sendHelper(composer *app.Composer, header *mail.Header, uri *url.URL, domai
 	// we don't want to block the UI thread while we are sending
 	// so we do everything in a goroutine and hide the composer from the user
 	app.RemoveTab(composer, false)
-	app.PushStatus("Sending...", 10*time.Second)
 
 	// enter no-quit mode
 	mode.NoQuit()
 
+	send := func() {
+		sendMessage(composer, header, uri, domain, from, rcpts, tabName,
+			copyTo, archive, copyToReplied, requestDSN)
+	}
+	if delay := config.Compose().SendDelay; delay > 0 {
+		delaySend(composer, tabName, delay, send)
+		return
+	}
+	send()
+}
+
+func sendMessage(composer *app.Composer, header *mail.Header, uri *url.URL, domain string,
+	from *mail.Address, rcpts []*mail.Address, tabName string, copyTo []string,
+	archive string, copyToReplied bool, requestDSN bool,
+) {
+	app.PushStatus("Sending...", 10*time.Second)
+
 	var shouldCopy bool = (len(copyTo) > 0 || copyToReplied) && !strings.HasPrefix(uri.Scheme, "jmap")
 	var copyBuf bytes.Buffer
+	// full message, only set when it could be written successfully
+	var raw []byte
+
+	var folders []string
+	folders = append(folders, copyTo...)
+	if copyToReplied && composer.Parent() != nil {
+		folders = append(folders, composer.Parent().Folder)
+	}
 
 	failCh := make(chan error)
 	// writer
@@ -206,12 +257,7 @@ func sendHelper(composer *app.Composer, header *mail.Header, uri *url.URL, domai
 			failCh <- err
 			return
 		}
-
-		var folders []string
-		folders = append(folders, copyTo...)
-		if copyToReplied && composer.Parent() != nil {
-			folders = append(folders, composer.Parent().Folder)
-		}
+		raw = msgBuf.Bytes()
 
 		var sender io.WriteCloser
 		sender, err = send.NewSender(
@@ -248,6 +294,12 @@ func sendHelper(composer *app.Composer, header *mail.Header, uri *url.URL, domai
 		defer mode.NoQuitDone()
 
 		err := <-failCh
+		if err != nil && raw != nil &&
+			queueFailed(composer, err, raw, from, rcpts, folders, requestDSN) {
+			composer.SetSent(archive)
+			composer.Close()
+			return
+		}
 		if err != nil {
 			app.PushError(strings.ReplaceAll(err.Error(), "\n", " "))
 			app.NewTab(composer, tabName)
@@ -283,6 +335,92 @@ func sendHelper(composer *app.Composer, header *mail.Header, uri *url.URL, domai
 	}()
 }
 
+// queueFailed stores a message that could not be sent because of a temporary
+// error in the account outbox, if enabled, so that delivery is retried later.
+func queueFailed(composer *app.Composer, sendErr error, raw []byte,
+	from *mail.Address, rcpts []*mail.Address, folders []string,
+	requestDSN bool,
+) bool {
+	acct := composer.Account()
+	box := acct.Outbox()
+	if !acct.AccountConfig().OutboxRetry || box == nil || !send.IsTemporary(sendErr) {
+		return false
+	}
+	err := box.Add(&outbox.Message{
+		SendAt:     time.Now().Add(outbox.RetryDelay(1)),
+		From:       from,
+		Rcpts:      rcpts,
+		CopyTo:     folders,
+		RequestDSN: requestDSN,
+		Attempts:   1,
+		LastError:  sendErr.Error(),
+	}, bytes.NewReader(raw))
+	if err != nil {
+		log.Errorf("failed to queue message: %v", err)
+		return false
+	}
+	app.PushWarning(fmt.Sprintf(
+		"Sending failed: %s. Message queued in the outbox.",
+		strings.ReplaceAll(sendErr.Error(), "\n", " ")))
+	return true
+}
+
+// scheduleHelper stores the message in the account outbox from which it will
+// be delivered at the requested time.
+func scheduleHelper(composer *app.Composer, header *mail.Header, at time.Time,
+	from *mail.Address, rcpts []*mail.Address, tabName string, copyTo []string,
+	archive string, copyToReplied bool, requestDSN bool,
+) {
+	box := composer.Account().Outbox()
+	if box == nil {
+		app.PushError("No outbox available for this account")
+		return
+	}
+	app.RemoveTab(composer, false)
+
+	// enter no-quit mode
+	mode.NoQuit()
+
+	go func() {
+		defer log.PanicHandler()
+
+		// leave no-quit mode
+		defer mode.NoQuitDone()
+
+		var buf bytes.Buffer
+		err := composer.WriteMessage(header, &buf)
+		if err != nil {
+			app.PushError(err.Error())
+			app.NewTab(composer, tabName)
+			return
+		}
+
+		var folders []string
+		folders = append(folders, copyTo...)
+		if copyToReplied && composer.Parent() != nil {
+			folders = append(folders, composer.Parent().Folder)
+		}
+
+		err = box.Add(&outbox.Message{
+			SendAt:     at,
+			From:       from,
+			Rcpts:      rcpts,
+			CopyTo:     folders,
+			RequestDSN: requestDSN,
+		}, &buf)
+		if err != nil {
+			app.PushError(err.Error())
+			app.NewTab(composer, tabName)
+			return
+		}
+
+		app.PushStatus(fmt.Sprintf("Message scheduled for %s.",
+			at.Format("Mon Jan 2 15:04")), 10*time.Second)
+		composer.SetSent(archive)
+		composer.Close()
+	}()
+}
+
 func listRecipients(h *mail.Header) ([]*mail.Address, error) {
 	var rcpts []*mail.Address
 	for _, key := range []string{"to", "cc", "bcc"} {
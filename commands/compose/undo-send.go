@@ -0,0 +1,92 @@
+package compose
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"git.sr.ht/~rjarry/aerc/app"
+	"git.sr.ht/~rjarry/aerc/commands"
+	"git.sr.ht/~rjarry/aerc/commands/mode"
+)
+
+type UndoSend struct{}
+
+func init() {
+	commands.Register(UndoSend{})
+}
+
+func (UndoSend) Description() string {
+	return "Cancel the last message sent during the send-delay period."
+}
+
+func (UndoSend) Context() commands.CommandContext {
+	return commands.GLOBAL
+}
+
+func (UndoSend) Aliases() []string {
+	return []string{"undo-send"}
+}
+
+// messages waiting for [compose].send-delay to expire, most recent last
+type pendingSend struct {
+	composer *app.Composer
+	tabName  string
+	timer    *time.Timer
+}
+
+var (
+	pendingLock  sync.Mutex
+	pendingSends []*pendingSend
+)
+
+// delaySend keeps the composer in memory and only calls send once delay has
+// expired, unless :undo-send is executed in the meantime.
+func delaySend(composer *app.Composer, tabName string, delay time.Duration, send func()) {
+	p := &pendingSend{composer: composer, tabName: tabName}
+
+	pendingLock.Lock()
+	defer pendingLock.Unlock()
+	p.timer = time.AfterFunc(delay, func() {
+		if takePending(p) {
+			send()
+		}
+	})
+	pendingSends = append(pendingSends, p)
+
+	app.PushStatus(fmt.Sprintf(
+		"Sending in %s. Use :undo-send to cancel.", delay), delay)
+}
+
+// takePending removes p from the pending messages. It returns false if p was
+// already removed.
+func takePending(p *pendingSend) bool {
+	pendingLock.Lock()
+	defer pendingLock.Unlock()
+	for i, pending := range pendingSends {
+		if pending == p {
+			pendingSends = append(pendingSends[:i], pendingSends[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (UndoSend) Execute(args []string) error {
+	pendingLock.Lock()
+	if len(pendingSends) == 0 {
+		pendingLock.Unlock()
+		return errors.New("No message waiting to be sent")
+	}
+	p := pendingSends[len(pendingSends)-1]
+	pendingSends = pendingSends[:len(pendingSends)-1]
+	pendingLock.Unlock()
+
+	p.timer.Stop()
+	// leave the no-quit mode entered by :send
+	mode.NoQuitDone()
+	app.NewTab(p.composer, p.tabName)
+	app.PushStatus("Sending cancelled.", 10*time.Second)
+	return nil
+}
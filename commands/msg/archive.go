@@ -95,7 +95,7 @@ func archive(msgs []*models.MessageInfo, mfs *types.MultiFileStrategy,
 	for _, msg := range msgs {
 		uids = append(uids, msg.Uid)
 	}
-	archiveDir := acct.AccountConfig().Archive
+	archiveDir := acct.ArchiveFolder()
 	marker := store.Marker()
 	marker.ClearVisualMark()
 	next := findNextNonDeleted(uids, store)
@@ -130,21 +130,23 @@ func archive(msgs []*models.MessageInfo, mfs *types.MultiFileStrategy,
 	wg.Add(len(uidMap))
 	success := true
 
-	for dir, uids := range uidMap {
-		store.Move(uids, dir, true, mfs, func(
-			msg types.WorkerMessage,
-		) {
-			switch msg := msg.(type) {
-			case *types.Done:
-				wg.Done()
-			case *types.Error:
-				app.PushError(msg.Error.Error())
-				success = false
-				wg.Done()
-				marker.Remark()
-			}
-		})
-	}
+	acct.UndoStack().Batch("archive", func() {
+		for dir, uids := range uidMap {
+			store.Move(uids, dir, true, mfs, func(
+				msg types.WorkerMessage,
+			) {
+				switch msg := msg.(type) {
+				case *types.Done:
+					wg.Done()
+				case *types.Error:
+					app.PushError(msg.Error.Error())
+					success = false
+					wg.Done()
+					marker.Remark()
+				}
+			})
+		}
+	})
 	// we need to do that in the background, else we block the main thread
 	go func() {
 		defer log.PanicHandler()
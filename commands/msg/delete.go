@@ -90,8 +90,14 @@ func (d Delete) Execute(args []string) error {
 	sel := store.Selected()
 	marker := store.Marker()
 	marker.ClearVisualMark()
-	// caution, can be nil
-	next := findNextNonDeleted(uids, store)
+	// the unified view selects the next message by itself, do not move the
+	// selection of the account
+	_, unified := h.msgProvider.(*app.UnifiedView)
+	var next *models.MessageInfo
+	if !unified {
+		// caution, can be nil
+		next = findNextNonDeleted(uids, store)
+	}
 	store.Delete(uids, d.MultiFileStrategy, func(msg types.WorkerMessage) {
 		switch msg := msg.(type) {
 		case *types.Done:
@@ -129,20 +135,22 @@ func (d Delete) Execute(args []string) error {
 							app.ReplaceTab(mv, nextMv, next.Envelope.Subject, true)
 						})
 				}
-			} else {
-				if next == nil {
-					// We deleted the last message, select the new last message
-					// instead of the first message
-					acct.Messages().Select(-1)
-				}
+			} else if next == nil && !unified {
+				// We deleted the last message, select the new last message
+				// instead of the first message
+				acct.Messages().Select(-1)
 			}
 		case *types.Error:
 			marker.Remark()
-			store.Select(sel.Uid)
+			if sel != nil {
+				store.Select(sel.Uid)
+			}
 			app.PushError(msg.Error.Error())
 		case *types.Unsupported:
 			marker.Remark()
-			store.Select(sel.Uid)
+			if sel != nil {
+				store.Select(sel.Uid)
+			}
 			// notmuch doesn't support it, we want the user to know
 			app.PushError(" error, unsupported for this worker")
 		}
@@ -65,7 +65,10 @@ func (m ModifyLabels) Execute(args []string) error {
 	copy(resolvedAdd, add)
 	resolvedRemove := make([]string, len(remove))
 	copy(resolvedRemove, remove)
-	currentLabels := store.Selected().Labels
+	var currentLabels []string
+	if msg, err := h.msgProvider.SelectedMessage(); err == nil {
+		currentLabels = msg.Labels
+	}
 	for _, tag := range toggle {
 		if slices.Contains(add, tag) || slices.Contains(remove, tag) {
 			continue
@@ -29,6 +29,9 @@ type Pipe struct {
 	Decrypt    bool   `opt:"-d" desc:"Decrypt the full message before piping."`
 	Part       bool   `opt:"-p" desc:"Only pipe the selected message part."`
 	Command    string `opt:"..."`
+	// Uids overrides the marked or selected messages. They are piped in
+	// this order.
+	Uids []models.UID
 }
 
 func init() {
@@ -177,9 +180,12 @@ func (p Pipe) Run(cb func()) error {
 			}
 			return err
 		}
-		uids, err = h.markedOrSelectedUids()
-		if err != nil {
-			return err
+		uids = p.Uids
+		if len(uids) == 0 {
+			uids, err = h.markedOrSelectedUids()
+			if err != nil {
+				return err
+			}
 		}
 
 		if len(uids) == 1 {
@@ -261,7 +267,17 @@ func (p Pipe) Run(cb func()) error {
 					break
 				}
 			}
-			if is_git_patches {
+			if len(p.Uids) > 0 {
+				// Keep the order of the provided uids.
+				order := make(map[models.UID]int)
+				for i, uid := range p.Uids {
+					order[uid] = i
+				}
+				sort.Slice(messages, func(i, j int) bool {
+					return order[messages[i].Content.Uid] <
+						order[messages[j].Content.Uid]
+				})
+			} else if is_git_patches {
 				// Sort all messages by increasing Message-Id header.
 				// This will ensure that patch series are applied in order.
 				sort.Slice(messages, func(i, j int) bool {
@@ -95,6 +95,10 @@ func (f FlagMsg) Execute(args []string) error {
 	}
 
 	h := newHelper()
+	acct, err := h.account()
+	if err != nil {
+		return err
+	}
 	store, err := h.store()
 	if err != nil {
 		return err
@@ -136,27 +140,29 @@ func (f FlagMsg) Execute(args []string) error {
 
 	status := fmt.Sprintf("%s flag %q successful", actionName, f.FlagName)
 
-	if len(toEnable) != 0 {
-		store.Flag(toEnable, f.Flag, true, func(msg types.WorkerMessage) {
-			switch msg := msg.(type) {
-			case *types.Done:
-				app.PushStatus(status, 10*time.Second)
-				store.Marker().ClearVisualMark()
-			case *types.Error:
-				app.PushError(msg.Error.Error())
-			}
-		})
-	}
-	if len(toDisable) != 0 {
-		store.Flag(toDisable, f.Flag, false, func(msg types.WorkerMessage) {
-			switch msg := msg.(type) {
-			case *types.Done:
-				app.PushStatus(status, 10*time.Second)
-				store.Marker().ClearVisualMark()
-			case *types.Error:
-				app.PushError(msg.Error.Error())
-			}
-		})
-	}
+	acct.UndoStack().Batch("flag change", func() {
+		if len(toEnable) != 0 {
+			store.Flag(toEnable, f.Flag, true, func(msg types.WorkerMessage) {
+				switch msg := msg.(type) {
+				case *types.Done:
+					app.PushStatus(status, 10*time.Second)
+					store.Marker().ClearVisualMark()
+				case *types.Error:
+					app.PushError(msg.Error.Error())
+				}
+			})
+		}
+		if len(toDisable) != 0 {
+			store.Flag(toDisable, f.Flag, false, func(msg types.WorkerMessage) {
+				switch msg := msg.(type) {
+				case *types.Done:
+					app.PushStatus(status, 10*time.Second)
+					store.Marker().ClearVisualMark()
+				case *types.Error:
+					app.PushError(msg.Error.Error())
+				}
+			})
+		}
+	})
 	return nil
 }
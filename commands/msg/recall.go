@@ -60,10 +60,11 @@ func (r Recall) Execute(args []string) error {
 		return errors.Wrap(err, "Recall failed")
 	}
 
-	if acct.SelectedDirectory() != acct.AccountConfig().Postpone &&
+	postpone := acct.PostponeFolder()
+	if acct.SelectedDirectory() != postpone &&
 		!msgInfo.Flags.Has(models.DraftFlag) && !r.Force {
 		return errors.New("Use -f to recall non-draft messages from outside the " +
-			acct.AccountConfig().Postpone + " directory.")
+			postpone + " directory.")
 	}
 
 	log.Debugf("Recalling message <%s>", msgInfo.Envelope.MessageId)
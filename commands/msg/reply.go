@@ -33,6 +33,7 @@ type reply struct {
 	NoEdit     bool   `opt:"-E" desc:"Force [compose].edit-headers = false."`
 	Account    string `opt:"-A" complete:"CompleteAccount" desc:"Reply with the specified account."`
 	SkipEditor bool   `opt:"-s" desc:"Skip the editor and go directly to the review screen."`
+	Review     bool   `opt:"-r" desc:"Review a patch and trim the quoted hunks without comments."`
 }
 
 func init() {
@@ -85,6 +86,19 @@ func (r reply) Execute(args []string) error {
 		return err
 	}
 
+	var diffPart []int
+	if r.Review {
+		var isDiff bool
+		diffPart, isDiff = findDiffPart(msg.BodyStructure)
+		_, isPatch := lib.ParsePatchSubject(msg.Envelope.Subject)
+		if !isDiff && !isPatch {
+			return errors.New("Selected message is not a patch")
+		}
+		if r.Template == "" {
+			r.Template = config.Templates().PatchReview
+		}
+	}
+
 	from, err := chooseFromAddr(conf, msg)
 	if err != nil {
 		return err
@@ -185,6 +199,7 @@ func (r reply) Execute(args []string) error {
 		if mv != nil && r.Close {
 			app.RemoveTab(mv, true)
 		}
+		composer.SetPatchReview(r.Review)
 
 		if r.SkipEditor {
 			composer.Terminal().Close()
@@ -234,7 +249,10 @@ func (r reply) Execute(args []string) error {
 				"can only include reply from the message viewer")
 		}
 
-		part := getMessagePart(msg, widget)
+		part := diffPart
+		if part == nil {
+			part = getMessagePart(msg, widget)
+		}
 		if part == nil {
 			// mkey... let's get the first thing that isn't a container
 			// if that's still nil it's either not a multipart msg (ok) or
@@ -266,6 +284,23 @@ func (r reply) Execute(args []string) error {
 	}
 }
 
+// findDiffPart returns the path of the first text/x-diff or text/x-patch part
+// of a message. The path is nil when the message itself is a diff.
+func findDiffPart(bs *models.BodyStructure) ([]int, bool) {
+	if bs == nil {
+		return nil, false
+	}
+	for _, mime := range []string{"text/x-diff", "text/x-patch"} {
+		if bs.FullMIMEType() == mime {
+			return nil, true
+		}
+		if part := lib.FindMIMEPart(mime, bs, nil); part != nil {
+			return part, true
+		}
+	}
+	return nil, false
+}
+
 func chooseFromAddr(conf *config.AccountConfig, msg *models.MessageInfo) (*mail.Address, error) {
 	if len(conf.Aliases) == 0 {
 		return conf.From, nil
@@ -0,0 +1,176 @@
+package msg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	"git.sr.ht/~rjarry/aerc/app"
+	"git.sr.ht/~rjarry/aerc/commands"
+	"git.sr.ht/~rjarry/aerc/lib/log"
+	"git.sr.ht/~rjarry/aerc/lib/ui"
+	"git.sr.ht/~rjarry/aerc/models"
+	"git.sr.ht/~rjarry/aerc/worker/types"
+)
+
+type MarkSpam struct {
+	NoTrain bool `opt:"-n" desc:"Do not run the trainer command."`
+}
+
+func init() {
+	commands.Register(MarkSpam{})
+}
+
+func (MarkSpam) Description() string {
+	return "Report the selected messages as spam or as legitimate."
+}
+
+func (MarkSpam) Context() commands.CommandContext {
+	return commands.MESSAGE_LIST | commands.MESSAGE_VIEWER
+}
+
+func (MarkSpam) Aliases() []string {
+	return []string{"mark-spam", "mark-ham"}
+}
+
+// Reporting a message as spam first feeds it to the mark-spam-cmd trainer,
+// then sets the $Junk keyword and finally moves it to the junk folder.
+// Reporting a message as ham does the reverse and moves it back to the inbox
+// if it was in the junk folder.
+func (m MarkSpam) Execute(args []string) error {
+	spam := args[0] == "mark-spam"
+
+	h := newHelper()
+	acct, err := h.account()
+	if err != nil {
+		return err
+	}
+	store, err := h.store()
+	if err != nil {
+		return err
+	}
+	uids, err := h.markedOrSelectedUids()
+	if err != nil {
+		return err
+	}
+
+	conf := acct.AccountConfig()
+	junk := acct.JunkFolder()
+	trainer := conf.MarkHamCmd
+	var dest string
+	if spam {
+		if junk == "" {
+			return errors.New("no junk folder, set junk in accounts.conf")
+		}
+		trainer = conf.MarkSpamCmd
+		dest = junk
+	} else if junk != "" && store.Name == junk {
+		var ok bool
+		dest, ok = acct.RoleDirectory(models.InboxRole)
+		if !ok {
+			dest = "INBOX"
+		}
+	}
+	if dest == store.Name {
+		dest = ""
+	}
+	if m.NoTrain {
+		trainer = ""
+	}
+
+	next := findNextNonDeleted(uids, store)
+	marker := store.Marker()
+	marker.ClearVisualMark()
+
+	what := "ham"
+	if spam {
+		what = "spam"
+	}
+	fail := func(err error) {
+		app.PushError(fmt.Sprintf("%s: %v", args[0], err))
+		marker.Remark()
+	}
+	moved := func(msg types.WorkerMessage) {
+		switch msg := msg.(type) {
+		case *types.Done:
+			app.PushStatus(fmt.Sprintf(
+				"%d message(s) reported as %s and moved to %s",
+				len(uids), what, dest), 10*time.Second)
+			handleDone(acct, next, store)
+		case *types.Error:
+			fail(msg.Error)
+		}
+	}
+	// backends without keywords only move the messages
+	flagged := func(msg types.WorkerMessage) {
+		switch msg := msg.(type) {
+		case *types.Done, *types.Unsupported:
+			if dest != "" {
+				store.Move(uids, dest, false, nil, moved)
+				return
+			}
+			app.PushStatus(fmt.Sprintf("%d message(s) reported as %s",
+				len(uids), what), 10*time.Second)
+		case *types.Error:
+			fail(msg.Error)
+		}
+	}
+
+	if trainer == "" {
+		store.Junk(uids, spam, flagged)
+		return nil
+	}
+
+	messages := make(chan *types.FullMessage, len(uids))
+	store.FetchFull(context.TODO(), uids, func(fm *types.FullMessage) {
+		messages <- fm
+	})
+	go func() {
+		defer log.PanicHandler()
+
+		err := trainMessages(messages, len(uids), trainer)
+		ui.QueueFunc(func() {
+			if err != nil {
+				fail(err)
+				return
+			}
+			store.Junk(uids, spam, flagged)
+		})
+	}()
+
+	return nil
+}
+
+// trainMessages pipes each fetched message to the trainer command.
+func trainMessages(messages <-chan *types.FullMessage, n int, command string) error {
+	for i := 0; i < n; i++ {
+		select {
+		case fm := <-messages:
+			if err := runTrainer(command, fm.Content.Reader); err != nil {
+				return err
+			}
+		case <-time.After(30 * time.Second):
+			return errors.New("failed to fetch all messages")
+		}
+	}
+	return nil
+}
+
+func runTrainer(command string, msg io.Reader) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = msg
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if s := strings.TrimSpace(stderr.String()); s != "" {
+			return fmt.Errorf("%s: %w: %s", command, err, s)
+		}
+		return fmt.Errorf("%s: %w", command, err)
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package patch
 
 import (
+	"errors"
 	"fmt"
 	"sort"
 	"strings"
@@ -9,15 +10,18 @@ import (
 	"git.sr.ht/~rjarry/aerc/app"
 	"git.sr.ht/~rjarry/aerc/commands"
 	"git.sr.ht/~rjarry/aerc/commands/msg"
+	"git.sr.ht/~rjarry/aerc/lib"
 	"git.sr.ht/~rjarry/aerc/lib/log"
 	"git.sr.ht/~rjarry/aerc/lib/pama"
 	"git.sr.ht/~rjarry/aerc/lib/pama/models"
+	aercmodels "git.sr.ht/~rjarry/aerc/models"
 )
 
 type Apply struct {
 	Cmd      string `opt:"-c" desc:"Apply patches with provided command."`
 	Worktree string `opt:"-w" desc:"Create linked worktree on this <commit-ish>."`
-	Tag      string `opt:"tag" required:"true" complete:"CompleteTag" desc:"Identify patches with tag."`
+	Thread   bool   `opt:"-t" desc:"Apply the newest revision of the patch series in the selected thread."`
+	Tag      string `opt:"tag" required:"false" complete:"CompleteTag" desc:"Identify patches with tag."`
 }
 
 func init() {
@@ -87,6 +91,26 @@ func (a Apply) Execute(args []string) error {
 	}
 	log.Tracef("Current project: %v", p)
 
+	var uids []aercmodels.UID
+	if a.Thread {
+		series, err := threadPatchSeries()
+		if err != nil {
+			return err
+		}
+		uids = series.Uids()
+		if patch == "" {
+			tags := models.Commits(p.Commits).Tags()
+			names := proposePatchName(tags, []string{series.Subject()})
+			if len(names) == 0 {
+				return errors.New("Cannot propose a tag, please provide one.")
+			}
+			patch = names[0]
+		}
+	}
+	if patch == "" {
+		return errors.New("A tag is required.")
+	}
+
 	if worktree != "" {
 		p, err = m.CreateWorktree(p, worktree, patch)
 		if err != nil {
@@ -126,7 +150,13 @@ func (a Apply) Execute(args []string) error {
 		}
 	}
 
-	msgData := collectMessageData()
+	if len(uids) == 0 {
+		uids, err = markedOrSelectedUids()
+		if err != nil {
+			return err
+		}
+	}
+	msgData := collectMessageData(uids)
 
 	// apply patches with the pipe cmd
 	pipe := msg.Pipe{
@@ -134,6 +164,7 @@ func (a Apply) Execute(args []string) error {
 		Full:       true,
 		Part:       false,
 		Command:    applyCmd,
+		Uids:       uids,
 	}
 	return pipe.Run(func() {
 		p, err = m.ApplyUpdate(p, patch, commit, msgData)
@@ -143,17 +174,68 @@ func (a Apply) Execute(args []string) error {
 	})
 }
 
-// collectMessageData returns a map where the key is the message id and the
-// value the subject of the marked messages
-func collectMessageData() map[string]string {
+// threadPatchSeries returns the newest complete revision of the patch series
+// in the thread of the selected message. If no revision is complete, the
+// newest one is returned. A warning is shown when patches are missing or when
+// a newer incomplete revision is skipped.
+func threadPatchSeries() (*lib.PatchSeries, error) {
 	acct := app.SelectedAccount()
 	if acct == nil {
-		return nil
+		return nil, errors.New("No account selected")
 	}
-
-	uids, err := commands.MarkedOrSelected(acct)
+	store := acct.Store()
+	if store == nil {
+		return nil, errors.New("Cannot perform action. Messages still loading")
+	}
+	selected, err := acct.SelectedMessage()
 	if err != nil {
-		log.Errorf("error occurred: %v", err)
+		return nil, err
+	}
+
+	msgs := make([]*aercmodels.MessageInfo, 0, len(store.Messages))
+	for _, msg := range store.Messages {
+		msgs = append(msgs, msg)
+	}
+	series := lib.ThreadPatchSeries(msgs, selected.Uid)
+	if len(series) == 0 {
+		return nil, errors.New("No patch series found in the thread")
+	}
+
+	newest := series[len(series)-1]
+	chosen := newest
+	for i := len(series) - 1; i >= 0; i-- {
+		if series[i].Complete() {
+			chosen = series[i]
+			break
+		}
+	}
+	switch {
+	case len(chosen.Uids()) == 0:
+		return nil, fmt.Errorf("No patches found for v%d", chosen.Version)
+	case chosen != newest:
+		app.PushWarning(fmt.Sprintf(
+			"v%d is missing patches %v, applying v%d",
+			newest.Version, newest.Missing(), chosen.Version))
+	case !chosen.Complete():
+		app.PushWarning(fmt.Sprintf("v%d is missing patches %v",
+			chosen.Version, chosen.Missing()))
+	}
+	return chosen, nil
+}
+
+func markedOrSelectedUids() ([]aercmodels.UID, error) {
+	acct := app.SelectedAccount()
+	if acct == nil {
+		return nil, errors.New("No account selected")
+	}
+	return commands.MarkedOrSelected(acct)
+}
+
+// collectMessageData returns a map where the key is the message id and the
+// value the subject of the provided messages
+func collectMessageData(uids []aercmodels.UID) map[string]string {
+	acct := app.SelectedAccount()
+	if acct == nil {
 		return nil
 	}
 
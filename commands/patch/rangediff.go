@@ -0,0 +1,71 @@
+package patch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"git.sr.ht/~rjarry/aerc/app"
+	"git.sr.ht/~rjarry/aerc/commands"
+	"git.sr.ht/~rjarry/aerc/config"
+	"git.sr.ht/~rjarry/aerc/lib/log"
+	"git.sr.ht/~rjarry/aerc/lib/pama"
+	"git.sr.ht/~rjarry/go-opt/v2"
+)
+
+type RangeDiff struct {
+	Old string `opt:"old-tag" complete:"CompleteTag" desc:"Tag of the old revision."`
+	New string `opt:"new-tag" complete:"CompleteTag" desc:"Tag of the new revision."`
+}
+
+func init() {
+	register(RangeDiff{})
+}
+
+func (RangeDiff) Description() string {
+	return "Show the changes between two revisions of a patch."
+}
+
+func (RangeDiff) Context() commands.CommandContext {
+	return commands.GLOBAL
+}
+
+func (RangeDiff) Aliases() []string {
+	return []string{"range-diff"}
+}
+
+func (*RangeDiff) CompleteTag(arg string) []string {
+	patches, err := pama.New().CurrentPatches()
+	if err != nil {
+		log.Errorf("failed to get current patches: %v", err)
+		return nil
+	}
+	return commands.FilterList(patches, arg, nil)
+}
+
+func (r RangeDiff) Execute(args []string) error {
+	diff, err := pama.New().RangeDiff(r.Old, r.New)
+	if err != nil {
+		return err
+	}
+
+	cmd := []string{"sh", "-c", hldiff() + " | " + config.Viewer().Pager}
+	term, err := commands.QuickTerm(cmd, strings.NewReader(diff), true)
+	if err != nil {
+		return err
+	}
+	app.NewTab(term, fmt.Sprintf("range-diff %s %s", r.Old, r.New))
+	return nil
+}
+
+// hldiff returns the command to run the hldiff filter shipped with aerc.
+func hldiff() string {
+	for _, dir := range config.SearchDirs {
+		path := filepath.Join(dir, "filters", "hldiff")
+		if _, err := os.Stat(path); err == nil {
+			return opt.QuoteArg(path)
+		}
+	}
+	return "hldiff"
+}
@@ -0,0 +1,252 @@
+package patch
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"git.sr.ht/~rjarry/aerc/app"
+	"git.sr.ht/~rjarry/aerc/commands"
+	"git.sr.ht/~rjarry/aerc/config"
+	"git.sr.ht/~rjarry/aerc/lib/log"
+	"git.sr.ht/~rjarry/aerc/lib/pama"
+	"git.sr.ht/~rjarry/aerc/lib/send"
+	"git.sr.ht/~rjarry/aerc/models"
+	"github.com/emersion/go-message/mail"
+)
+
+type Send struct {
+	Version   int    `opt:"-v" desc:"Version number of the series."`
+	InReplyTo bool   `opt:"--in-reply-to" desc:"Send the series as a reply to the selected message."`
+	Tag       string `opt:"tag" required:"true" complete:"CompleteTag" desc:"Patch tag to send."`
+}
+
+func init() {
+	register(Send{})
+}
+
+func (Send) Description() string {
+	return "Compose the commits of a patch as a series of emails."
+}
+
+func (Send) Context() commands.CommandContext {
+	return commands.GLOBAL
+}
+
+func (Send) Aliases() []string {
+	return []string{"send"}
+}
+
+func (*Send) CompleteTag(arg string) []string {
+	patches, err := pama.New().CurrentPatches()
+	if err != nil {
+		log.Errorf("failed to get current patches: %v", err)
+		return nil
+	}
+	return commands.FilterList(patches, arg, nil)
+}
+
+type seriesMessage struct {
+	header *mail.Header
+	body   string
+	edit   bool
+}
+
+// A series of more than one patch is preceded by a cover letter which is
+// opened in the editor. All patches are threaded as replies to the first
+// message and are opened in review mode.
+func (s Send) Execute(args []string) error {
+	acct := app.SelectedAccount()
+	if acct == nil {
+		return errors.New("No account selected")
+	}
+	conf := acct.AccountConfig()
+
+	patches, err := pama.New().Patches(s.Tag)
+	if err != nil {
+		return err
+	}
+	if len(patches) == 0 {
+		return fmt.Errorf("Patch '%s' has no commits", s.Tag)
+	}
+
+	var parent *models.MessageInfo
+	if s.InReplyTo {
+		parent, err = acct.SelectedMessage()
+		if err != nil {
+			return err
+		}
+	}
+
+	hostname, err := send.GetMessageIdHostname(conf.SendWithHostname, conf.From)
+	if err != nil {
+		return err
+	}
+
+	var messages []seriesMessage
+	n := len(patches)
+	if n > 1 {
+		messages = append(messages, seriesMessage{
+			header: s.header(0, n, "*** SUBJECT HERE ***"),
+			body:   coverLetter(patches),
+			edit:   true,
+		})
+	}
+	for i, p := range patches {
+		messages = append(messages, seriesMessage{
+			header: s.header(i+1, n, p.Subject),
+			body:   patchBody(p, conf.From),
+		})
+	}
+
+	// everything is a reply to the first message
+	var to, cc []*mail.Address
+	var inReplyTo, references []string
+	if parent != nil {
+		to, cc = s.recipients(conf, parent)
+		inReplyTo = []string{parent.Envelope.MessageId}
+		references = parentReferences(parent)
+	}
+	for i, m := range messages {
+		if err := m.header.GenerateMessageIDWithHostname(hostname); err != nil {
+			return err
+		}
+		m.header.SetAddressList("to", to)
+		m.header.SetAddressList("cc", cc)
+		if len(inReplyTo) > 0 {
+			m.header.SetMsgIDList("in-reply-to", inReplyTo)
+			m.header.SetMsgIDList("references", references)
+		}
+		if i == 0 {
+			msgid, err := m.header.MessageID()
+			if err != nil {
+				return err
+			}
+			inReplyTo = []string{msgid}
+			references = append(references, msgid)
+		}
+	}
+
+	editHeaders := config.Compose().EditHeaders
+	for i, m := range messages {
+		subject, _ := m.header.Subject()
+		composer, err := app.NewComposer(acct, conf, acct.Worker(),
+			editHeaders, "", m.header, nil, nil)
+		if err != nil {
+			return err
+		}
+		if err := composer.SetContents(strings.NewReader(m.body)); err != nil {
+			return err
+		}
+		if !m.edit {
+			composer.Terminal().Close()
+		}
+		if i == 0 {
+			composer.Tab = app.NewTab(composer, subject)
+		} else {
+			composer.Tab = app.NewBackgroundTab(composer, subject)
+		}
+	}
+
+	app.PushStatus(fmt.Sprintf("Review and send the %d message(s) of %s",
+		len(messages), s.Tag), 10*time.Second)
+	return nil
+}
+
+func (s Send) header(i, n int, subject string) *mail.Header {
+	prefix := "PATCH"
+	if s.Version > 1 {
+		prefix += fmt.Sprintf(" v%d", s.Version)
+	}
+	if n > 1 {
+		prefix += fmt.Sprintf(" %d/%d", i, n)
+	}
+	h := new(mail.Header)
+	h.SetSubject(fmt.Sprintf("[%s] %s", prefix, subject))
+	return h
+}
+
+// patchBody returns the commit message followed by the diff. Like with git
+// send-email, the body starts with an in-body From line when the patch author
+// is not the sender so that the author is kept when the patch is applied.
+func patchBody(p pama.Patch, from *mail.Address) string {
+	body := "---\n" + p.Diff + "\n"
+	if p.Body != "" {
+		body = p.Body + "\n" + body
+	}
+	if p.AuthorEmail != "" &&
+		(from == nil || !strings.EqualFold(p.AuthorEmail, from.Address)) {
+		author := mail.Address{Name: p.Author, Address: p.AuthorEmail}
+		body = "From: " + author.String() + "\n\n" + body
+	}
+	return body
+}
+
+// recipients replies to the author of the parent message and copies its
+// other recipients, except ourselves.
+func (Send) recipients(
+	conf *config.AccountConfig, parent *models.MessageInfo,
+) ([]*mail.Address, []*mail.Address) {
+	seen := make(map[string]bool)
+	if conf.From != nil {
+		seen[strings.ToLower(conf.From.Address)] = true
+	}
+	for _, a := range conf.Aliases {
+		seen[strings.ToLower(a.Address)] = true
+	}
+	dedupe := func(addrs ...[]*mail.Address) []*mail.Address {
+		var deduped []*mail.Address
+		for _, list := range addrs {
+			for _, a := range list {
+				key := strings.ToLower(a.Address)
+				if !seen[key] {
+					seen[key] = true
+					deduped = append(deduped, a)
+				}
+			}
+		}
+		return deduped
+	}
+	var to []*mail.Address
+	if len(parent.Envelope.ReplyTo) > 0 {
+		to = dedupe(parent.Envelope.ReplyTo)
+	} else {
+		to = dedupe(parent.Envelope.From)
+	}
+	cc := dedupe(parent.Envelope.To, parent.Envelope.Cc)
+	return to, cc
+}
+
+func parentReferences(parent *models.MessageInfo) []string {
+	var refs []string
+	if parent.RFC822Headers != nil {
+		refs, _ = parent.RFC822Headers.MsgIDList("references")
+		if len(refs) == 0 {
+			refs, _ = parent.RFC822Headers.MsgIDList("in-reply-to")
+		}
+	}
+	return append(refs, parent.Envelope.MessageId)
+}
+
+// coverLetter lists the patch subjects grouped by author like git shortlog.
+func coverLetter(patches []pama.Patch) string {
+	var authors []string
+	subjects := make(map[string][]string)
+	for _, p := range patches {
+		if _, ok := subjects[p.Author]; !ok {
+			authors = append(authors, p.Author)
+		}
+		subjects[p.Author] = append(subjects[p.Author], p.Subject)
+	}
+
+	var b strings.Builder
+	b.WriteString("*** BLURB HERE ***\n")
+	for _, author := range authors {
+		fmt.Fprintf(&b, "\n%s (%d):\n", author, len(subjects[author]))
+		for _, subject := range subjects[author] {
+			fmt.Fprintf(&b, "  %s\n", subject)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,76 @@
+package patch
+
+import (
+	"testing"
+
+	"git.sr.ht/~rjarry/aerc/lib/pama"
+	"git.sr.ht/~rjarry/aerc/lib/pama/models"
+	"github.com/emersion/go-message/mail"
+)
+
+func TestSend_subject(t *testing.T) {
+	tests := []struct {
+		version int
+		i, n    int
+		want    string
+	}{
+		{version: 0, i: 1, n: 1, want: "[PATCH] fix"},
+		{version: 1, i: 1, n: 1, want: "[PATCH] fix"},
+		{version: 2, i: 1, n: 1, want: "[PATCH v2] fix"},
+		{version: 0, i: 0, n: 3, want: "[PATCH 0/3] fix"},
+		{version: 3, i: 2, n: 3, want: "[PATCH v3 2/3] fix"},
+	}
+	for _, test := range tests {
+		h := Send{Version: test.version}.header(test.i, test.n, "fix")
+		if got, _ := h.Subject(); got != test.want {
+			t.Errorf("got %q, but wanted %q", got, test.want)
+		}
+	}
+}
+
+func TestSend_coverLetter(t *testing.T) {
+	patches := []pama.Patch{
+		{Commit: models.Commit{Subject: "a", Author: "Jane"}},
+		{Commit: models.Commit{Subject: "b", Author: "John"}},
+		{Commit: models.Commit{Subject: "c", Author: "Jane"}},
+	}
+	want := `*** BLURB HERE ***
+
+Jane (2):
+  a
+  c
+
+John (1):
+  b
+`
+	if got := coverLetter(patches); got != want {
+		t.Errorf("got %q, but wanted %q", got, want)
+	}
+}
+
+func TestSend_patchBody(t *testing.T) {
+	patch := pama.Patch{
+		Commit:      models.Commit{Subject: "fix", Author: "Jane Doe"},
+		AuthorEmail: "jane@example.com",
+		Body:        "Details.",
+		Diff:        " a | 2 +-",
+	}
+	tests := []struct {
+		from *mail.Address
+		want string
+	}{
+		{
+			from: &mail.Address{Name: "Jane", Address: "Jane@Example.com"},
+			want: "Details.\n---\n a | 2 +-\n",
+		},
+		{
+			from: &mail.Address{Name: "John Doe", Address: "john@example.com"},
+			want: "From: \"Jane Doe\" <jane@example.com>\n\nDetails.\n---\n a | 2 +-\n",
+		},
+	}
+	for _, test := range tests {
+		if got := patchBody(patch, test.from); got != test.want {
+			t.Errorf("got %q, but wanted %q", got, test.want)
+		}
+	}
+}
@@ -14,6 +14,7 @@ import (
 type Reload struct {
 	Binds bool   `opt:"-B" desc:"Reload binds.conf."`
 	Conf  bool   `opt:"-C" desc:"Reload aerc.conf."`
+	Rules bool   `opt:"-R" desc:"Reload rules.conf."`
 	Style string `opt:"-s" complete:"CompleteStyle" desc:"Reload the specified styleset."`
 }
 
@@ -65,9 +66,10 @@ func (Reload) Aliases() []string {
 }
 
 func (r Reload) Execute(args []string) error {
-	if !r.Binds && !r.Conf && r.Style == "" {
+	if !r.Binds && !r.Conf && !r.Rules && r.Style == "" {
 		r.Binds = true
 		r.Conf = true
+		r.Rules = true
 		r.Style = config.Ui().StyleSetName
 	}
 
@@ -90,6 +92,16 @@ func (r Reload) Execute(args []string) error {
 		reconfigure = true
 	}
 
+	if r.Rules {
+		f, err := config.ReloadRules()
+		if err != nil {
+			return err
+		}
+		if len(config.Rules()) > 0 {
+			app.PushSuccess("Rules reloaded: " + f)
+		}
+	}
+
 	if r.Style != "" {
 		config.Ui().ClearCache()
 		config.Ui().StyleSetName = r.Style
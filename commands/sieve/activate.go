@@ -0,0 +1,82 @@
+package sieve
+
+import (
+	"context"
+	"fmt"
+
+	"git.sr.ht/~rjarry/aerc/app"
+	"git.sr.ht/~rjarry/aerc/commands"
+	"git.sr.ht/~rjarry/aerc/worker/types"
+)
+
+type Activate struct {
+	Name string `opt:"name" complete:"CompleteName" desc:"Script name."`
+}
+
+type Deactivate struct{}
+
+func init() {
+	register(Activate{})
+	register(Deactivate{})
+}
+
+func (Activate) Description() string {
+	return "Make a script the active one."
+}
+
+func (Deactivate) Description() string {
+	return "Disable the active script."
+}
+
+func (Activate) Context() commands.CommandContext {
+	return commands.MESSAGE_LIST
+}
+
+func (Deactivate) Context() commands.CommandContext {
+	return commands.MESSAGE_LIST
+}
+
+func (Activate) Aliases() []string {
+	return []string{"activate"}
+}
+
+func (Deactivate) Aliases() []string {
+	return []string{"deactivate"}
+}
+
+func (*Activate) CompleteName(arg string) []string {
+	return completeScript(arg)
+}
+
+func (a Activate) Execute(args []string) error {
+	return setActive(a.Name)
+}
+
+func (Deactivate) Execute(args []string) error {
+	return setActive("")
+}
+
+func setActive(name string) error {
+	acct, err := selectedAccount()
+	if err != nil {
+		return err
+	}
+	acct.Worker().PostAction(context.TODO(), &types.ActivateSieveScript{
+		Name: name,
+	}, func(msg types.WorkerMessage) {
+		switch msg := msg.(type) {
+		case *types.Done:
+			if name == "" {
+				app.PushStatus("Sieve filtering disabled.", statusDuration)
+			} else {
+				app.PushStatus(fmt.Sprintf("Sieve script %q activated.", name),
+					statusDuration)
+			}
+		case *types.Error:
+			app.PushError("sieve: " + msg.Error.Error())
+		case *types.Unsupported:
+			app.PushError("sieve: not supported by this account")
+		}
+	})
+	return nil
+}
@@ -0,0 +1,84 @@
+package sieve
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"git.sr.ht/~rjarry/aerc/app"
+	"git.sr.ht/~rjarry/aerc/commands"
+	"git.sr.ht/~rjarry/aerc/lib/xdg"
+	"git.sr.ht/~rjarry/aerc/worker/types"
+)
+
+type Check struct {
+	File bool   `opt:"-f" desc:"Check a local file instead of a stored script."`
+	Name string `opt:"name" complete:"CompleteName" desc:"Script name or file."`
+}
+
+func init() {
+	register(Check{})
+}
+
+func (Check) Description() string {
+	return "Verify a script with the server."
+}
+
+func (Check) Context() commands.CommandContext {
+	return commands.MESSAGE_LIST
+}
+
+func (Check) Aliases() []string {
+	return []string{"check"}
+}
+
+func (c *Check) CompleteName(arg string) []string {
+	if c.File {
+		return commands.CompletePath(arg, false)
+	}
+	return completeScript(arg)
+}
+
+func (c Check) Execute(args []string) error {
+	acct, err := selectedAccount()
+	if err != nil {
+		return err
+	}
+	check := func(script string) {
+		acct.Worker().PostAction(context.TODO(), &types.CheckSieveScript{
+			Script: toNetwork(script),
+		}, func(msg types.WorkerMessage) {
+			switch msg := msg.(type) {
+			case *types.Done:
+				app.PushStatus(fmt.Sprintf("Sieve script %q is valid.", c.Name),
+					statusDuration)
+			case *types.Error:
+				app.PushError(fmt.Sprintf("sieve: %s: %v", c.Name, msg.Error))
+			case *types.Unsupported:
+				app.PushError("sieve: not supported by this account")
+			}
+		})
+	}
+
+	if c.File {
+		buf, err := os.ReadFile(xdg.ExpandHome(c.Name))
+		if err != nil {
+			return err
+		}
+		check(string(buf))
+		return nil
+	}
+
+	acct.Worker().PostAction(context.TODO(), &types.GetSieveScript{Name: c.Name},
+		func(msg types.WorkerMessage) {
+			switch msg := msg.(type) {
+			case *types.Error:
+				app.PushError("sieve: " + msg.Error.Error())
+			case *types.Unsupported:
+				app.PushError("sieve: not supported by this account")
+			case *types.SieveScript:
+				check(msg.Script)
+			}
+		})
+	return nil
+}
@@ -0,0 +1,164 @@
+package sieve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"git.sr.ht/~rjarry/aerc/app"
+	"git.sr.ht/~rjarry/aerc/commands"
+	"git.sr.ht/~rjarry/aerc/config"
+	"git.sr.ht/~rjarry/aerc/lib/managesieve"
+	"git.sr.ht/~rjarry/aerc/lib/ui"
+	"git.sr.ht/~rjarry/aerc/worker/types"
+	"git.sr.ht/~rjarry/go-opt/v2"
+)
+
+type Edit struct {
+	Name string `opt:"name" complete:"CompleteName" desc:"Script name."`
+}
+
+func init() {
+	register(Edit{})
+}
+
+func (Edit) Description() string {
+	return "Edit a script and upload it to the server."
+}
+
+func (Edit) Context() commands.CommandContext {
+	return commands.MESSAGE_LIST
+}
+
+func (Edit) Aliases() []string {
+	return []string{"edit"}
+}
+
+func (*Edit) CompleteName(arg string) []string {
+	return completeScript(arg)
+}
+
+func (e Edit) Execute(args []string) error {
+	acct, err := selectedAccount()
+	if err != nil {
+		return err
+	}
+	editScript(acct, e.Name)
+	return nil
+}
+
+// editScript downloads a script and opens it in the editor. Scripts that do
+// not exist yet start empty.
+func editScript(acct *app.AccountView, name string) {
+	acct.Worker().PostAction(context.TODO(), &types.GetSieveScript{Name: name},
+		func(msg types.WorkerMessage) {
+			switch msg := msg.(type) {
+			case *types.Error:
+				var serr *managesieve.Error
+				if errors.As(msg.Error, &serr) && serr.Code == "NONEXISTENT" {
+					openEditor(acct, name, "", "", "")
+					return
+				}
+				app.PushError("sieve: " + msg.Error.Error())
+			case *types.Unsupported:
+				app.PushError("sieve: not supported by this account")
+			case *types.SieveScript:
+				script := fromNetwork(msg.Script)
+				openEditor(acct, name, script, script, "")
+			}
+		})
+}
+
+// openEditor shows content in an embedded editor and uploads the result if
+// it differs from original. When the server refuses the script, the editor
+// is opened again with the rejected content so that errors can be fixed.
+// Quitting without changes after an error discards them.
+func openEditor(acct *app.AccountView, name, original, content, rejected string) {
+	f, err := os.CreateTemp(config.General().TempDir, "aerc-sieve-*.sieve")
+	if err != nil {
+		app.PushError(err.Error())
+		return
+	}
+	path := f.Name()
+	_, err = f.WriteString(content)
+	f.Close()
+	if err != nil {
+		os.Remove(path)
+		app.PushError(err.Error())
+		return
+	}
+
+	editorCmd, err := app.CmdFallbackSearch(config.EditorCmds(), true)
+	if err != nil {
+		os.Remove(path)
+		app.PushError(err.Error())
+		return
+	}
+	editor := exec.Command("/bin/sh", "-c", editorCmd+" "+opt.QuoteArg(path))
+	term, err := app.NewTerminal(editor)
+	if err != nil {
+		os.Remove(path)
+		app.PushError(err.Error())
+		return
+	}
+	term.OnClose = func(_ error) {
+		app.CloseDialog()
+		defer os.Remove(path)
+		defer term.Focus(false)
+
+		if editor.ProcessState.ExitCode() > 0 {
+			app.PushError("Quitting editor without saving.")
+			return
+		}
+		buf, err := os.ReadFile(path)
+		if err != nil {
+			app.PushError(fmt.Sprintf("failed to read file: %v", err))
+			return
+		}
+		edited := string(buf)
+		switch edited {
+		case original:
+			app.PushStatus("No changes.", statusDuration)
+		case rejected:
+			app.PushError(fmt.Sprintf("Sieve script %q not saved.", name))
+		default:
+			putScript(acct, name, original, edited)
+		}
+	}
+	term.Show(true)
+	term.Focus(true)
+
+	app.AddDialog(app.DefaultDialog(
+		ui.NewBox(term, "Sieve script "+name, "", acct.UiConfig()),
+	))
+}
+
+func putScript(acct *app.AccountView, name, original, script string) {
+	acct.Worker().PostAction(context.TODO(), &types.PutSieveScript{
+		Name:   name,
+		Script: toNetwork(script),
+	}, func(msg types.WorkerMessage) {
+		switch msg := msg.(type) {
+		case *types.Done:
+			app.PushStatus(fmt.Sprintf("Sieve script %q saved.", name),
+				statusDuration)
+		case *types.Error:
+			app.PushError(fmt.Sprintf("sieve: %s: %v", name, msg.Error))
+			openEditor(acct, name, original, script, script)
+		case *types.Unsupported:
+			app.PushError("sieve: not supported by this account")
+		}
+	})
+}
+
+// Sieve scripts use CRLF line endings
+func toNetwork(script string) string {
+	return strings.ReplaceAll(fromNetwork(script), "\n", "\r\n")
+}
+
+func fromNetwork(script string) string {
+	return strings.ReplaceAll(script, "\r\n", "\n")
+}
@@ -0,0 +1,75 @@
+package sieve
+
+import (
+	"context"
+	"strings"
+
+	"git.sr.ht/~rjarry/aerc/app"
+	"git.sr.ht/~rjarry/aerc/commands"
+	"git.sr.ht/~rjarry/aerc/worker/types"
+)
+
+type List struct{}
+
+func init() {
+	register(List{})
+}
+
+func (List) Description() string {
+	return "List the scripts stored on the server."
+}
+
+func (List) Context() commands.CommandContext {
+	return commands.MESSAGE_LIST
+}
+
+func (List) Aliases() []string {
+	return []string{"list", "ls"}
+}
+
+const activeSuffix = " (active)"
+
+func (List) Execute(args []string) error {
+	acct, err := selectedAccount()
+	if err != nil {
+		return err
+	}
+	acct.Worker().PostAction(context.TODO(), &types.ListSieveScripts{},
+		func(msg types.WorkerMessage) {
+			switch msg := msg.(type) {
+			case *types.Error:
+				app.PushError("sieve: " + msg.Error.Error())
+			case *types.Unsupported:
+				app.PushError("sieve: not supported by this account")
+			case *types.SieveScripts:
+				names := make([]string, 0, len(msg.Scripts))
+				lines := make([]string, 0, len(msg.Scripts))
+				for _, s := range msg.Scripts {
+					names = append(names, s.Name)
+					if s.Active {
+						lines = append(lines, s.Name+activeSuffix)
+					} else {
+						lines = append(lines, s.Name)
+					}
+				}
+				setKnownScripts(acct.Name(), names)
+				if len(lines) == 0 {
+					app.PushStatus("No sieve scripts", statusDuration)
+					return
+				}
+				app.AddDialog(app.DefaultDialog(app.NewListBox(
+					"Sieve scripts: press <Enter> to edit, <Esc> to close.",
+					lines, acct.UiConfig(),
+					func(line string) {
+						app.CloseDialog()
+						if line == "" {
+							return
+						}
+						name := strings.TrimSuffix(line, activeSuffix)
+						editScript(acct, name)
+					},
+				)))
+			}
+		})
+	return nil
+}
@@ -0,0 +1,127 @@
+package sieve
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"git.sr.ht/~rjarry/aerc/app"
+	"git.sr.ht/~rjarry/aerc/commands"
+	"git.sr.ht/~rjarry/go-opt/v2"
+)
+
+var subCommands map[string]commands.Command
+
+const statusDuration = 10 * time.Second
+
+func register(cmd commands.Command) {
+	if subCommands == nil {
+		subCommands = make(map[string]commands.Command)
+	}
+	for _, alias := range cmd.Aliases() {
+		if subCommands[alias] != nil {
+			panic("duplicate sub command alias: " + alias)
+		}
+		subCommands[alias] = cmd
+	}
+}
+
+type Sieve struct {
+	SubCmd commands.Command `opt:":cmd:" action:"ParseSub" complete:"CompleteSubNames"`
+}
+
+func init() {
+	commands.Register(Sieve{})
+}
+
+func (Sieve) Description() string {
+	return "Manage server-side Sieve filtering scripts."
+}
+
+func (Sieve) Context() commands.CommandContext {
+	return commands.MESSAGE_LIST
+}
+
+func (Sieve) Aliases() []string {
+	return []string{"sieve"}
+}
+
+func (s *Sieve) ParseSub(arg string) error {
+	cmd, ok := subCommands[arg]
+	if ok {
+		context := commands.CurrentContext()
+		if cmd.Context()&context != 0 {
+			// copy zeroed struct
+			clone := reflect.New(reflect.TypeOf(cmd)).Interface()
+			s.SubCmd = clone.(commands.Command)
+			return nil
+		}
+	}
+	return fmt.Errorf("%s unknown sub-command", arg)
+}
+
+func (*Sieve) CompleteSubNames(arg string) []string {
+	context := commands.CurrentContext()
+	options := make([]string, 0, len(subCommands))
+	for alias, cmd := range subCommands {
+		if cmd.Context()&context != 0 {
+			options = append(options, alias+"\n"+cmd.Description())
+		}
+	}
+	sort.Strings(options)
+	return commands.FilterList(options, arg, nil)
+}
+
+func (s *Sieve) CompleteSubArgs(arg string) []string {
+	if s.SubCmd == nil {
+		return nil
+	}
+	// prepend arbitrary string to arg to work with sub-commands
+	options, _ := commands.GetCompletions(s.SubCmd, opt.LexArgs("a "+arg))
+	completions := make([]string, 0, len(options))
+	for _, o := range options {
+		completions = append(completions, o.Value)
+	}
+	return completions
+}
+
+func (s Sieve) Execute(args []string) error {
+	if s.SubCmd == nil {
+		return errors.New("no subcommand found")
+	}
+	return s.SubCmd.Execute(args)
+}
+
+func selectedAccount() (*app.AccountView, error) {
+	acct := app.SelectedAccount()
+	if acct == nil {
+		return nil, errors.New("No account selected")
+	}
+	return acct, nil
+}
+
+// Script names last reported by each account, for completion
+var (
+	knownLock    sync.Mutex
+	knownScripts = make(map[string][]string)
+)
+
+func setKnownScripts(account string, names []string) {
+	knownLock.Lock()
+	defer knownLock.Unlock()
+	knownScripts[account] = names
+}
+
+func completeScript(arg string) []string {
+	acct := app.SelectedAccount()
+	if acct == nil {
+		return nil
+	}
+	knownLock.Lock()
+	names := knownScripts[acct.Name()]
+	knownLock.Unlock()
+	return commands.FilterList(names, arg, nil)
+}
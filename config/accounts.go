@@ -10,12 +10,14 @@ import (
 	"path"
 	"reflect"
 	"regexp"
+	"slices"
 	"sort"
 	"strings"
 	"time"
 
 	"git.sr.ht/~rjarry/aerc/lib/log"
 	"git.sr.ht/~rjarry/aerc/lib/xdg"
+	"git.sr.ht/~rjarry/aerc/models"
 	"github.com/emersion/go-message/mail"
 	"github.com/go-ini/ini"
 )
@@ -103,6 +105,11 @@ type AccountConfig struct {
 	StripBcc          bool            `ini:"strip-bcc" default:"true"`
 	Default           string          `ini:"default" default:"INBOX"`
 	Postpone          string          `ini:"postpone" default:"Drafts"`
+	Junk              string          `ini:"junk"`
+	MarkSpamCmd       string          `ini:"mark-spam-cmd"`
+	MarkHamCmd        string          `ini:"mark-ham-cmd"`
+	Outbox            string          `ini:"outbox"`
+	OutboxRetry       bool            `ini:"outbox-retry" default:"false"`
 	From              *mail.Address   `ini:"from"`
 	UseEnvelopeFrom   bool            `ini:"use-envelope-from" default:"false"`
 	OriginalToHeader  string          `ini:"original-to-header"`
@@ -117,6 +124,7 @@ type AccountConfig struct {
 	SignatureCmd      string          `ini:"signature-cmd"`
 	EnableFoldersSort bool            `ini:"enable-folders-sort" default:"true"`
 	FoldersSort       []string        `ini:"folders-sort" delim:","`
+	VirtualFolders    string          `ini:"virtual-folders"`
 	AddressBookCmd    string          `ini:"address-book-cmd"`
 	SendAsUTC         bool            `ini:"send-as-utc" default:"false"`
 	SendWithHostname  bool            `ini:"send-with-hostname" default:"false"`
@@ -133,16 +141,23 @@ type AccountConfig struct {
 	// Reconnection
 	ReconnectMaxWait time.Duration `ini:"reconnect-maxwait" default:"30s"`
 
-	// PGP Config
-	PgpKeyId                string `ini:"pgp-key-id"`
-	PgpAutoSign             bool   `ini:"pgp-auto-sign"`
-	PgpAttachKey            bool   `ini:"pgp-attach-key"`
-	PgpOpportunisticEncrypt bool   `ini:"pgp-opportunistic-encrypt"`
-	PgpErrorLevel           int    `ini:"pgp-error-level" parse:"ParsePgpErrorLevel" default:"warn"`
-	PgpSelfEncrypt          bool   `ini:"pgp-self-encrypt"`
+	// PGP and S/MIME Config
+	CryptoProvider          string   `ini:"crypto-provider" parse:"ParseCryptoProvider" default:"pgp"`
+	PgpKeyId                string   `ini:"pgp-key-id"`
+	PgpAutoSign             bool     `ini:"pgp-auto-sign"`
+	PgpAttachKey            bool     `ini:"pgp-attach-key"`
+	PgpOpportunisticEncrypt bool     `ini:"pgp-opportunistic-encrypt"`
+	PgpErrorLevel           int      `ini:"pgp-error-level" parse:"ParsePgpErrorLevel" default:"warn"`
+	PgpSelfEncrypt          bool     `ini:"pgp-self-encrypt"`
+	PgpKeyLookup            []string `ini:"pgp-key-lookup" delim:","`
+	Autocrypt               bool     `ini:"autocrypt"`
 
 	// AuthRes
 	TrustedAuthRes []string `ini:"trusted-authres" delim:","`
+
+	// folder options which are not set explicitly and may be replaced by
+	// the folders advertised by the backend
+	roleFolders []string
 }
 
 const (
@@ -302,6 +317,11 @@ func ParseAccountConfig(name string, section *ini.Section) (*AccountConfig, erro
 	if err := MapToStruct(section, &account, true); err != nil {
 		return nil, err
 	}
+	for key := range folderRoles {
+		if !section.HasKey(key) {
+			account.roleFolders = append(account.roleFolders, key)
+		}
+	}
 	for key, val := range section.KeysHash() {
 		backendSpecific := true
 		typ := reflect.TypeFor[AccountConfig]()
@@ -343,6 +363,61 @@ func ParseAccountConfig(name string, section *ini.Section) (*AccountConfig, erro
 	return &account, nil
 }
 
+// special-use roles of the folders used for the folder options which are not
+// set in accounts.conf
+var folderRoles = map[string]models.Role{
+	"archive":  models.ArchiveRole,
+	"postpone": models.DraftsRole,
+	"copy-to":  models.SentRole,
+	"junk":     models.JunkRole,
+}
+
+// ArchiveFolder returns the archive folder. When the option is not set, the
+// folder that has the archive role in roles is used, if any.
+func (a *AccountConfig) ArchiveFolder(roles map[models.Role]string) string {
+	if dir, ok := a.roleFolder("archive", roles); ok {
+		return dir
+	}
+	return a.Archive
+}
+
+// PostponeFolder returns the postpone folder. When the option is not set, the
+// folder that has the drafts role in roles is used, if any.
+func (a *AccountConfig) PostponeFolder(roles map[models.Role]string) string {
+	if dir, ok := a.roleFolder("postpone", roles); ok {
+		return dir
+	}
+	return a.Postpone
+}
+
+// CopyToFolders returns the folders to copy sent messages to. When the option
+// is not set, the folder that has the sent role in roles is used, if any.
+func (a *AccountConfig) CopyToFolders(roles map[models.Role]string) []string {
+	if dir, ok := a.roleFolder("copy-to", roles); ok {
+		return []string{dir}
+	}
+	return a.CopyTo
+}
+
+// JunkFolder returns the junk folder. When the option is not set, the folder
+// that has the junk role in roles is used, if any.
+func (a *AccountConfig) JunkFolder(roles map[models.Role]string) string {
+	if dir, ok := a.roleFolder("junk", roles); ok {
+		return dir
+	}
+	return a.Junk
+}
+
+func (a *AccountConfig) roleFolder(
+	key string, roles map[models.Role]string,
+) (string, bool) {
+	if !slices.Contains(a.roleFolders, key) {
+		return "", false
+	}
+	dir, ok := roles[folderRoles[key]]
+	return dir, ok
+}
+
 func parseBackend(source string) string {
 	u, err := url.Parse(source)
 	if err != nil {
@@ -402,6 +477,14 @@ func (a *AccountConfig) ParsePgpErrorLevel(sec *ini.Section, key *ini.Key) (int,
 	return level, err
 }
 
+func (a *AccountConfig) ParseCryptoProvider(sec *ini.Section, key *ini.Key) (string, error) {
+	switch key.String() {
+	case "pgp", "smime":
+		return key.String(), nil
+	}
+	return "", fmt.Errorf("must be either pgp or smime")
+}
+
 // checkConfigPerms checks for too open permissions
 // printing the fix on stdout and returning an error
 func checkConfigPerms(filename string) error {
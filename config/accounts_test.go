@@ -0,0 +1,48 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/go-ini/ini"
+	"github.com/stretchr/testify/assert"
+
+	"git.sr.ht/~rjarry/aerc/models"
+)
+
+func TestFolderRoles(t *testing.T) {
+	file, err := ini.LoadSources(ini.LoadOptions{
+		KeyValueDelimiters: "=",
+	}, []byte(`
+[work]
+source = maildir:///tmp/mail
+from = John Doe <john@example.com>
+archive = Old
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	acct, err := ParseAccountConfig("work", file.Section("work"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Drafts", acct.Postpone)
+	assert.Empty(t, acct.CopyTo)
+
+	roles := map[models.Role]string{
+		models.ArchiveRole: "Archives",
+		models.SentRole:    "Sent Messages",
+		models.JunkRole:    "Spam",
+	}
+	// explicit settings win, defaults are kept when no folder has the role
+	assert.Equal(t, "Old", acct.ArchiveFolder(roles))
+	assert.Equal(t, "Drafts", acct.PostponeFolder(roles))
+	assert.Equal(t, []string{"Sent Messages"}, acct.CopyToFolders(roles))
+	assert.Equal(t, "Spam", acct.JunkFolder(roles))
+	// the configuration is left untouched
+	assert.Empty(t, acct.CopyTo)
+	assert.Empty(t, acct.Junk)
+
+	// the defaults are restored when the roles disappear
+	assert.Empty(t, acct.CopyToFolders(nil))
+	assert.Empty(t, acct.JunkFolder(nil))
+}
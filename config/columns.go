@@ -35,7 +35,9 @@ type ColumnDef struct {
 
 var columnRe = regexp.MustCompile(`^([\w-]+)(?:([<:>])(=|\*|\d+%?)?)?$`)
 
-func parseColumnDef(col string, section *ini.Section) (*ColumnDef, error) {
+func parseColumnDef(
+	col string, section *ini.Section, defaults map[string]string,
+) (*ColumnDef, error) {
 	col = strings.TrimSpace(col)
 	match := columnRe.FindStringSubmatch(col)
 	if match == nil {
@@ -79,12 +81,16 @@ func parseColumnDef(col string, section *ini.Section) (*ColumnDef, error) {
 		}
 		width = w / divider
 	}
-	key, err := section.GetKey(keyName)
-	if err != nil {
+	var text string
+	if key, err := section.GetKey(keyName); err == nil {
+		text = key.String()
+	} else if def, ok := defaults[keyName]; ok {
+		text = def
+	} else {
 		return nil, err
 	}
 
-	t, err := templates.ParseTemplate(keyName, key.String())
+	t, err := templates.ParseTemplate(keyName, text)
 	if err != nil {
 		return nil, err
 	}
@@ -103,9 +109,17 @@ func parseColumnDef(col string, section *ini.Section) (*ColumnDef, error) {
 }
 
 func ParseColumnDefs(key *ini.Key, section *ini.Section) ([]*ColumnDef, error) {
+	return parseColumnDefs(key, section, nil)
+}
+
+// parseColumnDefs uses the templates from defaults for the columns which are
+// not defined in section.
+func parseColumnDefs(
+	key *ini.Key, section *ini.Section, defaults map[string]string,
+) ([]*ColumnDef, error) {
 	var columns []*ColumnDef
 	for _, col := range key.Strings(",") {
-		c, err := parseColumnDef(col, section)
+		c, err := parseColumnDef(col, section, defaults)
 		if err != nil {
 			return nil, err
 		}
@@ -3,6 +3,7 @@ package config
 import (
 	"regexp"
 	"sync/atomic"
+	"time"
 
 	"git.sr.ht/~rjarry/aerc/lib/log"
 	"github.com/go-ini/ini"
@@ -20,6 +21,7 @@ type ComposeConfig struct {
 	EditHeaders         bool           `ini:"edit-headers"`
 	FocusBody           bool           `ini:"focus-body"`
 	LFEditor            bool           `ini:"lf-editor"`
+	SendDelay           time.Duration  `ini:"send-delay" default:"0s"`
 }
 
 var composeConfig atomic.Pointer[ComposeConfig]
@@ -17,6 +17,7 @@ import (
 type GeneralConfig struct {
 	DefaultSavePath    string       `ini:"default-save-path"`
 	PgpProvider        string       `ini:"pgp-provider" default:"auto" parse:"ParsePgpProvider"`
+	SmimePasswordCmd   string       `ini:"smime-password-cmd"`
 	UnsafeAccountsConf bool         `ini:"unsafe-accounts-conf"`
 	LogFile            string       `ini:"log-file"`
 	LogLevel           log.LogLevel `ini:"log-level" default:"info" parse:"ParseLogLevel"`
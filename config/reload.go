@@ -11,6 +11,7 @@ import (
 type reloadStore struct {
 	binds string
 	conf  string
+	rules string
 }
 
 var rlst reloadStore
@@ -25,6 +26,11 @@ func SetConfFilename(fn string) {
 	rlst.conf = fn
 }
 
+func SetRulesFilename(fn string) {
+	log.Debugf("reloader: set rules file: %s", fn)
+	rlst.rules = fn
+}
+
 func ReloadBinds() (string, error) {
 	f := rlst.binds
 	if !exists(f) {
@@ -44,6 +50,17 @@ func ReloadConf() (string, error) {
 	return f, parseConf(f)
 }
 
+func ReloadRules() (string, error) {
+	f := rlst.rules
+	if !exists(f) {
+		// rules.conf is optional
+		rulesConfig.Store(nil)
+		return f, nil
+	}
+	log.Debugf("reload rules file: %s", f)
+	return f, parseRulesFromFile(f)
+}
+
 func ReloadAccounts() error {
 	return errors.New("not implemented")
 }
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"git.sr.ht/~rjarry/aerc/lib/log"
+	"github.com/go-ini/ini"
+)
+
+// RuleConfig is a client-side filtering rule from rules.conf.
+type RuleConfig struct {
+	Name string `ini:"-"`
+	// Accounts to which the rule applies. All if empty.
+	Accounts []string `ini:"account" delim:","`
+	// Folders to which the rule applies. All if nil.
+	Folder *regexp.Regexp `ini:"folder"`
+	// :search options selecting the messages.
+	Match string `ini:"match"`
+
+	Flag     []string `ini:"flag" delim:","`
+	Unflag   []string `ini:"unflag" delim:","`
+	MarkRead bool     `ini:"mark-read"`
+	Label    string   `ini:"label"`
+	Pipe     string   `ini:"pipe"`
+	Copy     string   `ini:"copy"`
+	Move     string   `ini:"move"`
+	// Skip the following rules for the matched messages.
+	Stop bool `ini:"stop"`
+}
+
+// AppliesTo returns true if the rule must run on messages of the given
+// account folder.
+func (r *RuleConfig) AppliesTo(account, folder string) bool {
+	if len(r.Accounts) > 0 && !contains(r.Accounts, account) {
+		return false
+	}
+	return r.Folder == nil || r.Folder.MatchString(folder)
+}
+
+var rulesConfig atomic.Pointer[[]*RuleConfig]
+
+// Rules returns the rules in the order they are defined in rules.conf.
+func Rules() []*RuleConfig {
+	if rules := rulesConfig.Load(); rules != nil {
+		return *rules
+	}
+	return nil
+}
+
+func parseRules(root string) error {
+	filename := path.Join(root, "rules.conf")
+	SetRulesFilename(filename)
+	if _, err := os.Stat(filename); errors.Is(err, os.ErrNotExist) {
+		// rules are optional
+		rulesConfig.Store(nil)
+		return nil
+	}
+	return parseRulesFromFile(filename)
+}
+
+func parseRulesFromFile(filename string) error {
+	log.Debugf("Parsing rules configuration from %s", filename)
+	file, err := ini.LoadSources(ini.LoadOptions{
+		KeyValueDelimiters: "=",
+	}, filename)
+	if err != nil {
+		return err
+	}
+	rules, err := parseRulesFile(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	rulesConfig.Store(&rules)
+	return nil
+}
+
+func parseRulesFile(file *ini.File) ([]*RuleConfig, error) {
+	var rules []*RuleConfig
+	for _, section := range file.Sections() {
+		if section.Name() == ini.DefaultSection {
+			if len(section.Keys()) > 0 {
+				return nil, errors.New("rules must be defined in a [section]")
+			}
+			continue
+		}
+		rule := &RuleConfig{Name: section.Name()}
+		if err := MapToStruct(section, rule, false); err != nil {
+			return nil, err
+		}
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("[%s]: %w", rule.Name, err)
+		}
+		log.Debugf("rules.conf: [%s] %#v", rule.Name, rule)
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (r *RuleConfig) validate() error {
+	for _, l := range strings.Fields(r.Label) {
+		if !strings.HasPrefix(l, "+") && !strings.HasPrefix(l, "-") {
+			return fmt.Errorf("label %q must start with + or -", l)
+		}
+	}
+	if len(r.Flag) == 0 && len(r.Unflag) == 0 && !r.MarkRead &&
+		r.Label == "" && r.Pipe == "" && r.Copy == "" &&
+		r.Move == "" && !r.Stop {
+		return errors.New("no action")
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/go-ini/ini"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRules(t *testing.T) {
+	file, err := ini.LoadSources(ini.LoadOptions{
+		KeyValueDelimiters: "=",
+	}, []byte(`
+[lists]
+account = work,personal
+folder = ^INBOX$
+match = -H "List-Id:aerc-devel"
+label = +aerc -inbox
+move = Lists/aerc
+stop = true
+
+[flag boss]
+match = -f boss@example.com
+flag = flagged
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := parseRulesFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, rules, 2)
+
+	lists := rules[0]
+	assert.Equal(t, "lists", lists.Name)
+	assert.Equal(t, []string{"work", "personal"}, lists.Accounts)
+	assert.Equal(t, `-H "List-Id:aerc-devel"`, lists.Match)
+	assert.Equal(t, "Lists/aerc", lists.Move)
+	assert.True(t, lists.Stop)
+	assert.True(t, lists.AppliesTo("work", "INBOX"))
+	assert.False(t, lists.AppliesTo("work", "INBOX/sub"))
+	assert.False(t, lists.AppliesTo("other", "INBOX"))
+
+	boss := rules[1]
+	assert.Equal(t, []string{"flagged"}, boss.Flag)
+	assert.True(t, boss.AppliesTo("other", "Archive"))
+
+	for _, conf := range []string{
+		"match = -u\nmark-read = true\n",
+		"[no action]\nmatch = -u\n",
+		"[bad label]\nlabel = foo\n",
+		"[bad folder]\nfolder = (\nmark-read = true\n",
+	} {
+		file, err := ini.LoadSources(ini.LoadOptions{
+			KeyValueDelimiters: "=",
+		}, []byte(conf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = parseRulesFile(file)
+		assert.Error(t, err, conf)
+	}
+}
@@ -16,6 +16,7 @@ type TemplateConfig struct {
 	TemplateDirs []string `ini:"template-dirs" delim:":"`
 	NewMessage   string   `ini:"new-message" default:"new_message"`
 	QuotedReply  string   `ini:"quoted-reply" default:"quoted_reply"`
+	PatchReview  string   `ini:"patch-review" default:"patch_review"`
 	Forwards     string   `ini:"forwards" default:"forward_as_body"`
 }
 
@@ -46,6 +47,9 @@ func parseTemplates(file *ini.File) (*TemplateConfig, error) {
 	if err := checkTemplate(conf.QuotedReply, conf.TemplateDirs); err != nil {
 		return nil, err
 	}
+	if err := checkTemplate(conf.PatchReview, conf.TemplateDirs); err != nil {
+		return nil, err
+	}
 	if err := checkTemplate(conf.Forwards, conf.TemplateDirs); err != nil {
 		return nil, err
 	}
@@ -21,6 +21,7 @@ import (
 type UIConfig struct {
 	IndexColumns    []*ColumnDef `ini:"index-columns" parse:"ParseIndexColumns" default:"flags:4,name<20%,subject,date>="`
 	ColumnSeparator string       `ini:"column-separator" default:"  "`
+	UnifiedColumns  []*ColumnDef `ini:"unified-columns" parse:"ParseUnifiedColumns" default:"account<12,flags:4,name<20%,subject,date>="`
 
 	DirListLeft  *template.Template `ini:"dirlist-left" default:"{{.Folder}}"`
 	DirListRight *template.Template `ini:"dirlist-right" default:"{{if .Unread}}{{humanReadable .Unread}}{{end}}"`
@@ -239,6 +240,16 @@ func (*UIConfig) ParseIndexColumns(section *ini.Section, key *ini.Key) ([]*Colum
 	return ParseColumnDefs(key, section)
 }
 
+func (*UIConfig) ParseUnifiedColumns(section *ini.Section, key *ini.Key) ([]*ColumnDef, error) {
+	return parseColumnDefs(key, section, map[string]string{
+		"column-account": `{{.Account}}`,
+		"column-date":    `{{.DateAutoFormat .Date.Local}}`,
+		"column-name":    `{{index (.From | names) 0}}`,
+		"column-flags":   `{{.Flags | join ""}}`,
+		"column-subject": `{{.ThreadPrefix}}{{.Subject}}`,
+	})
+}
+
 type SplitDirection int
 
 const (
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/go-ini/ini"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseUnifiedColumns(t *testing.T) {
+	file, err := ini.LoadSources(ini.LoadOptions{
+		KeyValueDelimiters: "=",
+	}, []byte(`
+[ui]
+unified-columns = account<10,date<*,subject<*
+column-subject = {{.Subject}}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	section := file.Section("ui")
+	columns, err := new(UIConfig).ParseUnifiedColumns(
+		section, section.Key("unified-columns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, columns, 3)
+	assert.Equal(t, "account", columns[0].Name)
+	assert.Equal(t, "date", columns[1].Name)
+	assert.Equal(t, "subject", columns[2].Name)
+	// the defaults must not leak into the configuration
+	assert.False(t, section.HasKey("column-account"))
+	assert.False(t, section.HasKey("column-date"))
+
+	_, err = section.NewKey("column-account", `[{{.Account}}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns, err = new(UIConfig).ParseUnifiedColumns(
+		section, section.Key("unified-columns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "[{{.Account}}]", columns[0].Template.Root.String())
+}
+
+func TestParseUnifiedColumnsUndefined(t *testing.T) {
+	file := ini.Empty()
+	section := file.Section("ui")
+	key, _ := section.NewKey("unified-columns", "account,foo")
+	_, err := new(UIConfig).ParseUnifiedColumns(section, key)
+	assert.Error(t, err)
+}
@@ -0,0 +1,120 @@
+// Package autocrypt implements the Autocrypt Level 1 headers and peer state
+// (https://autocrypt.org/level1.html).
+package autocrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+type Header struct {
+	Addr          string
+	PreferEncrypt bool
+	KeyData       []byte
+}
+
+// Parse parses the value of an Autocrypt or Autocrypt-Gossip header.
+func Parse(value string) (*Header, error) {
+	var h Header
+	for _, attr := range strings.Split(value, ";") {
+		attr = strings.TrimSpace(attr)
+		if attr == "" {
+			continue
+		}
+		name, val, ok := strings.Cut(attr, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid attribute %q", attr)
+		}
+		name = strings.TrimSpace(name)
+		val = strings.TrimSpace(val)
+		switch {
+		case name == "addr":
+			h.Addr = strings.ToLower(val)
+		case name == "prefer-encrypt":
+			h.PreferEncrypt = val == "mutual"
+		case name == "keydata":
+			key, err := base64.StdEncoding.DecodeString(
+				strings.Join(strings.Fields(val), ""))
+			if err != nil {
+				return nil, fmt.Errorf("invalid keydata: %w", err)
+			}
+			h.KeyData = key
+		case strings.HasPrefix(name, "_"):
+			// non-critical attribute
+		default:
+			return nil, fmt.Errorf("unknown critical attribute %q", name)
+		}
+	}
+	if h.Addr == "" || len(h.KeyData) == 0 {
+		return nil, errors.New("missing addr or keydata")
+	}
+	return &h, nil
+}
+
+// Format returns the value of an Autocrypt header. The key data is split
+// with spaces to allow folding the header.
+func (h *Header) Format() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "addr=%s;", h.Addr)
+	if h.PreferEncrypt {
+		b.WriteString(" prefer-encrypt=mutual;")
+	}
+	b.WriteString(" keydata=")
+	key := base64.StdEncoding.EncodeToString(h.KeyData)
+	var chunks []string
+	for len(key) > 0 {
+		n := min(len(key), 64)
+		chunks = append(chunks, key[:n])
+		key = key[n:]
+	}
+	b.WriteString(strings.Join(chunks, " "))
+	return b.String()
+}
+
+// Dearmor returns the binary key data of an ASCII armored public key as
+// returned by crypto.Provider.ExportKey.
+func Dearmor(r io.Reader) ([]byte, error) {
+	block, err := armor.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, block.Body); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// FilterKey removes all user IDs but the ones matching addr from the binary
+// public key data of an Autocrypt header. Senders cannot otherwise be trusted
+// with the addresses their keys claim.
+func FilterKey(data []byte, addr string) ([]byte, error) {
+	entities, err := openpgp.ReadKeyRing(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if len(entities) != 1 {
+		return nil, fmt.Errorf("expected one key, got %d", len(entities))
+	}
+	e := entities[0]
+	for name, id := range e.Identities {
+		if !strings.EqualFold(id.UserId.Email, addr) {
+			delete(e.Identities, name)
+		}
+	}
+	if len(e.Identities) == 0 {
+		return nil, fmt.Errorf("key has no user ID for %s", addr)
+	}
+	var buf bytes.Buffer
+	if err := e.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
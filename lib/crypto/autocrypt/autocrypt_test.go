@@ -0,0 +1,141 @@
+package autocrypt
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+func TestParseFormat(t *testing.T) {
+	key := bytes.Repeat([]byte{0x99, 0x01, 0x0d}, 100)
+	h := Header{Addr: "alice@example.org", PreferEncrypt: true, KeyData: key}
+	value := h.Format()
+	if !strings.HasPrefix(value, "addr=alice@example.org; prefer-encrypt=mutual; keydata=") {
+		t.Errorf("unexpected header %q", value)
+	}
+	for _, chunk := range strings.Fields(value) {
+		if len(chunk) > 76 {
+			t.Errorf("chunk too long to fold: %q", chunk)
+		}
+	}
+
+	parsed, err := Parse(strings.ReplaceAll(value, " ", "\r\n "))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Addr != h.Addr || !parsed.PreferEncrypt ||
+		!bytes.Equal(parsed.KeyData, key) {
+		t.Errorf("unexpected parsed header %#v", parsed)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	values := []string{
+		"addr=alice@example.org",
+		"keydata=mQ==",
+		"addr=alice@example.org; keydata=!!!",
+		"addr=alice@example.org; color=blue; keydata=mQ==",
+	}
+	for _, value := range values {
+		if _, err := Parse(value); err == nil {
+			t.Errorf("expected error for %q", value)
+		}
+	}
+	h, err := Parse("addr=Alice@Example.org; _color=blue; keydata=mQ==")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Addr != "alice@example.org" || h.PreferEncrypt {
+		t.Errorf("unexpected parsed header %#v", h)
+	}
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "autocrypt", "test.json")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := func(d int) time.Time {
+		return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	k1 := &Header{Addr: "bob@example.org", KeyData: []byte{1}}
+	k2 := &Header{Addr: "bob@example.org", KeyData: []byte{2}, PreferEncrypt: true}
+
+	if key := s.UpdateGossip("bob@example.org", day(1), k1); !bytes.Equal(key, k1.KeyData) {
+		t.Errorf("expected gossip key, got %v", key)
+	}
+	if key := s.Update("Bob@example.org", day(2), k1); key != nil {
+		t.Errorf("expected unchanged key, got %v", key)
+	}
+	if key := s.Update("bob@example.org", day(4), k2); !bytes.Equal(key, k2.KeyData) {
+		t.Errorf("expected new key, got %v", key)
+	}
+	// older messages are ignored
+	if key := s.Update("bob@example.org", day(3), k1); key != nil {
+		t.Errorf("expected older message to be ignored, got %v", key)
+	}
+	// gossip does not override the autocrypt key
+	if key := s.UpdateGossip("bob@example.org", day(5), k1); key != nil {
+		t.Errorf("expected gossip to be ignored, got %v", key)
+	}
+	s.Update("bob@example.org", day(6), nil)
+
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := s.Peers["bob@example.org"]
+	if p == nil {
+		t.Fatal("peer not saved")
+	}
+	if !p.LastSeen.Equal(day(6)) || !p.AutocryptTimestamp.Equal(day(4)) ||
+		!p.PreferEncrypt || !bytes.Equal(p.Key(), k2.KeyData) {
+		t.Errorf("unexpected peer state %#v", p)
+	}
+}
+
+func TestFilterKey(t *testing.T) {
+	e, err := openpgp.NewEntity("Bob", "", "bob@example.org", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.AddUserId("Alice", "", "alice@example.org", nil); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := e.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := FilterKey(buf.Bytes(), "Bob@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entities, err := openpgp.ReadKeyRing(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entities) != 1 || len(entities[0].Identities) != 1 {
+		t.Fatalf("unexpected filtered key %#v", entities)
+	}
+	for _, id := range entities[0].Identities {
+		if id.UserId.Email != "bob@example.org" {
+			t.Errorf("unexpected user ID %q", id.Name)
+		}
+	}
+	if len(entities[0].Subkeys) != len(e.Subkeys) {
+		t.Errorf("subkeys were dropped")
+	}
+
+	if _, err := FilterKey(buf.Bytes(), "mallory@example.org"); err == nil {
+		t.Error("expected an error for a key without matching user ID")
+	}
+}
@@ -0,0 +1,137 @@
+package autocrypt
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Peer is the Autocrypt state of a correspondent.
+type Peer struct {
+	LastSeen           time.Time `json:"last_seen"`
+	AutocryptTimestamp time.Time `json:"autocrypt_timestamp"`
+	PublicKey          []byte    `json:"public_key,omitempty"`
+	PreferEncrypt      bool      `json:"prefer_encrypt"`
+	GossipTimestamp    time.Time `json:"gossip_timestamp"`
+	GossipKey          []byte    `json:"gossip_key,omitempty"`
+}
+
+// Key returns the Autocrypt key of the peer, or its gossip key if none.
+func (p *Peer) Key() []byte {
+	if len(p.PublicKey) > 0 {
+		return p.PublicKey
+	}
+	return p.GossipKey
+}
+
+// Store holds the peer states of an account, indexed by lower case e-mail
+// address.
+type Store struct {
+	path  string
+	dirty bool
+	Peers map[string]*Peer
+}
+
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, Peers: make(map[string]*Peer)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.Peers); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Save writes the store to disk if it has been modified.
+func (s *Store) Save() error {
+	if !s.dirty {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.Peers, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+func effectiveDate(date time.Time) time.Time {
+	if now := time.Now(); date.After(now) {
+		return now
+	}
+	return date
+}
+
+// Update updates the state of the sender of a message dated date with its
+// Autocrypt header, or nil if it had none. It returns the key of the peer
+// if it has changed.
+func (s *Store) Update(addr string, date time.Time, h *Header) []byte {
+	addr = strings.ToLower(addr)
+	date = effectiveDate(date)
+	p := s.Peers[addr]
+	if p != nil && !date.After(p.AutocryptTimestamp) {
+		return nil
+	}
+	if h == nil {
+		if p != nil && date.After(p.LastSeen) {
+			p.LastSeen = date
+			s.dirty = true
+		}
+		return nil
+	}
+	if p == nil {
+		p = &Peer{}
+		s.Peers[addr] = p
+	}
+	changed := !bytes.Equal(p.Key(), h.KeyData)
+	p.LastSeen = date
+	p.AutocryptTimestamp = date
+	p.PublicKey = h.KeyData
+	p.PreferEncrypt = h.PreferEncrypt
+	s.dirty = true
+	if changed {
+		return p.PublicKey
+	}
+	return nil
+}
+
+// UpdateGossip updates the state of a recipient of a message dated date with
+// an Autocrypt-Gossip header. Gossip keys are only used for peers without an
+// Autocrypt key, in which case the key is returned if it has changed.
+func (s *Store) UpdateGossip(addr string, date time.Time, h *Header) []byte {
+	addr = strings.ToLower(addr)
+	date = effectiveDate(date)
+	p := s.Peers[addr]
+	if p != nil && !date.After(p.GossipTimestamp) {
+		return nil
+	}
+	if p == nil {
+		p = &Peer{}
+		s.Peers[addr] = p
+	}
+	changed := !bytes.Equal(p.GossipKey, h.KeyData)
+	p.GossipTimestamp = date
+	p.GossipKey = h.KeyData
+	s.dirty = true
+	if changed && len(p.PublicKey) == 0 {
+		return p.GossipKey
+	}
+	return nil
+}
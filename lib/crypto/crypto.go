@@ -1,17 +1,22 @@
 package crypto
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
 	"io"
 	"slices"
+	"strings"
 
 	"git.sr.ht/~rjarry/aerc/config"
 	"git.sr.ht/~rjarry/aerc/lib/crypto/gpg"
 	"git.sr.ht/~rjarry/aerc/lib/crypto/pgp"
+	"git.sr.ht/~rjarry/aerc/lib/crypto/smime"
 	"git.sr.ht/~rjarry/aerc/lib/log"
 	"git.sr.ht/~rjarry/aerc/models"
 	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/emersion/go-message/mail"
+	"github.com/emersion/go-message/textproto"
 )
 
 type Provider interface {
@@ -26,7 +31,23 @@ type Provider interface {
 	ExportKey(string) (io.Reader, error)
 }
 
-func New() Provider {
+// Providers dispatches the decryption of S/MIME messages to the S/MIME
+// provider and of all other messages to the PGP provider selected with
+// pgp-provider. Messages are signed and encrypted with the PGP provider
+// unless another one is selected for an account, see For.
+type Providers struct {
+	PGP   Provider
+	SMIME Provider
+}
+
+func New() *Providers {
+	return &Providers{
+		PGP:   newPGP(),
+		SMIME: &smime.Mail{},
+	}
+}
+
+func newPGP() Provider {
 	switch config.General().PgpProvider {
 	case "auto":
 		internal := &pgp.Mail{}
@@ -45,6 +66,61 @@ func New() Provider {
 	}
 }
 
+// For returns the provider used to sign and encrypt the messages of an
+// account.
+func (p *Providers) For(acct *config.AccountConfig) Provider {
+	if acct != nil && acct.CryptoProvider == "smime" {
+		return p.SMIME
+	}
+	return p.PGP
+}
+
+func (p *Providers) Decrypt(r io.Reader, decryptKeys openpgp.PromptFunction) (*models.MessageDetails, error) {
+	var buf bytes.Buffer
+	h, err := textproto.ReadHeader(bufio.NewReader(io.TeeReader(r, &buf)))
+	if err != nil {
+		return nil, err
+	}
+	r = io.MultiReader(&buf, r)
+	if smime.IsSMIME(h.Get("Content-Type")) {
+		return p.SMIME.Decrypt(r, decryptKeys)
+	}
+	return p.PGP.Decrypt(r, decryptKeys)
+}
+
+func (p *Providers) Encrypt(buf *bytes.Buffer, rcpts []string, signer string, decryptKeys openpgp.PromptFunction, header *mail.Header) (io.WriteCloser, error) {
+	return p.PGP.Encrypt(buf, rcpts, signer, decryptKeys, header)
+}
+
+func (p *Providers) Sign(buf *bytes.Buffer, signer string, decryptKeys openpgp.PromptFunction, header *mail.Header) (io.WriteCloser, error) {
+	return p.PGP.Sign(buf, signer, decryptKeys, header)
+}
+
+func (p *Providers) ImportKeys(r io.Reader) error {
+	return p.PGP.ImportKeys(r)
+}
+
+func (p *Providers) Init() error {
+	return errors.Join(p.PGP.Init(), p.SMIME.Init())
+}
+
+func (p *Providers) Close() {
+	p.PGP.Close()
+	p.SMIME.Close()
+}
+
+func (p *Providers) GetSignerKeyId(s string) (string, error) {
+	return p.PGP.GetSignerKeyId(s)
+}
+
+func (p *Providers) GetKeyId(s string) (string, error) {
+	return p.PGP.GetKeyId(s)
+}
+
+func (p *Providers) ExportKey(k string) (io.Reader, error) {
+	return p.PGP.ExportKey(k)
+}
+
 func IsEncrypted(bs *models.BodyStructure) bool {
 	if bs == nil {
 		return false
@@ -52,5 +128,10 @@ func IsEncrypted(bs *models.BodyStructure) bool {
 	if bs.MIMEType == "application" && bs.MIMESubType == "pgp-encrypted" {
 		return true
 	}
+	if bs.MIMEType == "application" &&
+		(bs.MIMESubType == "pkcs7-mime" || bs.MIMESubType == "x-pkcs7-mime") &&
+		!strings.EqualFold(bs.Params["smime-type"], "signed-data") {
+		return true
+	}
 	return slices.ContainsFunc(bs.Parts, IsEncrypted)
 }
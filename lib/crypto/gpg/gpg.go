@@ -6,6 +6,7 @@ import (
 	"os/exec"
 
 	"git.sr.ht/~rjarry/aerc/lib/crypto/gpg/gpgbin"
+	"git.sr.ht/~rjarry/aerc/lib/crypto/protected"
 	"git.sr.ht/~rjarry/aerc/models"
 	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/emersion/go-message/mail"
@@ -37,7 +38,12 @@ func (m *Mail) ImportKeys(r io.Reader) error {
 }
 
 func (m *Mail) Encrypt(buf *bytes.Buffer, rcpts []string, signer string, decryptKeys openpgp.PromptFunction, header *mail.Header) (io.WriteCloser, error) {
-	return Encrypt(buf, header.Header.Header, rcpts, signer)
+	h, protect := protected.Encrypt(header.Header.Header)
+	cleartext, err := Encrypt(buf, h, rcpts, signer)
+	if err != nil {
+		return nil, err
+	}
+	return protect(cleartext), nil
 }
 
 func (m *Mail) Sign(buf *bytes.Buffer, signer string, decryptKeys openpgp.PromptFunction, header *mail.Header) (io.WriteCloser, error) {
@@ -0,0 +1,183 @@
+// Package keylookup retrieves the public PGP keys of recipients from Web Key
+// Directories (WKD) and HKP keyservers.
+package keylookup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+// Key is a public key found for an e-mail address.
+type Key struct {
+	// Source is the lookup source where the key was found.
+	Source      string
+	Fingerprint string
+	UserId      string
+	// Data is the binary public key.
+	Data []byte
+}
+
+var ErrNotFound = errors.New("no key found")
+
+// Lookup tries each source in order and returns the first key found for
+// email. Sources are either:
+//
+//	wkd                  standard WKD lookup on the domain of the address
+//	http(s)://host[/path] WKD direct method rooted at the given URL
+//	hkp(s)://host[:port]  HKP keyserver
+func Lookup(ctx context.Context, sources []string, email string) (*Key, error) {
+	var errs []error
+	for _, source := range sources {
+		urls, err := lookupURLs(source, email)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, u := range urls {
+			data, err := fetch(ctx, u)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			key, err := parse(data, email)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", u, err))
+				continue
+			}
+			key.Source = source
+			return key, nil
+		}
+	}
+	if len(errs) == 0 {
+		return nil, ErrNotFound
+	}
+	return nil, errors.Join(errs...)
+}
+
+func lookupURLs(source, email string) ([]string, error) {
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || local == "" || domain == "" {
+		return nil, fmt.Errorf("invalid address %q", email)
+	}
+	domain = strings.ToLower(domain)
+	hash := wkdHash(local)
+	query := "?l=" + url.QueryEscape(local)
+
+	if source == "wkd" {
+		return []string{
+			fmt.Sprintf("https://openpgpkey.%s/.well-known/openpgpkey/%s/hu/%s%s",
+				domain, domain, hash, query),
+			fmt.Sprintf("https://%s/.well-known/openpgpkey/hu/%s%s",
+				domain, hash, query),
+		}, nil
+	}
+
+	u, err := url.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https":
+		u.Path = strings.TrimSuffix(u.Path, "/") +
+			"/.well-known/openpgpkey/hu/" + hash
+		u.RawQuery = "l=" + url.QueryEscape(local)
+	case "hkp", "hkps":
+		if u.Scheme == "hkp" {
+			u.Scheme = "http"
+			if u.Port() == "" {
+				u.Host += ":11371"
+			}
+		} else {
+			u.Scheme = "https"
+		}
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/pks/lookup"
+		u.RawQuery = url.Values{
+			"op":      {"get"},
+			"options": {"mr"},
+			"search":  {email},
+		}.Encode()
+	default:
+		return nil, fmt.Errorf("unsupported key lookup source %q", source)
+	}
+	return []string{u.String()}, nil
+}
+
+// wkdHash returns the z-base-32 encoded SHA-1 digest of the lower case local
+// part of an address.
+func wkdHash(local string) string {
+	const alphabet = "ybndrfg8ejkmcpqxot1uwisza345h769"
+	sum := sha1.Sum([]byte(strings.ToLower(local)))
+	var b strings.Builder
+	var acc, bits uint
+	for _, c := range sum {
+		acc = acc<<8 | uint(c)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			b.WriteByte(alphabet[(acc>>bits)&0x1f])
+		}
+	}
+	if bits > 0 {
+		b.WriteByte(alphabet[(acc<<(5-bits))&0x1f])
+	}
+	return b.String()
+}
+
+func fetch(ctx context.Context, u string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", u, res.Status)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, 1<<20))
+}
+
+// parse returns the first key of data with a user id matching email.
+func parse(data []byte, email string) (*Key, error) {
+	var entities openpgp.EntityList
+	var err error
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN")) {
+		entities, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	} else {
+		entities, err = openpgp.ReadKeyRing(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entities {
+		for _, id := range e.Identities {
+			if !strings.EqualFold(id.UserId.Email, email) {
+				continue
+			}
+			var buf bytes.Buffer
+			if err := e.Serialize(&buf); err != nil {
+				return nil, err
+			}
+			return &Key{
+				Fingerprint: fmt.Sprintf("%X", e.PrimaryKey.Fingerprint),
+				UserId:      id.Name,
+				Data:        buf.Bytes(),
+			}, nil
+		}
+	}
+	return nil, ErrNotFound
+}
@@ -0,0 +1,84 @@
+package keylookup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+func TestWKDHash(t *testing.T) {
+	// example from draft-koch-openpgp-webkey-service
+	if h := wkdHash("Joe.Doe"); h != "iy9q119eutrkn8s1mk4r39qejnbu3n5q" {
+		t.Errorf("unexpected hash %q", h)
+	}
+}
+
+func newKey(t *testing.T, email string) (*openpgp.Entity, []byte) {
+	t.Helper()
+	e, err := openpgp.NewEntity("Joe Doe", "", email, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := e.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return e, buf.Bytes()
+}
+
+func TestLookup(t *testing.T) {
+	const email = "Joe.Doe@example.org"
+	e, key := newKey(t, "joe.doe@example.org")
+	var armored bytes.Buffer
+	w, err := armor.Encode(&armored, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.Write(key)
+	w.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/wkd/.well-known/openpgpkey/hu/iy9q119eutrkn8s1mk4r39qejnbu3n5q",
+		func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(key)
+		})
+	mux.HandleFunc("/pks/lookup", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("op") != "get" || r.FormValue("search") != email {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(armored.Bytes())
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	hkp := strings.Replace(srv.URL, "http://", "hkp://", 1)
+	fpr := fmt.Sprintf("%X", e.PrimaryKey.Fingerprint)
+
+	for _, sources := range [][]string{
+		{srv.URL + "/wkd"},
+		{srv.URL + "/nowhere", hkp},
+	} {
+		k, err := Lookup(context.Background(), sources, email)
+		if err != nil {
+			t.Fatalf("%v: %v", sources, err)
+		}
+		if k.Fingerprint != fpr || k.UserId != "Joe Doe <joe.doe@example.org>" ||
+			k.Source != sources[len(sources)-1] {
+			t.Errorf("%v: unexpected key %#v", sources, k)
+		}
+		if _, err := openpgp.ReadKeyRing(bytes.NewReader(k.Data)); err != nil {
+			t.Errorf("%v: %v", sources, err)
+		}
+	}
+
+	if _, err := Lookup(context.Background(), []string{hkp}, "other@example.org"); err == nil {
+		t.Error("expected lookup to fail")
+	}
+}
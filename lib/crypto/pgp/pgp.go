@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"git.sr.ht/~rjarry/aerc/lib/crypto/protected"
 	"git.sr.ht/~rjarry/aerc/lib/log"
 	"git.sr.ht/~rjarry/aerc/lib/xdg"
 	"git.sr.ht/~rjarry/aerc/models"
@@ -200,12 +201,12 @@ func (m *Mail) Encrypt(buf *bytes.Buffer, rcpts []string, signer string, decrypt
 		to = append(to, toEntity)
 	}
 
-	cleartext, err := pgpmail.Encrypt(buf, header.Header.Header,
-		to, signerEntity, nil)
+	h, protect := protected.Encrypt(header.Header.Header)
+	cleartext, err := pgpmail.Encrypt(buf, h, to, signerEntity, nil)
 	if err != nil {
 		return nil, err
 	}
-	return cleartext, nil
+	return protect(cleartext), nil
 }
 
 func (m *Mail) Sign(buf *bytes.Buffer, signer string, decryptKeys openpgp.PromptFunction, header *mail.Header) (io.WriteCloser, error) {
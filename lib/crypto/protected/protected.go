@@ -0,0 +1,101 @@
+// Package protected implements the Protected Headers for Cryptographic
+// E-mail scheme (draft-autocrypt-lamps-protected-headers): the headers of an
+// encrypted message are copied in the encrypted part and the outer Subject
+// is replaced with a placeholder.
+package protected
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mime"
+
+	"github.com/emersion/go-message/mail"
+	"github.com/emersion/go-message/textproto"
+)
+
+// Placeholder replaces the Subject of the outer header of encrypted messages.
+const Placeholder = "..."
+
+// Headers are the header fields copied in the encrypted part.
+var Headers = []string{
+	"Subject", "From", "To", "Cc", "Reply-To", "Date",
+	"Message-Id", "In-Reply-To", "References",
+}
+
+type writer struct {
+	buf   bytes.Buffer
+	inner textproto.Header
+	w     io.WriteCloser
+}
+
+// Encrypt obscures the Subject of the outer header h of an encrypted
+// message. It returns a copy of h to pass to the encrypter and a wrapper
+// around the cleartext writer returned by the encrypter that adds the
+// original headers to the header of the encrypted part.
+func Encrypt(h textproto.Header) (
+	textproto.Header, func(io.WriteCloser) io.WriteCloser,
+) {
+	var inner textproto.Header
+	for _, key := range Headers {
+		values := h.Values(key)
+		for i := len(values) - 1; i >= 0; i-- {
+			inner.Add(key, values[i])
+		}
+	}
+	outer := h.Copy()
+	if outer.Has("Subject") {
+		outer.Set("Subject", Placeholder)
+	}
+	return outer, func(w io.WriteCloser) io.WriteCloser {
+		return &writer{inner: inner, w: w}
+	}
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *writer) Close() error {
+	r := bufio.NewReader(&w.buf)
+	h, err := textproto.ReadHeader(r)
+	if err != nil {
+		return err
+	}
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+	params["protected-headers"] = "v1"
+	h.Set("Content-Type", mime.FormatMediaType(mediaType, params))
+	for _, key := range Headers {
+		values := w.inner.Values(key)
+		for i := len(values) - 1; i >= 0; i-- {
+			h.Add(key, values[i])
+		}
+	}
+	if err := textproto.WriteHeader(w.w, h); err != nil {
+		return err
+	}
+	if _, err := io.Copy(w.w, r); err != nil {
+		return err
+	}
+	return w.w.Close()
+}
+
+// Unwrap returns the protected headers of the header of a decrypted part, or
+// nil if it has none.
+func Unwrap(h textproto.Header) *mail.Header {
+	_, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil || params["protected-headers"] == "" {
+		return nil
+	}
+	var protected mail.Header
+	for _, key := range Headers {
+		values := h.Values(key)
+		for i := len(values) - 1; i >= 0; i-- {
+			protected.Add(key, values[i])
+		}
+	}
+	return &protected
+}
@@ -0,0 +1,74 @@
+package protected
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-message/textproto"
+)
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+func TestEncryptUnwrap(t *testing.T) {
+	var h textproto.Header
+	h.Set("Subject", "secret plans")
+	h.Set("From", "alice@example.org")
+	h.Add("To", "carol@example.org")
+	h.Add("To", "bob@example.org")
+	h.Set("X-Mailer", "aerc")
+
+	outer, protect := Encrypt(h)
+	if s := h.Get("Subject"); s != "secret plans" {
+		t.Errorf("original header modified: %q", s)
+	}
+	if s := outer.Get("Subject"); s != Placeholder {
+		t.Errorf("unexpected outer subject %q", s)
+	}
+
+	var buf bytes.Buffer
+	w := protect(nopCloser{&buf})
+	_, _ = io.WriteString(w,
+		"Content-Type: text/plain; charset=UTF-8\r\n\r\nHello!\r\n")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := bufio.NewReader(&buf)
+	inner, err := textproto.ReadHeader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := inner.Get("Content-Type"); !strings.Contains(ct, `protected-headers=v1`) {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	if inner.Has("X-Mailer") {
+		t.Error("unexpected X-Mailer in protected headers")
+	}
+	if body, _ := io.ReadAll(r); string(body) != "Hello!\r\n" {
+		t.Errorf("unexpected body %q", body)
+	}
+
+	ph := Unwrap(inner)
+	if ph == nil {
+		t.Fatal("no protected headers")
+	}
+	if s, _ := ph.Subject(); s != "secret plans" {
+		t.Errorf("unexpected protected subject %q", s)
+	}
+	to := ph.Values("To")
+	if len(to) != 2 || to[0] != "bob@example.org" || to[1] != "carol@example.org" {
+		t.Errorf("unexpected protected To %v", to)
+	}
+
+	var plain textproto.Header
+	plain.Set("Content-Type", "text/plain")
+	plain.Set("Subject", "not protected")
+	if Unwrap(plain) != nil {
+		t.Error("unexpected protected headers")
+	}
+}
@@ -0,0 +1,772 @@
+package smime
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"slices"
+	"time"
+)
+
+// Minimal implementation of the PKCS#7/CMS structures used by S/MIME (RFC
+// 5652): detached and opaque signed data and RSA enveloped data.
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidEnvelopedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+
+	oidAttributeContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttributeMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttributeSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSHA1WithRSA     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}
+	oidSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSHA384WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSHA512WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidECPublicKey     = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidECDSAWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+
+	oidAES128CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+var (
+	errUnknownSigner = errors.New("smime: signer certificate not found")
+	errNoKey         = errors.New("smime: no private key to decrypt message")
+	// reported for every decryption failure to avoid giving hints about the
+	// padding or the content encryption key
+	errDecrypt = errors.New("smime: message decryption failed")
+)
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+// rawContent holds an optional implicitly tagged element verbatim.
+type rawContent struct {
+	Raw asn1.RawContent
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      contentInfo
+	Certificates     rawContent   `asn1:"optional,tag:0"`
+	CRLs             rawContent   `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo `asn1:"set"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        rawContent `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      rawContent `asn1:"optional,tag:1"`
+}
+
+type issuerAndSerial struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type attribute struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+type envelopedData struct {
+	Version              int
+	OriginatorInfo       rawContent      `asn1:"optional,tag:0"`
+	RecipientInfos       []asn1.RawValue `asn1:"set"`
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type keyTransRecipientInfo struct {
+	Version                int
+	RID                    asn1.RawValue
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedKey           []byte
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           asn1.RawValue `asn1:"optional"`
+}
+
+// identity is a certificate with its private key.
+type identity struct {
+	cert  *x509.Certificate
+	key   crypto.PrivateKey
+	chain []*x509.Certificate
+}
+
+// signature is the result of the verification of a signed data structure.
+type signature struct {
+	signer      *x509.Certificate
+	certs       []*x509.Certificate
+	signingTime time.Time
+	micalg      string
+	// embedded content of opaque signatures
+	content []byte
+}
+
+func explicit(tag int, b []byte) asn1.RawValue {
+	return asn1.RawValue{
+		Class: asn1.ClassContextSpecific, Tag: tag,
+		IsCompound: true, Bytes: b,
+	}
+}
+
+func sid(cert *x509.Certificate) (asn1.RawValue, error) {
+	b, err := asn1.Marshal(issuerAndSerial{
+		Issuer:       asn1.RawValue{FullBytes: cert.RawIssuer},
+		SerialNumber: cert.SerialNumber,
+	})
+	return asn1.RawValue{FullBytes: b}, err
+}
+
+// matchesSID returns true if the signer or recipient identifier designates
+// cert, either by issuer and serial number or by subject key identifier.
+func matchesSID(id asn1.RawValue, cert *x509.Certificate) bool {
+	if id.Class == asn1.ClassContextSpecific && id.Tag == 0 {
+		return len(cert.SubjectKeyId) > 0 &&
+			bytes.Equal(id.Bytes, cert.SubjectKeyId)
+	}
+	var ias issuerAndSerial
+	if _, err := asn1.Unmarshal(id.FullBytes, &ias); err != nil {
+		return false
+	}
+	return bytes.Equal(ias.Issuer.FullBytes, cert.RawIssuer) &&
+		ias.SerialNumber.Cmp(cert.SerialNumber) == 0
+}
+
+// octets returns the contents of a possibly constructed OCTET STRING.
+func octets(v asn1.RawValue) ([]byte, error) {
+	if !v.IsCompound {
+		return v.Bytes, nil
+	}
+	var content []byte
+	rest := v.Bytes
+	for len(rest) > 0 {
+		var chunk asn1.RawValue
+		var err error
+		rest, err = asn1.Unmarshal(rest, &chunk)
+		if err != nil {
+			return nil, err
+		}
+		b, err := octets(chunk)
+		if err != nil {
+			return nil, err
+		}
+		content = append(content, b...)
+	}
+	return content, nil
+}
+
+func parseContentInfo(der []byte) (*contentInfo, error) {
+	der, err := ber2der(der)
+	if err != nil {
+		return nil, err
+	}
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, fmt.Errorf("smime: invalid content info: %w", err)
+	}
+	return &ci, nil
+}
+
+func digestAlgorithm(oid asn1.ObjectIdentifier) (crypto.Hash, string, error) {
+	switch {
+	case oid.Equal(oidSHA1):
+		return crypto.SHA1, "sha-1", nil
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, "sha-256", nil
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, "sha-384", nil
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, "sha-512", nil
+	}
+	return 0, "", fmt.Errorf("smime: unsupported digest algorithm %s", oid)
+}
+
+func newHash(h crypto.Hash) hash.Hash {
+	switch h {
+	case crypto.SHA1:
+		return sha1.New()
+	case crypto.SHA384:
+		return sha512.New384()
+	case crypto.SHA512:
+		return sha512.New()
+	}
+	return sha256.New()
+}
+
+func signatureAlgorithm(
+	h crypto.Hash, alg asn1.ObjectIdentifier,
+) (x509.SignatureAlgorithm, error) {
+	switch {
+	case alg.Equal(oidRSAEncryption) || alg.Equal(oidSHA1WithRSA) ||
+		alg.Equal(oidSHA256WithRSA) || alg.Equal(oidSHA384WithRSA) ||
+		alg.Equal(oidSHA512WithRSA):
+		switch h {
+		case crypto.SHA1:
+			return x509.SHA1WithRSA, nil
+		case crypto.SHA256:
+			return x509.SHA256WithRSA, nil
+		case crypto.SHA384:
+			return x509.SHA384WithRSA, nil
+		case crypto.SHA512:
+			return x509.SHA512WithRSA, nil
+		}
+	case alg.Equal(oidECPublicKey) || alg.Equal(oidECDSAWithSHA1) ||
+		alg.Equal(oidECDSAWithSHA256) || alg.Equal(oidECDSAWithSHA384) ||
+		alg.Equal(oidECDSAWithSHA512):
+		switch h {
+		case crypto.SHA1:
+			return x509.ECDSAWithSHA1, nil
+		case crypto.SHA256:
+			return x509.ECDSAWithSHA256, nil
+		case crypto.SHA384:
+			return x509.ECDSAWithSHA384, nil
+		case crypto.SHA512:
+			return x509.ECDSAWithSHA512, nil
+		}
+	}
+	return 0, fmt.Errorf("smime: unsupported signature algorithm %s", alg)
+}
+
+func parseAttributes(raw []byte) ([]attribute, error) {
+	var set asn1.RawValue
+	if _, err := asn1.Unmarshal(raw, &set); err != nil {
+		return nil, err
+	}
+	var attrs []attribute
+	rest := set.Bytes
+	for len(rest) > 0 {
+		var attr attribute
+		var err error
+		rest, err = asn1.Unmarshal(rest, &attr)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, attr)
+	}
+	return attrs, nil
+}
+
+// attributeValue returns the first value of the SET of values of an
+// attribute.
+func attributeValue(attrs []attribute, oid asn1.ObjectIdentifier) []byte {
+	for _, attr := range attrs {
+		if attr.Type.Equal(oid) {
+			var v asn1.RawValue
+			if _, err := asn1.Unmarshal(attr.Value.Bytes, &v); err == nil {
+				return v.FullBytes
+			}
+		}
+	}
+	return nil
+}
+
+// verify checks a signed data structure against the detached content or
+// its embedded content. The certificates of the message are looked up
+// before the known ones to find the signer. When it cannot be found,
+// errUnknownSigner is returned along with the embedded content.
+func verify(der []byte, content []byte, known []*x509.Certificate) (*signature, error) {
+	ci, err := parseContentInfo(der)
+	if err != nil {
+		return nil, err
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("smime: not signed data: %s", ci.ContentType)
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("smime: invalid signed data: %w", err)
+	}
+	if len(sd.SignerInfos) == 0 {
+		return nil, errors.New("smime: no signer information")
+	}
+	sig := &signature{}
+	if len(sd.Certificates.Raw) > 0 {
+		var certs asn1.RawValue
+		if _, err := asn1.Unmarshal(sd.Certificates.Raw, &certs); err != nil {
+			return nil, err
+		}
+		sig.certs, err = x509.ParseCertificates(certs.Bytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if content == nil {
+		// the explicit [0] tagging is kept in the raw value
+		var econtent asn1.RawValue
+		_, err := asn1.Unmarshal(sd.ContentInfo.Content.Bytes, &econtent)
+		if err != nil {
+			return nil, errors.New("smime: signed content not found")
+		}
+		sig.content, err = octets(econtent)
+		if err != nil {
+			return nil, err
+		}
+		content = sig.content
+	}
+
+	si := sd.SignerInfos[0]
+	for _, cert := range slices.Concat(sig.certs, known) {
+		if matchesSID(si.SID, cert) {
+			sig.signer = cert
+			break
+		}
+	}
+	if sig.signer == nil {
+		return sig, errUnknownSigner
+	}
+	h, micalg, err := digestAlgorithm(si.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return sig, err
+	}
+	sig.micalg = micalg
+	alg, err := signatureAlgorithm(h, si.SignatureAlgorithm.Algorithm)
+	if err != nil {
+		return sig, err
+	}
+	signed := content
+	if len(si.SignedAttrs.Raw) > 0 {
+		attrs, err := parseAttributes(si.SignedAttrs.Raw)
+		if err != nil {
+			return sig, err
+		}
+		var digest []byte
+		v := attributeValue(attrs, oidAttributeMessageDigest)
+		if _, err := asn1.Unmarshal(v, &digest); err != nil {
+			return sig, errors.New("smime: missing message digest")
+		}
+		hash := newHash(h)
+		hash.Write(content)
+		if !bytes.Equal(digest, hash.Sum(nil)) {
+			return sig, errors.New("smime: message digest mismatch")
+		}
+		if v := attributeValue(attrs, oidAttributeSigningTime); v != nil {
+			_, _ = asn1.Unmarshal(v, &sig.signingTime)
+		}
+		// the signature is computed on the DER encoding of the SET
+		// of attributes and not on their implicit [0] tagging
+		signed = append([]byte{0x31}, si.SignedAttrs.Raw[1:]...)
+	}
+	err = sig.signer.CheckSignature(alg, signed, si.Signature)
+	if err != nil {
+		return sig, fmt.Errorf("smime: %w", err)
+	}
+	return sig, nil
+}
+
+// sign creates a detached signature of content. The certificate chain of
+// the signer is included so that recipients can verify it.
+func sign(content []byte, id *identity) ([]byte, error) {
+	signer, ok := id.key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("smime: unsupported private key type")
+	}
+	var sigAlg pkix.AlgorithmIdentifier
+	switch signer.Public().(type) {
+	case *rsa.PublicKey:
+		sigAlg.Algorithm = oidRSAEncryption
+		sigAlg.Parameters = asn1.NullRawValue
+	case *ecdsa.PublicKey:
+		sigAlg.Algorithm = oidECDSAWithSHA256
+	default:
+		return nil, errors.New("smime: unsupported private key type")
+	}
+	digest := sha256.Sum256(content)
+
+	var attrs [][]byte
+	for _, a := range []struct {
+		oid   asn1.ObjectIdentifier
+		value any
+	}{
+		{oidAttributeContentType, oidData},
+		{oidAttributeSigningTime, time.Now().UTC()},
+		{oidAttributeMessageDigest, digest[:]},
+	} {
+		v, err := asn1.Marshal(a.value)
+		if err != nil {
+			return nil, err
+		}
+		attr, err := asn1.Marshal(attribute{
+			Type: a.oid,
+			Value: asn1.RawValue{
+				Tag: asn1.TagSet, IsCompound: true, Bytes: v,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, attr)
+	}
+	// DER requires the elements of a SET OF to be sorted
+	slices.SortFunc(attrs, bytes.Compare)
+	signedAttrs, err := asn1.Marshal(asn1.RawValue{
+		Tag: asn1.TagSet, IsCompound: true, Bytes: bytes.Join(attrs, nil),
+	})
+	if err != nil {
+		return nil, err
+	}
+	hashed := sha256.Sum256(signedAttrs)
+	sig, err := signer.Sign(rand.Reader, hashed[:], crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("smime: %w", err)
+	}
+
+	signerID, err := sid(id.cert)
+	if err != nil {
+		return nil, err
+	}
+	var certs []byte
+	for _, cert := range append([]*x509.Certificate{id.cert}, id.chain...) {
+		certs = append(certs, cert.Raw...)
+	}
+	rawCerts, err := asn1.Marshal(explicit(0, certs))
+	if err != nil {
+		return nil, err
+	}
+	sha256Alg := pkix.AlgorithmIdentifier{
+		Algorithm: oidSHA256, Parameters: asn1.NullRawValue,
+	}
+	sd, err := asn1.Marshal(signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256Alg},
+		ContentInfo:      contentInfo{ContentType: oidData},
+		Certificates:     rawContent{Raw: rawCerts},
+		SignerInfos: []signerInfo{{
+			Version:         1,
+			SID:             signerID,
+			DigestAlgorithm: sha256Alg,
+			SignedAttrs: rawContent{
+				Raw: append([]byte{0xa0}, signedAttrs[1:]...),
+			},
+			SignatureAlgorithm: sigAlg,
+			Signature:          sig,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     explicit(0, sd),
+	})
+}
+
+// encrypt encrypts content with AES-256-CBC for the given recipients.
+func encrypt(content []byte, recipients []*x509.Certificate) ([]byte, error) {
+	key := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	padding := aes.BlockSize - len(content)%aes.BlockSize
+	ciphertext := append(bytes.Clone(content),
+		bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, ciphertext)
+
+	var infos []asn1.RawValue
+	for _, cert := range recipients {
+		pub, ok := cert.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf(
+				"smime: unsupported key type for %s", certName(cert))
+		}
+		encryptedKey, err := rsa.EncryptPKCS1v15(rand.Reader, pub, key)
+		if err != nil {
+			return nil, err
+		}
+		rid, err := sid(cert)
+		if err != nil {
+			return nil, err
+		}
+		info, err := asn1.Marshal(keyTransRecipientInfo{
+			RID: rid,
+			KeyEncryptionAlgorithm: pkix.AlgorithmIdentifier{
+				Algorithm:  oidRSAEncryption,
+				Parameters: asn1.NullRawValue,
+			},
+			EncryptedKey: encryptedKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, asn1.RawValue{FullBytes: info})
+	}
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	ed, err := asn1.Marshal(envelopedData{
+		RecipientInfos: infos,
+		EncryptedContentInfo: encryptedContentInfo{
+			ContentType: oidData,
+			ContentEncryptionAlgorithm: pkix.AlgorithmIdentifier{
+				Algorithm:  oidAES256CBC,
+				Parameters: asn1.RawValue{FullBytes: ivParam},
+			},
+			EncryptedContent: asn1.RawValue{
+				Class: asn1.ClassContextSpecific, Tag: 0,
+				Bytes: ciphertext,
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: oidEnvelopedData,
+		Content:     explicit(0, ed),
+	})
+}
+
+// decrypt decrypts an enveloped data structure with the first identity
+// that is one of its recipients.
+func decrypt(der []byte, ids []*identity) ([]byte, *identity, error) {
+	ci, err := parseContentInfo(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ci.ContentType.Equal(oidEnvelopedData) {
+		return nil, nil, fmt.Errorf("smime: not enveloped data: %s", ci.ContentType)
+	}
+	var ed envelopedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &ed); err != nil {
+		return nil, nil, fmt.Errorf("smime: invalid enveloped data: %w", err)
+	}
+	var key []byte
+	var recipient *identity
+	for _, raw := range ed.RecipientInfos {
+		var ktri keyTransRecipientInfo
+		if _, err := asn1.Unmarshal(raw.FullBytes, &ktri); err != nil {
+			// other key management techniques are not supported
+			continue
+		}
+		for _, id := range ids {
+			if !matchesSID(ktri.RID, id.cert) {
+				continue
+			}
+			priv, ok := id.key.(*rsa.PrivateKey)
+			if !ok {
+				continue
+			}
+			key, err = rsa.DecryptPKCS1v15(rand.Reader, priv, ktri.EncryptedKey)
+			if err != nil {
+				return nil, nil, errDecrypt
+			}
+			recipient = id
+			break
+		}
+		if recipient != nil {
+			break
+		}
+	}
+	if recipient == nil {
+		return nil, nil, errNoKey
+	}
+
+	eci := ed.EncryptedContentInfo
+	alg := eci.ContentEncryptionAlgorithm
+	var block cipher.Block
+	switch {
+	case alg.Algorithm.Equal(oidAES128CBC), alg.Algorithm.Equal(oidAES192CBC),
+		alg.Algorithm.Equal(oidAES256CBC):
+		block, err = aes.NewCipher(key)
+	case alg.Algorithm.Equal(oidDESEDE3CBC):
+		block, err = des.NewTripleDESCipher(key)
+	default:
+		return nil, nil, fmt.Errorf(
+			"smime: unsupported content encryption algorithm %s",
+			alg.Algorithm)
+	}
+	if err != nil {
+		// wrong size of the decrypted key
+		return nil, nil, errDecrypt
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(alg.Parameters.FullBytes, &iv); err != nil ||
+		len(iv) != block.BlockSize() {
+		return nil, nil, errors.New("smime: invalid initialization vector")
+	}
+	ciphertext, err := octets(eci.EncryptedContent)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(ciphertext) == 0 || len(ciphertext)%block.BlockSize() != 0 {
+		return nil, nil, errDecrypt
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+	plaintext, ok := unpad(plaintext, block.BlockSize())
+	if !ok {
+		return nil, nil, errDecrypt
+	}
+	return plaintext, recipient, nil
+}
+
+// unpad removes the PKCS#7 padding of a decrypted content. All padding bytes
+// are checked, in constant time.
+func unpad(b []byte, blockSize int) ([]byte, bool) {
+	if len(b) < blockSize {
+		return nil, false
+	}
+	n := b[len(b)-1]
+	good := subtle.ConstantTimeLessOrEq(1, int(n)) &
+		subtle.ConstantTimeLessOrEq(int(n), blockSize)
+	for i := 1; i <= blockSize; i++ {
+		// only the last n bytes are padding
+		inPadding := subtle.ConstantTimeLessOrEq(i, int(n))
+		match := subtle.ConstantTimeByteEq(b[len(b)-i], n)
+		good &= match | (1 ^ inPadding)
+	}
+	if good != 1 {
+		return nil, false
+	}
+	return b[:len(b)-int(n)], true
+}
+
+// ber2der converts the indefinite lengths of a BER encoding to definite
+// lengths so that it can be parsed by encoding/asn1. Other BER encodings
+// such as constructed strings are left as is.
+func ber2der(ber []byte) ([]byte, error) {
+	der, rest, err := convertBER(ber)
+	if err != nil {
+		return nil, fmt.Errorf("smime: invalid encoding: %w", err)
+	}
+	if len(bytes.Trim(rest, "\x00")) > 0 {
+		return nil, errors.New("smime: trailing data after content")
+	}
+	return der, nil
+}
+
+func convertBER(b []byte) ([]byte, []byte, error) {
+	if len(b) < 2 {
+		return nil, nil, errors.New("truncated element")
+	}
+	tagLen := 1
+	if b[0]&0x1f == 0x1f {
+		for tagLen < len(b) && b[tagLen]&0x80 != 0 {
+			tagLen++
+		}
+		tagLen++
+		if tagLen >= len(b) {
+			return nil, nil, errors.New("truncated tag")
+		}
+	}
+	tag := b[:tagLen]
+	constructed := b[0]&0x20 != 0
+	b = b[tagLen:]
+	if len(b) == 0 {
+		return nil, nil, errors.New("truncated length")
+	}
+
+	var body []byte
+	switch {
+	case b[0] == 0x80:
+		if !constructed {
+			return nil, nil, errors.New("indefinite length primitive")
+		}
+		b = b[1:]
+		for {
+			if len(b) >= 2 && b[0] == 0 && b[1] == 0 {
+				b = b[2:]
+				break
+			}
+			child, rest, err := convertBER(b)
+			if err != nil {
+				return nil, nil, err
+			}
+			body = append(body, child...)
+			b = rest
+		}
+	default:
+		length := int(b[0])
+		b = b[1:]
+		if length&0x80 != 0 {
+			n := length & 0x7f
+			if n > 4 || n > len(b) {
+				return nil, nil, errors.New("invalid length")
+			}
+			length = 0
+			for _, c := range b[:n] {
+				length = length<<8 | int(c)
+			}
+			b = b[n:]
+		}
+		if length > len(b) {
+			return nil, nil, errors.New("truncated element")
+		}
+		content := b[:length]
+		b = b[length:]
+		if !constructed {
+			body = content
+			break
+		}
+		for len(content) > 0 {
+			child, rest, err := convertBER(content)
+			if err != nil {
+				return nil, nil, err
+			}
+			body = append(body, child...)
+			content = rest
+		}
+	}
+
+	der := append(bytes.Clone(tag), encodeLength(len(body))...)
+	return append(der, body...), b, nil
+}
+
+func encodeLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
@@ -0,0 +1,190 @@
+package smime
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+
+	"git.sr.ht/~rjarry/aerc/models"
+	"github.com/emersion/go-message"
+	"github.com/emersion/go-message/mail"
+	"github.com/emersion/go-message/textproto"
+)
+
+type Reader struct {
+	Header         textproto.Header
+	MessageDetails *models.MessageDetails
+}
+
+func isPKCS7Mime(t string) bool {
+	return strings.EqualFold(t, "application/pkcs7-mime") ||
+		strings.EqualFold(t, "application/x-pkcs7-mime")
+}
+
+func isPKCS7Signature(t string) bool {
+	return strings.EqualFold(t, "application/pkcs7-signature") ||
+		strings.EqualFold(t, "application/x-pkcs7-signature")
+}
+
+// IsSMIME returns true if the value of a Content-Type header designates an
+// S/MIME signed or encrypted entity.
+func IsSMIME(contentType string) bool {
+	t, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return isPKCS7Mime(t) || (strings.EqualFold(t, "multipart/signed") &&
+		isPKCS7Signature(params["protocol"]))
+}
+
+// NewReader reads an S/MIME entity. The signatures are checked against the
+// From address of h.
+func (m *Mail) NewReader(h textproto.Header, body io.Reader) (*Reader, error) {
+	return m.newReader(h, body, sender(h))
+}
+
+// sender returns the address of the From header of h, if any.
+func sender(h textproto.Header) string {
+	addrs, err := (&mail.Header{Header: message.Header{Header: h}}).AddressList("From")
+	if err != nil || len(addrs) == 0 {
+		return ""
+	}
+	return addrs[0].Address
+}
+
+func (m *Mail) newReader(h textproto.Header, body io.Reader, from string) (*Reader, error) {
+	t, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+
+	if isPKCS7Mime(t) {
+		der, err := io.ReadAll(decode(h, body))
+		if err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(params["smime-type"], "signed-data") {
+			return m.newOpaqueSignedReader(h, der, from)
+		}
+		return m.newEncryptedReader(h, der, from)
+	}
+	if strings.EqualFold(t, "multipart/signed") && isPKCS7Signature(params["protocol"]) {
+		mr := textproto.NewMultipartReader(body, params["boundary"])
+		return m.newSignedReader(h, mr, params["micalg"], from)
+	}
+
+	var headerBuf bytes.Buffer
+	_ = textproto.WriteHeader(&headerBuf, h)
+
+	return &Reader{
+		Header: h,
+		MessageDetails: &models.MessageDetails{
+			Body: io.MultiReader(&headerBuf, body),
+		},
+	}, nil
+}
+
+func Read(r io.Reader, m *Mail) (*Reader, error) {
+	br := bufio.NewReader(r)
+
+	h, err := textproto.ReadHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	return m.NewReader(h, br)
+}
+
+// decode returns the body of an entity with its transfer encoding decoded.
+func decode(h textproto.Header, body io.Reader) io.Reader {
+	entity, err := message.New(message.Header{Header: h}, body)
+	if err != nil {
+		return body
+	}
+	return entity.Body
+}
+
+func (m *Mail) newEncryptedReader(h textproto.Header, der []byte, from string) (*Reader, error) {
+	plaintext, recipient, err := decrypt(der, m.ids)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(bytes.NewReader(plaintext))
+	var inner *Reader
+	innerHeader, err := textproto.ReadHeader(br)
+	if err == nil {
+		if from == "" {
+			from = sender(innerHeader)
+		}
+		inner, err = m.newReader(innerHeader, br, from)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("smime: failed to read decrypted message: %w", err)
+	}
+	md := inner.MessageDetails
+	md.IsEncrypted = true
+	md.DecryptedWith = certName(recipient.cert)
+	md.DecryptedWithKeyId = keyId(recipient.cert)
+	return &Reader{
+		Header:         h,
+		MessageDetails: md,
+	}, nil
+}
+
+func (m *Mail) newOpaqueSignedReader(h textproto.Header, der []byte, from string) (*Reader, error) {
+	sig, err := verify(der, nil, m.certs)
+	if sig == nil || sig.content == nil {
+		return nil, err
+	}
+	md := m.details(sig, err, from)
+	md.Body = bytes.NewReader(sig.content)
+	return &Reader{
+		Header:         h,
+		MessageDetails: md,
+	}, nil
+}
+
+func (m *Mail) newSignedReader(
+	h textproto.Header, mr *textproto.MultipartReader, micalg string, from string,
+) (*Reader, error) {
+	p, err := mr.NextPart()
+	if err != nil {
+		return nil, fmt.Errorf("smime: failed to read signed part in multipart/signed message: %w", err)
+	}
+	var msg bytes.Buffer
+	_ = textproto.WriteHeader(&msg, p.Header)
+	if _, err := io.Copy(&msg, p); err != nil {
+		return nil, err
+	}
+
+	p, err = mr.NextPart()
+	if err != nil {
+		return nil, fmt.Errorf("smime: failed to read signature part in multipart/signed message: %w", err)
+	}
+	der, err := io.ReadAll(decode(p.Header, p))
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := verify(der, msg.Bytes(), m.certs)
+	if sig == nil {
+		return nil, err
+	}
+	md := m.details(sig, err, from)
+	micalg = strings.ReplaceAll(strings.ToLower(micalg), "-", "")
+	if md.SignatureError == "" && micalg != "" &&
+		micalg != strings.ReplaceAll(md.Micalg, "-", "") {
+		md.SignatureValidity = models.MicalgMismatch
+		md.SignatureError = errMicalgMismatch.Error()
+	}
+	md.Body = &msg
+	return &Reader{
+		Header:         h,
+		MessageDetails: md,
+	}, nil
+}
+
+var errMicalgMismatch = errors.New("smime: header hash does not match actual sig hash")
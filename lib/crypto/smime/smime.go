@@ -0,0 +1,467 @@
+package smime
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"git.sr.ht/~rjarry/aerc/config"
+	"git.sr.ht/~rjarry/aerc/lib/log"
+	"git.sr.ht/~rjarry/aerc/lib/xdg"
+	"git.sr.ht/~rjarry/aerc/models"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/emersion/go-message/mail"
+	pkcs12 "software.sslmate.com/src/go-pkcs12"
+)
+
+// Mail implements the crypto provider interface with S/MIME certificates
+// read from a local store directory.
+type Mail struct {
+	// directory containing the certificates and private keys
+	Dir string
+
+	certs []*x509.Certificate
+	ids   []*identity
+}
+
+func (m *Mail) dir() string {
+	if m.Dir != "" {
+		return m.Dir
+	}
+	return xdg.DataPath("aerc", "smime")
+}
+
+func (m *Mail) Init() error {
+	log.Debugf("Initializing S/MIME certificate store")
+	entries, err := os.ReadDir(m.dir())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var password *string
+	var keys []crypto.PrivateKey
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		// an unreadable file must not disable the whole store
+		path := filepath.Join(m.dir(), entry.Name())
+		certs, key, err := readFile(path, &password)
+		if err != nil {
+			log.Errorf("smime: %s: %v", path, err)
+			continue
+		}
+		m.certs = append(m.certs, certs...)
+		keys = append(keys, key...)
+	}
+	for _, key := range keys {
+		pub, ok := key.(interface{ Public() crypto.PublicKey })
+		if !ok {
+			continue
+		}
+		for _, cert := range m.certs {
+			eq, ok := cert.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+			if ok && eq.Equal(pub.Public()) {
+				m.ids = append(m.ids, &identity{
+					cert:  cert,
+					key:   key,
+					chain: m.chain(cert),
+				})
+			}
+		}
+	}
+	log.Debugf("smime: loaded %d certificate(s), %d with a private key",
+		len(m.certs), len(m.ids))
+	return nil
+}
+
+// readFile reads the certificates and private keys of a file of the store. The
+// password of PKCS#12 files is only read once, when first needed.
+func readFile(path string, password **string) (
+	[]*x509.Certificate, []crypto.PrivateKey, error,
+) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".p12", ".pfx":
+		key, cert, chain, err := pkcs12.DecodeChain(data, "")
+		if errors.Is(err, pkcs12.ErrIncorrectPassword) {
+			if *password == nil {
+				pw, err := readPassword()
+				if err != nil {
+					return nil, nil, err
+				}
+				*password = &pw
+			}
+			key, cert, chain, err = pkcs12.DecodeChain(data, **password)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return append([]*x509.Certificate{cert}, chain...),
+			[]crypto.PrivateKey{key}, nil
+	}
+	var certs []*x509.Certificate
+	var keys []crypto.PrivateKey
+	for _, block := range decodePEM(data) {
+		switch {
+		case block.Type == "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, nil, err
+			}
+			certs = append(certs, cert)
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			key, err := parsePrivateKey(block.Bytes)
+			if err != nil {
+				return nil, nil, err
+			}
+			keys = append(keys, key)
+		}
+	}
+	return certs, keys, nil
+}
+
+func (m *Mail) Close() {}
+
+// readPassword runs smime-password-cmd to get the password of the PKCS#12
+// files of the store.
+func readPassword() (string, error) {
+	cmd := config.General().SmimePasswordCmd
+	if cmd == "" {
+		return "", errors.New("smime: password protected PKCS#12 file " +
+			"and no smime-password-cmd set")
+	}
+	out, err := exec.Command("sh", "-c", cmd).Output()
+	if err != nil {
+		return "", fmt.Errorf("smime-password-cmd: %w", err)
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+// decodePEM returns the PEM blocks of data. If it is not PEM encoded, it is
+// considered to be a DER encoded certificate.
+func decodePEM(data []byte) []*pem.Block {
+	var blocks []*pem.Block
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		blocks = append(blocks, block)
+	}
+	if len(blocks) == 0 && len(data) > 0 {
+		blocks = append(blocks, &pem.Block{Type: "CERTIFICATE", Bytes: data})
+	}
+	return blocks
+}
+
+func parsePrivateKey(der []byte) (crypto.PrivateKey, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("unsupported private key format")
+}
+
+// chain returns the certificates of the store that issued cert, up to the
+// root certificate.
+func (m *Mail) chain(cert *x509.Certificate) []*x509.Certificate {
+	var chain []*x509.Certificate
+	for len(chain) < 10 {
+		if bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+			break
+		}
+		var issuer *x509.Certificate
+		for _, c := range m.certs {
+			if c != cert && cert.CheckSignatureFrom(c) == nil {
+				issuer = c
+				break
+			}
+		}
+		if issuer == nil {
+			break
+		}
+		chain = append(chain, issuer)
+		cert = issuer
+	}
+	return chain
+}
+
+var oidEmailAddress = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}
+
+func emails(cert *x509.Certificate) []string {
+	addrs := slices.Clone(cert.EmailAddresses)
+	for _, name := range cert.Subject.Names {
+		if s, ok := name.Value.(string); ok && name.Type.Equal(oidEmailAddress) {
+			addrs = append(addrs, s)
+		}
+	}
+	return addrs
+}
+
+// certName returns the e-mail address of cert or its common name.
+func certName(cert *x509.Certificate) string {
+	if addrs := emails(cert); len(addrs) > 0 {
+		if cert.Subject.CommonName != "" {
+			return fmt.Sprintf("%s <%s>", cert.Subject.CommonName, addrs[0])
+		}
+		return addrs[0]
+	}
+	return cert.Subject.String()
+}
+
+func fingerprint(cert *x509.Certificate) []byte {
+	sum := sha1.Sum(cert.Raw)
+	return sum[:]
+}
+
+// keyId returns the first 64 bits of the SHA-1 fingerprint of cert, which
+// are used to designate it like PGP key ids.
+func keyId(cert *x509.Certificate) uint64 {
+	return binary.BigEndian.Uint64(fingerprint(cert))
+}
+
+func keyIdString(cert *x509.Certificate) string {
+	return strings.ToUpper(hex.EncodeToString(fingerprint(cert)[:8]))
+}
+
+// matches returns true if cert has the e-mail address s or if s is a prefix
+// of its fingerprint.
+func matches(cert *x509.Certificate, s string) bool {
+	if strings.Contains(s, "@") {
+		for _, addr := range emails(cert) {
+			if strings.EqualFold(addr, s) {
+				return true
+			}
+		}
+		return false
+	}
+	fpr := hex.EncodeToString(fingerprint(cert))
+	s = strings.ToLower(strings.ReplaceAll(s, ":", ""))
+	return s != "" && strings.HasPrefix(fpr, s)
+}
+
+// better returns true if cert a should be preferred over b: currently valid
+// certificates first, then the ones expiring last.
+func better(a, b *x509.Certificate) bool {
+	now := time.Now()
+	validA := now.After(a.NotBefore) && now.Before(a.NotAfter)
+	validB := now.After(b.NotBefore) && now.Before(b.NotAfter)
+	if validA != validB {
+		return validA
+	}
+	return a.NotAfter.After(b.NotAfter)
+}
+
+func (m *Mail) getIdentity(s string) (*identity, error) {
+	var found *identity
+	for _, id := range m.ids {
+		if matches(id.cert, s) && (found == nil || better(id.cert, found.cert)) {
+			found = id
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no certificate with a private key found for %s", s)
+	}
+	return found, nil
+}
+
+func (m *Mail) getCertificate(s string) (*x509.Certificate, error) {
+	var found *x509.Certificate
+	for _, cert := range m.certs {
+		if matches(cert, s) && (found == nil || better(cert, found)) {
+			found = cert
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no certificate found for %s", s)
+	}
+	return found, nil
+}
+
+func (m *Mail) GetSignerKeyId(s string) (string, error) {
+	id, err := m.getIdentity(s)
+	if err != nil {
+		return "", err
+	}
+	return keyIdString(id.cert), nil
+}
+
+func (m *Mail) GetKeyId(s string) (string, error) {
+	cert, err := m.getCertificate(s)
+	if err != nil {
+		return "", err
+	}
+	return keyIdString(cert), nil
+}
+
+func (m *Mail) ExportKey(k string) (io.Reader, error) {
+	id, err := m.getIdentity(k)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	for _, cert := range append([]*x509.Certificate{id.cert}, id.chain...) {
+		err = pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+		if err != nil {
+			return nil, fmt.Errorf("smime: error exporting certificate: %w", err)
+		}
+	}
+	return &buf, nil
+}
+
+// ImportKeys adds the PEM or DER encoded certificates read from r to the
+// store.
+func (m *Mail) ImportKeys(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var certs []*x509.Certificate
+	for _, block := range decodePEM(data) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return errors.New("smime: no certificate found")
+	}
+	if err := os.MkdirAll(m.dir(), 0o700); err != nil {
+		return err
+	}
+	for _, cert := range certs {
+		path := filepath.Join(m.dir(), hex.EncodeToString(fingerprint(cert))+".pem")
+		data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			return err
+		}
+		m.certs = append(m.certs, cert)
+	}
+	return nil
+}
+
+// trust verifies the certificate chain of a signature. Certificates of the
+// store are trusted in addition to the system ones.
+func (m *Mail) trust(sig *signature) error {
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	for _, cert := range m.certs {
+		roots.AddCert(cert)
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range sig.certs {
+		intermediates.AddCert(cert)
+	}
+	// The signing time is chosen by the signer, the chain is verified at
+	// the current time so that expired certificates cannot be used.
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageEmailProtection,
+		},
+	}
+	_, err = sig.signer.Verify(opts)
+	return err
+}
+
+// details returns the message details of a verified signature. The signer
+// certificate must contain the address of the sender from (RFC 8551 section
+// 3.1) if it is not empty.
+func (m *Mail) details(sig *signature, err error, from string) *models.MessageDetails {
+	md := &models.MessageDetails{IsSigned: true}
+	if sig != nil {
+		md.Micalg = sig.micalg
+	}
+	switch {
+	case errors.Is(err, errUnknownSigner):
+		md.SignatureValidity = models.UnknownEntity
+		md.SignatureError = err.Error()
+	case err != nil:
+		md.SignatureValidity = models.InvalidSignature
+		md.SignatureError = err.Error()
+	default:
+		md.SignedBy = certName(sig.signer)
+		md.SignedByKeyId = keyId(sig.signer)
+		md.SignatureValidity = models.Valid
+		if err := m.trust(sig); err != nil {
+			md.SignatureValidity = models.UnknownEntity
+			md.SignatureError = "smime: " + err.Error()
+		}
+		if from != "" && !slices.ContainsFunc(emails(sig.signer), func(addr string) bool {
+			return strings.EqualFold(addr, from)
+		}) {
+			md.SignatureValidity = models.InvalidSignature
+			md.SignatureError = fmt.Sprintf(
+				"smime: signer certificate does not match sender %s", from)
+		}
+	}
+	return md
+}
+
+func (m *Mail) Decrypt(r io.Reader, decryptKeys openpgp.PromptFunction) (*models.MessageDetails, error) {
+	reader, err := Read(r, m)
+	if err != nil {
+		return nil, err
+	}
+	return reader.MessageDetails, nil
+}
+
+func (m *Mail) Encrypt(buf *bytes.Buffer, rcpts []string, signer string, decryptKeys openpgp.PromptFunction, header *mail.Header) (io.WriteCloser, error) {
+	var signerId *identity
+	var err error
+	if signer != "" {
+		signerId, err = m.getIdentity(signer)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var to []*x509.Certificate
+	for _, rcpt := range rcpts {
+		cert, err := m.getCertificate(rcpt)
+		if err != nil {
+			return nil, err
+		}
+		to = append(to, cert)
+	}
+	return newEncrypter(buf, header.Header.Header, to, signerId)
+}
+
+func (m *Mail) Sign(buf *bytes.Buffer, signer string, decryptKeys openpgp.PromptFunction, header *mail.Header) (io.WriteCloser, error) {
+	id, err := m.getIdentity(signer)
+	if err != nil {
+		return nil, err
+	}
+	return newSigner(buf, header.Header.Header, id)
+}
@@ -0,0 +1,390 @@
+package smime
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"git.sr.ht/~rjarry/aerc/config"
+	"git.sr.ht/~rjarry/aerc/models"
+	"github.com/emersion/go-message/mail"
+)
+
+func newCert(
+	t *testing.T, name string, key crypto.Signer,
+	parent *x509.Certificate, parentKey crypto.Signer,
+) *x509.Certificate {
+	t.Helper()
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		template.ExtKeyUsage = nil
+		parent, parentKey = template, key
+	} else {
+		template.EmailAddresses = []string{name}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent,
+		key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func writePEM(t *testing.T, path string, blocks ...*pem.Block) {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, block := range blocks {
+		if err := pem.Encode(&buf, block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newStores returns the S/MIME stores of two users whose certificates are
+// issued by the same CA. Alice has an RSA key and Bob an ECDSA key.
+func newStores(t *testing.T) (alice *Mail, bob *Mail) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := newCert(t, "Test CA", caKey, nil, nil)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := []struct {
+		name string
+		key  crypto.Signer
+	}{
+		{"alice@example.org", rsaKey},
+		{"bob@example.org", ecKey},
+	}
+	var certs []*x509.Certificate
+	for _, u := range users {
+		certs = append(certs, newCert(t, u.name, u.key, ca, caKey))
+	}
+	var stores []*Mail
+	for i, u := range users {
+		dir := t.TempDir()
+		writePEM(t, filepath.Join(dir, "ca.pem"),
+			&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})
+		der, err := x509.MarshalPKCS8PrivateKey(u.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writePEM(t, filepath.Join(dir, "me.pem"),
+			&pem.Block{Type: "CERTIFICATE", Bytes: certs[i].Raw},
+			&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		// only the certificate of alice is known to bob
+		if i == 1 {
+			writePEM(t, filepath.Join(dir, "alice.crt"),
+				&pem.Block{Type: "CERTIFICATE", Bytes: certs[0].Raw})
+		}
+		m := &Mail{Dir: dir}
+		if err := m.Init(); err != nil {
+			t.Fatal(err)
+		}
+		stores = append(stores, m)
+	}
+	return stores[0], stores[1]
+}
+
+const body = "Content-Type: text/plain\r\n\r\nHello world!\r\n"
+
+func header(from string) *mail.Header {
+	var h mail.Header
+	h.SetAddressList("From", []*mail.Address{{Address: from}})
+	h.SetSubject("test")
+	return &h
+}
+
+func readBody(t *testing.T, md *models.MessageDetails) string {
+	t.Helper()
+	b, err := io.ReadAll(md.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestSignVerify(t *testing.T) {
+	alice, bob := newStores(t)
+
+	var buf bytes.Buffer
+	w, err := alice.Sign(&buf, "alice@example.org", nil, header("alice@example.org"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.WriteString(w, body)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	signed := buf.String()
+
+	md, err := bob.Decrypt(strings.NewReader(signed), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !md.IsSigned || md.SignatureValidity != models.Valid {
+		t.Fatalf("expected valid signature, got %v: %s",
+			md.SignatureValidity, md.SignatureError)
+	}
+	if md.SignedBy != "alice@example.org <alice@example.org>" {
+		t.Errorf("unexpected signer %q", md.SignedBy)
+	}
+	if b := readBody(t, md); b != body {
+		t.Errorf("unexpected body %q", b)
+	}
+
+	tampered := strings.Replace(signed, "Hello", "Hallo", 1)
+	md, err = bob.Decrypt(strings.NewReader(tampered), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.SignatureValidity != models.InvalidSignature {
+		t.Errorf("expected invalid signature, got %v", md.SignatureValidity)
+	}
+
+	// the certificate of alice does not match the sender
+	buf.Reset()
+	w, err = alice.Sign(&buf, "alice@example.org", nil, header("bob@example.org"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.WriteString(w, body)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	md, err = bob.Decrypt(strings.NewReader(buf.String()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.SignatureValidity != models.InvalidSignature ||
+		!strings.Contains(md.SignatureError, "does not match sender") {
+		t.Errorf("expected sender mismatch, got %v: %s",
+			md.SignatureValidity, md.SignatureError)
+	}
+
+	// the CA of alice is unknown
+	other := &Mail{Dir: t.TempDir()}
+	md, err = other.Decrypt(strings.NewReader(signed), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.SignatureValidity != models.UnknownEntity {
+		t.Errorf("expected unknown signer, got %v", md.SignatureValidity)
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	alice, bob := newStores(t)
+
+	if _, err := bob.GetKeyId("alice@example.org"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.GetKeyId("bob@example.org"); err == nil {
+		t.Fatal("expected no certificate for bob")
+	}
+
+	var buf bytes.Buffer
+	w, err := bob.Encrypt(&buf, []string{"alice@example.org"},
+		"bob@example.org", nil, header("bob@example.org"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.WriteString(w, body)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	encrypted := buf.String()
+	if strings.Contains(encrypted, "Hello") {
+		t.Fatal("message not encrypted")
+	}
+
+	md, err := alice.Decrypt(strings.NewReader(encrypted), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !md.IsEncrypted || md.DecryptedWith != "alice@example.org <alice@example.org>" {
+		t.Errorf("unexpected decryption details %#v", md)
+	}
+	// alice does not know the certificate of bob but it is included in
+	// the signature and issued by a trusted CA
+	if !md.IsSigned || md.SignatureValidity != models.Valid {
+		t.Errorf("expected valid signature, got %v: %s",
+			md.SignatureValidity, md.SignatureError)
+	}
+	if b := readBody(t, md); b != body {
+		t.Errorf("unexpected body %q", b)
+	}
+
+	if _, err := bob.Decrypt(strings.NewReader(encrypted), nil); err == nil {
+		t.Error("expected decryption by bob to fail")
+	}
+}
+
+func TestBER(t *testing.T) {
+	// SEQUENCE { OCTET STRING (constructed, indefinite) { "ab" "c" } }
+	ber := []byte{
+		0x30, 0x80,
+		0x24, 0x80, 0x04, 0x02, 'a', 'b', 0x04, 0x01, 'c', 0x00, 0x00,
+		0x00, 0x00,
+	}
+	der, err := ber2der(ber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{
+		0x30, 0x09,
+		0x24, 0x07, 0x04, 0x02, 'a', 'b', 0x04, 0x01, 'c',
+	}
+	if !bytes.Equal(der, expected) {
+		t.Errorf("expected % x, got % x", expected, der)
+	}
+}
+
+// copyTestdata returns a store directory containing the given files of
+// testdata, which were generated with the openssl command line tool.
+func copyTestdata(t *testing.T, names ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestOpenSSLInterop(t *testing.T) {
+	m := &Mail{Dir: copyTestdata(t, "ca.pem", "alice.pem", "alice.key")}
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+	expected := "Content-Type: text/plain\r\n\r\nHello world!\r\n"
+	for _, test := range []struct {
+		file      string
+		signed    bool
+		encrypted bool
+	}{
+		{"signed.eml", true, false},
+		{"opaque.eml", true, false},
+		{"enveloped-aes.eml", false, true},
+		{"enveloped-3des.eml", false, true},
+	} {
+		t.Run(test.file, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", test.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			md, err := m.Decrypt(f, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if md.IsSigned != test.signed || md.IsEncrypted != test.encrypted {
+				t.Errorf("expected signed=%v encrypted=%v, got %#v",
+					test.signed, test.encrypted, md)
+			}
+			if test.signed && md.SignatureValidity != models.Valid {
+				t.Errorf("expected valid signature, got %v: %s",
+					md.SignatureValidity, md.SignatureError)
+			}
+			b := strings.ReplaceAll(readBody(t, md), "\r\n", "\n")
+			if b != strings.ReplaceAll(expected, "\r\n", "\n") {
+				t.Errorf("unexpected body %q", b)
+			}
+		})
+	}
+}
+
+func TestInitPKCS12(t *testing.T) {
+	defer func(cmd string) {
+		config.General().SmimePasswordCmd = cmd
+	}(config.General().SmimePasswordCmd)
+	config.General().SmimePasswordCmd = "echo secret"
+
+	// alice.p12 is encrypted with the defaults of OpenSSL 3: PBES2,
+	// AES-256-CBC and HMAC-SHA256
+	dir := copyTestdata(t, "alice.p12")
+	// an invalid file must not prevent loading the others
+	err := os.WriteFile(filepath.Join(dir, "broken.p12"), []byte("junk"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Mail{Dir: dir}
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.ids) != 1 || !matches(m.ids[0].cert, "alice@example.org") {
+		t.Fatalf("expected the identity of alice, got %v", m.ids)
+	}
+	if len(m.ids[0].chain) != 1 || m.ids[0].chain[0].Subject.CommonName != "Test CA" {
+		t.Errorf("expected the CA in the chain of alice, got %v", m.ids[0].chain)
+	}
+}
+
+func TestUnpad(t *testing.T) {
+	for _, test := range []struct {
+		in  []byte
+		out []byte
+		ok  bool
+	}{
+		{[]byte("abcd\x04\x04\x04\x04"), []byte("abcd"), true},
+		{[]byte("abcdefg\x01"), []byte("abcdefg"), true},
+		{[]byte("\x08\x08\x08\x08\x08\x08\x08\x08"), []byte{}, true},
+		// only the last byte is a valid padding length
+		{[]byte("abcd\x01\x02\x03\x04"), nil, false},
+		{[]byte("abcdefg\x00"), nil, false},
+		{[]byte("abcdefg\x09"), nil, false},
+		{[]byte("abc"), nil, false},
+	} {
+		out, ok := unpad(test.in, 8)
+		if ok != test.ok || !bytes.Equal(out, test.out) {
+			t.Errorf("%q: expected %q %v, got %q %v",
+				test.in, test.out, test.ok, out, ok)
+		}
+	}
+}
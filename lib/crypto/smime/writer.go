@@ -0,0 +1,166 @@
+package smime
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+
+	"git.sr.ht/~rjarry/aerc/lib/rfc822"
+	"github.com/emersion/go-message/textproto"
+)
+
+type EncrypterSigner struct {
+	msgBuf bytes.Buffer
+	w      io.Writer
+	header textproto.Header
+	to     []*x509.Certificate
+	signer *identity
+}
+
+func (es *EncrypterSigner) Write(p []byte) (int, error) {
+	return es.msgBuf.Write(p)
+}
+
+func (es *EncrypterSigner) Close() error {
+	content, err := canonical(&es.msgBuf)
+	if err != nil {
+		return err
+	}
+	if es.signer != nil {
+		var signed bytes.Buffer
+		var h textproto.Header
+		if err := writeSigned(&signed, h, content, es.signer); err != nil {
+			return err
+		}
+		content = signed.Bytes()
+	}
+	der, err := encrypt(content, es.to)
+	if err != nil {
+		return err
+	}
+	es.header.Set("Content-Type", mime.FormatMediaType("application/pkcs7-mime",
+		map[string]string{"smime-type": "enveloped-data", "name": "smime.p7m"}))
+	es.header.Set("Content-Transfer-Encoding", "base64")
+	es.header.Set("Content-Disposition", mime.FormatMediaType("attachment",
+		map[string]string{"filename": "smime.p7m"}))
+	// Ensure Mime-Version header is set on the top level to be compliant
+	// with RFC 2045
+	es.header.Set("Mime-Version", "1.0")
+	if err := textproto.WriteHeader(es.w, es.header); err != nil {
+		return err
+	}
+	return writeBase64(es.w, der)
+}
+
+type Signer struct {
+	signedMsg bytes.Buffer
+	w         io.Writer
+	header    textproto.Header
+	signer    *identity
+}
+
+func (s *Signer) Write(p []byte) (int, error) {
+	return s.signedMsg.Write(p)
+}
+
+func (s *Signer) Close() error {
+	reader := bufio.NewReader(&s.signedMsg)
+	header, err := textproto.ReadHeader(reader)
+	if err != nil {
+		return err
+	}
+	// MIME-Version must only be set on the top level header, see the
+	// gpg signer for details.
+	header.Del("Mime-Version")
+
+	var buf bytes.Buffer
+	_ = textproto.WriteHeader(&buf, header)
+	_, _ = io.Copy(&buf, reader)
+	content, err := canonical(&buf)
+	if err != nil {
+		return err
+	}
+	s.header.Set("Mime-Version", "1.0")
+	return writeSigned(s.w, s.header, content, s.signer)
+}
+
+// canonical converts the line endings of a MIME entity to CRLF as required
+// before signing or encrypting it.
+func canonical(r io.Reader) ([]byte, error) {
+	return io.ReadAll(rfc822.NewCRLFReader(r))
+}
+
+// writeSigned writes a multipart/signed entity with the header h containing
+// content and its detached signature.
+func writeSigned(
+	w io.Writer, h textproto.Header, content []byte, signer *identity,
+) error {
+	sig, err := sign(content, signer)
+	if err != nil {
+		return err
+	}
+	mw := textproto.NewMultipartWriter(w)
+	params := map[string]string{
+		"boundary": mw.Boundary(),
+		"protocol": "application/pkcs7-signature",
+		"micalg":   "sha-256",
+	}
+	h.Set("Content-Type", mime.FormatMediaType("multipart/signed", params))
+	if err := textproto.WriteHeader(w, h); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "--%s\r\n", mw.Boundary())
+	_, _ = w.Write(content)
+	_, _ = w.Write([]byte("\r\n"))
+
+	var sigHeader textproto.Header
+	sigHeader.Set("Content-Type", mime.FormatMediaType(
+		"application/pkcs7-signature", map[string]string{"name": "smime.p7s"}))
+	sigHeader.Set("Content-Transfer-Encoding", "base64")
+	sigHeader.Set("Content-Disposition", mime.FormatMediaType("attachment",
+		map[string]string{"filename": "smime.p7s"}))
+	pw, err := mw.CreatePart(sigHeader)
+	if err != nil {
+		return err
+	}
+	if err := writeBase64(pw, sig); err != nil {
+		return err
+	}
+	return mw.Close()
+}
+
+// writeBase64 writes data base64 encoded in lines of 76 characters.
+func writeBase64(w io.Writer, data []byte) error {
+	s := base64.StdEncoding.EncodeToString(data)
+	for len(s) > 0 {
+		n := min(len(s), 76)
+		if _, err := io.WriteString(w, s[:n]+"\r\n"); err != nil {
+			return err
+		}
+		s = s[n:]
+	}
+	return nil
+}
+
+func newEncrypter(
+	w io.Writer, h textproto.Header, to []*x509.Certificate, signer *identity,
+) (io.WriteCloser, error) {
+	return &EncrypterSigner{
+		w:      w,
+		header: h,
+		to:     to,
+		signer: signer,
+	}, nil
+}
+
+func newSigner(w io.Writer, h textproto.Header, signer *identity) (io.WriteCloser, error) {
+	return &Signer{
+		w:      w,
+		header: h,
+		signer: signer,
+	}, nil
+}
@@ -0,0 +1,415 @@
+// Package managesieve implements a client for the ManageSieve protocol
+// (RFC 5804) used to manage server-side Sieve filtering scripts.
+package managesieve
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-sasl"
+)
+
+// Default ManageSieve port
+const Port = "4190"
+
+// A Script stored on the server.
+type Script struct {
+	Name   string
+	Active bool
+}
+
+// Error is returned when the server answers NO or BYE to a command. For
+// PUTSCRIPT and CHECKSCRIPT, Msg contains the script errors reported by the
+// server.
+type Error struct {
+	Code string
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	if e.Msg == "" {
+		if e.Code != "" {
+			return e.Code
+		}
+		return "command failed"
+	}
+	return e.Msg
+}
+
+type Client struct {
+	conn net.Conn
+	r    *bufio.Reader
+	caps map[string]string
+}
+
+// NewClient reads the server greeting on conn and returns a client ready to
+// authenticate.
+func NewClient(conn net.Conn) (*Client, error) {
+	c := &Client{conn: conn, r: bufio.NewReader(conn)}
+	if err := c.readCapabilities(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Supports returns true if the server advertised the given capability.
+func (c *Client) Supports(capability string) bool {
+	_, ok := c.caps[strings.ToUpper(capability)]
+	return ok
+}
+
+// SupportsAuth returns true if the server supports the given SASL mechanism.
+func (c *Client) SupportsAuth(mech string) bool {
+	for _, m := range strings.Fields(c.caps["SASL"]) {
+		if strings.EqualFold(m, mech) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) StartTLS(config *tls.Config) error {
+	if !c.Supports("STARTTLS") {
+		return errors.New("managesieve: server does not support STARTTLS")
+	}
+	if _, err := c.execute("STARTTLS"); err != nil {
+		return err
+	}
+	tlsConn := tls.Client(c.conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	c.conn = tlsConn
+	c.r = bufio.NewReader(tlsConn)
+	// capabilities are sent again after the TLS negotiation
+	return c.readCapabilities()
+}
+
+func (c *Client) Authenticate(client sasl.Client) error {
+	mech, ir, err := client.Start()
+	if err != nil {
+		return err
+	}
+	cmd := "AUTHENTICATE " + quote(mech)
+	if ir != nil {
+		cmd += " " + quote(base64.StdEncoding.EncodeToString(ir))
+	}
+	if err := c.writeLine(cmd); err != nil {
+		return err
+	}
+	for {
+		fields, err := c.readLine()
+		if err != nil {
+			return err
+		}
+		if len(fields) > 0 && fields[0].isString {
+			// server challenge
+			challenge, err := base64.StdEncoding.DecodeString(fields[0].value)
+			if err != nil {
+				return err
+			}
+			resp, err := client.Next(challenge)
+			if err != nil {
+				// abort the exchange
+				_ = c.writeLine(quote("*"))
+				_, _ = c.readResponse()
+				return err
+			}
+			err = c.writeLine(quote(base64.StdEncoding.EncodeToString(resp)))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		return statusError(fields)
+	}
+}
+
+// ListScripts returns all the scripts stored on the server.
+func (c *Client) ListScripts() ([]Script, error) {
+	lines, err := c.execute("LISTSCRIPTS")
+	if err != nil {
+		return nil, err
+	}
+	scripts := make([]Script, 0, len(lines))
+	for _, fields := range lines {
+		if len(fields) == 0 {
+			continue
+		}
+		s := Script{Name: fields[0].value}
+		if len(fields) > 1 && strings.EqualFold(fields[1].value, "ACTIVE") {
+			s.Active = true
+		}
+		scripts = append(scripts, s)
+	}
+	return scripts, nil
+}
+
+// GetScript returns the content of a script.
+func (c *Client) GetScript(name string) (string, error) {
+	lines, err := c.execute("GETSCRIPT " + quote(name))
+	if err != nil {
+		return "", err
+	}
+	if len(lines) == 0 || len(lines[0]) == 0 {
+		return "", fmt.Errorf("managesieve: empty response for %q", name)
+	}
+	return lines[0][0].value, nil
+}
+
+// PutScript uploads a script, replacing any existing one with the same name.
+// The server refuses scripts with errors.
+func (c *Client) PutScript(name, content string) error {
+	_, err := c.execute("PUTSCRIPT " + quote(name) + " " + literal(content))
+	return err
+}
+
+// CheckScript verifies a script without storing it.
+func (c *Client) CheckScript(content string) error {
+	if !c.Supports("VERSION") {
+		return errors.New("managesieve: server does not support CHECKSCRIPT")
+	}
+	_, err := c.execute("CHECKSCRIPT " + literal(content))
+	return err
+}
+
+// SetActive makes name the active script. An empty name deactivates all
+// scripts.
+func (c *Client) SetActive(name string) error {
+	_, err := c.execute("SETACTIVE " + quote(name))
+	return err
+}
+
+// Logout ends the session and closes the connection.
+func (c *Client) Logout() error {
+	_, err := c.execute("LOGOUT")
+	if cerr := c.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) readCapabilities() error {
+	lines, err := c.readResponse()
+	if err != nil {
+		return err
+	}
+	c.caps = make(map[string]string)
+	for _, fields := range lines {
+		if len(fields) == 0 {
+			continue
+		}
+		var value string
+		if len(fields) > 1 {
+			value = fields[1].value
+		}
+		c.caps[strings.ToUpper(fields[0].value)] = value
+	}
+	return nil
+}
+
+func (c *Client) execute(cmd string) ([][]field, error) {
+	if err := c.writeLine(cmd); err != nil {
+		return nil, err
+	}
+	return c.readResponse()
+}
+
+func (c *Client) writeLine(line string) error {
+	_, err := io.WriteString(c.conn, line+"\r\n")
+	return err
+}
+
+// readResponse reads data lines until the final OK, NO or BYE line.
+func (c *Client) readResponse() ([][]field, error) {
+	var lines [][]field
+	for {
+		fields, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) > 0 && !fields[0].isString {
+			return lines, statusError(fields)
+		}
+		lines = append(lines, fields)
+	}
+}
+
+// statusError returns nil for an OK response and an *Error otherwise.
+func statusError(fields []field) error {
+	if len(fields) == 0 {
+		return errors.New("managesieve: empty response")
+	}
+	status := strings.ToUpper(fields[0].value)
+	var e Error
+	for _, f := range fields[1:] {
+		if f.isCode {
+			e.Code = f.value
+		} else {
+			e.Msg = f.value
+		}
+	}
+	switch status {
+	case "OK":
+		return nil
+	case "NO", "BYE":
+		return &e
+	default:
+		return fmt.Errorf("managesieve: unexpected response %q", status)
+	}
+}
+
+type field struct {
+	value string
+	// quoted string or literal, as opposed to atoms
+	isString bool
+	// response code between parentheses
+	isCode bool
+}
+
+// readLine reads a response line. Literals may span over multiple lines.
+func (c *Client) readLine() ([]field, error) {
+	return readFields(c.r)
+}
+
+func readFields(r *bufio.Reader) ([]field, error) {
+	var fields []field
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		switch b {
+		case ' ':
+			continue
+		case '\r':
+			continue
+		case '\n':
+			return fields, nil
+		case '"':
+			s, err := readQuoted(r)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, field{value: s, isString: true})
+		case '{':
+			s, err := readLiteral(r)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, field{value: s, isString: true})
+		case '(':
+			s, err := readCode(r)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, field{value: s, isCode: true})
+		default:
+			var atom strings.Builder
+			atom.WriteByte(b)
+			for {
+				b, err := r.ReadByte()
+				if err != nil {
+					return nil, err
+				}
+				if b == ' ' || b == '\r' || b == '\n' {
+					_ = r.UnreadByte()
+					break
+				}
+				atom.WriteByte(b)
+			}
+			fields = append(fields, field{value: atom.String()})
+		}
+	}
+}
+
+func readQuoted(r *bufio.Reader) (string, error) {
+	var s strings.Builder
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		switch b {
+		case '"':
+			return s.String(), nil
+		case '\\':
+			b, err = r.ReadByte()
+			if err != nil {
+				return "", err
+			}
+		case '\r', '\n':
+			return "", errors.New("managesieve: unterminated quoted string")
+		}
+		s.WriteByte(b)
+	}
+}
+
+func readLiteral(r *bufio.Reader) (string, error) {
+	spec, err := r.ReadString('}')
+	if err != nil {
+		return "", err
+	}
+	spec = strings.TrimSuffix(strings.TrimSuffix(spec, "}"), "+")
+	n, err := strconv.Atoi(spec)
+	if err != nil || n < 0 {
+		return "", fmt.Errorf("managesieve: invalid literal {%s}", spec)
+	}
+	if line, err := r.ReadString('\n'); err != nil {
+		return "", err
+	} else if strings.TrimSpace(line) != "" {
+		return "", fmt.Errorf("managesieve: unexpected data after literal")
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+func readCode(r *bufio.Reader) (string, error) {
+	var s strings.Builder
+	quoted := false
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case b == '"':
+			quoted = !quoted
+		case b == ')' && !quoted:
+			return s.String(), nil
+		case b == '\n':
+			return "", errors.New("managesieve: unterminated response code")
+		}
+		s.WriteByte(b)
+	}
+}
+
+func quote(s string) string {
+	if strings.ContainsAny(s, "\r\n") {
+		return literal(s)
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// literal returns a non-synchronizing literal which does not require
+// waiting for the server to accept it.
+func literal(s string) string {
+	return fmt.Sprintf("{%d+}\r\n%s", len(s), s)
+}
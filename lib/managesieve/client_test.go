@@ -0,0 +1,165 @@
+package managesieve
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-sasl"
+)
+
+// fakeServer is a minimal ManageSieve server storing scripts in memory.
+// Scripts containing "error" are rejected.
+type fakeServer struct {
+	scripts map[string]string
+	active  string
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := func(format string, args ...any) {
+		fmt.Fprintf(conn, format+"\r\n", args...)
+	}
+	check := func(script string) bool {
+		if strings.Contains(script, "error") {
+			w(`NO "line 2: unknown command 'error'"`)
+			return false
+		}
+		return true
+	}
+	w(`"IMPLEMENTATION" "fake"`)
+	w(`"SASL" "PLAIN"`)
+	w(`"SIEVE" "fileinto reject"`)
+	w(`"VERSION" "1.0"`)
+	w(`OK "ready"`)
+
+	for {
+		fields, err := readFields(r)
+		if err != nil || len(fields) == 0 {
+			return
+		}
+		args := make([]string, 0, len(fields)-1)
+		for _, f := range fields[1:] {
+			args = append(args, f.value)
+		}
+		switch strings.ToUpper(fields[0].value) {
+		case "AUTHENTICATE":
+			ir, _ := base64.StdEncoding.DecodeString(args[1])
+			if args[0] != "PLAIN" || string(ir) != "\x00alice\x00secret" {
+				w(`NO "authentication failed"`)
+				continue
+			}
+			w(`OK`)
+		case "LISTSCRIPTS":
+			names := make([]string, 0, len(s.scripts))
+			for name := range s.scripts {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				if name == s.active {
+					w(`%s ACTIVE`, quote(name))
+				} else {
+					w(`%s`, quote(name))
+				}
+			}
+			w(`OK`)
+		case "GETSCRIPT":
+			script, ok := s.scripts[args[0]]
+			if !ok {
+				w(`NO (NONEXISTENT) "no such script"`)
+				continue
+			}
+			w("{%d}\r\n%s", len(script), script)
+			w(`OK`)
+		case "PUTSCRIPT":
+			if check(args[1]) {
+				s.scripts[args[0]] = args[1]
+				w(`OK`)
+			}
+		case "CHECKSCRIPT":
+			if check(args[0]) {
+				w(`OK`)
+			}
+		case "SETACTIVE":
+			s.active = args[0]
+			w(`OK`)
+		case "LOGOUT":
+			w(`OK "bye"`)
+			return
+		default:
+			w(`NO "unknown command"`)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	server := &fakeServer{scripts: map[string]string{
+		"vacation": "require \"vacation\";\r\nvacation \"away\";\r\n",
+	}}
+	client, conn := net.Pipe()
+	go server.serve(conn)
+
+	c, err := NewClient(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.SupportsAuth("plain") || c.Supports("STARTTLS") {
+		t.Errorf("unexpected capabilities: %v", c.caps)
+	}
+
+	err = c.Authenticate(sasl.NewPlainClient("", "alice", "wrong"))
+	var serr *Error
+	if !errors.As(err, &serr) || serr.Msg != "authentication failed" {
+		t.Fatalf("expected authentication error, got %v", err)
+	}
+	if err := c.Authenticate(sasl.NewPlainClient("", "alice", "secret")); err != nil {
+		t.Fatal(err)
+	}
+
+	script := "require \"fileinto\";\r\nfileinto \"Lists\";\r\n"
+	if err := c.PutScript("main \"rules\"", script); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetActive("main \"rules\""); err != nil {
+		t.Fatal(err)
+	}
+	scripts, err := c.ListScripts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Script{{Name: "main \"rules\"", Active: true}, {Name: "vacation"}}
+	if fmt.Sprint(scripts) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, scripts)
+	}
+
+	content, err := c.GetScript("main \"rules\"")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != script {
+		t.Errorf("unexpected script: %q", content)
+	}
+	_, err = c.GetScript("missing")
+	if !errors.As(err, &serr) || serr.Code != "NONEXISTENT" {
+		t.Errorf("expected NONEXISTENT error, got %v", err)
+	}
+
+	err = c.CheckScript("if true {\r\n  error;\r\n}\r\n")
+	if err == nil || err.Error() != "line 2: unknown command 'error'" {
+		t.Errorf("expected syntax error, got %v", err)
+	}
+	if err := c.CheckScript(script); err != nil {
+		t.Error(err)
+	}
+
+	if err := c.Logout(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -10,9 +10,11 @@ import (
 
 	"github.com/ProtonMail/go-crypto/openpgp"
 	_ "github.com/emersion/go-message/charset"
+	"github.com/emersion/go-message/mail"
 
 	"git.sr.ht/~rjarry/aerc/config"
 	"git.sr.ht/~rjarry/aerc/lib/crypto"
+	"git.sr.ht/~rjarry/aerc/lib/crypto/protected"
 	"git.sr.ht/~rjarry/aerc/lib/log"
 	"git.sr.ht/~rjarry/aerc/lib/rfc822"
 	"git.sr.ht/~rjarry/aerc/models"
@@ -50,9 +52,10 @@ func usePGP(info *models.BodyStructure) bool {
 		return false
 	}
 	if info.MIMEType == "application" {
-		if info.MIMESubType == "pgp-encrypted" ||
-			info.MIMESubType == "pgp-signature" {
-
+		switch info.MIMESubType {
+		case "pgp-encrypted", "pgp-signature",
+			"pkcs7-mime", "x-pkcs7-mime",
+			"pkcs7-signature", "x-pkcs7-signature":
 			return true
 		}
 	}
@@ -116,6 +119,12 @@ func NewMessageStoreView(messageInfo *models.MessageInfo, setSeen bool,
 				cb(nil, err)
 				return
 			}
+			if md.IsEncrypted {
+				ph := protected.Unwrap(decrypted.Header.Header)
+				if ph != nil {
+					unwrapProtectedHeaders(messageInfo, ph)
+				}
+			}
 			bs, err := rfc822.ParseEntityStructure(decrypted)
 			if rfc822.IsMultipartError(err) {
 				log.Warnf("MessageView: %v", err)
@@ -133,6 +142,32 @@ func NewMessageStoreView(messageInfo *models.MessageInfo, setSeen bool,
 	}
 }
 
+// unwrapProtectedHeaders replaces the headers of an encrypted message with the
+// protected headers found in its encrypted part.
+func unwrapProtectedHeaders(info *models.MessageInfo, ph *mail.Header) {
+	if info.RFC822Headers == nil {
+		if info.Envelope != nil && ph.Has("Subject") {
+			env := *info.Envelope
+			env.Subject, _ = ph.Subject()
+			info.Envelope = &env
+		}
+		return
+	}
+	h := info.RFC822Headers.Copy()
+	for _, key := range protected.Headers {
+		if !ph.Has(key) {
+			continue
+		}
+		h.Del(key)
+		values := ph.Values(key)
+		for i := len(values) - 1; i >= 0; i-- {
+			h.Add(key, values[i])
+		}
+	}
+	info.RFC822Headers = &h
+	info.Envelope = rfc822.ParseEnvelope(&h)
+}
+
 func (msv *MessageStoreView) SeenFlagSet() bool {
 	return msv.setSeen
 }
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"io"
 	"slices"
+	"strings"
 	"sync"
 	"time"
 
@@ -58,6 +59,11 @@ type MessageStore struct {
 	builder       *ThreadBuilder
 
 	directoryContentsLoaded bool
+	// last listing of the messages requested by the store
+	listing types.WorkerMessage
+
+	// incremented on every change of the messages or their order
+	version uint64
 
 	// Map of uids we've asked the worker to fetch
 	onUpdate       func(store *MessageStore) // TODO: multiple onUpdate handlers
@@ -66,6 +72,7 @@ type MessageStore struct {
 	pendingBodies  map[models.UID]any
 	pendingHeaders map[models.UID]any
 	worker         *types.Worker
+	undo           *UndoStack
 
 	needsFlags         []models.UID
 	fetchFlagsDebounce *time.Timer
@@ -270,6 +277,7 @@ func actualPositionInList(pos int, len int, reverse bool) int {
 }
 
 func (store *MessageStore) Update(msg types.WorkerMessage) {
+	store.version++
 	var newUids []models.UID
 	update := false
 	updateThreads := false
@@ -284,7 +292,7 @@ func (store *MessageStore) Update(msg types.WorkerMessage) {
 		store.Sort(store.sortCriteria, nil)
 		update = true
 	case *types.DirectoryContents:
-		if msg.Directory != store.Name {
+		if msg.Directory != store.Name || !store.requested(msg) {
 			break
 		}
 		nUids := len(msg.Uids)
@@ -308,7 +316,7 @@ func (store *MessageStore) Update(msg types.WorkerMessage) {
 		}
 		store.directoryContentsLoaded = true
 	case *types.DirectoryThreaded:
-		if msg.Directory != store.Name {
+		if msg.Directory != store.Name || !store.requested(msg) {
 			break
 		}
 		if store.builder == nil {
@@ -471,7 +479,15 @@ func (store *MessageStore) OnUpdateDirs(fn func()) {
 	store.onUpdateDirs = fn
 }
 
+// Version changes every time the messages of the store or their order may
+// have changed. It allows other views of the store to cache what they
+// computed from it.
+func (store *MessageStore) Version() uint64 {
+	return store.version
+}
+
 func (store *MessageStore) update(threads bool) {
+	store.version++
 	if store.onUpdate != nil {
 		store.onUpdate(store)
 	}
@@ -657,16 +673,26 @@ func (store *MessageStore) Delete(uids []models.UID, mfs *types.MultiFileStrateg
 		store.Deleted[uid] = nil
 	}
 
+	undo := store.undo.begin("delete")
+
 	store.worker.PostAction(context.TODO(), &types.DeleteMessages{
 		Directory:         store.Name,
 		Uids:              uids,
 		MultiFileStrategy: mfs,
 	}, func(msg types.WorkerMessage) {
+		// Only backends which move deleted messages to the trash
+		// report it.
+		if msg, ok := msg.(*types.MessagesMoved); ok {
+			store.recordMoved(undo, msg)
+			return
+		}
 		if _, ok := msg.(*types.Error); ok {
 			store.revertDeleted(uids)
+			store.undo.discard(undo)
 		}
 		if _, ok := msg.(*types.Unsupported); ok {
 			store.revertDeleted(uids)
+			store.undo.discard(undo)
 		}
 		if _, ok := msg.(*types.Done); ok {
 			store.triggerMailDeleted()
@@ -681,6 +707,27 @@ func (store *MessageStore) revertDeleted(uids []models.UID) {
 	}
 }
 
+// recordMoved records how to move messages back into this store's directory.
+func (store *MessageStore) recordMoved(undo *UndoEntry, msg *types.MessagesMoved) {
+	if len(msg.DestUids) != len(msg.Uids) {
+		return
+	}
+	uids := msg.Uids
+	undo.add(&types.MoveMessages{
+		Source:      msg.Destination,
+		Destination: store.Name,
+		Uids:        msg.DestUids,
+	}, func() {
+		store.revertDeleted(uids)
+	})
+}
+
+// SetUndoStack sets where the operations performed on messages are recorded
+// so that they can be undone.
+func (store *MessageStore) SetUndoStack(undo *UndoStack) {
+	store.undo = undo
+}
+
 func (store *MessageStore) Copy(uids []models.UID, dest string, createDest bool,
 	mfs *types.MultiFileStrategy, cb func(msg types.WorkerMessage),
 ) {
@@ -718,15 +765,20 @@ func (store *MessageStore) Move(uids []models.UID, dest string, createDest bool,
 		}, nil) // quiet doesn't return an error, don't want the done cb here
 	}
 
+	undo := store.undo.begin("move to " + dest)
+
 	store.worker.PostAction(context.TODO(), &types.MoveMessages{
 		Source:            store.Name,
 		Destination:       dest,
 		Uids:              uids,
 		MultiFileStrategy: mfs,
 	}, func(msg types.WorkerMessage) {
-		switch msg.(type) {
+		switch msg := msg.(type) {
+		case *types.MessagesMoved:
+			store.recordMoved(undo, msg)
 		case *types.Error:
 			store.revertDeleted(uids)
+			store.undo.discard(undo)
 			cb(msg)
 		case *types.Done:
 			store.triggerMailDeleted()
@@ -761,6 +813,19 @@ func (store *MessageStore) Append(dest string, flags models.Flags, date time.Tim
 func (store *MessageStore) Flag(uids []models.UID, flags models.Flags,
 	enable bool, cb func(msg types.WorkerMessage),
 ) {
+	// only revert the flag on messages where it actually changes
+	var changed []models.UID
+	for _, uid := range uids {
+		info := store.Messages[uid]
+		if info == nil || info.Flags.Has(flags) != enable {
+			changed = append(changed, uid)
+		}
+	}
+	var undo *UndoEntry
+	if len(changed) > 0 {
+		undo = store.undo.begin("flag change")
+	}
+
 	store.worker.PostAction(context.TODO(), &types.FlagMessages{
 		Directory: store.Name,
 		Enable:    enable,
@@ -780,8 +845,17 @@ func (store *MessageStore) Flag(uids []models.UID, flags models.Flags,
 		case models.DraftFlag:
 			flagName = "draft"
 		}
+		if _, ok := msg.(*types.Error); ok {
+			store.undo.discard(undo)
+		}
 		if _, ok := msg.(*types.Done); ok {
 			store.triggerFlagChanged(flagName)
+			undo.add(&types.FlagMessages{
+				Directory: store.Name,
+				Enable:    !enable,
+				Flags:     flags,
+				Uids:      changed,
+			}, nil)
 		}
 		if cb != nil {
 			cb(msg)
@@ -809,6 +883,16 @@ func (store *MessageStore) Forwarded(uids []models.UID, forwarded bool,
 	}, cb)
 }
 
+func (store *MessageStore) Junk(uids []models.UID, junk bool,
+	cb func(msg types.WorkerMessage),
+) {
+	store.worker.PostAction(context.TODO(), &types.JunkMessages{
+		Junk:      junk,
+		Directory: store.Name,
+		Uids:      uids,
+	}, cb)
+}
+
 func (store *MessageStore) Uids() []models.UID {
 	if store.ThreadedView() && store.builder != nil {
 		if uids := store.builder.Uids(); len(uids) > 0 {
@@ -1002,19 +1086,83 @@ func (store *MessageStore) PrevResult() {
 func (store *MessageStore) ModifyLabels(uids []models.UID, add, remove, toggle []string,
 	cb func(msg types.WorkerMessage),
 ) {
+	inverse := store.inverseLabels(uids, add, remove, toggle)
+	var undo *UndoEntry
+	if len(inverse) > 0 {
+		undo = store.undo.begin("label change")
+	}
+
 	store.worker.PostAction(context.TODO(), &types.ModifyLabels{
 		Uids:   uids,
 		Add:    add,
 		Remove: remove,
 		Toggle: toggle,
 	}, func(msg types.WorkerMessage) {
+		if _, ok := msg.(*types.Error); ok {
+			store.undo.discard(undo)
+		}
 		if _, ok := msg.(*types.Done); ok {
 			store.triggerTagModified(add, remove, toggle)
+			for _, action := range inverse {
+				undo.add(action, nil)
+			}
 		}
 		cb(msg)
 	})
 }
 
+// inverseLabels returns the actions restoring the current labels of messages
+// after the given modification. Messages with identical changes are grouped
+// in the same action.
+func (store *MessageStore) inverseLabels(
+	uids []models.UID, add, remove, toggle []string,
+) []*types.ModifyLabels {
+	var actions []*types.ModifyLabels
+	groups := make(map[string]*types.ModifyLabels)
+
+	for _, uid := range uids {
+		info := store.Messages[uid]
+		if info == nil {
+			continue
+		}
+		var added, removed []string
+		for _, l := range add {
+			if !slices.Contains(info.Labels, l) && !slices.Contains(added, l) {
+				added = append(added, l)
+			}
+		}
+		for _, l := range remove {
+			if slices.Contains(info.Labels, l) && !slices.Contains(removed, l) {
+				removed = append(removed, l)
+			}
+		}
+		for _, l := range toggle {
+			if slices.Contains(info.Labels, l) {
+				removed = append(removed, l)
+			} else {
+				added = append(added, l)
+			}
+		}
+		if len(added) == 0 && len(removed) == 0 {
+			continue
+		}
+		key := strings.Join(added, "\x00") + "\x01" + strings.Join(removed, "\x00")
+		if action, ok := groups[key]; ok {
+			action.Uids = append(action.Uids, uid)
+			continue
+		}
+		action := &types.ModifyLabels{
+			Uids:   []models.UID{uid},
+			Add:    removed,
+			Remove: added,
+		}
+		groups[key] = action
+		actions = append(actions, action)
+	}
+
+	return actions
+}
+
 func (store *MessageStore) Sort(criteria []*types.SortCriterion, cb func(types.WorkerMessage)) {
 	store.sortCriteria = criteria
 	store.Sorting = true
@@ -1033,19 +1181,29 @@ func (store *MessageStore) Sort(criteria []*types.SortCriterion, cb func(types.W
 	}
 
 	if store.threadedView && !store.buildThreads {
-		store.worker.PostAction(store.ctx, &types.FetchDirectoryThreaded{
+		store.listing = &types.FetchDirectoryThreaded{
 			Directory:     store.Name,
 			SortCriteria:  criteria,
 			Filter:        store.filter,
 			ThreadContext: store.threadContext,
-		}, handle_return)
+		}
 	} else {
-		store.worker.PostAction(store.ctx, &types.FetchDirectoryContents{
+		store.listing = &types.FetchDirectoryContents{
 			Directory:    store.Name,
 			SortCriteria: criteria,
 			Filter:       store.filter,
-		}, handle_return)
+		}
 	}
+	store.worker.PostAction(store.ctx, store.listing, handle_return)
+}
+
+// requested returns false if msg lists the messages of the directory in
+// response to a request which was not made by the store (e.g. by
+// :import-folder) or which has been superseded. Its filter and sort order
+// may differ from those of the store.
+func (store *MessageStore) requested(msg types.WorkerMessage) bool {
+	r := msg.InResponseTo()
+	return r == nil || r == store.listing
 }
 
 func (store *MessageStore) GetCurrentSortCriteria() []*types.SortCriterion {
@@ -0,0 +1,390 @@
+package outbox
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-maildir"
+	"github.com/emersion/go-message"
+	"github.com/emersion/go-message/mail"
+	"github.com/emersion/go-message/textproto"
+
+	"git.sr.ht/~rjarry/aerc/lib/log"
+	"git.sr.ht/~rjarry/aerc/lib/xdg"
+)
+
+// Header fields used to store the delivery parameters along with the
+// message. They are removed before the message is handed to the sender.
+const (
+	sendAtHeader = "X-Aerc-Outbox-Send-At"
+	fromHeader   = "X-Aerc-Outbox-From"
+	rcptHeader   = "X-Aerc-Outbox-Rcpt"
+	copyToHeader = "X-Aerc-Outbox-Copy-To"
+	dsnHeader    = "X-Aerc-Outbox-Dsn"
+	tryHeader    = "X-Aerc-Outbox-Attempts"
+	errorHeader  = "X-Aerc-Outbox-Error"
+)
+
+const controlPrefix = "X-Aerc-Outbox-"
+
+// Message is a message waiting in the outbox along with everything needed to
+// deliver it.
+type Message struct {
+	Key        string
+	SendAt     time.Time
+	From       *mail.Address
+	Rcpts      []*mail.Address
+	CopyTo     []string
+	RequestDSN bool
+	// Number of failed delivery attempts and the last error encountered.
+	Attempts  int
+	LastError string
+	// Header of the message, without the outbox control fields.
+	Header mail.Header
+}
+
+// DeliverFunc sends a message read from the outbox. body yields everything
+// that follows the header.
+type DeliverFunc func(msg *Message, body io.Reader) error
+
+// Outbox is a local maildir where messages wait until they are due.
+type Outbox struct {
+	lock     sync.Mutex
+	dir      maildir.Dir
+	deliver  DeliverFunc
+	onError  func(*Message, error)
+	onChange func()
+	timer    *time.Timer
+	busy     bool
+}
+
+// DefaultPath returns the location of the outbox of an account when none is
+// configured.
+func DefaultPath(account string) string {
+	return xdg.StatePath("aerc", "outbox", account)
+}
+
+// Open returns the outbox located at path, creating it if needed.
+func Open(path string) (*Outbox, error) {
+	path = xdg.ExpandHome(path)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	dir := maildir.Dir(path)
+	if err := dir.Init(); err != nil {
+		return nil, err
+	}
+	return &Outbox{dir: dir}, nil
+}
+
+// Add stores a complete RFC 5322 message in the outbox and arms the
+// delivery timer if the outbox is started. The Key field of msg is updated.
+func (o *Outbox) Add(msg *Message, r io.Reader) error {
+	br := bufio.NewReader(r)
+	h, err := textproto.ReadHeader(br)
+	if err != nil {
+		return fmt.Errorf("outbox: %w", err)
+	}
+	msg.Header = mail.Header{Header: message.Header{Header: h}}
+	if err := o.write(msg, br); err != nil {
+		return err
+	}
+	o.changed()
+	o.schedule()
+	return nil
+}
+
+func (o *Outbox) write(msg *Message, body io.Reader) error {
+	h := msg.Header.Copy()
+	h.Set(sendAtHeader, msg.SendAt.Format(time.RFC3339))
+	if msg.From != nil {
+		h.Set(fromHeader, msg.From.String())
+	}
+	for _, rcpt := range msg.Rcpts {
+		h.Add(rcptHeader, rcpt.String())
+	}
+	if len(msg.CopyTo) > 0 {
+		h.Set(copyToHeader, strings.Join(msg.CopyTo, ","))
+	}
+	if msg.RequestDSN {
+		h.Set(dsnHeader, strconv.FormatBool(msg.RequestDSN))
+	}
+	if msg.Attempts > 0 {
+		h.Set(tryHeader, strconv.Itoa(msg.Attempts))
+	}
+	if msg.LastError != "" {
+		h.Set(errorHeader, strings.Join(strings.Fields(msg.LastError), " "))
+	}
+
+	m, w, err := o.dir.Create(nil)
+	if err != nil {
+		return fmt.Errorf("outbox: %w", err)
+	}
+	err = textproto.WriteHeader(w, h.Header.Header)
+	if err == nil {
+		_, err = io.Copy(w, body)
+	}
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("outbox: %w", err)
+	}
+	msg.Key = m.Key()
+	return nil
+}
+
+// List returns all messages in the outbox ordered by delivery time.
+func (o *Outbox) List() ([]*Message, error) {
+	files, err := o.dir.Messages()
+	if err != nil {
+		return nil, err
+	}
+	var msgs []*Message
+	for _, f := range files {
+		msg, body, err := o.read(f)
+		if err != nil {
+			log.Errorf("outbox: %s: %v", f.Filename(), err)
+			continue
+		}
+		body.Close()
+		msgs = append(msgs, msg)
+	}
+	sort.SliceStable(msgs, func(i, j int) bool {
+		return msgs[i].SendAt.Before(msgs[j].SendAt)
+	})
+	return msgs, nil
+}
+
+// Len returns the number of messages waiting in the outbox.
+func (o *Outbox) Len() int {
+	files, err := o.dir.Messages()
+	if err != nil {
+		return 0
+	}
+	return len(files)
+}
+
+// Remove deletes a message from the outbox.
+func (o *Outbox) Remove(key string) error {
+	f, err := o.dir.MessageByKey(key)
+	if err != nil {
+		return err
+	}
+	if err := f.Remove(); err != nil {
+		return err
+	}
+	o.changed()
+	return nil
+}
+
+// OnChange registers a function that is called from a background goroutine
+// whenever messages are added to or removed from the outbox.
+func (o *Outbox) OnChange(fn func()) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.onChange = fn
+}
+
+func (o *Outbox) changed() {
+	o.lock.Lock()
+	fn := o.onChange
+	o.lock.Unlock()
+	if fn != nil {
+		fn()
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func (o *Outbox) read(f *maildir.Message) (*Message, io.ReadCloser, error) {
+	file, err := os.Open(f.Filename())
+	if err != nil {
+		return nil, nil, err
+	}
+	br := bufio.NewReader(file)
+	h, err := textproto.ReadHeader(br)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	msg := &Message{Key: f.Key()}
+	if msg.SendAt, err = time.Parse(time.RFC3339, h.Get(sendAtHeader)); err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("%s: %w", sendAtHeader, err)
+	}
+	if from := h.Get(fromHeader); from != "" {
+		if msg.From, err = mail.ParseAddress(from); err != nil {
+			file.Close()
+			return nil, nil, fmt.Errorf("%s: %w", fromHeader, err)
+		}
+	}
+	for _, rcpt := range h.Values(rcptHeader) {
+		addr, err := mail.ParseAddress(rcpt)
+		if err != nil {
+			file.Close()
+			return nil, nil, fmt.Errorf("%s: %w", rcptHeader, err)
+		}
+		msg.Rcpts = append(msg.Rcpts, addr)
+	}
+	if copyTo := h.Get(copyToHeader); copyTo != "" {
+		msg.CopyTo = strings.Split(copyTo, ",")
+	}
+	msg.RequestDSN, _ = strconv.ParseBool(h.Get(dsnHeader))
+	msg.Attempts, _ = strconv.Atoi(h.Get(tryHeader))
+	msg.LastError = h.Get(errorHeader)
+
+	fields := h.Fields()
+	for fields.Next() {
+		if strings.HasPrefix(fields.Key(), controlPrefix) {
+			fields.Del()
+		}
+	}
+	msg.Header = mail.Header{Header: message.Header{Header: h}}
+
+	return msg, readCloser{Reader: br, Closer: file}, nil
+}
+
+// Start arms the delivery timer. deliver is invoked from a background
+// goroutine for each message that is due. Messages are removed from the
+// outbox once delivered. If delivery fails, onError is called and the
+// message is retried later with an exponential backoff.
+func (o *Outbox) Start(deliver DeliverFunc, onError func(*Message, error)) {
+	o.lock.Lock()
+	started := o.deliver != nil
+	o.deliver = deliver
+	o.onError = onError
+	o.lock.Unlock()
+	if !started {
+		o.schedule()
+	}
+}
+
+// Stop disarms the delivery timer. It does not interrupt an ongoing
+// delivery.
+func (o *Outbox) Stop() {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.timer != nil {
+		o.timer.Stop()
+		o.timer = nil
+	}
+	o.deliver = nil
+}
+
+const (
+	minRetryDelay = time.Minute
+	maxRetryDelay = time.Hour
+)
+
+// RetryDelay returns the time to wait before attempting to deliver a message
+// again after the given number of failed attempts.
+func RetryDelay(attempts int) time.Duration {
+	delay := minRetryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+func (o *Outbox) schedule() {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.deliver == nil || o.busy {
+		return
+	}
+	if o.timer != nil {
+		o.timer.Stop()
+		o.timer = nil
+	}
+	msgs, err := o.List()
+	if err != nil {
+		log.Errorf("outbox: %v", err)
+		return
+	}
+	if len(msgs) == 0 {
+		return
+	}
+	o.timer = time.AfterFunc(time.Until(msgs[0].SendAt), o.flush)
+}
+
+func (o *Outbox) flush() {
+	defer log.PanicHandler()
+
+	o.lock.Lock()
+	if o.busy || o.deliver == nil {
+		o.lock.Unlock()
+		return
+	}
+	o.busy = true
+	deliver, onError := o.deliver, o.onError
+	o.lock.Unlock()
+
+	defer func() {
+		o.lock.Lock()
+		o.busy = false
+		o.lock.Unlock()
+		o.schedule()
+	}()
+
+	files, err := o.dir.Messages()
+	if err != nil {
+		log.Errorf("outbox: %v", err)
+		return
+	}
+	now := time.Now()
+	for _, f := range files {
+		msg, body, err := o.read(f)
+		if err != nil {
+			log.Errorf("outbox: %s: %v", f.Filename(), err)
+			continue
+		}
+		if msg.SendAt.After(now) {
+			body.Close()
+			continue
+		}
+		err = deliver(msg, body)
+		body.Close()
+		if err == nil {
+			if err := f.Remove(); err != nil {
+				log.Errorf("outbox: %v", err)
+			}
+			o.changed()
+			continue
+		}
+		if onError != nil {
+			onError(msg, err)
+		}
+		if err := o.retry(f, err); err != nil {
+			log.Errorf("outbox: %v", err)
+		}
+	}
+}
+
+// retry records a failed delivery attempt and postpones the message
+// accordingly.
+func (o *Outbox) retry(f *maildir.Message, failure error) error {
+	msg, body, err := o.read(f)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	msg.Attempts++
+	msg.LastError = failure.Error()
+	msg.SendAt = time.Now().Add(RetryDelay(msg.Attempts))
+	if err := o.write(msg, body); err != nil {
+		return err
+	}
+	return f.Remove()
+}
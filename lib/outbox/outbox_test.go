@@ -0,0 +1,144 @@
+package outbox_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-message/mail"
+
+	"git.sr.ht/~rjarry/aerc/lib/outbox"
+)
+
+const testMessage = "From: Alice <alice@example.com>\r\n" +
+	"To: Bob <bob@example.com>\r\n" +
+	"Subject: good morning\r\n" +
+	"\r\n" +
+	"Hello Bob!\r\n"
+
+func TestOutbox(t *testing.T) {
+	box, err := outbox.Open(filepath.Join(t.TempDir(), "outbox"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rcpt, _ := mail.ParseAddress("Bob <bob@example.com>")
+	later := time.Now().Add(time.Hour).Truncate(time.Second)
+	msg := &outbox.Message{
+		SendAt:     later,
+		Rcpts:      []*mail.Address{rcpt},
+		CopyTo:     []string{"Sent", "INBOX"},
+		RequestDSN: true,
+	}
+	if err := box.Add(msg, strings.NewReader(testMessage)); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Key == "" {
+		t.Fatal("no key assigned")
+	}
+	err = box.Add(&outbox.Message{
+		SendAt: time.Now().Add(-time.Minute),
+		Rcpts:  []*mail.Address{rcpt},
+	}, strings.NewReader(testMessage))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, err := box.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || box.Len() != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(msgs))
+	}
+	m := msgs[1]
+	if m.Key != msg.Key || !m.SendAt.Equal(later) || !m.RequestDSN ||
+		len(m.Rcpts) != 1 || m.Rcpts[0].Address != "bob@example.com" ||
+		strings.Join(m.CopyTo, ",") != "Sent,INBOX" {
+		t.Errorf("unexpected message: %#v", m)
+	}
+	if m.Header.Has("X-Aerc-Outbox-Send-At") {
+		t.Errorf("control fields not stripped")
+	}
+
+	err = box.Add(&outbox.Message{
+		SendAt: time.Now().Add(-time.Minute),
+		Rcpts:  []*mail.Address{rcpt},
+	}, strings.NewReader(testMessage))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Of the two messages that are due, the first delivery attempt fails
+	// and the second one succeeds.
+	sent := make(chan string, 1)
+	failed := make(chan error, 1)
+	attempts := 0
+	box.Start(func(m *outbox.Message, body io.Reader) error {
+		attempts++
+		if attempts == 1 {
+			return errors.New("connection refused")
+		}
+		var buf bytes.Buffer
+		_, err := io.Copy(&buf, body)
+		sent <- m.Header.Get("Subject") + ":" + buf.String()
+		return err
+	}, func(m *outbox.Message, err error) {
+		failed <- err
+	})
+	defer box.Stop()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-failed:
+			if err.Error() != "connection refused" {
+				t.Errorf("unexpected error: %v", err)
+			}
+		case s := <-sent:
+			if s != "good morning:Hello Bob!\r\n" {
+				t.Errorf("unexpected message: %q", s)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+		}
+	}
+	box.Stop()
+
+	// the delivered message is removed and the failed one is postponed
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		msgs, err = box.List()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(msgs) == 2 && msgs[0].Attempts == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected outbox contents: %d messages", len(msgs))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if msgs[0].LastError != "connection refused" ||
+		!msgs[0].SendAt.After(time.Now()) {
+		t.Errorf("failure not recorded: %#v", msgs[0])
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for attempts, delay := range map[int]time.Duration{
+		1:  time.Minute,
+		2:  2 * time.Minute,
+		4:  8 * time.Minute,
+		7:  time.Hour,
+		50: time.Hour,
+	} {
+		if d := outbox.RetryDelay(attempts); d != delay {
+			t.Errorf("attempts=%d: expected %s, got %s", attempts, delay, d)
+		}
+	}
+}
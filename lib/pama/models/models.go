@@ -68,8 +68,17 @@ type RevisionController interface {
 	Subject(string) string
 	// Author returns the author for the provided commit hash.
 	Author(string) string
+	// AuthorEmail returns the author's email address for the provided
+	// commit hash.
+	AuthorEmail(string) string
 	// Date returns the date for the provided commit hash.
 	Date(string) string
+	// Body returns the commit message for the provided commit hash without
+	// its subject line.
+	Body(string) string
+	// Diff returns the diffstat followed by the diff in git format for the
+	// provided commit hash.
+	Diff(string) (string, error)
 	// Drop removes the commit with the provided commit hash from the
 	// repository.
 	Drop(string) error
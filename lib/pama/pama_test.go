@@ -42,6 +42,7 @@ func newTestManager(
 type mockRevctrl struct {
 	commitIDs []string
 	titles    []string
+	diffs     map[string]string
 }
 
 func (c *mockRevctrl) Support() bool {
@@ -88,10 +89,22 @@ func (c *mockRevctrl) Author(commit string) string {
 	return ""
 }
 
+func (c *mockRevctrl) AuthorEmail(commit string) string {
+	return ""
+}
+
 func (c *mockRevctrl) Date(commit string) string {
 	return ""
 }
 
+func (c *mockRevctrl) Body(commit string) string {
+	return ""
+}
+
+func (c *mockRevctrl) Diff(commit string) (string, error) {
+	return c.diffs[commit], nil
+}
+
 func (c *mockRevctrl) Drop(commit string) error {
 	for i, s := range c.commitIDs {
 		if s == commit {
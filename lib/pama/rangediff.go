@@ -0,0 +1,153 @@
+package pama
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// RangeDiff compares two revisions of a patch set of the current project.
+// Commits are paired by subject, or else by diff similarity. The result
+// starts with a "diff" line and each pair is introduced by one of:
+//
+//	= i/n <old> <new> <subject>	unchanged commit
+//	! i/n <old> <new> <subject>	changed commit, followed by a unified diff
+//	> i/n ------- <new> <subject>	new commit, followed by its content
+//	< i/n <old> ------- <subject>	removed commit, followed by its content
+//
+// The changes between the commit messages and the diffs are shown as a diff
+// of their contents, which can be colored with the hldiff filter.
+func (m PatchManager) RangeDiff(oldTag, newTag string) (string, error) {
+	olds, err := m.Patches(oldTag)
+	if err != nil {
+		return "", err
+	}
+	news, err := m.Patches(newTag)
+	if err != nil {
+		return "", err
+	}
+
+	pairs := pairPatches(olds, news)
+	paired := make(map[int]bool)
+	var b strings.Builder
+	fmt.Fprintf(&b, "diff %s %s\n", oldTag, newTag)
+	for i := range news {
+		index := fmt.Sprintf("%d/%d", i+1, len(news))
+		j, ok := pairs[i]
+		if !ok {
+			writeRangeDiff(&b, '>', index, nil, &news[i])
+			continue
+		}
+		paired[j] = true
+		writeRangeDiff(&b, '!', index, &olds[j], &news[i])
+	}
+	for j := range olds {
+		if !paired[j] {
+			index := fmt.Sprintf("%d/%d", j+1, len(olds))
+			writeRangeDiff(&b, '<', index, &olds[j], nil)
+		}
+	}
+	return b.String(), nil
+}
+
+// minimum similarity of the diffs of two commits with different subjects to
+// pair them
+const minDiffSimilarity = 0.5
+
+// pairPatches returns the indexes of the old patches paired with the new ones.
+// Patches are paired by subject first. The remaining ones are paired with the
+// patch which has the most similar diff, like git range-diff does, so that
+// rewording a subject does not hide the changes.
+func pairPatches(olds, news []Patch) map[int]int {
+	pairs := make(map[int]int)
+	paired := make(map[int]bool)
+	for i, n := range news {
+		for j, o := range olds {
+			if !paired[j] && o.Subject == n.Subject {
+				pairs[i] = j
+				paired[j] = true
+				break
+			}
+		}
+	}
+	for i, n := range news {
+		if _, ok := pairs[i]; ok || n.Diff == "" {
+			continue
+		}
+		best, bestRatio := -1, minDiffSimilarity
+		for j, o := range olds {
+			if paired[j] || o.Diff == "" {
+				continue
+			}
+			m := difflib.NewMatcher(
+				difflib.SplitLines(o.normalizedDiff()),
+				difflib.SplitLines(n.normalizedDiff()),
+			)
+			if r := m.Ratio(); r >= bestRatio {
+				best, bestRatio = j, r
+			}
+		}
+		if best >= 0 {
+			pairs[i] = best
+			paired[best] = true
+		}
+	}
+	return pairs
+}
+
+func writeRangeDiff(b *strings.Builder, status rune, index string, o, n *Patch) {
+	oldID, newID := "-------", "-------"
+	var a, z []string
+	subject := ""
+	if o != nil {
+		oldID = shortID(o.ID)
+		a = difflib.SplitLines(o.content())
+		subject = o.Subject
+	}
+	if n != nil {
+		newID = shortID(n.ID)
+		z = difflib.SplitLines(n.content())
+		subject = n.Subject
+	}
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A: a, B: z, Context: 3,
+	})
+	if status == '!' && diff == "" {
+		status = '='
+	}
+	fmt.Fprintf(b, "%c %s %s %s %s\n", status, index, oldID, newID, subject)
+	b.WriteString(diff)
+}
+
+var (
+	blobLineRe = regexp.MustCompile(`(?m)^index [0-9a-f]+\.\.[0-9a-f]+.*\n`)
+	hunkLineRe = regexp.MustCompile(`(?m)^@@ -\d+(,\d+)? \+\d+(,\d+)? @@`)
+)
+
+// content returns the commit message and the diff of the patch. The blob
+// hashes and line numbers are removed since they change with the base.
+func (p *Patch) content() string {
+	var s strings.Builder
+	s.WriteString(p.Subject + "\n")
+	if p.Body != "" {
+		s.WriteString("\n" + p.Body + "\n")
+	}
+	s.WriteString("---\n" + p.normalizedDiff() + "\n")
+	return s.String()
+}
+
+// normalizedDiff returns the diff of the patch without the blob hashes and
+// line numbers.
+func (p *Patch) normalizedDiff() string {
+	diff := blobLineRe.ReplaceAllString(p.Diff, "")
+	return hunkLineRe.ReplaceAllString(diff, "@@")
+}
+
+func shortID(id string) string {
+	if len(id) > 7 {
+		return id[:7]
+	}
+	return id
+}
@@ -0,0 +1,104 @@
+package pama_test
+
+import (
+	"strings"
+	"testing"
+
+	"git.sr.ht/~rjarry/aerc/lib/pama/models"
+)
+
+func TestPatchmgmt_RangeDiff(t *testing.T) {
+	p := models.Project{
+		Name: "project1",
+		Commits: []models.Commit{
+			newCommit("1", "a", "fix_v1"),
+			newCommit("2", "b", "fix_v1"),
+			newCommit("3", "a", "fix_v2"),
+			newCommit("4", "c", "fix_v2"),
+		},
+		Base: newCommit("0", "0", ""),
+	}
+	mgr, _, _ := newTestManager(
+		[]string{"0", "1", "2", "3", "4"},
+		[]string{"0", "a", "b", "a", "c"},
+		map[string]models.Project{p.Name: p}, p.Name,
+	)
+
+	diff, err := mgr.RangeDiff("fix_v1", "fix_v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var headers []string
+	for _, line := range strings.Split(diff, "\n") {
+		// skip the diff content
+		if line != "" && !strings.ContainsAny(line[:1], "+-@ ") {
+			headers = append(headers, line)
+		}
+	}
+	want := []string{
+		"diff fix_v1 fix_v2",
+		"= 1/2 1 3 a",
+		"> 2/2 ------- 4 c",
+		"< 2/2 2 ------- b",
+	}
+	if strings.Join(headers, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected range-diff:\n%s", diff)
+	}
+	if !strings.Contains(diff, "\n+c\n") || !strings.Contains(diff, "\n-b\n") {
+		t.Errorf("missing added or removed commit content:\n%s", diff)
+	}
+
+	if _, err := mgr.RangeDiff("fix_v1", "unknown"); err == nil {
+		t.Error("unknown patch did not fail")
+	}
+}
+
+func TestPatchmgmt_RangeDiffReworded(t *testing.T) {
+	p := models.Project{
+		Name: "project1",
+		Commits: []models.Commit{
+			newCommit("1", "fix typo", "fix_v1"),
+			newCommit("2", "add feature", "fix_v1"),
+			newCommit("3", "doc: fix typo", "fix_v2"),
+			newCommit("4", "other feature", "fix_v2"),
+		},
+		Base: newCommit("0", "0", ""),
+	}
+	mgr, rc, _ := newTestManager(
+		[]string{"0", "1", "2", "3", "4"},
+		[]string{"0", "fix typo", "add feature", "doc: fix typo", "other feature"},
+		map[string]models.Project{p.Name: p}, p.Name,
+	)
+	typo := "--- a/README\n+++ b/README\n@@ -1,3 +1,3 @@\n" +
+		" title\n-teh\n+the\n end\n"
+	rc.(*mockRevctrl).diffs = map[string]string{
+		"1": typo,
+		"2": "--- a/main.go\n+++ b/main.go\n@@ -1 +1,2 @@\n main\n+feature()\n",
+		"3": strings.Replace(typo, "@@ -1,3 +1,3 @@", "@@ -4,3 +4,3 @@", 1),
+		"4": "--- a/lib.go\n+++ b/lib.go\n@@ -0,0 +1 @@\n+package lib\n",
+	}
+
+	diff, err := mgr.RangeDiff("fix_v1", "fix_v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var headers []string
+	for _, line := range strings.Split(diff, "\n") {
+		if line != "" && !strings.ContainsAny(line[:1], "+-@ ") {
+			headers = append(headers, line)
+		}
+	}
+	// the reworded commit is paired by its diff, unrelated diffs are not
+	want := []string{
+		"diff fix_v1 fix_v2",
+		"! 1/2 1 3 doc: fix typo",
+		"> 2/2 ------- 4 other feature",
+		"< 2/2 2 ------- add feature",
+	}
+	if strings.Join(headers, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected range-diff:\n%s", diff)
+	}
+	if !strings.Contains(diff, "\n-fix typo\n+doc: fix typo\n") {
+		t.Errorf("missing subject change:\n%s", diff)
+	}
+}
@@ -1,7 +1,6 @@
 package revctrl
 
 import (
-	"bytes"
 	"fmt"
 	"os"
 	"os/exec"
@@ -60,6 +59,14 @@ func (g git) Author(commit string) string {
 	return s
 }
 
+func (g git) AuthorEmail(commit string) string {
+	s, exitcode, err := g.do("log", "-1", "--pretty=%ae", commit)
+	if exitcode > 0 || err != nil {
+		return ""
+	}
+	return s
+}
+
 func (g git) Date(commit string) string {
 	s, exitcode, err := g.do("log", "-1", "--pretty=%as", commit)
 	if exitcode > 0 || err != nil {
@@ -68,6 +75,24 @@ func (g git) Date(commit string) string {
 	return s
 }
 
+func (g git) Body(commit string) string {
+	s, exitcode, err := g.do("log", "-1", "--pretty=%b", commit)
+	if exitcode > 0 || err != nil {
+		return ""
+	}
+	return s
+}
+
+func (g git) Diff(commit string) (string, error) {
+	// the first line of the diffstat is indented, do not trim it
+	s, exitcode, err := g.run("show", "--pretty=format:", "--stat",
+		"--patch", commit)
+	if exitcode > 0 && err == nil {
+		err = fmt.Errorf("git show %s failed", commit)
+	}
+	return strings.TrimRight(s, "\n"), err
+}
+
 func (g git) Drop(commit string) error {
 	_, exitcode, err := g.do("rebase", "--onto", commit+"^", commit)
 	if exitcode > 0 {
@@ -120,9 +145,14 @@ func (g git) ApplyCmd() string {
 }
 
 func (g git) do(args ...string) (string, int, error) {
+	s, exitcode, err := g.run(args...)
+	return strings.TrimSpace(s), exitcode, err
+}
+
+func (g git) run(args ...string) (string, int, error) {
 	proc := exec.Command("git", "-C", g.path)
 	proc.Args = append(proc.Args, args...)
 	proc.Env = os.Environ()
 	result, err := proc.Output()
-	return string(bytes.TrimSpace(result)), proc.ProcessState.ExitCode(), err
+	return string(result), proc.ProcessState.ExitCode(), err
 }
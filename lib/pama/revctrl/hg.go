@@ -0,0 +1,176 @@
+package revctrl
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"git.sr.ht/~rjarry/aerc/lib/log"
+	"git.sr.ht/~rjarry/aerc/lib/pama/models"
+)
+
+func init() {
+	register("hg", newHg)
+}
+
+func newHg(s string) models.RevisionController {
+	return &hg{path: strings.TrimSpace(s)}
+}
+
+type hg struct {
+	path string
+}
+
+func (h hg) Support() bool {
+	_, exitcode, err := h.do("root")
+	return exitcode == 0 && err == nil
+}
+
+func (h hg) Root() (string, error) {
+	s, _, err := h.do("root")
+	return s, err
+}
+
+func (h hg) Head() (string, error) {
+	return h.log(".", "{node}")
+}
+
+func (h hg) History(commit string) ([]string, error) {
+	s, err := h.log(fmt.Sprintf("only(., %s)", commit), "{node}\n")
+	return strings.Fields(s), err
+}
+
+func (h hg) Subject(commit string) string {
+	s, _ := h.log(commit, "{desc|firstline}")
+	return s
+}
+
+func (h hg) Author(commit string) string {
+	s, _ := h.log(commit, "{author|person}")
+	return s
+}
+
+func (h hg) AuthorEmail(commit string) string {
+	s, _ := h.log(commit, "{author|email}")
+	return s
+}
+
+func (h hg) Date(commit string) string {
+	s, _ := h.log(commit, "{date|shortdate}")
+	return s
+}
+
+func (h hg) Body(commit string) string {
+	s, _ := h.log(commit, "{desc}")
+	if _, body, ok := strings.Cut(s, "\n"); ok {
+		return strings.TrimSpace(body)
+	}
+	return ""
+}
+
+func (h hg) Diff(commit string) (string, error) {
+	// the first line of the diffstat is indented, do not trim it
+	stat, exitcode, err := h.run("diff", "--stat", "-c", commit)
+	if exitcode > 0 || err != nil {
+		return "", fmt.Errorf("hg diff -c %s failed: %w", commit, err)
+	}
+	diff, exitcode, err := h.run("diff", "--git", "-c", commit)
+	if exitcode > 0 || err != nil {
+		return "", fmt.Errorf("hg diff -c %s failed: %w", commit, err)
+	}
+	return strings.TrimRight(stat, "\n") + "\n\n" +
+		strings.TrimRight(diff, "\n"), nil
+}
+
+func (h hg) Drop(commit string) error {
+	// move the descendants onto the parent first, strip would remove them
+	children, err := h.log(fmt.Sprintf("children(%s)", commit), "{node}\n")
+	if err != nil {
+		return fmt.Errorf("failed to drop commit %s: %w", commit, err)
+	}
+	if children != "" {
+		_, exitcode, err := h.do("--config", "extensions.rebase=",
+			"rebase", "-s", fmt.Sprintf("children(%s)", commit),
+			"-d", fmt.Sprintf("p1(%s)", commit))
+		if exitcode > 0 || err != nil {
+			return fmt.Errorf("failed to drop commit %s", commit)
+		}
+	}
+	_, exitcode, err := h.do("--config", "extensions.strip=",
+		"strip", "-r", commit)
+	if exitcode > 0 {
+		return fmt.Errorf("failed to drop commit %s", commit)
+	}
+	return err
+}
+
+func (h hg) Exists(commit string) bool {
+	s, err := h.log(fmt.Sprintf("%s and ::.", commit), "{node}")
+	return s != "" && err == nil
+}
+
+func (h hg) Clean() bool {
+	// is a rebase, graft or histedit in progress?
+	states := []string{"rebasestate", "graftstate", "histedit-state"}
+	for _, state := range states {
+		if _, err := os.Stat(filepath.Join(h.path, ".hg", state)); !os.IsNotExist(err) {
+			log.Errorf("%s exists: another operation in progress..", state)
+			return false
+		}
+	}
+	// are there uncommitted changes?
+	s, exitcode, err := h.do("status", "--modified", "--added",
+		"--removed", "--deleted")
+	return len(s) == 0 && exitcode == 0 && err == nil
+}
+
+func (h hg) CreateWorktree(target, commit string) error {
+	_, exitcode, err := h.do("--config", "extensions.share=",
+		"share", "--noupdate", h.path, target)
+	if exitcode > 0 || err != nil {
+		return fmt.Errorf("failed to create worktree in %s: %w", target, err)
+	}
+	w := hg{path: target}
+	_, exitcode, err = w.do("update", "-r", commit)
+	if exitcode > 0 {
+		return fmt.Errorf("failed to create worktree in %s: %w", target, err)
+	}
+	return err
+}
+
+func (h hg) DeleteWorktree(target string) error {
+	// a shared repository only points to the store of its source
+	_, err := os.Stat(filepath.Join(target, ".hg", "sharedpath"))
+	if err != nil {
+		return fmt.Errorf("failed to delete worktree in %s: %w", target, err)
+	}
+	return os.RemoveAll(target)
+}
+
+func (h hg) ApplyCmd() string {
+	return fmt.Sprintf("hg -R %s import -", h.path)
+}
+
+func (h hg) log(revset, template string) (string, error) {
+	s, exitcode, err := h.do("log", "-r", revset, "-T", template)
+	if exitcode > 0 && err == nil {
+		err = fmt.Errorf("hg log -r %s failed", revset)
+	}
+	return s, err
+}
+
+func (h hg) do(args ...string) (string, int, error) {
+	s, exitcode, err := h.run(args...)
+	return strings.TrimSpace(s), exitcode, err
+}
+
+func (h hg) run(args ...string) (string, int, error) {
+	proc := exec.Command("hg", "--cwd", h.path)
+	proc.Args = append(proc.Args, args...)
+	// ignore the user configuration, aliases and localized output
+	proc.Env = append(os.Environ(), "HGPLAIN=1")
+	result, err := proc.Output()
+	return string(result), proc.ProcessState.ExitCode(), err
+}
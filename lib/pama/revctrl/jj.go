@@ -0,0 +1,172 @@
+package revctrl
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"git.sr.ht/~rjarry/aerc/lib/pama/models"
+)
+
+func init() {
+	register("jj", newJj)
+}
+
+func newJj(s string) models.RevisionController {
+	return &jj{path: strings.TrimSpace(s)}
+}
+
+// jj works on the parent of the working-copy commit, which plays the role of
+// HEAD. The working-copy commit itself must be empty.
+type jj struct {
+	path string
+}
+
+func (j jj) Support() bool {
+	_, exitcode, err := j.do("root")
+	return exitcode == 0 && err == nil
+}
+
+func (j jj) Root() (string, error) {
+	s, _, err := j.do("root")
+	return s, err
+}
+
+func (j jj) Head() (string, error) {
+	s, err := j.log("latest(@-)", `commit_id`)
+	return s, err
+}
+
+func (j jj) History(commit string) ([]string, error) {
+	s, err := j.log(fmt.Sprintf("%s..@-", commit), `commit_id ++ "\n"`,
+		"--reversed")
+	return strings.Fields(s), err
+}
+
+func (j jj) Subject(commit string) string {
+	s, _ := j.log(commit, `description.first_line()`)
+	return s
+}
+
+func (j jj) Author(commit string) string {
+	s, _ := j.log(commit, `author.name()`)
+	return s
+}
+
+func (j jj) AuthorEmail(commit string) string {
+	s, _ := j.log(commit, `author.email()`)
+	return s
+}
+
+func (j jj) Date(commit string) string {
+	s, _ := j.log(commit, `author.timestamp().format("%Y-%m-%d")`)
+	return s
+}
+
+func (j jj) Body(commit string) string {
+	s, _ := j.log(commit, `description`)
+	if _, body, ok := strings.Cut(s, "\n"); ok {
+		return strings.TrimSpace(body)
+	}
+	return ""
+}
+
+func (j jj) Diff(commit string) (string, error) {
+	stat, exitcode, err := j.do("diff", "-r", commit, "--stat")
+	if exitcode > 0 || err != nil {
+		return "", fmt.Errorf("jj diff -r %s failed: %w", commit, err)
+	}
+	diff, exitcode, err := j.do("diff", "-r", commit, "--git")
+	if exitcode > 0 || err != nil {
+		return "", fmt.Errorf("jj diff -r %s failed: %w", commit, err)
+	}
+	return stat + "\n\n" + diff, nil
+}
+
+func (j jj) Drop(commit string) error {
+	// descendants are rebased onto the parent automatically
+	_, exitcode, err := j.do("abandon", commit)
+	if exitcode > 0 {
+		return fmt.Errorf("failed to drop commit %s", commit)
+	}
+	return err
+}
+
+func (j jj) Exists(commit string) bool {
+	s, err := j.log(fmt.Sprintf("%s & ::@", commit), `commit_id`)
+	return s != "" && err == nil
+}
+
+func (j jj) Clean() bool {
+	// are there changes in the working-copy commit?
+	s, exitcode, err := j.do("diff", "-r", "@", "--summary")
+	if len(s) > 0 || exitcode != 0 || err != nil {
+		return false
+	}
+	// are there unresolved conflicts?
+	s, err = j.log("conflicts() & ::@", `commit_id`)
+	return len(s) == 0 && err == nil
+}
+
+func (j jj) CreateWorktree(target, commit string) error {
+	_, exitcode, err := j.do("workspace", "add", "-r", commit, target)
+	if exitcode > 0 {
+		return fmt.Errorf("failed to create worktree in %s: %w", target, err)
+	}
+	return err
+}
+
+func (j jj) DeleteWorktree(target string) error {
+	// workspaces are named after their directory by default
+	_, exitcode, err := j.do("workspace", "forget", filepath.Base(target))
+	if exitcode > 0 || err != nil {
+		return fmt.Errorf("failed to delete worktree in %s: %w", target, err)
+	}
+	return os.RemoveAll(target)
+}
+
+// jj cannot import patches. Each message is split with git and its diff is
+// applied to the working-copy commit which is then described and followed by
+// a new empty one.
+const jjApplyScript = `set -e
+cd '%s'
+d=$(mktemp -d)
+trap 'rm -rf "$d"' EXIT
+git mailsplit -o"$d" >/dev/null
+for m in "$d"/0*; do
+	git mailinfo "$d/msg" "$d/patch" <"$m" >"$d/info"
+	git apply "$d/patch"
+	name=$(sed -n 's/^Author: //p' "$d/info")
+	email=$(sed -n 's/^Email: //p' "$d/info")
+	{ sed -n 's/^Subject: //p' "$d/info"; echo; cat "$d/msg"; } |
+		jj describe --stdin --author "$name <$email>"
+	jj new
+done
+`
+
+func (j jj) ApplyCmd() string {
+	return fmt.Sprintf(jjApplyScript, j.path)
+}
+
+func (j jj) log(revset, template string, args ...string) (string, error) {
+	args = append([]string{
+		"log", "--no-graph", "-r", revset, "-T", template,
+	}, args...)
+	s, exitcode, err := j.do(args...)
+	if exitcode > 0 && err == nil {
+		err = fmt.Errorf("jj log -r %s failed", revset)
+	}
+	return s, err
+}
+
+func (j jj) do(args ...string) (string, int, error) {
+	proc := exec.Command("jj", "--color=never")
+	proc.Args = append(proc.Args, args...)
+	proc.Dir = j.path
+	proc.Env = os.Environ()
+	result, err := proc.Output()
+	return string(bytes.TrimSpace(result)), proc.ProcessState.ExitCode(), err
+}
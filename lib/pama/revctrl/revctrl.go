@@ -3,6 +3,8 @@ package revctrl
 import (
 	"errors"
 	"fmt"
+	"maps"
+	"slices"
 
 	"git.sr.ht/~rjarry/aerc/lib/log"
 	"git.sr.ht/~rjarry/aerc/lib/pama/models"
@@ -32,8 +34,13 @@ type detector interface {
 }
 
 func Detect(path string) (string, string, error) {
-	for controllerID, factoryFunc := range controllers {
-		rc, ok := factoryFunc(path).(detector)
+	ids := slices.Sorted(maps.Keys(controllers))
+	// jj repositories can be colocated with a git repository, try git last
+	if i := slices.Index(ids, "git"); i >= 0 {
+		ids = append(slices.Delete(ids, i, i+1), "git")
+	}
+	for _, controllerID := range ids {
+		rc, ok := controllers[controllerID](path).(detector)
 		if ok && rc.Support() {
 			log.Tracef("support found for %v", controllerID)
 			root, err := rc.Root()
@@ -0,0 +1,225 @@
+package revctrl
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const testPatch = `From 0000000000000000000000000000000000000000 Mon Sep 17 00:00:00 2001
+From: Jane Doe <jane@example.com>
+Date: Mon, 1 Jan 2024 12:00:00 +0100
+Subject: [PATCH] add c
+
+Some details.
+---
+ c | 1 +
+ 1 file changed, 1 insertion(+)
+ create mode 100644 c
+
+diff --git a/c b/c
+new file mode 100644
+--- /dev/null
++++ b/c
+@@ -0,0 +1 @@
++hello
+--
+2.43.0
+`
+
+type testRepo struct {
+	init   [][]string
+	commit [][]string
+}
+
+var testRepos = map[string]testRepo{
+	"git": {
+		init: [][]string{{"git", "init", "-q"}},
+		commit: [][]string{
+			{"git", "add", "-A"},
+			{"git", "commit", "-q", "-m"},
+		},
+	},
+	"hg": {
+		init:   [][]string{{"hg", "init"}},
+		commit: [][]string{{"hg", "commit", "-A", "-m"}},
+	},
+	"jj": {
+		init:   [][]string{{"jj", "git", "init"}},
+		commit: [][]string{{"jj", "commit", "-m"}},
+	},
+}
+
+func TestRevisionControllers(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", home)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	for _, v := range []string{"GIT_AUTHOR", "GIT_COMMITTER"} {
+		t.Setenv(v+"_NAME", "John Doe")
+		t.Setenv(v+"_EMAIL", "john@example.com")
+	}
+	t.Setenv("HGUSER", "John Doe <john@example.com>")
+	t.Setenv("JJ_USER", "John Doe")
+	t.Setenv("JJ_EMAIL", "john@example.com")
+
+	for id, repo := range testRepos {
+		t.Run(id, func(t *testing.T) {
+			if _, err := exec.LookPath(id); err != nil {
+				t.Skipf("%s not installed", id)
+			}
+			testRevisionController(t, id, repo)
+		})
+	}
+}
+
+func testRevisionController(t *testing.T, id string, repo testRepo) {
+	dir := t.TempDir()
+	run := func(stdin string, args ...string) {
+		t.Helper()
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Dir = dir
+		cmd.Stdin = strings.NewReader(stdin)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%v: %v\n%s", args, err, out)
+		}
+	}
+	commit := func(name, subject string) {
+		t.Helper()
+		err := os.WriteFile(filepath.Join(dir, name), []byte(subject+"\n"), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, args := range repo.commit {
+			if i == len(repo.commit)-1 {
+				args = append(args, subject)
+			}
+			run("", args...)
+		}
+	}
+	for _, args := range repo.init {
+		run("", args...)
+	}
+
+	detected, _, err := Detect(dir)
+	if err != nil || detected != id {
+		t.Fatalf("detected %q: %v", detected, err)
+	}
+	rc, err := New(id, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commit("a", "base")
+	base, err := rc.Head()
+	if err != nil || base == "" {
+		t.Fatalf("no head: %v", err)
+	}
+	commit("a", "first")
+	commit("b", "second")
+
+	history, err := rc.History(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("unexpected history %v", history)
+	}
+	if head, _ := rc.Head(); history[1] != head {
+		t.Errorf("history does not end with head %s: %v", head, history)
+	}
+	if s := rc.Subject(history[1]); s != "second" {
+		t.Errorf("unexpected subject %q", s)
+	}
+	if s := rc.Author(history[1]); s != "John Doe" {
+		t.Errorf("unexpected author %q", s)
+	}
+	if s := rc.AuthorEmail(history[1]); s != "john@example.com" {
+		t.Errorf("unexpected author email %q", s)
+	}
+	if s := rc.Date(history[1]); !regexp.MustCompile(`^\d{4}-\d\d-\d\d$`).MatchString(s) {
+		t.Errorf("unexpected date %q", s)
+	}
+	if s := rc.Body(history[1]); s != "" {
+		t.Errorf("unexpected body %q", s)
+	}
+	diff, err := rc.Diff(history[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(diff, "1 file") ||
+		!strings.Contains(diff, "\n\ndiff --git a/b b/b\n") ||
+		!strings.HasSuffix(diff, "\n+second") {
+		t.Errorf("unexpected diff %q", diff)
+	}
+	if !rc.Exists(history[0]) {
+		t.Errorf("%s does not exist", history[0])
+	}
+
+	if !rc.Clean() {
+		t.Fatal("repository not clean")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "b"), []byte("dirty\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if rc.Clean() {
+		t.Error("uncommitted changes not detected")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "b"), []byte("second\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rc.Drop(history[0]); err != nil {
+		t.Fatal(err)
+	}
+	if rc.Exists(history[0]) {
+		t.Errorf("%s still exists", history[0])
+	}
+	history, err = rc.History(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || rc.Subject(history[0]) != "second" {
+		t.Fatalf("unexpected history after drop %v", history)
+	}
+
+	before, _ := rc.Head()
+	run(testPatch, "sh", "-c", rc.ApplyCmd())
+	history, err = rc.History(before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("unexpected history after apply %v", history)
+	}
+	if s := rc.Subject(history[0]); s != "add c" {
+		t.Errorf("unexpected subject %q", s)
+	}
+	if s := rc.Author(history[0]); s != "Jane Doe" {
+		t.Errorf("unexpected author %q", s)
+	}
+	if s := rc.AuthorEmail(history[0]); s != "jane@example.com" {
+		t.Errorf("unexpected author email %q", s)
+	}
+	if s := rc.Body(history[0]); s != "Some details." {
+		t.Errorf("unexpected body %q", s)
+	}
+
+	target := filepath.Join(t.TempDir(), "worktree")
+	if err := rc.CreateWorktree(target, base); err != nil {
+		t.Fatal(err)
+	}
+	wt, _ := New(id, target)
+	if head, _ := wt.Head(); head != base {
+		t.Errorf("worktree head %s, expected %s", head, base)
+	}
+	if err := rc.DeleteWorktree(target); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("worktree not deleted: %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package pama
+
+import (
+	"fmt"
+
+	"git.sr.ht/~rjarry/aerc/lib/log"
+	"git.sr.ht/~rjarry/aerc/lib/pama/models"
+)
+
+// Patch is a tracked commit with the content needed to send it by email.
+type Patch struct {
+	models.Commit
+	// AuthorEmail is the email address of the commit author.
+	AuthorEmail string
+	// Body is the commit message without its subject line.
+	Body string
+	// Diff contains the diffstat followed by the diff.
+	Diff string
+}
+
+// Patches returns the commits of the current project with the provided tag
+// in the order of the commit history.
+func (m PatchManager) Patches(tag string) ([]Patch, error) {
+	p, err := m.CurrentProject()
+	if err != nil {
+		return nil, err
+	}
+
+	if !models.Commits(p.Commits).HasTag(tag) {
+		return nil, fmt.Errorf("Patch '%s' not found in project '%s'", tag, p.Name)
+	}
+
+	rc, err := m.rc(p.RevctrlID, p.Root)
+	if err != nil {
+		return nil, revErr(err)
+	}
+
+	var patches []Patch
+	for _, c := range p.Commits {
+		if c.Tag != tag {
+			continue
+		}
+		if !rc.Exists(c.ID) {
+			log.Errorf("failed to find commit. %v", c)
+			return nil, fmt.Errorf("Cannot send patch. " +
+				"Please rebase first with ':patch rebase'")
+		}
+		diff, err := rc.Diff(c.ID)
+		if err != nil {
+			return nil, revErr(err)
+		}
+		patches = append(patches, Patch{
+			Commit:      models.NewCommit(rc, c.ID, c.Tag),
+			AuthorEmail: rc.AuthorEmail(c.ID),
+			Body:        rc.Body(c.ID),
+			Diff:        diff,
+		})
+	}
+	return patches, nil
+}
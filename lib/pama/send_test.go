@@ -0,0 +1,49 @@
+package pama_test
+
+import (
+	"reflect"
+	"testing"
+
+	"git.sr.ht/~rjarry/aerc/lib/pama/models"
+)
+
+func TestPatchmgmt_Patches(t *testing.T) {
+	p := models.Project{
+		Name: "project1",
+		Commits: []models.Commit{
+			newCommit("1", "a", "patch1"),
+			newCommit("2", "b", "patch2"),
+			newCommit("3", "c", "patch1"),
+			newCommit("4", "d", "gone"),
+		},
+		Base: newCommit("0", "0", ""),
+	}
+	mgr, _, _ := newTestManager(
+		[]string{"0", "1", "2", "3"},
+		[]string{"0", "a", "b", "c"},
+		map[string]models.Project{p.Name: p}, p.Name,
+	)
+
+	patches, err := mgr.Patches("patch1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []models.Commit
+	for _, patch := range patches {
+		got = append(got, patch.Commit)
+	}
+	want := []models.Commit{
+		newCommit("1", "a", "patch1"),
+		newCommit("3", "c", "patch1"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, but wanted %v", got, want)
+	}
+
+	if _, err := mgr.Patches("unknown"); err == nil {
+		t.Error("unknown patch did not fail")
+	}
+	if _, err := mgr.Patches("gone"); err == nil {
+		t.Error("patch with a missing commit did not fail")
+	}
+}
@@ -0,0 +1,80 @@
+package parse
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+var sendTimeLayouts = []string{
+	"2006-01-02 15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02T15:04:05",
+}
+
+// SendTime parses a point in time in the future relative to now. The
+// following formats are accepted:
+//
+//	+1h30m             a duration (the leading + is optional)
+//	08:00              the next occurrence of that time of the day
+//	today 18:00
+//	tomorrow 08:00
+//	2025-01-31 08:00   an absolute local date and time
+//	2025-01-31T08:00:00+01:00
+//
+// An error is returned if the resulting time is not after now.
+func SendTime(s string, now time.Time) (time.Time, error) {
+	s0 := s
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return time.Time{}, fmt.Errorf("empty time")
+	}
+
+	t, err := sendTime(s, now)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: %w", s0, err)
+	}
+	if !t.After(now) {
+		return time.Time{}, fmt.Errorf("%q is in the past", s0)
+	}
+	return t, nil
+}
+
+func sendTime(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(strings.TrimPrefix(s, "+")); err == nil {
+		return now.Add(d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, strings.ToUpper(s)); err == nil {
+		return t, nil
+	}
+	for _, layout := range sendTimeLayouts {
+		t, err := time.ParseInLocation(layout, strings.ToUpper(s), now.Location())
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	day, clock, found := strings.Cut(s, " ")
+	if !found {
+		day, clock = "", s
+	}
+	hm, err := time.Parse("15:04", strings.TrimSpace(clock))
+	if err != nil {
+		return time.Time{}, err
+	}
+	y, m, d := now.Date()
+	t := time.Date(y, m, d, hm.Hour(), hm.Minute(), 0, 0, now.Location())
+	switch day {
+	case "":
+		if !t.After(now) {
+			t = t.AddDate(0, 0, 1)
+		}
+	case "today":
+	case "tomorrow":
+		t = t.AddDate(0, 0, 1)
+	default:
+		return time.Time{}, fmt.Errorf("unknown day %q", day)
+	}
+	return t, nil
+}
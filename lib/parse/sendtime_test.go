@@ -0,0 +1,48 @@
+package parse_test
+
+import (
+	"testing"
+	"time"
+
+	"git.sr.ht/~rjarry/aerc/lib/parse"
+)
+
+func TestSendTime(t *testing.T) {
+	now := time.Date(2025, 1, 31, 22, 15, 0, 0, time.Local)
+	tests := []struct {
+		s        string
+		expected time.Time
+	}{
+		{"+30m", now.Add(30 * time.Minute)},
+		{"1h30m", now.Add(90 * time.Minute)},
+		{"23:00", time.Date(2025, 1, 31, 23, 0, 0, 0, time.Local)},
+		{"08:00", time.Date(2025, 2, 1, 8, 0, 0, 0, time.Local)},
+		{"today 23:30", time.Date(2025, 1, 31, 23, 30, 0, 0, time.Local)},
+		{"Tomorrow 7:45", time.Date(2025, 2, 1, 7, 45, 0, 0, time.Local)},
+		{"2025-02-03 09:00", time.Date(2025, 2, 3, 9, 0, 0, 0, time.Local)},
+		{"2025-02-03T09:00:30", time.Date(2025, 2, 3, 9, 0, 30, 0, time.Local)},
+		{
+			"2025-02-03T09:00:00Z",
+			time.Date(2025, 2, 3, 9, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.s, func(t *testing.T) {
+			res, err := parse.SendTime(test.s, now)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !res.Equal(test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, res)
+			}
+		})
+	}
+
+	for _, s := range []string{"", "-1h", "today 08:00", "2024-12-25 10:00", "someday 10:00", "25:00"} {
+		t.Run("invalid "+s, func(t *testing.T) {
+			if res, err := parse.SendTime(s, now); err == nil {
+				t.Errorf("expected error, got %v", res)
+			}
+		})
+	}
+}
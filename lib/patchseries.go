@@ -0,0 +1,184 @@
+package lib
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"git.sr.ht/~rjarry/aerc/lib/jwz"
+	"git.sr.ht/~rjarry/aerc/models"
+	sortthread "github.com/emersion/go-imap-sortthread"
+)
+
+var (
+	patchPrefixRe  = regexp.MustCompile(`\[([^\]]*\bPATCH\b[^\]]*)\]`)
+	patchIndexRe   = regexp.MustCompile(`^(\d+)/(\d+)$`)
+	patchVersionRe = regexp.MustCompile(`^[vV](\d+)$`)
+)
+
+// PatchSubject holds the information of a [PATCH vN i/n] subject prefix.
+type PatchSubject struct {
+	// Version is the revision of the series, 1 if not specified.
+	Version int
+	// Index is the position in the series, 0 for a cover letter.
+	Index int
+	// Total is the number of patches in the series.
+	Total int
+}
+
+// ParsePatchSubject returns false if the subject has no PATCH prefix or is a
+// reply to a patch.
+func ParsePatchSubject(subject string) (PatchSubject, bool) {
+	ps := PatchSubject{Version: 1, Index: 1, Total: 1}
+	if _, isReply := sortthread.GetBaseSubject(subject); isReply {
+		return ps, false
+	}
+	m := patchPrefixRe.FindStringSubmatch(subject)
+	if m == nil {
+		return ps, false
+	}
+	for _, field := range strings.Fields(m[1]) {
+		if v := patchVersionRe.FindStringSubmatch(field); v != nil {
+			ps.Version, _ = strconv.Atoi(v[1])
+		} else if i := patchIndexRe.FindStringSubmatch(field); i != nil {
+			ps.Index, _ = strconv.Atoi(i[1])
+			ps.Total, _ = strconv.Atoi(i[2])
+		}
+	}
+	if ps.Total < 1 || ps.Index > ps.Total {
+		return ps, false
+	}
+	return ps, true
+}
+
+// PatchSeries is one revision of a patch series.
+type PatchSeries struct {
+	Version int
+	// Cover is the cover letter, nil if there is none.
+	Cover *models.MessageInfo
+	// Patches are ordered by index. Missing patches are nil.
+	Patches []*models.MessageInfo
+}
+
+// Complete returns true if no patch is missing.
+func (s *PatchSeries) Complete() bool {
+	return len(s.Missing()) == 0
+}
+
+// Missing returns the indexes of the missing patches.
+func (s *PatchSeries) Missing() []int {
+	var missing []int
+	for i, msg := range s.Patches {
+		if msg == nil {
+			missing = append(missing, i+1)
+		}
+	}
+	return missing
+}
+
+// Uids returns the uids of the patches in order, without the cover letter.
+func (s *PatchSeries) Uids() []models.UID {
+	var uids []models.UID
+	for _, msg := range s.Patches {
+		if msg != nil {
+			uids = append(uids, msg.Uid)
+		}
+	}
+	return uids
+}
+
+// Subject returns the subject of the cover letter or of the first patch.
+func (s *PatchSeries) Subject() string {
+	if s.Cover != nil {
+		return s.Cover.Envelope.Subject
+	}
+	for _, msg := range s.Patches {
+		if msg != nil {
+			return msg.Envelope.Subject
+		}
+	}
+	return ""
+}
+
+// ThreadPatchSeries threads the messages by their references and returns the
+// revisions of the patch series found in the thread that contains uid, from
+// the oldest to the newest version.
+func ThreadPatchSeries(msgs []*models.MessageInfo, uid models.UID) []*PatchSeries {
+	threadables := make([]jwz.Threadable, 0, len(msgs))
+	for _, msg := range msgs {
+		if msg == nil || msg.Envelope == nil {
+			continue
+		}
+		if t := newThreadable(msg, false); t != nil {
+			threadables = append(threadables, t)
+		}
+	}
+	structure, err := jwz.NewThreader().ThreadSlice(threadables)
+	if err != nil {
+		return nil
+	}
+
+	var thread []*models.MessageInfo
+	for root := structure; root != nil; root = root.GetNext() {
+		var msgs []*models.MessageInfo
+		collectThread(root, &msgs)
+		if slices.ContainsFunc(msgs, func(msg *models.MessageInfo) bool {
+			return msg.Uid == uid
+		}) {
+			thread = msgs
+			break
+		}
+	}
+
+	return groupPatchSeries(thread)
+}
+
+// collectThread appends the messages of the thread tree below node to msgs.
+func collectThread(node jwz.Threadable, msgs *[]*models.MessageInfo) {
+	if t, ok := node.(*threadable); ok && !t.IsDummy() {
+		*msgs = append(*msgs, t.MsgInfo)
+	}
+	for child := node.GetChild(); child != nil; child = child.GetNext() {
+		collectThread(child, msgs)
+	}
+}
+
+func groupPatchSeries(msgs []*models.MessageInfo) []*PatchSeries {
+	// when a patch was sent twice, keep the newest one
+	newer := func(a, b *models.MessageInfo) bool {
+		return b == nil || a.Envelope.Date.After(b.Envelope.Date)
+	}
+
+	versions := make(map[int]*PatchSeries)
+	for _, msg := range msgs {
+		ps, ok := ParsePatchSubject(msg.Envelope.Subject)
+		if !ok {
+			continue
+		}
+		s, ok := versions[ps.Version]
+		if !ok {
+			s = &PatchSeries{Version: ps.Version}
+			versions[ps.Version] = s
+		}
+		for len(s.Patches) < ps.Total {
+			s.Patches = append(s.Patches, nil)
+		}
+		if ps.Index == 0 {
+			if newer(msg, s.Cover) {
+				s.Cover = msg
+			}
+		} else if newer(msg, s.Patches[ps.Index-1]) {
+			s.Patches[ps.Index-1] = msg
+		}
+	}
+
+	series := make([]*PatchSeries, 0, len(versions))
+	for _, s := range versions {
+		series = append(series, s)
+	}
+	slices.SortFunc(series, func(a, b *PatchSeries) int {
+		return a.Version - b.Version
+	})
+	return series
+}
@@ -0,0 +1,85 @@
+package lib
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"git.sr.ht/~rjarry/aerc/models"
+)
+
+func TestParsePatchSubject(t *testing.T) {
+	tests := []struct {
+		subject string
+		want    PatchSubject
+		ok      bool
+	}{
+		{"[PATCH] fix", PatchSubject{1, 1, 1}, true},
+		{"[PATCH 2/3] fix", PatchSubject{1, 2, 3}, true},
+		{"[PATCH v4 0/3] cover", PatchSubject{4, 0, 3}, true},
+		{"[RFC PATCH aerc v2 10/12] fix", PatchSubject{2, 10, 12}, true},
+		{"[PATCH 4/3] fix", PatchSubject{}, false},
+		{"Re: [PATCH v2 1/2] fix", PatchSubject{}, false},
+		{"[BUG] crash", PatchSubject{}, false},
+		{"no prefix", PatchSubject{}, false},
+	}
+	for _, test := range tests {
+		got, ok := ParsePatchSubject(test.subject)
+		if ok != test.ok || (ok && got != test.want) {
+			t.Errorf("%q: got %v %v, but wanted %v %v",
+				test.subject, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestThreadPatchSeries(t *testing.T) {
+	date := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var msgs []*models.MessageInfo
+	add := func(uid, subject, msgid string, refs ...string) {
+		date = date.Add(time.Minute)
+		msgs = append(msgs, &models.MessageInfo{
+			Uid:  models.UID(uid),
+			Refs: refs,
+			Envelope: &models.Envelope{
+				Subject:   subject,
+				MessageId: msgid,
+				Date:      date,
+			},
+		})
+	}
+	add("1", "[PATCH 0/2] cover", "c1")
+	add("2", "[PATCH 1/2] first", "p1", "c1")
+	add("3", "[PATCH 2/2] second", "p2", "c1")
+	add("4", "Re: [PATCH 2/2] second", "r1", "c1", "p2")
+	add("5", "[PATCH v2 0/3] cover", "c2", "c1")
+	add("6", "[PATCH v2 3/3] third", "q3", "c1", "c2")
+	add("7", "[PATCH v2 1/3] first", "q1", "c1", "c2")
+	add("8", "[PATCH v2 1/3] first", "q1bis", "c1", "c2")
+	add("9", "[PATCH] unrelated", "u1")
+
+	series := ThreadPatchSeries(msgs, "4")
+	if len(series) != 2 {
+		t.Fatalf("unexpected series %v", series)
+	}
+	v1, v2 := series[0], series[1]
+	if v1.Version != 1 || !v1.Complete() || v1.Cover != msgs[0] {
+		t.Errorf("unexpected v1 %v", v1)
+	}
+	if uids := v1.Uids(); !reflect.DeepEqual(uids, []models.UID{"2", "3"}) {
+		t.Errorf("unexpected v1 uids %v", uids)
+	}
+	if v2.Version != 2 || v2.Subject() != "[PATCH v2 0/3] cover" {
+		t.Errorf("unexpected v2 %v", v2)
+	}
+	if missing := v2.Missing(); !reflect.DeepEqual(missing, []int{2}) {
+		t.Errorf("unexpected v2 missing patches %v", missing)
+	}
+	if uids := v2.Uids(); !reflect.DeepEqual(uids, []models.UID{"8", "6"}) {
+		t.Errorf("unexpected v2 uids %v", uids)
+	}
+
+	series = ThreadPatchSeries(msgs, "9")
+	if len(series) != 1 || !reflect.DeepEqual(series[0].Uids(), []models.UID{"9"}) {
+		t.Errorf("unexpected series %v", series)
+	}
+}
@@ -0,0 +1,35 @@
+package send
+
+import (
+	"errors"
+	"os/exec"
+
+	"github.com/emersion/go-smtp"
+)
+
+// sysexits(3) codes returned by sendmail compatible programs for errors that
+// will not go away by trying again.
+var permanentExitCodes = map[int]bool{
+	64: true, // EX_USAGE
+	65: true, // EX_DATAERR
+	67: true, // EX_NOUSER
+	68: true, // EX_NOHOST
+	77: true, // EX_NOPERM
+	78: true, // EX_CONFIG
+}
+
+// IsTemporary reports whether sending a message may succeed if attempted
+// again later. SMTP 5xx replies (e.g. rejected recipients or failed
+// authentication) and sendmail usage or data errors are permanent. Anything
+// else, including network failures, is considered temporary.
+func IsTemporary(err error) bool {
+	var smtpErr *smtp.SMTPError
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Temporary()
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return !permanentExitCodes[exitErr.ExitCode()]
+	}
+	return err != nil
+}
@@ -0,0 +1,40 @@
+package send
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+
+	"github.com/emersion/go-smtp"
+	pkgerrors "github.com/pkg/errors"
+)
+
+func TestIsTemporary(t *testing.T) {
+	exit := func(code int) error {
+		err := exec.Command("sh", "-c", fmt.Sprintf("exit %d", code)).Run()
+		if err == nil {
+			t.Fatal("command did not fail")
+		}
+		return err
+	}
+	tests := []struct {
+		name      string
+		err       error
+		temporary bool
+	}{
+		{"nil", nil, false},
+		{"network", errors.New("dial tcp: connection refused"), true},
+		{"smtp 4xx", pkgerrors.Wrap(&smtp.SMTPError{Code: 451}, "conn.Rcpt"), true},
+		{"smtp 5xx", pkgerrors.Wrap(&smtp.SMTPError{Code: 535}, "conn.Auth"), false},
+		{"EX_TEMPFAIL", exit(75), true},
+		{"EX_NOUSER", exit(67), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if IsTemporary(test.err) != test.temporary {
+				t.Errorf("expected %v for %v", test.temporary, test.err)
+			}
+		})
+	}
+}
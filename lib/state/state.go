@@ -8,6 +8,7 @@ type AccountState struct {
 	Connected    bool
 	connActivity string
 	passthrough  bool
+	outbox       int
 	folders      map[string]*folderState
 }
 
@@ -95,3 +96,9 @@ func Passthrough(on bool) SetStateFunc {
 		s.passthrough = on
 	}
 }
+
+func Outbox(queued int) SetStateFunc {
+	return func(s *AccountState, folder string) {
+		s.outbox = queued
+	}
+}
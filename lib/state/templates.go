@@ -654,6 +654,9 @@ func (d *templateData) ContentInfo() string {
 	if fldr.Search != "" {
 		content = append(content, texter().FormatSearch(fldr.Search))
 	}
+	if d.state.outbox > 0 {
+		content = append(content, texter().FormatOutbox(d.state.outbox))
+	}
 	return strings.Join(content, config.Statusline().Separator)
 }
 
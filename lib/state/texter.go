@@ -1,6 +1,7 @@
 package state
 
 import (
+	"fmt"
 	"strings"
 
 	"git.sr.ht/~rjarry/aerc/config"
@@ -15,6 +16,7 @@ type texterInterface interface {
 	Visual() string
 	FormatFilter(string) string
 	FormatSearch(string) string
+	FormatOutbox(int) string
 }
 
 type text struct{}
@@ -53,6 +55,10 @@ func (t text) FormatSearch(s string) string {
 	return s
 }
 
+func (t text) FormatOutbox(n int) string {
+	return fmt.Sprintf("%d queued", n)
+}
+
 type icon struct{}
 
 var icn icon
@@ -89,6 +95,10 @@ func (i icon) FormatSearch(s string) string {
 	return strings.ReplaceAll(s, "search", "🔎")
 }
 
+func (i icon) FormatOutbox(n int) string {
+	return fmt.Sprintf("📤 %d", n)
+}
+
 func texter() texterInterface {
 	switch strings.ToLower(config.Statusline().DisplayMode) {
 	case "icon":
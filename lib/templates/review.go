@@ -0,0 +1,91 @@
+package templates
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	quotedFileRe = regexp.MustCompile(`^> ?diff `)
+	quotedHunkRe = regexp.MustCompile(`^> ?@@ `)
+)
+
+type reviewBlock struct {
+	lines     []string
+	file      bool
+	commented bool
+}
+
+// TrimQuotedHunks removes the quoted diff hunks of a patch review which have
+// no comments. A comment is any unquoted line between a quoted hunk header
+// and the next one. Quoted file headers are removed when none of their hunks
+// are kept. Everything before the first quoted diff header is left untouched,
+// and so is any text after the last quoted line of the diff or after the
+// signature delimiter.
+func TrimQuotedHunks(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	lines := strings.Split(text, "\n")
+
+	head := &reviewBlock{}
+	blocks := []*reviewBlock{head}
+	var tail []string
+	for i, line := range lines {
+		if line == "-- " {
+			tail = lines[i:]
+			break
+		}
+		block := blocks[len(blocks)-1]
+		switch {
+		case quotedFileRe.MatchString(line):
+			block = &reviewBlock{file: true}
+			blocks = append(blocks, block)
+		case quotedHunkRe.MatchString(line):
+			block = &reviewBlock{}
+			blocks = append(blocks, block)
+		case isReviewComment(line):
+			block.commented = true
+		}
+		block.lines = append(block.lines, line)
+	}
+
+	// text after the last quoted line is not a comment of the last hunk
+	// but the conclusion of the review
+	if last := blocks[len(blocks)-1]; len(blocks) > 1 && last.commented {
+		end := len(last.lines)
+		for end > 0 && !strings.HasPrefix(last.lines[end-1], ">") {
+			end--
+		}
+		tail = append(slices.Clone(last.lines[end:]), tail...)
+		last.lines = last.lines[:end]
+		last.commented = slices.ContainsFunc(last.lines, isReviewComment)
+	}
+
+	// a file header is kept if one of its hunks is kept
+	keep := make([]bool, len(blocks))
+	keep[0] = true
+	file := -1
+	for i, block := range blocks[1:] {
+		i++
+		if block.file {
+			file = i
+		}
+		keep[i] = block.commented
+		if block.commented && file >= 0 {
+			keep[file] = true
+		}
+	}
+
+	var trimmed []string
+	for i, block := range blocks {
+		if keep[i] {
+			trimmed = append(trimmed, block.lines...)
+		}
+	}
+	trimmed = append(trimmed, tail...)
+	return strings.Join(trimmed, "\n")
+}
+
+func isReviewComment(line string) bool {
+	return strings.TrimSpace(line) != "" && !strings.HasPrefix(line, ">")
+}
@@ -0,0 +1,101 @@
+package templates
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplates_TrimQuotedHunks(t *testing.T) {
+	review := `Hi,
+
+On Mon Jan 1, 2024 at 12:00 PM CET, Jane Doe wrote:
+> fix things
+> ---
+>  a | 2 +-
+>  b | 2 +-
+>
+> diff --git a/a b/a
+> index 1111111..2222222 100644
+> --- a/a
+> +++ b/a
+> @@ -1,3 +1,3 @@
+>  one
+> -two
+> +deux
+>  three
+> @@ -10,3 +10,3 @@
+>  ten
+> -eleven
+> +onze
+
+Why French?
+
+>  twelve
+> diff --git a/b b/b
+> index 3333333..4444444 100644
+> --- a/b
+> +++ b/b
+> @@ -1 +1 @@
+> -b
+> +c
+
+` + "-- \nJohn\n"
+	want := `Hi,
+
+On Mon Jan 1, 2024 at 12:00 PM CET, Jane Doe wrote:
+> fix things
+> ---
+>  a | 2 +-
+>  b | 2 +-
+>
+> diff --git a/a b/a
+> index 1111111..2222222 100644
+> --- a/a
+> +++ b/a
+> @@ -10,3 +10,3 @@
+>  ten
+> -eleven
+> +onze
+
+Why French?
+
+>  twelve
+` + "-- \nJohn\n"
+	assert.Equal(t, want, TrimQuotedHunks(review))
+}
+
+func TestTemplates_TrimQuotedHunksConclusion(t *testing.T) {
+	review := `On Mon Jan 1, 2024 at 12:00 PM CET, Jane Doe wrote:
+> diff --git a/a b/a
+> --- a/a
+> +++ b/a
+> @@ -1,3 +1,3 @@
+>  one
+> -two
+> +deux
+
+Why French?
+
+> @@ -10,2 +10,2 @@
+> -eleven
+> +onze
+
+Looks good otherwise, thanks!
+`
+	want := `On Mon Jan 1, 2024 at 12:00 PM CET, Jane Doe wrote:
+> diff --git a/a b/a
+> --- a/a
+> +++ b/a
+> @@ -1,3 +1,3 @@
+>  one
+> -two
+> +deux
+
+Why French?
+
+
+Looks good otherwise, thanks!
+`
+	assert.Equal(t, want, TrimQuotedHunks(review))
+}
@@ -0,0 +1,201 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"git.sr.ht/~rjarry/aerc/worker/types"
+)
+
+// Maximum number of operations that can be undone
+const maxUndoEntries = 50
+
+// UndoStack records how to revert the operations performed on messages via
+// MessageStore.Move, Delete, Flag and ModifyLabels. It is shared by all the
+// message stores of an account. A nil UndoStack records nothing.
+type UndoStack struct {
+	sync.Mutex
+	entries []*UndoEntry
+	batch   *UndoEntry
+	ignore  int
+}
+
+// UndoEntry holds the worker actions reverting one operation. Actions are
+// added once the worker has reported the result of the operation.
+type UndoEntry struct {
+	Description string
+
+	lock    sync.Mutex
+	actions []types.WorkerMessage
+	undone  []func()
+}
+
+func NewUndoStack() *UndoStack {
+	return &UndoStack{}
+}
+
+// Batch records all operations started by fn as a single entry.
+func (s *UndoStack) Batch(description string, fn func()) {
+	if s == nil {
+		fn()
+		return
+	}
+	s.Lock()
+	s.batch = &UndoEntry{Description: description}
+	s.push(s.batch)
+	s.Unlock()
+
+	fn()
+
+	s.Lock()
+	s.batch = nil
+	s.Unlock()
+}
+
+// Ignore does not record the operations started by fn. They cannot be undone
+// and do not hide the operations recorded before them.
+func (s *UndoStack) Ignore(fn func()) {
+	if s == nil {
+		fn()
+		return
+	}
+	s.Lock()
+	s.ignore++
+	s.Unlock()
+
+	fn()
+
+	s.Lock()
+	s.ignore--
+	s.Unlock()
+}
+
+// begin returns the entry where the inverse of a new operation must be
+// recorded.
+func (s *UndoStack) begin(description string) *UndoEntry {
+	if s == nil {
+		return nil
+	}
+	s.Lock()
+	defer s.Unlock()
+	if s.ignore > 0 {
+		return nil
+	}
+	if s.batch != nil {
+		return s.batch
+	}
+	e := &UndoEntry{Description: description}
+	s.push(e)
+	return e
+}
+
+func (s *UndoStack) push(e *UndoEntry) {
+	s.entries = append(s.entries, e)
+	if len(s.entries) > maxUndoEntries {
+		s.entries = s.entries[len(s.entries)-maxUndoEntries:]
+	}
+}
+
+// Pop removes and returns the most recent entry. If its operation cannot be
+// reverted (e.g. a delete which the backend did not move to the trash), an
+// error is returned instead of undoing an older, unrelated operation. Pop
+// returns nil if there is nothing to undo.
+func (s *UndoStack) Pop() (*UndoEntry, error) {
+	if s == nil {
+		return nil, nil
+	}
+	s.Lock()
+	defer s.Unlock()
+	if len(s.entries) == 0 {
+		return nil, nil
+	}
+	e := s.entries[len(s.entries)-1]
+	s.entries = s.entries[:len(s.entries)-1]
+	if e == s.batch {
+		s.batch = nil
+	}
+	if e.empty() {
+		return nil, fmt.Errorf("cannot undo %s", e.Description)
+	}
+	return e, nil
+}
+
+// discard removes the entry of an operation which failed.
+func (s *UndoStack) discard(e *UndoEntry) {
+	if s == nil || e == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	if e == s.batch || !e.empty() {
+		return
+	}
+	if i := slices.Index(s.entries, e); i >= 0 {
+		s.entries = slices.Delete(s.entries, i, i+1)
+	}
+}
+
+// add records an action reverting part of the operation. If not nil, undone
+// is called once the action has completed.
+func (e *UndoEntry) add(action types.WorkerMessage, undone func()) {
+	if e == nil {
+		return
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.actions = append(e.actions, action)
+	if undone != nil {
+		e.undone = append(e.undone, undone)
+	}
+}
+
+func (e *UndoEntry) empty() bool {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return len(e.actions) == 0
+}
+
+// Run posts the recorded actions to the worker. cb is called with the first
+// error, if any, once all of them have completed.
+func (e *UndoEntry) Run(worker *types.Worker, cb func(error)) {
+	e.lock.Lock()
+	actions := e.actions
+	undone := e.undone
+	e.lock.Unlock()
+
+	var err error
+	pending := len(actions)
+	for _, action := range actions {
+		worker.PostAction(context.TODO(), action, func(msg types.WorkerMessage) {
+			switch msg := msg.(type) {
+			case *types.Error:
+				if err == nil {
+					err = msg.Error
+				}
+			case *types.Unsupported:
+				if err == nil {
+					err = types.ErrUnsupported
+				}
+			case *types.Cancelled:
+				if err == nil {
+					err = context.Canceled
+				}
+			case *types.Done:
+			default:
+				return
+			}
+			pending--
+			if pending > 0 {
+				return
+			}
+			if err == nil {
+				for _, f := range undone {
+					f()
+				}
+			}
+			cb(err)
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package lib
+
+import (
+	"reflect"
+	"testing"
+
+	"git.sr.ht/~rjarry/aerc/models"
+	"git.sr.ht/~rjarry/aerc/worker/types"
+)
+
+func TestUndoStack(t *testing.T) {
+	s := NewUndoStack()
+
+	move := s.begin("move")
+	move.add(&types.MoveMessages{Source: "Archive", Destination: "INBOX"}, nil)
+	// the backend removed the messages, nothing recorded
+	s.begin("delete")
+	// failed operation, nothing recorded
+	s.discard(s.begin("flag change"))
+	s.Batch("archive", func() {
+		s.begin("move").add(&types.MoveMessages{Source: "2024"}, nil)
+		s.begin("move").add(&types.MoveMessages{Source: "2025"}, nil)
+	})
+	// automatic operations, nothing recorded
+	s.Ignore(func() {
+		s.begin("flag change").add(&types.FlagMessages{}, nil)
+		s.Ignore(func() {})
+		s.begin("move to Lists").add(&types.MoveMessages{}, nil)
+	})
+
+	e, err := s.Pop()
+	if err != nil || e == nil || e.Description != "archive" || len(e.actions) != 2 {
+		t.Fatalf("unexpected entry: %#v %v", e, err)
+	}
+	if e, err = s.Pop(); err == nil || err.Error() != "cannot undo delete" {
+		t.Fatalf("expected delete error, got %#v %v", e, err)
+	}
+	if e, err = s.Pop(); err != nil || e != move {
+		t.Fatalf("expected move entry, got %#v %v", e, err)
+	}
+	if e, err = s.Pop(); err != nil || e != nil {
+		t.Fatalf("expected empty stack, got %#v %v", e, err)
+	}
+
+	var nilStack *UndoStack
+	called := false
+	nilStack.Batch("flag change", func() { called = true })
+	if e, err := nilStack.Pop(); !called || e != nil || err != nil {
+		t.Errorf("nil stack misbehaves")
+	}
+}
+
+func TestInverseLabels(t *testing.T) {
+	store := &MessageStore{Messages: map[models.UID]*models.MessageInfo{
+		"1": {Labels: []string{"inbox", "todo"}},
+		"2": {Labels: []string{"inbox"}},
+		"3": {Labels: []string{"inbox"}},
+	}}
+	actions := store.inverseLabels(
+		[]models.UID{"1", "2", "3", "4"},
+		[]string{"todo"}, []string{"inbox"}, nil)
+
+	expected := []*types.ModifyLabels{
+		{Uids: []models.UID{"1"}, Add: []string{"inbox"}},
+		{
+			Uids:   []models.UID{"2", "3"},
+			Add:    []string{"inbox"},
+			Remove: []string{"todo"},
+		},
+	}
+	if !reflect.DeepEqual(actions, expected) {
+		t.Errorf("unexpected actions: %#v", actions)
+	}
+}
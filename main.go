@@ -15,6 +15,7 @@ import (
 
 	"git.sr.ht/~rjarry/aerc/app"
 	"git.sr.ht/~rjarry/aerc/commands"
+	"git.sr.ht/~rjarry/aerc/commands/account"
 	"git.sr.ht/~rjarry/aerc/config"
 	"git.sr.ht/~rjarry/aerc/lib"
 	"git.sr.ht/~rjarry/aerc/lib/crypto"
@@ -26,11 +27,11 @@ import (
 	"git.sr.ht/~rjarry/aerc/lib/ui"
 	"git.sr.ht/~rjarry/aerc/models"
 
-	_ "git.sr.ht/~rjarry/aerc/commands/account"
 	_ "git.sr.ht/~rjarry/aerc/commands/compose"
 	_ "git.sr.ht/~rjarry/aerc/commands/msg"
 	_ "git.sr.ht/~rjarry/aerc/commands/msgview"
 	_ "git.sr.ht/~rjarry/aerc/commands/patch"
+	_ "git.sr.ht/~rjarry/aerc/commands/sieve"
 )
 
 func execCommand(
@@ -223,7 +224,8 @@ func main() {
 	}
 	defer c.Close()
 
-	app.Init(c, execCommand, getCompletions, &commands.CmdHistory, deferLoop)
+	app.Init(c, execCommand, getCompletions, &commands.CmdHistory,
+		account.QueueNewMessage, deferLoop)
 
 	err = ui.Initialize(app.Drawable())
 	if err != nil {
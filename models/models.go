@@ -292,3 +292,9 @@ type MessageDetails struct {
 	Body               io.Reader
 	Micalg             string
 }
+
+// A SieveScript is a server-side filtering script
+type SieveScript struct {
+	Name   string
+	Active bool
+}
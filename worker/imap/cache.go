@@ -6,6 +6,8 @@ import (
 	"encoding/gob"
 	"errors"
 	"fmt"
+	"io"
+	"slices"
 	"strings"
 	"time"
 
@@ -13,11 +15,13 @@ import (
 	"git.sr.ht/~rjarry/aerc/lib/parse"
 	"git.sr.ht/~rjarry/aerc/lib/xdg"
 	"git.sr.ht/~rjarry/aerc/models"
+	"git.sr.ht/~rjarry/aerc/worker/lib"
 	"git.sr.ht/~rjarry/aerc/worker/types"
 	"github.com/emersion/go-message"
 	"github.com/emersion/go-message/mail"
 	"github.com/emersion/go-message/textproto"
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 type CachedHeader struct {
@@ -82,6 +86,33 @@ func (w *IMAPWorker) initCacheDb(acct string) {
 	}
 }
 
+// initSearchIndex opens (or creates) the full text search index of the
+// account, next to the header cache.
+func (w *IMAPWorker) initSearchIndex(acct string) {
+	p := xdg.CachePath("aerc", "index", acct)
+	idx, err := lib.OpenSearchIndex(p)
+	if err != nil {
+		w.worker.Errorf("failed opening search index at %s: %v", p, err)
+		return
+	}
+	w.index = idx
+	w.worker.Debugf("search index opened: %s", p)
+}
+
+// indexMessage adds a full message to the search index and returns a reader
+// of its content.
+func (w *IMAPWorker) indexMessage(dir string, uid models.UID, r io.Reader) io.Reader {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		w.worker.Errorf("cannot read message %s: %v", uid, err)
+		return bytes.NewReader(body)
+	}
+	if err := w.index.Add(dir, uid, bytes.NewReader(body)); err != nil {
+		w.worker.Errorf("cannot index message %s: %v", uid, err)
+	}
+	return bytes.NewReader(body)
+}
+
 func (w *IMAPWorker) cacheHeader(mi *models.MessageInfo) {
 	key := w.headerKey(mi.Uid)
 	w.worker.Debugf("caching header for message %s", key)
@@ -143,6 +174,7 @@ func (w *IMAPWorker) getCachedHeaders(msg *types.FetchMessageHeaders) []models.U
 		}
 
 		hdr := &mail.Header{Header: message.Header{Header: textprotoHeader}}
+		needsFlags := true
 		mi := &models.MessageInfo{
 			BodyStructure: &ch.BodyStructure,
 			Envelope:      &ch.Envelope,
@@ -154,10 +186,19 @@ func (w *IMAPWorker) getCachedHeaders(msg *types.FetchMessageHeaders) []models.U
 			Size:          ch.Size,
 			Labels:        ch.Labels,
 		}
+		// Gmail labels are not flags
+		if flags, ok := w.knownFlags(w.UidToUint32(uid)); ok && !w.caps.Has("X-GM-EXT-1") {
+			systemFlags, keywordFlags := translateImapFlags(flags)
+			mi.Flags = systemFlags
+			if len(w.selected.PermanentFlags) == 0 || slices.Contains(w.selected.PermanentFlags, "\\*") {
+				mi.Labels = keywordFlags
+			}
+			needsFlags = false
+		}
 		w.worker.PostMessage(&types.MessageInfo{
 			Message:    types.RespondTo(msg),
 			Info:       mi,
-			NeedsFlags: true,
+			NeedsFlags: needsFlags,
 		}, nil)
 	}
 	return need
@@ -174,11 +215,8 @@ func (w *IMAPWorker) cleanCache(path string) {
 	defer log.PanicHandler()
 	start := time.Now()
 	var scanned, removed int
-	iter := w.cache.NewIterator(nil, nil)
+	iter := w.cache.NewIterator(util.BytesPrefix([]byte("header.")), nil)
 	for iter.Next() {
-		if bytes.Equal(iter.Key(), cacheTagKey) {
-			continue
-		}
 		data := iter.Value()
 		ch := &CachedHeader{}
 		dec := gob.NewDecoder(bytes.NewReader(data))
@@ -1,6 +1,7 @@
 package imap
 
 import (
+	"context"
 	"fmt"
 
 	"git.sr.ht/~rjarry/aerc/models"
@@ -89,3 +90,37 @@ func (w *IMAPWorker) handleCheckMailMessage(msg *types.CheckMail) error {
 	}
 	return nil
 }
+
+// queueNotifyStatus is called by the idler when the server reports a change
+// in another mailbox. It runs in the client reader and must not block.
+func (w *IMAPWorker) queueNotifyStatus(status *imap.MailboxStatus) {
+	select {
+	case w.notify <- status:
+	default:
+		w.worker.Debugf("NOTIFY queue full, dropping status of %s", status.Name)
+	}
+}
+
+// handleNotifyStatus updates the counters of a mailbox from a STATUS
+// notification. When the server omits some of them, they are requested
+// explicitly.
+func (w *IMAPWorker) handleNotifyStatus(status *imap.MailboxStatus) {
+	_, messages := status.Items[imap.StatusMessages]
+	_, unseen := status.Items[imap.StatusUnseen]
+	if !messages || !unseen {
+		w.worker.PostAction(context.TODO(), &types.CheckMail{
+			Directories: []string{status.Name},
+		}, nil)
+		return
+	}
+	info := &models.DirectoryInfo{
+		Name:   status.Name,
+		Exists: int(status.Messages),
+		Recent: int(status.Recent),
+		Unseen: int(status.Unseen),
+	}
+	if status.UidValidity != 0 {
+		info.Uid = fmt.Sprintf("%d", status.UidValidity)
+	}
+	w.worker.PostMessage(&types.DirectoryInfo{Info: info}, nil)
+}
@@ -0,0 +1,291 @@
+package imap
+
+import (
+	"errors"
+	"time"
+
+	"github.com/emersion/go-imap"
+	sortthread "github.com/emersion/go-imap-sortthread"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/commands"
+	"github.com/emersion/go-imap/responses"
+
+	"git.sr.ht/~rjarry/aerc/worker/imap/extensions"
+)
+
+// The methods below replace those of client.Client for all the commands sent
+// by the worker. They pass the VANISHED responses sent instead of EXPUNGE
+// once QRESYNC is enabled to the updates channel, see
+// extensions.WithVanished. New commands must be sent the same way.
+
+func (c *imapClient) Execute(
+	cmdr imap.Commander, h responses.Handler,
+) (*imap.StatusResp, error) {
+	return c.Client.Execute(cmdr, extensions.WithVanished(c.Client, h))
+}
+
+func (c *imapClient) execute(cmdr imap.Commander, h responses.Handler) error {
+	status, err := c.Execute(cmdr, h)
+	if err != nil {
+		return err
+	}
+	return status.Err()
+}
+
+func (c *imapClient) authenticated() error {
+	switch c.State() {
+	case imap.AuthenticatedState, imap.SelectedState:
+		return nil
+	}
+	return client.ErrNotLoggedIn
+}
+
+func (c *imapClient) Create(name string) error {
+	if err := c.authenticated(); err != nil {
+		return err
+	}
+	return c.execute(&commands.Create{Mailbox: name}, nil)
+}
+
+func (c *imapClient) Delete(name string) error {
+	if err := c.authenticated(); err != nil {
+		return err
+	}
+	return c.execute(&commands.Delete{Mailbox: name}, nil)
+}
+
+func (c *imapClient) List(ref, name string, ch chan *imap.MailboxInfo) error {
+	defer close(ch)
+	if err := c.authenticated(); err != nil {
+		return err
+	}
+	return c.execute(&commands.List{Reference: ref, Mailbox: name},
+		&responses.List{Mailboxes: ch})
+}
+
+func (c *imapClient) Status(
+	name string, items []imap.StatusItem,
+) (*imap.MailboxStatus, error) {
+	if err := c.authenticated(); err != nil {
+		return nil, err
+	}
+	res := &responses.Status{Mailbox: new(imap.MailboxStatus)}
+	err := c.execute(&commands.Status{Mailbox: name, Items: items}, res)
+	return res.Mailbox, err
+}
+
+func (c *imapClient) Append(
+	mbox string, flags []string, date time.Time, msg imap.Literal,
+) error {
+	if err := c.authenticated(); err != nil {
+		return err
+	}
+	return c.execute(&commands.Append{
+		Mailbox: mbox,
+		Flags:   flags,
+		Date:    date,
+		Message: msg,
+	}, nil)
+}
+
+func (c *imapClient) Expunge(ch chan uint32) error {
+	if ch != nil {
+		defer close(ch)
+	}
+	if c.State() != imap.SelectedState {
+		return client.ErrNoMailboxSelected
+	}
+	var h responses.Handler
+	if ch != nil {
+		h = &responses.Expunge{SeqNums: ch}
+	}
+	return c.execute(new(commands.Expunge), h)
+}
+
+func (c *imapClient) UidSearch(criteria *imap.SearchCriteria) ([]uint32, error) {
+	if c.State() != imap.SelectedState {
+		return nil, client.ErrNoMailboxSelected
+	}
+	search := func(charset string) ([]uint32, *imap.StatusResp, error) {
+		res := new(responses.Search)
+		status, err := c.Execute(&commands.Uid{Cmd: &commands.Search{
+			Charset:  charset,
+			Criteria: criteria,
+		}}, res)
+		if err != nil {
+			return nil, nil, err
+		}
+		return res.Ids, status, status.Err()
+	}
+	uids, status, err := search("UTF-8")
+	if status != nil && status.Code == imap.CodeBadCharset {
+		// some servers do not support UTF-8
+		uids, _, err = search("US-ASCII")
+	}
+	return uids, err
+}
+
+func (c *imapClient) UidFetch(
+	seqset *imap.SeqSet, items []imap.FetchItem, ch chan *imap.Message,
+) error {
+	defer close(ch)
+	if c.State() != imap.SelectedState {
+		return client.ErrNoMailboxSelected
+	}
+	return c.execute(&commands.Uid{Cmd: &commands.Fetch{
+		SeqSet: seqset,
+		Items:  items,
+	}}, &responses.Fetch{Messages: ch, SeqSet: seqset, Uid: true})
+}
+
+func (c *imapClient) UidStore(
+	seqset *imap.SeqSet, item imap.StoreItem, value any, ch chan *imap.Message,
+) error {
+	if ch != nil {
+		defer close(ch)
+	}
+	if c.State() != imap.SelectedState {
+		return client.ErrNoMailboxSelected
+	}
+	if fields, ok := value.([]any); ok {
+		for i, field := range fields {
+			if s, ok := field.(string); ok {
+				fields[i] = imap.RawString(s)
+			}
+		}
+	}
+	var h responses.Handler
+	if ch != nil {
+		h = &responses.Fetch{Messages: ch, SeqSet: seqset, Uid: true}
+	} else if op, _, err := imap.ParseFlagsOp(item); err == nil {
+		// the updated flags would be lost
+		item = imap.FormatFlagsOp(op, true)
+	}
+	return c.execute(&commands.Uid{Cmd: &commands.Store{
+		SeqSet: seqset,
+		Item:   item,
+		Value:  value,
+	}}, h)
+}
+
+func (c *imapClient) UidCopy(seqset *imap.SeqSet, dest string) error {
+	if c.State() != imap.SelectedState {
+		return client.ErrNoMailboxSelected
+	}
+	return c.execute(&commands.Uid{Cmd: &commands.Copy{
+		SeqSet:  seqset,
+		Mailbox: dest,
+	}}, nil)
+}
+
+func (c *imapClient) UidMove(seqset *imap.SeqSet, dest string) error {
+	if c.State() != imap.SelectedState {
+		return client.ErrNoMailboxSelected
+	}
+	if ok, err := c.Support("MOVE"); err != nil {
+		return err
+	} else if ok {
+		return c.execute(&commands.Uid{Cmd: &commands.Move{
+			SeqSet:  seqset,
+			Mailbox: dest,
+		}}, nil)
+	}
+	if err := c.UidCopy(seqset, dest); err != nil {
+		return err
+	}
+	item := imap.FormatFlagsOp(imap.AddFlags, true)
+	err := c.UidStore(seqset, item, []any{imap.DeletedFlag}, nil)
+	if err != nil {
+		return err
+	}
+	return c.Expunge(nil)
+}
+
+func (c *imapClient) UidSort(
+	sortCriteria []sortthread.SortCriterion, criteria *imap.SearchCriteria,
+) ([]uint32, error) {
+	if c.State() != imap.SelectedState {
+		return nil, client.ErrNoMailboxSelected
+	}
+	res := new(sortthread.SortResponse)
+	err := c.execute(&commands.Uid{Cmd: &sortthread.SortCommand{
+		SortCriteria:   sortCriteria,
+		Charset:        "UTF-8",
+		SearchCriteria: criteria,
+	}}, res)
+	return res.Ids, err
+}
+
+func (c *imapClient) UidThread(
+	algorithm sortthread.ThreadAlgorithm, criteria *imap.SearchCriteria,
+) ([]*sortthread.Thread, error) {
+	if c.State() != imap.SelectedState {
+		return nil, client.ErrNoMailboxSelected
+	}
+	res := new(sortthread.ThreadResponse)
+	err := c.execute(&commands.Uid{Cmd: &sortthread.ThreadCommand{
+		Algorithm:      algorithm,
+		Charset:        "UTF-8",
+		SearchCriteria: criteria,
+	}}, res)
+	return res.Threads, err
+}
+
+// Idle works like client.Idle. IDLE is restarted every 25 minutes to avoid
+// being logged out by the server. When the server does not support it, a NOOP
+// command is sent every minute.
+func (c *imapClient) Idle(stop <-chan struct{}, _ *client.IdleOptions) error {
+	if ok, err := c.Support("IDLE"); err != nil {
+		return err
+	} else if !ok {
+		return c.poll(stop)
+	}
+
+	t := time.NewTicker(25 * time.Minute)
+	defer t.Stop()
+
+	for {
+		stopOrRestart := make(chan struct{})
+		done := make(chan error, 1)
+		go func() {
+			done <- c.execute(&commands.Idle{}, &responses.Idle{
+				Stop:      stopOrRestart,
+				RepliesCh: make(chan []byte, 10),
+			})
+		}()
+
+		select {
+		case <-t.C:
+			close(stopOrRestart)
+			if err := <-done; err != nil {
+				return err
+			}
+		case <-stop:
+			close(stopOrRestart)
+			return <-done
+		case err := <-done:
+			close(stopOrRestart)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (c *imapClient) poll(stop <-chan struct{}) error {
+	t := time.NewTicker(time.Minute)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			if err := c.execute(new(commands.Noop), nil); err != nil {
+				return err
+			}
+		case <-stop:
+			return nil
+		case <-c.LoggedOut():
+			return errors.New("disconnected while idling")
+		}
+	}
+}
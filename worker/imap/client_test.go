@@ -0,0 +1,172 @@
+package imap
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+
+	"git.sr.ht/~rjarry/aerc/worker/imap/extensions"
+)
+
+// fakeServer connects a client to a scripted server. respond is called with
+// the tag and the rest of each command line and returns the response lines.
+func fakeServer(
+	t *testing.T, respond func(tag, cmd string) []string,
+) (*imapClient, chan client.Update) {
+	t.Helper()
+	srv, conn := net.Pipe()
+	t.Cleanup(func() { srv.Close() })
+	go func() {
+		r := bufio.NewReader(srv)
+		fmt.Fprint(srv, "* OK [CAPABILITY IMAP4rev1 IDLE QRESYNC] ready\r\n")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			tag, cmd, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+			for _, resp := range respond(tag, cmd) {
+				fmt.Fprint(srv, resp+"\r\n")
+			}
+		}
+	}()
+	c, err := client.New(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates := make(chan client.Update, 10)
+	c.Updates = updates
+	return &imapClient{Client: c, qresync: extensions.NewQresyncClient(c)}, updates
+}
+
+func vanishedUpdate(t *testing.T, updates chan client.Update) *imap.SeqSet {
+	t.Helper()
+	for {
+		select {
+		case update := <-updates:
+			if s, ok := update.(*client.StatusUpdate); ok {
+				if set, ok := extensions.Vanished(s); ok {
+					return set
+				}
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+func TestClientVanished(t *testing.T) {
+	c, updates := fakeServer(t, func(tag, cmd string) []string {
+		return []string{
+			"* 1 FETCH (UID 1 FLAGS (\\Seen))",
+			"* VANISHED 3:5",
+			tag + " OK done",
+		}
+	})
+	c.SetState(imap.SelectedState, &imap.MailboxStatus{Name: "INBOX"})
+
+	set := new(imap.SeqSet)
+	set.AddNum(1)
+	ch := make(chan *imap.Message, 10)
+	err := c.UidFetch(set, []imap.FetchItem{imap.FetchFlags}, ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := <-ch; msg == nil || msg.Uid != 1 {
+		t.Errorf("unexpected message %v", msg)
+	}
+	vanished := vanishedUpdate(t, updates)
+	if vanished == nil || vanished.String() != "3:5" {
+		t.Errorf("unexpected vanished uids %v", vanished)
+	}
+}
+
+func TestClientIdleVanished(t *testing.T) {
+	var idleTag string
+	c, updates := fakeServer(t, func(tag, cmd string) []string {
+		switch {
+		case cmd == "IDLE":
+			idleTag = tag
+			return []string{"+ idling", "* VANISHED 7"}
+		case tag == "DONE":
+			return []string{idleTag + " OK idle terminated"}
+		}
+		return []string{tag + " BAD unexpected"}
+	})
+	c.SetState(imap.SelectedState, &imap.MailboxStatus{Name: "INBOX"})
+
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() { done <- c.Idle(stop, nil) }()
+	update := <-updates
+	status, ok := update.(*client.StatusUpdate)
+	if !ok {
+		t.Fatalf("unexpected update %#v", update)
+	}
+	if set, ok := extensions.Vanished(status); !ok || set.String() != "7" {
+		t.Errorf("unexpected update %v", status.Status)
+	}
+	// the DONE reply of the IDLE handler must still be sent
+	close(stop)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("IDLE was not terminated")
+	}
+}
+
+func TestQresyncSelect(t *testing.T) {
+	var command string
+	c, updates := fakeServer(t, func(tag, cmd string) []string {
+		command = cmd
+		return []string{
+			"* VANISHED 9",
+			"* OK [CLOSED] previous mailbox closed",
+			"* 3 EXISTS",
+			"* OK [UIDVALIDITY 42] ok",
+			"* OK [HIGHESTMODSEQ 20] ok",
+			"* VANISHED (EARLIER) 2,4",
+			"* 2 FETCH (UID 3 FLAGS (\\Seen) MODSEQ (15))",
+			tag + " OK [READ-WRITE] selected",
+		}
+	})
+	c.SetState(imap.AuthenticatedState, nil)
+
+	mbox, modseq, changes, err := c.qresync.Select("INBOX", 42, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command != "SELECT INBOX (QRESYNC (42 10))" {
+		t.Errorf("unexpected command %q", command)
+	}
+	if mbox.Messages != 3 || mbox.UidValidity != 42 || modseq != 20 {
+		t.Errorf("unexpected status %+v %d", mbox, modseq)
+	}
+	if changes.Vanished.String() != "2,4" {
+		t.Errorf("unexpected vanished uids %v", changes.Vanished)
+	}
+	if len(changes.Changed) != 1 || changes.Changed[0].Uid != 3 ||
+		len(changes.Changed[0].Flags) != 1 {
+		t.Errorf("unexpected changes %+v", changes.Changed)
+	}
+	// nothing must be reported as a change of the new mailbox
+	for len(updates) > 0 {
+		switch update := (<-updates).(type) {
+		case *client.MessageUpdate:
+			t.Errorf("unexpected message update %v", update.Message)
+		case *client.StatusUpdate:
+			if set, ok := extensions.Vanished(update); ok {
+				t.Errorf("unexpected vanished uids %v", set)
+			}
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package imap
+
+import (
+	"bytes"
+	"encoding/gob"
+	"slices"
+	"sync"
+
+	"github.com/emersion/go-imap"
+
+	"git.sr.ht/~rjarry/aerc/lib/log"
+	"git.sr.ht/~rjarry/aerc/worker/imap/extensions"
+)
+
+// mailboxState is the list of messages of a mailbox and their flags as of
+// its HIGHESTMODSEQ. It is stored in the header cache so that reopening the
+// mailbox only requires fetching what changed since (RFC 7162).
+type mailboxState struct {
+	UidValidity   uint32
+	HighestModSeq uint64
+	Uids          []uint32
+	Flags         map[uint32][]string
+
+	mu sync.Mutex
+	// the UID list can be used instead of a UID SEARCH
+	fresh bool
+}
+
+func mailboxStateKey(mailbox string) []byte {
+	return []byte("modseq." + mailbox)
+}
+
+func (w *IMAPWorker) loadMailboxState(mailbox string) *mailboxState {
+	data, err := w.cache.Get(mailboxStateKey(mailbox), nil)
+	if err != nil {
+		return nil
+	}
+	st := &mailboxState{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(st); err != nil {
+		w.worker.Errorf("cannot decode state of %s: %v", mailbox, err)
+		return nil
+	}
+	return st
+}
+
+func (w *IMAPWorker) saveMailboxState(mailbox string, st *mailboxState) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(st); err != nil {
+		w.worker.Errorf("cannot encode state of %s: %v", mailbox, err)
+		return
+	}
+	if err := w.cache.Put(mailboxStateKey(mailbox), buf.Bytes(), nil); err != nil {
+		w.worker.Errorf("cannot write state of %s: %v", mailbox, err)
+	}
+}
+
+// selectMailbox selects a mailbox. When the server supports CONDSTORE and the
+// header cache is enabled, the saved state of the mailbox is resynchronized.
+// With QRESYNC, the changes are reported by the server in response to the
+// SELECT command.
+func (w *IMAPWorker) selectMailbox(name string) (*imap.MailboxStatus, error) {
+	w.mailbox = nil
+	if !w.condstore || w.cache == nil {
+		return w.client.Select(name, false)
+	}
+	var sel *imap.MailboxStatus
+	var modseq uint64
+	var changes *extensions.Changes
+	var err error
+	st := w.loadMailboxState(name)
+	if w.qresync && st != nil && st.HighestModSeq != 0 {
+		sel, modseq, changes, err = w.client.qresync.Select(
+			name, st.UidValidity, st.HighestModSeq)
+	} else {
+		sel, modseq, err = w.client.condstore.Select(name)
+	}
+	if err != nil || modseq == 0 {
+		return sel, err
+	}
+
+	switch {
+	case st == nil || st.UidValidity != sel.UidValidity:
+		w.worker.Debugf("%s: fetching all flags", name)
+		st = &mailboxState{UidValidity: sel.UidValidity}
+		err = w.fetchMailboxState(st, sel)
+	case changes != nil:
+		w.worker.Debugf("%s: %d messages changed since modseq %d",
+			name, len(changes.Changed), st.HighestModSeq)
+		err = w.applyMailboxChanges(st, sel, changes)
+	case st.HighestModSeq != modseq || len(st.Uids) != int(sel.Messages):
+		w.worker.Debugf("%s: fetching changes since modseq %d",
+			name, st.HighestModSeq)
+		err = w.resyncMailboxState(st, sel)
+	default:
+		w.worker.Debugf("%s: unchanged since modseq %d", name, modseq)
+	}
+	if err != nil {
+		// not fatal, the messages are listed as usual
+		w.worker.Warnf("%s: CONDSTORE resynchronization failed: %v", name, err)
+		return sel, nil
+	}
+	st.HighestModSeq = modseq
+	w.saveMailboxState(name, st)
+	st.fresh = true
+	w.mailbox = st
+	return sel, nil
+}
+
+// fetchMailboxState fetches the flags of all messages of the selected
+// mailbox.
+func (w *IMAPWorker) fetchMailboxState(
+	st *mailboxState, sel *imap.MailboxStatus,
+) error {
+	st.Uids = nil
+	st.Flags = make(map[uint32][]string)
+	if sel.Messages == 0 {
+		return nil
+	}
+	set := new(imap.SeqSet)
+	set.AddRange(1, 0)
+	items := []imap.FetchItem{imap.FetchUid, imap.FetchFlags}
+	return w.fetchState(func(ch chan *imap.Message) error {
+		return w.client.UidFetch(set, items, ch)
+	}, func(msg *imap.Message) {
+		st.Uids = append(st.Uids, msg.Uid)
+		st.Flags[msg.Uid] = msg.Flags
+	})
+}
+
+// resyncMailboxState fetches the flags of the messages of the selected
+// mailbox which changed since the saved HIGHESTMODSEQ. The full UID list is
+// only fetched when messages were expunged.
+func (w *IMAPWorker) resyncMailboxState(
+	st *mailboxState, sel *imap.MailboxStatus,
+) error {
+	if st.Flags == nil {
+		st.Flags = make(map[uint32][]string)
+	}
+	if sel.Messages == 0 {
+		st.setUids(nil)
+		return nil
+	}
+	set := new(imap.SeqSet)
+	set.AddRange(1, 0)
+	items := []imap.FetchItem{imap.FetchUid, imap.FetchFlags}
+	var changed []*imap.Message
+	err := w.fetchState(func(ch chan *imap.Message) error {
+		return w.client.condstore.UidFetchChangedSince(
+			set, items, st.HighestModSeq, ch)
+	}, func(msg *imap.Message) {
+		changed = append(changed, msg)
+	})
+	if err != nil {
+		return err
+	}
+	if st.apply(changed) == int(sel.Messages) {
+		return nil
+	}
+	uids, err := w.client.UidSearch(imap.NewSearchCriteria())
+	if err != nil {
+		return err
+	}
+	st.setUids(uids)
+	return nil
+}
+
+// applyMailboxChanges updates the state of the selected mailbox with the
+// changes reported by SELECT (QRESYNC). The full UID list is only fetched if
+// the message count does not match.
+func (w *IMAPWorker) applyMailboxChanges(
+	st *mailboxState, sel *imap.MailboxStatus, changes *extensions.Changes,
+) error {
+	if st.Flags == nil {
+		st.Flags = make(map[uint32][]string)
+	}
+	st.vanish(changes.Vanished)
+	if st.apply(changes.Changed) == int(sel.Messages) {
+		return nil
+	}
+	w.worker.Debugf("%s: message count mismatch, searching all UIDs", sel.Name)
+	uids, err := w.client.UidSearch(imap.NewSearchCriteria())
+	if err != nil {
+		return err
+	}
+	st.setUids(uids)
+	return nil
+}
+
+func (w *IMAPWorker) fetchState(
+	fetch func(chan *imap.Message) error, procFunc func(*imap.Message),
+) error {
+	messages := make(chan *imap.Message)
+	done := make(chan struct{})
+	go func() {
+		defer log.PanicHandler()
+		for msg := range messages {
+			if msg.Uid != 0 && msg.Flags != nil {
+				procFunc(msg)
+			}
+		}
+		close(done)
+	}()
+	err := fetch(messages)
+	<-done
+	return err
+}
+
+// apply updates the state with changed messages and returns the expected
+// number of messages if none were expunged.
+func (st *mailboxState) apply(changed []*imap.Message) int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for _, msg := range changed {
+		if _, known := st.Flags[msg.Uid]; !known {
+			st.Uids = append(st.Uids, msg.Uid)
+		}
+		st.Flags[msg.Uid] = msg.Flags
+	}
+	slices.Sort(st.Uids)
+	return len(st.Uids)
+}
+
+// setUids replaces the list of messages and forgets the flags of expunged
+// ones.
+func (st *mailboxState) setUids(uids []uint32) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.Uids = slices.Clone(uids)
+	slices.Sort(st.Uids)
+	for uid := range st.Flags {
+		if _, found := slices.BinarySearch(st.Uids, uid); !found {
+			delete(st.Flags, uid)
+		}
+	}
+}
+
+// vanish removes the messages expunged from the mailbox.
+func (st *mailboxState) vanish(set *imap.SeqSet) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.Uids = slices.DeleteFunc(st.Uids, set.Contains)
+	for uid := range st.Flags {
+		if set.Contains(uid) {
+			delete(st.Flags, uid)
+		}
+	}
+}
+
+// takeUids returns the UID list of the selected mailbox if it is known to
+// be up to date. It can only be used once, the next listings are performed
+// by the server.
+func (w *IMAPWorker) takeUids() ([]uint32, bool) {
+	st := w.mailbox
+	if st == nil {
+		return nil, false
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	// messages may have arrived since the mailbox was selected
+	if !st.fresh || len(st.Uids) != int(w.selected.Messages) {
+		return nil, false
+	}
+	st.fresh = false
+	return slices.Clone(st.Uids), true
+}
+
+// knownUids returns the UID list of the selected mailbox if it was
+// resynchronized when selecting it. Unlike takeUids, the next listing can
+// still use it.
+func (w *IMAPWorker) knownUids() ([]uint32, bool) {
+	st := w.mailbox
+	if st == nil {
+		return nil, false
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if !st.fresh || len(st.Uids) != int(w.selected.Messages) {
+		return nil, false
+	}
+	return slices.Clone(st.Uids), true
+}
+
+// knownFlags returns the flags of a message of the selected mailbox.
+func (w *IMAPWorker) knownFlags(uid uint32) ([]string, bool) {
+	st := w.mailbox
+	if st == nil {
+		return nil, false
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	flags, ok := st.Flags[uid]
+	return flags, ok
+}
+
+// updateKnownFlags keeps the flags of the selected mailbox up to date while
+// it is open.
+func (w *IMAPWorker) updateKnownFlags(msg *imap.Message) {
+	st := w.mailbox
+	if st == nil || msg.Uid == 0 || msg.Flags == nil {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.Flags[msg.Uid] = msg.Flags
+}
+
+// forgetState marks the UID list of the selected mailbox as outdated after
+// a message was expunged.
+func (w *IMAPWorker) forgetState(uid uint32) {
+	st := w.mailbox
+	if st == nil {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.fresh = false
+	delete(st.Flags, uid)
+}
@@ -0,0 +1,75 @@
+package imap
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/emersion/go-imap"
+)
+
+func TestMailboxStateResync(t *testing.T) {
+	st := &mailboxState{
+		Uids: []uint32{1, 2, 3},
+		Flags: map[uint32][]string{
+			1: {imap.SeenFlag},
+			2: {},
+			3: {imap.SeenFlag},
+		},
+	}
+
+	// flag change and new message, nothing expunged
+	n := st.apply([]*imap.Message{
+		{Uid: 2, Flags: []string{imap.FlaggedFlag}},
+		{Uid: 5, Flags: []string{}},
+	})
+	if n != 4 || !slices.Equal(st.Uids, []uint32{1, 2, 3, 5}) {
+		t.Errorf("unexpected uids %d %v", n, st.Uids)
+	}
+	if !slices.Equal(st.Flags[2], []string{imap.FlaggedFlag}) {
+		t.Errorf("unexpected flags %v", st.Flags[2])
+	}
+
+	// message 3 was expunged
+	st.setUids([]uint32{5, 1, 2})
+	if !slices.Equal(st.Uids, []uint32{1, 2, 5}) {
+		t.Errorf("unexpected uids %v", st.Uids)
+	}
+	if _, ok := st.Flags[3]; ok {
+		t.Error("flags of expunged message not removed")
+	}
+}
+
+func TestMailboxStateVanish(t *testing.T) {
+	st := &mailboxState{
+		Uids:  []uint32{1, 2, 3, 7},
+		Flags: map[uint32][]string{1: {}, 2: {}, 3: {}, 7: {}},
+	}
+	// servers may report UIDs which were never known
+	set, _ := imap.ParseSeqSet("2:5")
+	st.vanish(set)
+	if !slices.Equal(st.Uids, []uint32{1, 7}) || len(st.Flags) != 2 {
+		t.Errorf("unexpected state %v %v", st.Uids, st.Flags)
+	}
+}
+
+func TestMailboxStateKnownUids(t *testing.T) {
+	w := &IMAPWorker{
+		selected: &imap.MailboxStatus{Messages: 2},
+		mailbox:  &mailboxState{Uids: []uint32{4, 7}, fresh: true},
+	}
+	// switching folders must not consume the list needed by the listing
+	if uids, ok := w.knownUids(); !ok || !slices.Equal(uids, []uint32{4, 7}) {
+		t.Errorf("unexpected known uids %v %v", uids, ok)
+	}
+	if uids, ok := w.takeUids(); !ok || !slices.Equal(uids, []uint32{4, 7}) {
+		t.Errorf("unexpected taken uids %v %v", uids, ok)
+	}
+	if _, ok := w.knownUids(); ok {
+		t.Error("uids known after the listing")
+	}
+	w.mailbox.fresh = true
+	w.selected.Messages = 3
+	if _, ok := w.knownUids(); ok {
+		t.Error("uids known although a message arrived")
+	}
+}
@@ -105,6 +105,12 @@ func (w *IMAPWorker) handleConfigure(msg *types.Configure) error {
 				return fmt.Errorf("invalid cache-max-age value %v: %w", value, err)
 			}
 			w.config.cacheMaxAge = val
+		case "search-index":
+			enable, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid search-index value %v: %w", value, err)
+			}
+			w.config.searchIndex = enable
 		case "expunge-policy":
 			switch value {
 			case "auto":
@@ -118,11 +124,26 @@ func (w *IMAPWorker) handleConfigure(msg *types.Configure) error {
 			}
 		case "debug-log-path":
 			w.config.debugLogPath = value
+		case "sieve":
+			u, err := parseSieveURL(value)
+			if err != nil {
+				return fmt.Errorf("invalid sieve value %v: %w", value, err)
+			}
+			w.config.sieve = u
+		case "offline":
+			enable, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid offline value %v: %w", value, err)
+			}
+			w.config.offline = enable
 		}
 	}
 	if w.config.cacheEnabled {
 		w.initCacheDb(msg.Config.Name)
 	}
+	if w.config.searchIndex {
+		w.initSearchIndex(msg.Config.Name)
+	}
 
 	if name, ok := msg.Config.Params["folder-map"]; ok {
 		file := xdg.ExpandHome(name)
@@ -138,6 +159,25 @@ func (w *IMAPWorker) handleConfigure(msg *types.Configure) error {
 		w.worker = middleware.NewFolderMapper(w.worker, fmap, order)
 	}
 
+	vf, err := middleware.NewVirtualFolders(w.worker, msg.Config, false)
+	if err != nil {
+		return err
+	}
+	w.worker = vf
+
+	if w.config.offline {
+		p := xdg.CachePath("aerc", "offline", msg.Config.Name)
+		store, err := openOfflineStore(p)
+		if err != nil {
+			return fmt.Errorf("failed opening offline store at %s: %w", p, err)
+		}
+		w.offline = store
+		// record the folder names as known by the server
+		w.worker = newOfflineRecorder(w.worker, store, func() bool {
+			return w.client != nil
+		})
+	}
+
 	return nil
 }
 
@@ -113,6 +113,21 @@ func (h *ExpungeHandler) PopSequenceNumber(seqNum uint32) (uint32, bool) {
 	return uid, ok
 }
 
+// Pop the entries whose UID matches, for servers which report expunged
+// messages by UID (VANISHED responses with QRESYNC).
+func (h *ExpungeHandler) PopUids(match func(uint32) bool) []uint32 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	var uids []uint32
+	for seqNum, uid := range h.items {
+		if match(uid) {
+			uids = append(uids, uid)
+			delete(h.items, seqNum)
+		}
+	}
+	return uids
+}
+
 func (h *ExpungeHandler) IsExpungingForDelete(uid uint32) bool {
 	h.lock.Lock()
 	defer h.lock.Unlock()
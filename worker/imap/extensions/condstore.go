@@ -0,0 +1,172 @@
+package extensions
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/commands"
+	"github.com/emersion/go-imap/responses"
+)
+
+// A CONDSTORE client (RFC 7162)
+type CondstoreClient struct {
+	c *client.Client
+}
+
+func NewCondstoreClient(c *client.Client) *CondstoreClient {
+	return &CondstoreClient{c}
+}
+
+// SupportCondstore checks if the server supports the CONDSTORE extension.
+func (c *CondstoreClient) SupportCondstore() (bool, error) {
+	return c.c.Support("CONDSTORE")
+}
+
+// Select performs a SELECT (CONDSTORE) command. It returns the status of the
+// selected mailbox and its HIGHESTMODSEQ, which is zero if the mailbox does
+// not support modification sequences.
+func (c *CondstoreClient) Select(name string) (*imap.MailboxStatus, uint64, error) {
+	res := newCondstoreSelectResponse(name)
+	cmd := &condstoreSelectCommand{Select: commands.Select{Mailbox: name}}
+	return executeSelect(c.c, cmd, res, res)
+}
+
+// executeSelect executes a SELECT command whose responses are handled by h,
+// which must pass the standard responses to res.
+func executeSelect(
+	c *client.Client, cmd imap.Commander,
+	res *condstoreSelectResponse, h responses.Handler,
+) (*imap.MailboxStatus, uint64, error) {
+	state := c.State()
+	if state != imap.AuthenticatedState && state != imap.SelectedState {
+		return nil, 0, client.ErrNotLoggedIn
+	}
+
+	mbox := res.Mailbox
+	// EXISTS and RECENT are handled by the client on its current mailbox
+	c.SetState(state, mbox)
+
+	status, err := c.Execute(cmd, h)
+	if err == nil {
+		err = status.Err()
+	}
+	if err != nil {
+		c.SetState(imap.AuthenticatedState, nil)
+		return nil, 0, err
+	}
+	mbox.ReadOnly = status.Code == imap.CodeReadOnly
+	c.SetState(imap.SelectedState, mbox)
+	if res.noModSeq {
+		return mbox, 0, nil
+	}
+	return mbox, res.highestModSeq, nil
+}
+
+// UidFetchChangedSince performs a UID FETCH command with the CHANGEDSINCE
+// modifier: only the messages of seqset whose mod-sequence is greater than
+// modseq are returned.
+func (c *CondstoreClient) UidFetchChangedSince(
+	seqset *imap.SeqSet,
+	items []imap.FetchItem,
+	modseq uint64,
+	ch chan *imap.Message,
+) error {
+	defer close(ch)
+
+	if c.c.State() != imap.SelectedState {
+		return client.ErrNoMailboxSelected
+	}
+
+	cmd := &commands.Uid{Cmd: &changedSinceFetchCommand{
+		Fetch:  commands.Fetch{SeqSet: seqset, Items: items},
+		ModSeq: modseq,
+	}}
+	res := &responses.Fetch{Messages: ch, SeqSet: seqset, Uid: true}
+
+	status, err := c.c.Execute(cmd, WithVanished(c.c, res))
+	if err != nil {
+		return err
+	}
+	return status.Err()
+}
+
+func parseModSeq(f interface{}) (uint64, error) {
+	switch f := f.(type) {
+	case uint32:
+		return uint64(f), nil
+	case string:
+		return strconv.ParseUint(f, 10, 64)
+	case imap.RawString:
+		return strconv.ParseUint(string(f), 10, 64)
+	}
+	return 0, fmt.Errorf("invalid mod-sequence %v", f)
+}
+
+// SELECT mailbox (CONDSTORE)
+type condstoreSelectCommand struct {
+	commands.Select
+}
+
+func (cmd *condstoreSelectCommand) Command() *imap.Command {
+	c := cmd.Select.Command()
+	c.Arguments = append(c.Arguments,
+		[]interface{}{imap.RawString("CONDSTORE")})
+	return c
+}
+
+type condstoreSelectResponse struct {
+	responses.Select
+	highestModSeq uint64
+	noModSeq      bool
+}
+
+func newCondstoreSelectResponse(name string) *condstoreSelectResponse {
+	return &condstoreSelectResponse{
+		Select: responses.Select{Mailbox: &imap.MailboxStatus{
+			Name:  name,
+			Items: make(map[imap.StatusItem]interface{}),
+		}},
+	}
+}
+
+func (r *condstoreSelectResponse) Handle(resp imap.Resp) error {
+	if name, _, ok := imap.ParseNamedResp(resp); ok && name == "VANISHED" {
+		// sent with QRESYNC enabled for the previously selected mailbox
+		return nil
+	}
+	if status, ok := resp.(*imap.StatusResp); ok {
+		switch status.Code {
+		case "HIGHESTMODSEQ":
+			if len(status.Arguments) < 1 {
+				return responses.ErrUnhandled
+			}
+			modseq, err := parseModSeq(status.Arguments[0])
+			if err != nil {
+				return err
+			}
+			r.highestModSeq = modseq
+			return nil
+		case "NOMODSEQ":
+			r.noModSeq = true
+			return nil
+		}
+	}
+	return r.Select.Handle(resp)
+}
+
+// FETCH seqset items (CHANGEDSINCE modseq)
+type changedSinceFetchCommand struct {
+	commands.Fetch
+	ModSeq uint64
+}
+
+func (cmd *changedSinceFetchCommand) Command() *imap.Command {
+	c := cmd.Fetch.Command()
+	c.Arguments = append(c.Arguments, []interface{}{
+		imap.RawString("CHANGEDSINCE"),
+		imap.RawString(strconv.FormatUint(cmd.ModSeq, 10)),
+	})
+	return c
+}
@@ -48,7 +48,7 @@ func (c *ListStatusClient) ListStatus(
 	}
 	res := &ListStatusResponse{Mailboxes: ch}
 
-	status, err := c.c.Execute(cmd, res)
+	status, err := c.c.Execute(cmd, WithVanished(c.c, res))
 	if err != nil {
 		return nil, err
 	}
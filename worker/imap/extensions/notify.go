@@ -0,0 +1,131 @@
+package extensions
+
+import (
+	"errors"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/commands"
+	"github.com/emersion/go-imap/responses"
+)
+
+// A NOTIFY client (RFC 5465)
+type NotifyClient struct {
+	c *client.Client
+}
+
+func NewNotifyClient(c *client.Client) *NotifyClient {
+	return &NotifyClient{c}
+}
+
+// SupportNotify checks if the server supports the NOTIFY extension.
+func (c *NotifyClient) SupportNotify() (bool, error) {
+	return c.c.Support("NOTIFY")
+}
+
+// Set asks the server to report new, expunged and changed messages of the
+// selected mailbox as usual and those of all subscribed mailboxes with
+// untagged STATUS responses.
+func (c *NotifyClient) Set() error {
+	state := c.c.State()
+	if state != imap.AuthenticatedState && state != imap.SelectedState {
+		return client.ErrNotLoggedIn
+	}
+	status, err := c.c.Execute(&notifySetCommand{}, WithVanished(c.c, nil))
+	if err != nil {
+		return err
+	}
+	return status.Err()
+}
+
+// Idle works like client.Idle except that the STATUS responses received
+// while idling are passed to onStatus. They are otherwise ignored by go-imap.
+// onStatus is called from the client reader and must not block.
+func (c *NotifyClient) Idle(
+	stop <-chan struct{}, onStatus func(*imap.MailboxStatus),
+) error {
+	// same as client.Idle to avoid being logged out by the server
+	t := time.NewTicker(25 * time.Minute)
+	defer t.Stop()
+
+	for {
+		stopOrRestart := make(chan struct{})
+		done := make(chan error, 1)
+		go func() {
+			done <- c.idle(stopOrRestart, onStatus)
+		}()
+
+		select {
+		case <-t.C:
+			close(stopOrRestart)
+			if err := <-done; err != nil {
+				return err
+			}
+		case <-stop:
+			close(stopOrRestart)
+			return <-done
+		case err := <-done:
+			close(stopOrRestart)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (c *NotifyClient) idle(
+	stop <-chan struct{}, onStatus func(*imap.MailboxStatus),
+) error {
+	res := &notifyIdleResponse{
+		Idle: responses.Idle{
+			Stop:      stop,
+			RepliesCh: make(chan []byte, 10),
+		},
+		onStatus: onStatus,
+	}
+	status, err := c.c.Execute(&commands.Idle{}, WithVanished(c.c, res))
+	if err != nil {
+		return err
+	}
+	return status.Err()
+}
+
+// NOTIFY SET (selected (MessageNew MessageExpunge FlagChange))
+// (subscribed (MessageNew MessageExpunge FlagChange))
+type notifySetCommand struct{}
+
+func (cmd *notifySetCommand) Command() *imap.Command {
+	events := []interface{}{
+		imap.RawString("MessageNew"),
+		imap.RawString("MessageExpunge"),
+		imap.RawString("FlagChange"),
+	}
+	return &imap.Command{
+		Name: "NOTIFY",
+		Arguments: []interface{}{
+			imap.RawString("SET"),
+			[]interface{}{imap.RawString("selected"), events},
+			[]interface{}{imap.RawString("subscribed"), events},
+		},
+	}
+}
+
+type notifyIdleResponse struct {
+	responses.Idle
+	onStatus func(*imap.MailboxStatus)
+}
+
+func (r *notifyIdleResponse) Handle(resp imap.Resp) error {
+	status := &responses.Status{}
+	err := status.Handle(resp)
+	switch {
+	case err == nil:
+		r.onStatus(status.Mailbox)
+		return nil
+	case !errors.Is(err, responses.ErrUnhandled):
+		// a malformed notification must not abort the IDLE command
+		return nil
+	}
+	return r.Idle.Handle(resp)
+}
@@ -0,0 +1,244 @@
+package extensions
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/commands"
+	"github.com/emersion/go-imap/responses"
+)
+
+// A QRESYNC client (RFC 7162)
+//
+// Once QRESYNC is enabled, the server reports expunged messages with VANISHED
+// responses instead of EXPUNGE, during any command. go-imap ignores them, so
+// every command sent on the connection must be executed with a response
+// handler wrapped by WithVanished.
+type QresyncClient struct {
+	c *client.Client
+}
+
+func NewQresyncClient(c *client.Client) *QresyncClient {
+	return &QresyncClient{c}
+}
+
+// SupportQresync checks if the server supports the QRESYNC extension.
+func (c *QresyncClient) SupportQresync() (bool, error) {
+	return c.c.Support("QRESYNC")
+}
+
+// Enable performs an ENABLE QRESYNC command (RFC 5161). It must be sent
+// before selecting a mailbox.
+func (c *QresyncClient) Enable() error {
+	if c.c.State() != imap.AuthenticatedState {
+		return client.ErrNotLoggedIn
+	}
+	res := &enabledResponse{}
+	status, err := c.c.Execute(&enableCommand{}, res)
+	if err != nil {
+		return err
+	}
+	if err := status.Err(); err != nil {
+		return err
+	}
+	if !res.enabled {
+		return errors.New("QRESYNC was not enabled by the server")
+	}
+	return nil
+}
+
+// Changes are the changes of a mailbox reported when selecting it with
+// QRESYNC.
+type Changes struct {
+	// UIDs of the messages expunged since the known mod-sequence. The set
+	// may include UIDs which were never known.
+	Vanished *imap.SeqSet
+	// UIDs and flags of the messages changed or added since
+	Changed []*imap.Message
+}
+
+// Select performs a SELECT (QRESYNC) command with the UIDVALIDITY and
+// HIGHESTMODSEQ saved for the mailbox. It returns the status and HIGHESTMODSEQ
+// of the mailbox like CondstoreClient.Select, and the changes since modseq.
+// The changes are empty if uidValidity has changed.
+func (c *QresyncClient) Select(
+	name string, uidValidity uint32, modseq uint64,
+) (*imap.MailboxStatus, uint64, *Changes, error) {
+	res := &qresyncSelectResponse{
+		condstoreSelectResponse: newCondstoreSelectResponse(name),
+		changes:                 &Changes{Vanished: new(imap.SeqSet)},
+	}
+	cmd := &qresyncSelectCommand{
+		Select:      commands.Select{Mailbox: name},
+		UidValidity: uidValidity,
+		ModSeq:      modseq,
+	}
+	mbox, highest, err := executeSelect(c.c, cmd, res.condstoreSelectResponse, res)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return mbox, highest, res.changes, nil
+}
+
+// WithVanished wraps the response handler h of a command so that the VANISHED
+// responses received meanwhile are passed to the client updates, in order with
+// the other updates. They are sent as status updates which can be decoded with
+// Vanished. h may be nil.
+func WithVanished(c *client.Client, h responses.Handler) responses.Handler {
+	return &vanishedHandler{c: c, h: h}
+}
+
+// Vanished returns the UIDs reported by a VANISHED response passed as a status
+// update by WithVanished.
+func Vanished(update *client.StatusUpdate) (*imap.SeqSet, bool) {
+	status := update.Status
+	if status == nil || status.Tag != vanishedTag || len(status.Arguments) != 1 {
+		return nil, false
+	}
+	set, ok := status.Arguments[0].(*imap.SeqSet)
+	return set, ok
+}
+
+// tag of the status updates carrying VANISHED responses, real untagged
+// responses are tagged with "*"
+const vanishedTag = "VANISHED"
+
+type vanishedHandler struct {
+	c *client.Client
+	h responses.Handler
+}
+
+func (v *vanishedHandler) Handle(resp imap.Resp) error {
+	if v.h != nil {
+		if err := v.h.Handle(resp); !errors.Is(err, responses.ErrUnhandled) {
+			return err
+		}
+	}
+	set, earlier, ok := parseVanished(resp)
+	if !ok {
+		return responses.ErrUnhandled
+	}
+	// VANISHED (EARLIER) is only sent in response to commands which ask
+	// for it
+	if !earlier && v.c.Updates != nil {
+		v.c.Updates <- &client.StatusUpdate{Status: &imap.StatusResp{
+			Tag:       vanishedTag,
+			Type:      imap.StatusRespOk,
+			Arguments: []interface{}{set},
+		}}
+	}
+	return nil
+}
+
+// Replies forwards the replies of the wrapped handler, needed by IDLE.
+func (v *vanishedHandler) Replies() <-chan []byte {
+	if r, ok := v.h.(responses.Replier); ok {
+		return r.Replies()
+	}
+	return nil
+}
+
+// parseVanished parses a VANISHED [(EARLIER)] uid-set response.
+func parseVanished(resp imap.Resp) (*imap.SeqSet, bool, bool) {
+	name, fields, ok := imap.ParseNamedResp(resp)
+	if !ok || name != "VANISHED" || len(fields) == 0 {
+		return nil, false, false
+	}
+	earlier := false
+	if tags, ok := fields[0].([]interface{}); ok {
+		for _, tag := range tags {
+			if s, _ := imap.ParseString(tag); strings.EqualFold(s, "EARLIER") {
+				earlier = true
+			}
+		}
+		fields = fields[1:]
+	}
+	if len(fields) != 1 {
+		return nil, false, false
+	}
+	s, err := imap.ParseString(fields[0])
+	if err != nil {
+		return nil, false, false
+	}
+	set, err := imap.ParseSeqSet(s)
+	if err != nil {
+		return nil, false, false
+	}
+	return set, earlier, true
+}
+
+// ENABLE QRESYNC
+type enableCommand struct{}
+
+func (cmd *enableCommand) Command() *imap.Command {
+	return &imap.Command{
+		Name:      "ENABLE",
+		Arguments: []interface{}{imap.RawString("QRESYNC")},
+	}
+}
+
+type enabledResponse struct {
+	enabled bool
+}
+
+func (r *enabledResponse) Handle(resp imap.Resp) error {
+	name, fields, ok := imap.ParseNamedResp(resp)
+	if !ok || name != "ENABLED" {
+		return responses.ErrUnhandled
+	}
+	for _, f := range fields {
+		if s, _ := imap.ParseString(f); strings.EqualFold(s, "QRESYNC") {
+			r.enabled = true
+		}
+	}
+	return nil
+}
+
+// SELECT mailbox (QRESYNC (uidvalidity modseq))
+type qresyncSelectCommand struct {
+	commands.Select
+	UidValidity uint32
+	ModSeq      uint64
+}
+
+func (cmd *qresyncSelectCommand) Command() *imap.Command {
+	c := cmd.Select.Command()
+	c.Arguments = append(c.Arguments, []interface{}{
+		imap.RawString("QRESYNC"),
+		[]interface{}{
+			imap.RawString(strconv.FormatUint(uint64(cmd.UidValidity), 10)),
+			imap.RawString(strconv.FormatUint(cmd.ModSeq, 10)),
+		},
+	})
+	return c
+}
+
+type qresyncSelectResponse struct {
+	*condstoreSelectResponse
+	changes *Changes
+}
+
+func (r *qresyncSelectResponse) Handle(resp imap.Resp) error {
+	name, fields, ok := imap.ParseNamedResp(resp)
+	switch {
+	case ok && name == "FETCH" && len(fields) == 2:
+		seqNum, _ := imap.ParseNumber(fields[0])
+		items, _ := fields[1].([]interface{})
+		msg := &imap.Message{SeqNum: seqNum}
+		if err := msg.Parse(items); err == nil && msg.Uid != 0 {
+			r.changes.Changed = append(r.changes.Changed, msg)
+		}
+		return nil
+	case ok && name == "VANISHED":
+		// without EARLIER, the UIDs belong to the previously selected
+		// mailbox (RFC 7162 section 3.2.5.1)
+		if set, earlier, ok := parseVanished(resp); ok && earlier {
+			r.changes.Vanished.AddSet(set)
+		}
+		return nil
+	}
+	return r.condstoreSelectResponse.Handle(resp)
+}
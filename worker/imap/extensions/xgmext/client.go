@@ -10,6 +10,7 @@ import (
 	"github.com/emersion/go-imap/responses"
 
 	"git.sr.ht/~rjarry/aerc/lib/log"
+	"git.sr.ht/~rjarry/aerc/worker/imap/extensions"
 )
 
 // XGMExtClient is a client for the X-GM-EXT-1 Gmail extension.
@@ -62,7 +63,7 @@ func (x *XGMExtClient) fetchThreadIds(uids []uint32) ([]string, error) {
 	for _, uid := range uids {
 		set.AddNum(uid)
 	}
-	err := x.c.UidFetch(&set, items, messages)
+	err := x.uidFetch(&set, items, messages)
 	<-done
 
 	thrid := make([]string, 0, len(m))
@@ -72,6 +73,24 @@ func (x *XGMExtClient) fetchThreadIds(uids []uint32) ([]string, error) {
 	return thrid, err
 }
 
+// uidFetch works like client.UidFetch but passes the VANISHED responses on
+// (see extensions.WithVanished).
+func (x *XGMExtClient) uidFetch(
+	set *imap.SeqSet, items []imap.FetchItem, ch chan *imap.Message,
+) error {
+	defer close(ch)
+	if x.c.State() != imap.SelectedState {
+		return client.ErrNoMailboxSelected
+	}
+	cmd := &commands.Uid{Cmd: &commands.Fetch{SeqSet: set, Items: items}}
+	res := &responses.Fetch{Messages: ch, SeqSet: set, Uid: true}
+	status, err := x.c.Execute(cmd, extensions.WithVanished(x.c, res))
+	if err != nil {
+		return err
+	}
+	return status.Err()
+}
+
 func (x *XGMExtClient) RawSearch(rawSearch string) ([]uint32, error) {
 	return x.runSearch(NewRawSearch(rawSearch))
 }
@@ -82,7 +101,7 @@ func (x *XGMExtClient) runSearch(cmd imap.Commander) ([]uint32, error) {
 	}
 	cmd = &commands.Uid{Cmd: cmd}
 	res := new(responses.Search)
-	status, err := x.c.Execute(cmd, res)
+	status, err := x.c.Execute(cmd, extensions.WithVanished(x.c, res))
 	if err != nil {
 		return nil, fmt.Errorf("imap execute failed: %w", err)
 	}
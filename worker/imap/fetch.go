@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"fmt"
+	"io"
 	"slices"
 	"time"
 
@@ -258,10 +259,15 @@ func (imapw *IMAPWorker) handleFetchFullMessages(
 			if r == nil {
 				return fmt.Errorf("could not get section %#v", section)
 			}
+			var reader io.Reader = bufio.NewReader(r)
+			if imapw.index != nil {
+				reader = imapw.indexMessage(msg.Directory,
+					imapw.Uint32ToUid(_msg.Uid), r)
+			}
 			imapw.worker.PostMessage(&types.FullMessage{
 				Message: types.RespondTo(msg),
 				Content: &models.FullMessage{
-					Reader: bufio.NewReader(r),
+					Reader: reader,
 					Uid:    imapw.Uint32ToUid(_msg.Uid),
 				},
 			}, nil)
@@ -342,6 +348,7 @@ func (imapw *IMAPWorker) handleFetchMessages(
 					goto out
 				}
 				delete(missingUids, imapw.Uint32ToUid(_msg.Uid))
+				imapw.updateKnownFlags(_msg)
 				err := procFunc(_msg)
 				if err != nil {
 					imapw.worker.Errorf("failed to process message <%d>: %v", _msg.Uid, err)
@@ -31,7 +31,8 @@ func (imapw *IMAPWorker) drainUpdates() *drainCloser {
 			case update := <-imapw.updates:
 				switch update.(type) {
 				case *client.MessageUpdate,
-					*client.ExpungeUpdate:
+					*client.ExpungeUpdate,
+					*client.StatusUpdate:
 					imapw.handleImapUpdate(update)
 				}
 			case <-done:
@@ -98,6 +99,49 @@ func (imapw *IMAPWorker) handleAnsweredMessages(msg *types.AnsweredMessages) err
 		})
 }
 
+func (imapw *IMAPWorker) handleJunkMessages(msg *types.JunkMessages) error {
+	if err := imapw.ensureSelected(msg.Directory); err != nil {
+		return err
+	}
+	perm := imapw.selected.PermanentFlags
+	if len(perm) > 0 && !slices.Contains(perm, "\\*") &&
+		!slices.Contains(perm, junkKeyword) {
+		return types.ErrUnsupported
+	}
+	set, unset := junkKeyword, notJunkKeyword
+	if !msg.Junk {
+		set, unset = notJunkKeyword, junkKeyword
+	}
+	ops := []struct {
+		op   imap.FlagsOp
+		flag string
+	}{
+		{imap.RemoveFlags, unset},
+		{imap.AddFlags, set},
+	}
+	for _, o := range ops {
+		item := imap.FormatFlagsOp(o.op, false)
+		err := imapw.handleStoreOps(msg.Uids, item, []any{o.flag},
+			func(_msg *imap.Message) error {
+				systemFlags, keywordFlags := translateImapFlags(_msg.Flags)
+				imapw.worker.PostMessage(&types.MessageInfo{
+					Message: types.RespondTo(msg),
+					Info: &models.MessageInfo{
+						Flags:     systemFlags,
+						Labels:    keywordFlags,
+						Directory: msg.Directory,
+						Uid:       imapw.Uint32ToUid(_msg.Uid),
+					},
+				}, nil)
+				return nil
+			})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (imapw *IMAPWorker) handleFlagMessages(msg *types.FlagMessages) error {
 	if err := imapw.ensureSelected(msg.Directory); err != nil {
 		return err
@@ -244,6 +288,7 @@ func (imapw *IMAPWorker) handleStoreOps(
 
 		var reterr error
 		for _msg := range messages {
+			imapw.updateKnownFlags(_msg)
 			err := procFunc(_msg)
 			if err != nil {
 				if reterr == nil {
@@ -24,6 +24,8 @@ type idler struct {
 	stop      chan struct{}
 	start     chan struct{}
 	done      chan error
+	// receives the status of other mailboxes when NOTIFY is enabled
+	onStatus func(*imap.MailboxStatus)
 }
 
 func newIdler(w types.WorkerInteractor, startIdler chan struct{}) *idler {
@@ -42,6 +44,13 @@ func (i *idler) SetClient(c *imapClient) {
 	i.client = c
 }
 
+// SetStatusHandler makes the idler report the STATUS responses sent by the
+// server for other mailboxes than the selected one (RFC 5465). A nil handler
+// restores the plain IDLE command.
+func (i *idler) SetStatusHandler(onStatus func(*imap.MailboxStatus)) {
+	i.onStatus = onStatus
+}
+
 func (i *idler) ready() bool {
 	return (i.client != nil && i.client.State() == imap.SelectedState)
 }
@@ -91,7 +100,12 @@ func (i *idler) Execute() {
 		defer log.PanicHandler()
 
 		start := time.Now()
-		err := i.client.Idle(i.stop, nil)
+		var err error
+		if i.onStatus != nil {
+			err = i.client.notify.Idle(i.stop, i.onStatus)
+		} else {
+			err = i.client.Idle(i.stop, nil)
+		}
 		if err != nil {
 			i.worker.Errorf("idle returned error: %v", err)
 		}
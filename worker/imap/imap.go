@@ -24,7 +24,11 @@ func (w *IMAPWorker) UidToUint32(uid models.UID) uint32 {
 }
 
 func (w *IMAPWorker) Uint32ToUid(u uint32) models.UID {
-	return models.UID(fmt.Sprintf("%s:%d:%012d", w.selected.Name, w.selected.UidValidity, u))
+	return formatUid(w.selected.Name, w.selected.UidValidity, u)
+}
+
+func formatUid(mailbox string, validity uint32, u uint32) models.UID {
+	return models.UID(fmt.Sprintf("%s:%d:%012d", mailbox, validity, u))
 }
 
 func (w *IMAPWorker) UidToUint32List(uids []models.UID) []uint32 {
@@ -119,6 +123,12 @@ var imapToFlag = map[string]models.Flags{
 	imap.DraftFlag:    models.DraftFlag,
 }
 
+// keywords used by spam filters (RFC 5788)
+const (
+	junkKeyword    = "$Junk"
+	notJunkKeyword = "$NotJunk"
+)
+
 var flagToImap = map[models.Flags]string{
 	models.SeenFlag:     imap.SeenFlag,
 	models.RecentFlag:   imap.RecentFlag,
@@ -49,3 +49,22 @@ func TestTranslateEnvelope(t *testing.T) {
 	}
 	assert.Equal(t, &expected, translateEnvelope(&given))
 }
+
+func TestCopyUidResponse(t *testing.T) {
+	res := &copyUidResponse{}
+	err := res.Handle(&imap.StatusResp{
+		Type:      imap.StatusRespOk,
+		Code:      "COPYUID",
+		Arguments: []any{"38505", "304,319:320", "3956:3958"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(38505), res.validity)
+	assert.Equal(t, map[uint32]uint32{
+		304: 3956,
+		319: 3957,
+		320: 3958,
+	}, res.uids)
+
+	err = res.Handle(&imap.StatusResp{Type: imap.StatusRespOk, Code: "UIDNEXT"})
+	assert.Error(t, err)
+}
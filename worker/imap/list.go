@@ -8,6 +8,7 @@ import (
 
 	"git.sr.ht/~rjarry/aerc/lib/log"
 	"git.sr.ht/~rjarry/aerc/models"
+	"git.sr.ht/~rjarry/aerc/worker/lib"
 	"git.sr.ht/~rjarry/aerc/worker/types"
 )
 
@@ -140,6 +141,18 @@ func (imapw *IMAPWorker) handleSearchDirectory(msg *types.SearchDirectory) error
 		return nil
 	}
 
+	if imapw.index != nil && lib.CanSearch(msg.Criteria) {
+		if uids, ok := imapw.searchIndex(msg); ok {
+			imapw.worker.PostMessage(&types.SearchResults{
+				Message:   types.RespondTo(msg),
+				Directory: msg.Directory,
+				Criteria:  msg.Criteria,
+				Uids:      uids,
+			}, nil)
+			return nil
+		}
+	}
+
 	criteria := translateSearch(msg.Criteria)
 
 	uids, err := imapw.client.UidSearch(criteria)
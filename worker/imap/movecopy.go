@@ -1,8 +1,15 @@
 package imap
 
 import (
+	"fmt"
 	"io"
+	"strings"
 
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/commands"
+	"github.com/emersion/go-imap/responses"
+
+	"git.sr.ht/~rjarry/aerc/models"
 	"git.sr.ht/~rjarry/aerc/worker/types"
 )
 
@@ -11,13 +18,23 @@ func (imapw *IMAPWorker) handleCopyMessages(msg *types.CopyMessages) error {
 		return err
 	}
 	uids := imapw.UidListToSeqSet(msg.Uids)
-	if err := imapw.client.UidCopy(uids, msg.Destination); err != nil {
+	res := &copyUidResponse{}
+	status, err := imapw.client.Execute(&commands.Uid{
+		Cmd: &commands.Copy{SeqSet: uids, Mailbox: msg.Destination},
+	}, res)
+	if err != nil {
+		return err
+	}
+	if err := status.Err(); err != nil {
 		return err
 	}
+	// UID COPY returns COPYUID in the tagged response
+	_ = res.Handle(status)
 	imapw.worker.PostMessage(&types.MessagesCopied{
 		Message:     types.RespondTo(msg),
 		Destination: msg.Destination,
 		Uids:        msg.Uids,
+		DestUids:    res.destUids(imapw, msg.Destination, msg.Uids),
 	}, nil)
 	return nil
 }
@@ -53,13 +70,115 @@ func (imapw *IMAPWorker) handleMoveMessages(msg *types.MoveMessages) error {
 	imapw.BuildExpungeHandler(imapw.UidToUint32List(msg.Uids), false)
 
 	uids := imapw.UidListToSeqSet(msg.Uids)
-	if err := imapw.client.UidMove(uids, msg.Destination); err != nil {
+	res := &copyUidResponse{}
+	if ok, _ := imapw.client.Support("MOVE"); ok {
+		// MOVE returns COPYUID in an untagged response
+		status, err := imapw.client.Execute(&commands.Uid{
+			Cmd: &commands.Move{SeqSet: uids, Mailbox: msg.Destination},
+		}, res)
+		if err != nil {
+			return err
+		}
+		if err := status.Err(); err != nil {
+			return err
+		}
+	} else if err := imapw.client.UidMove(uids, msg.Destination); err != nil {
 		return err
 	}
 	imapw.worker.PostMessage(&types.MessagesMoved{
 		Message:     types.RespondTo(msg),
 		Destination: msg.Destination,
 		Uids:        msg.Uids,
+		DestUids:    res.destUids(imapw, msg.Destination, msg.Uids),
 	}, nil)
 	return nil
 }
+
+// copyUidResponse collects the COPYUID response code (RFC 4315) sent by
+// servers supporting UIDPLUS after a COPY or MOVE command.
+type copyUidResponse struct {
+	validity uint32
+	uids     map[uint32]uint32
+}
+
+func (r *copyUidResponse) Handle(resp imap.Resp) error {
+	status, ok := resp.(*imap.StatusResp)
+	if !ok || status.Code != "COPYUID" {
+		return responses.ErrUnhandled
+	}
+	if len(status.Arguments) < 3 {
+		return responses.ErrUnhandled
+	}
+	validity, err := imap.ParseNumber(status.Arguments[0])
+	if err != nil {
+		return responses.ErrUnhandled
+	}
+	srcSet, _ := imap.ParseString(status.Arguments[1])
+	destSet, _ := imap.ParseString(status.Arguments[2])
+	src, err := parseUidSet(srcSet)
+	if err != nil {
+		return responses.ErrUnhandled
+	}
+	dest, err := parseUidSet(destSet)
+	if err != nil || len(src) != len(dest) {
+		return responses.ErrUnhandled
+	}
+	if r.uids == nil {
+		r.uids = make(map[uint32]uint32)
+	}
+	r.validity = validity
+	for i, u := range src {
+		r.uids[u] = dest[i]
+	}
+	return nil
+}
+
+// destUids returns the UIDs of the messages in the destination folder, in the
+// same order as uids. It returns nil if the server did not report them all.
+func (r *copyUidResponse) destUids(
+	imapw *IMAPWorker, dest string, uids []models.UID,
+) []models.UID {
+	if len(r.uids) == 0 {
+		return nil
+	}
+	destUids := make([]models.UID, 0, len(uids))
+	for _, uid := range uids {
+		u, ok := r.uids[imapw.UidToUint32(uid)]
+		if !ok {
+			return nil
+		}
+		destUids = append(destUids, formatUid(dest, r.validity, u))
+	}
+	return destUids
+}
+
+// parseUidSet expands a uid-set as sent in COPYUID responses. Unlike
+// imap.SeqSet, the order of the UIDs is preserved since source and
+// destination sets are matched by position.
+func parseUidSet(set string) ([]uint32, error) {
+	var uids []uint32
+	for _, s := range strings.Split(set, ",") {
+		start, stop, isRange := strings.Cut(s, ":")
+		first, err := imap.ParseNumber(start)
+		if err != nil {
+			return nil, err
+		}
+		last := first
+		if isRange {
+			last, err = imap.ParseNumber(stop)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if last < first {
+			first, last = last, first
+		}
+		if last-first > 1<<16 {
+			return nil, fmt.Errorf("uid range too large: %s", s)
+		}
+		for u := first; u <= last; u++ {
+			uids = append(uids, u)
+		}
+	}
+	return uids, nil
+}
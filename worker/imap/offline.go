@@ -0,0 +1,962 @@
+package imap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-message"
+	"github.com/emersion/go-message/mail"
+	"github.com/emersion/go-message/textproto"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+
+	"git.sr.ht/~rjarry/aerc/config"
+	aercLib "git.sr.ht/~rjarry/aerc/lib"
+	"git.sr.ht/~rjarry/aerc/lib/iterator"
+	"git.sr.ht/~rjarry/aerc/lib/log"
+	"git.sr.ht/~rjarry/aerc/lib/rfc822"
+	"git.sr.ht/~rjarry/aerc/models"
+	"git.sr.ht/~rjarry/aerc/worker/lib"
+	"git.sr.ht/~rjarry/aerc/worker/types"
+)
+
+// number of message bodies downloaded per synchronization step
+const offlineSyncBatch = 50
+
+// offlineStore keeps the folders, message lists, flags and bodies of an
+// account to serve them while disconnected, along with the operations to
+// replay on the server once connected again.
+//
+//	dir.<folder>     models.Directory
+//	uids.<folder>    []models.UID
+//	flags.<uid>      offlineFlags
+//	body.<uid>       raw message
+//	queue.<seq>      offlineOp
+type offlineStore struct {
+	db  *leveldb.DB
+	seq uint64
+}
+
+type offlineFlags struct {
+	Flags  models.Flags
+	Labels []string
+}
+
+// offlineOp is an operation performed while disconnected.
+type offlineOp struct {
+	// flag, answer, delete, move, copy or append
+	Kind        string
+	Directory   string
+	Destination string
+	Uids        []models.UID
+	// Message-Id of each of Uids, used to find the messages again if the
+	// UIDVALIDITY of the folder has changed.
+	MessageIds []string
+	Flags      models.Flags
+	Enable     bool
+	Date       time.Time
+	Data       []byte
+}
+
+func openOfflineStore(path string) (*offlineStore, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	s := &offlineStore{db: db}
+	iter := db.NewIterator(util.BytesPrefix([]byte("queue.")), nil)
+	if iter.Last() {
+		_, _ = fmt.Sscanf(string(iter.Key()), "queue.%d", &s.seq)
+	}
+	iter.Release()
+	return s, iter.Error()
+}
+
+func (s *offlineStore) get(key string, v any) bool {
+	data, err := s.db.Get([]byte(key), nil)
+	if err != nil {
+		return false
+	}
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v) == nil
+}
+
+func (s *offlineStore) put(key string, v any) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return err
+	}
+	return s.db.Put([]byte(key), buf.Bytes(), nil)
+}
+
+func (s *offlineStore) PutDirectory(dir *models.Directory) error {
+	return s.put("dir."+dir.Name, dir)
+}
+
+func (s *offlineStore) Directories() []*models.Directory {
+	var dirs []*models.Directory
+	iter := s.db.NewIterator(util.BytesPrefix([]byte("dir.")), nil)
+	defer iter.Release()
+	for iter.Next() {
+		var dir models.Directory
+		if gob.NewDecoder(bytes.NewReader(iter.Value())).Decode(&dir) == nil {
+			dirs = append(dirs, &dir)
+		}
+	}
+	return dirs
+}
+
+// PruneDirectories removes the folders not in keep along with their
+// messages.
+func (s *offlineStore) PruneDirectories(keep map[string]bool) error {
+	for _, dir := range s.Directories() {
+		if keep[dir.Name] {
+			continue
+		}
+		if err := s.SetUids(dir.Name, nil); err != nil {
+			return err
+		}
+		if err := s.db.Delete([]byte("uids."+dir.Name), nil); err != nil {
+			return err
+		}
+		if err := s.db.Delete([]byte("dir."+dir.Name), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Uids returns the messages of a folder, in ascending order.
+func (s *offlineStore) Uids(dir string) []models.UID {
+	var uids []models.UID
+	s.get("uids."+dir, &uids)
+	return uids
+}
+
+// SetUids replaces the messages of a folder. The flags and bodies of the
+// messages which are not listed anymore are removed.
+func (s *offlineStore) SetUids(dir string, uids []models.UID) error {
+	uids = slices.Clone(uids)
+	slices.Sort(uids)
+	batch := new(leveldb.Batch)
+	for _, uid := range s.Uids(dir) {
+		if _, found := slices.BinarySearch(uids, uid); !found {
+			batch.Delete([]byte("flags." + uid))
+			batch.Delete([]byte("body." + uid))
+		}
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(uids); err != nil {
+		return err
+	}
+	batch.Put([]byte("uids."+dir), buf.Bytes())
+	return s.db.Write(batch, nil)
+}
+
+func (s *offlineStore) RemoveUids(dir string, uids []models.UID) error {
+	return s.SetUids(dir, slices.DeleteFunc(s.Uids(dir), func(uid models.UID) bool {
+		return slices.Contains(uids, uid)
+	}))
+}
+
+func (s *offlineStore) Flags(uid models.UID) offlineFlags {
+	var flags offlineFlags
+	s.get("flags."+string(uid), &flags)
+	return flags
+}
+
+func (s *offlineStore) PutFlags(uid models.UID, flags offlineFlags) error {
+	return s.put("flags."+string(uid), flags)
+}
+
+func (s *offlineStore) Body(uid models.UID) ([]byte, bool) {
+	data, err := s.db.Get([]byte("body."+uid), nil)
+	return data, err == nil
+}
+
+func (s *offlineStore) HasBody(uid models.UID) bool {
+	ok, _ := s.db.Has([]byte("body."+uid), nil)
+	return ok
+}
+
+func (s *offlineStore) PutBody(uid models.UID, data []byte) error {
+	return s.db.Put([]byte("body."+uid), data, nil)
+}
+
+// MessageIds returns the Message-Id of each message, or an empty string if
+// unknown.
+func (s *offlineStore) MessageIds(uids []models.UID) []string {
+	ids := make([]string, len(uids))
+	for i, uid := range uids {
+		data, ok := s.Body(uid)
+		if !ok {
+			continue
+		}
+		h, err := textproto.ReadHeader(bufio.NewReader(bytes.NewReader(data)))
+		if err != nil {
+			continue
+		}
+		ids[i], _ = (&mail.Header{Header: message.Header{Header: h}}).MessageID()
+	}
+	return ids
+}
+
+func (s *offlineStore) Enqueue(op *offlineOp) error {
+	s.seq++
+	return s.put(fmt.Sprintf("queue.%020d", s.seq), op)
+}
+
+// Queue returns the keys of the queued operations, oldest first.
+func (s *offlineStore) Queue() []string {
+	var keys []string
+	iter := s.db.NewIterator(util.BytesPrefix([]byte("queue.")), nil)
+	defer iter.Release()
+	for iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	return keys
+}
+
+func (s *offlineStore) Dequeue(key string) error {
+	return s.db.Delete([]byte(key), nil)
+}
+
+// offlineMessage implements rfc822.RawMessage for stored messages.
+type offlineMessage struct {
+	uid   models.UID
+	data  []byte
+	flags offlineFlags
+}
+
+func (m *offlineMessage) NewReader() (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(m.data)), nil
+}
+
+func (m *offlineMessage) ModelFlags() (models.Flags, error) {
+	return m.flags.Flags, nil
+}
+
+func (m *offlineMessage) Labels() ([]string, error) {
+	return m.flags.Labels, nil
+}
+
+func (m *offlineMessage) UID() models.UID {
+	return m.uid
+}
+
+// offlineRecorder is the outermost worker middleware. It records the
+// folders, message lists, flags and bodies sent by the worker while
+// connected.
+type offlineRecorder struct {
+	sync.Mutex
+	types.WorkerInteractor
+	store  *offlineStore
+	online func() bool
+	listed map[string]bool
+}
+
+func newOfflineRecorder(base types.WorkerInteractor, store *offlineStore,
+	online func() bool,
+) types.WorkerInteractor {
+	base.Infof("loading worker middleware: offline")
+	return &offlineRecorder{
+		WorkerInteractor: base,
+		store:            store,
+		online:           online,
+	}
+}
+
+func (r *offlineRecorder) Unwrap() types.WorkerInteractor {
+	return r.WorkerInteractor
+}
+
+func (r *offlineRecorder) ProcessAction(msg types.WorkerMessage) types.WorkerMessage {
+	msg = r.WorkerInteractor.ProcessAction(msg)
+	if _, ok := msg.(*types.ListDirectories); ok && r.online() {
+		r.Lock()
+		r.listed = make(map[string]bool)
+		r.Unlock()
+	}
+	return msg
+}
+
+func (r *offlineRecorder) PostMessage(msg types.WorkerMessage,
+	cb func(m types.WorkerMessage),
+) {
+	if r.online() {
+		if err := r.record(msg); err != nil {
+			r.Errorf("offline store: %v", err)
+		}
+	}
+	r.WorkerInteractor.PostMessage(msg, cb)
+}
+
+func (r *offlineRecorder) record(msg types.WorkerMessage) error {
+	switch msg := msg.(type) {
+	case *types.Directory:
+		r.Lock()
+		if r.listed != nil {
+			r.listed[msg.Dir.Name] = true
+		}
+		r.Unlock()
+		return r.store.PutDirectory(msg.Dir)
+	case *types.Done:
+		if _, ok := msg.InResponseTo().(*types.ListDirectories); !ok {
+			return nil
+		}
+		r.Lock()
+		listed := r.listed
+		r.listed = nil
+		r.Unlock()
+		if listed != nil {
+			return r.store.PruneDirectories(listed)
+		}
+	case *types.DirectoryContents:
+		if msg.Filter == nil {
+			return r.store.SetUids(msg.Directory, msg.Uids)
+		}
+	case *types.DirectoryThreaded:
+		if msg.Filter == nil {
+			var uids []models.UID
+			for _, thread := range msg.Threads {
+				_ = thread.Walk(func(t *types.Thread, _ int, _ error) error {
+					uids = append(uids, t.Uid)
+					return nil
+				})
+			}
+			return r.store.SetUids(msg.Directory, uids)
+		}
+	case *types.MessageInfo:
+		info := msg.Info
+		if msg.NeedsFlags || info == nil || info.Error != nil || info.Uid == "" {
+			return nil
+		}
+		flags := offlineFlags{Flags: info.Flags &^ models.RecentFlag, Labels: info.Labels}
+		if flags.Labels == nil {
+			flags.Labels = r.store.Flags(info.Uid).Labels
+		}
+		return r.store.PutFlags(info.Uid, flags)
+	case *types.FullMessage:
+		data, err := io.ReadAll(msg.Content.Reader)
+		msg.Content.Reader = bytes.NewReader(data)
+		if err != nil {
+			return err
+		}
+		return r.store.PutBody(msg.Content.Uid, data)
+	case *types.MessagesDeleted:
+		if len(msg.Uids) > 0 {
+			return r.store.RemoveUids(msg.Directory, msg.Uids)
+		}
+	}
+	return nil
+}
+
+// offlineSync is the synchronization in progress of the selected folder.
+type offlineSync struct {
+	dir   string
+	flags bool
+	// messages left to download, newest first
+	uids []uint32
+}
+
+// queueOfflineSync schedules the download of the flags and bodies of the
+// messages of the selected folder.
+func (w *IMAPWorker) queueOfflineSync(uids []uint32) {
+	if w.offline == nil {
+		return
+	}
+	pending := slices.Clone(uids)
+	slices.Sort(pending)
+	slices.Reverse(pending)
+	w.sync = &offlineSync{dir: w.selected.Name, flags: true, uids: pending}
+}
+
+func (w *IMAPWorker) scheduleOfflineSync() {
+	if w.sync == nil {
+		return
+	}
+	select {
+	case w.syncNext <- struct{}{}:
+	default:
+	}
+}
+
+// syncOffline downloads the flags of all messages of the selected folder,
+// then, on each subsequent call, a batch of the message bodies missing from
+// the offline store. It runs between actions to keep the UI responsive.
+func (w *IMAPWorker) syncOffline() {
+	s := w.sync
+	if s == nil || w.client == nil || s.dir != w.selected.Name || len(s.uids) == 0 {
+		w.sync = nil
+		return
+	}
+	drain := w.drainUpdates()
+	defer drain.Close()
+
+	if s.flags {
+		s.flags = false
+		set := new(imap.SeqSet)
+		set.AddNum(s.uids...)
+		items := []imap.FetchItem{imap.FetchUid, imap.FetchFlags}
+		err := w.offlineFetch(set, items, func(m *imap.Message) error {
+			uid := w.Uint32ToUid(m.Uid)
+			systemFlags, keywordFlags := translateImapFlags(m.Flags)
+			flags := w.offline.Flags(uid)
+			flags.Flags = systemFlags &^ models.RecentFlag
+			if !w.caps.Has("X-GM-EXT-1") {
+				flags.Labels = keywordFlags
+			}
+			return w.offline.PutFlags(uid, flags)
+		})
+		if err != nil {
+			w.worker.Errorf("offline sync of %s: %v", s.dir, err)
+			w.sync = nil
+		}
+		return
+	}
+
+	set := new(imap.SeqSet)
+	n := 0
+	for len(s.uids) > 0 && n < offlineSyncBatch {
+		u := s.uids[0]
+		s.uids = s.uids[1:]
+		if !w.offline.HasBody(w.Uint32ToUid(u)) {
+			set.AddNum(u)
+			n++
+		}
+	}
+	if len(s.uids) == 0 {
+		w.sync = nil
+	}
+	if n == 0 {
+		return
+	}
+	section := &imap.BodySectionName{Peek: true}
+	items := []imap.FetchItem{imap.FetchUid, section.FetchItem()}
+	err := w.offlineFetch(set, items, func(m *imap.Message) error {
+		r := m.GetBody(section)
+		if r == nil {
+			return nil
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		return w.offline.PutBody(w.Uint32ToUid(m.Uid), data)
+	})
+	if err != nil {
+		w.worker.Errorf("offline sync of %s: %v", s.dir, err)
+		w.sync = nil
+		return
+	}
+	w.worker.Debugf("offline sync of %s: %d messages downloaded, %d left",
+		s.dir, n, len(s.uids))
+}
+
+func (w *IMAPWorker) offlineFetch(
+	set *imap.SeqSet, items []imap.FetchItem, procFunc func(*imap.Message) error,
+) error {
+	messages := make(chan *imap.Message)
+	done := make(chan error, 1)
+	go func() {
+		defer log.PanicHandler()
+		var err error
+		for m := range messages {
+			if e := procFunc(m); e != nil && err == nil {
+				err = e
+			}
+		}
+		done <- err
+	}()
+	err := w.client.UidFetch(set, items, messages)
+	if e := <-done; err == nil {
+		err = e
+	}
+	return err
+}
+
+// goOffline notifies the UI that the connection failed and that messages
+// are served from the offline store until a reconnection succeeds.
+func (w *IMAPWorker) goOffline(msg types.WorkerMessage, err error) error {
+	w.terminate()
+	w.sync = nil
+	w.worker.PostMessage(&types.Offline{
+		Message: types.RespondTo(msg),
+		Error:   err,
+	}, nil)
+	return types.ErrNoop
+}
+
+func (w *IMAPWorker) handleOfflineMessage(msg types.WorkerMessage) error {
+	switch msg := msg.(type) {
+	case *types.ListDirectories:
+		for _, dir := range w.offline.Directories() {
+			w.worker.PostMessage(&types.Directory{
+				Message: types.RespondTo(msg),
+				Dir:     dir,
+			}, nil)
+		}
+		return nil
+	case *types.OpenDirectory:
+		w.selected = &imap.MailboxStatus{Name: msg.Directory}
+		return nil
+	case *types.FetchDirectoryContents:
+		uids, infos, err := w.offlineSearch(msg.Directory, msg.Filter)
+		if err != nil {
+			return err
+		}
+		if len(msg.SortCriteria) > 0 {
+			uids, err = lib.Sort(infos, msg.SortCriteria)
+			if err != nil {
+				return err
+			}
+		}
+		w.worker.PostMessage(&types.DirectoryContents{
+			Message:   types.RespondTo(msg),
+			Directory: msg.Directory,
+			Filter:    msg.Filter,
+			Uids:      uids,
+		}, nil)
+		return nil
+	case *types.FetchDirectoryThreaded:
+		uids, infos, err := w.offlineSearch(msg.Directory, msg.Filter)
+		if err != nil {
+			return err
+		}
+		ui := config.Ui().ForAccount(w.worker.Name())
+		builder := aercLib.NewThreadBuilder(
+			iterator.NewFactory(ui.ReverseOrder), ui.ThreadingBySubject)
+		for _, info := range infos {
+			builder.Update(info)
+		}
+		if len(msg.SortCriteria) > 0 {
+			uids, err = lib.Sort(infos, msg.SortCriteria)
+			if err != nil {
+				return err
+			}
+		}
+		w.worker.PostMessage(&types.DirectoryThreaded{
+			Message:   types.RespondTo(msg),
+			Directory: msg.Directory,
+			Filter:    msg.Filter,
+			Threads: builder.Threads(uids,
+				ui.ReverseThreadOrder, ui.SortThreadSiblings),
+		}, nil)
+		return nil
+	case *types.FetchMessageHeaders:
+		for _, uid := range msg.Uids {
+			info, err := w.offlineInfo(uid)
+			if err != nil {
+				info = &models.MessageInfo{
+					Envelope: &models.Envelope{},
+					Flags:    models.SeenFlag,
+					Uid:      uid,
+					Error:    err,
+				}
+			}
+			info.Directory = msg.Directory
+			w.worker.PostMessage(&types.MessageInfo{
+				Message: types.RespondTo(msg),
+				Info:    info,
+			}, nil)
+		}
+		return nil
+	case *types.FetchFullMessages:
+		for _, uid := range msg.Uids {
+			data, ok := w.offline.Body(uid)
+			if !ok {
+				continue
+			}
+			w.worker.PostMessage(&types.FullMessage{
+				Message: types.RespondTo(msg),
+				Content: &models.FullMessage{
+					Reader: bytes.NewReader(data),
+					Uid:    uid,
+				},
+			}, nil)
+		}
+		return nil
+	case *types.FetchMessageBodyPart:
+		data, ok := w.offline.Body(msg.Uid)
+		if !ok {
+			return fmt.Errorf("message %s not available offline", msg.Uid)
+		}
+		e, err := rfc822.ReadMessage(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		r, err := rfc822.FetchEntityPartReader(e, msg.Part)
+		if err != nil {
+			return err
+		}
+		w.worker.PostMessage(&types.MessageBodyPart{
+			Message: types.RespondTo(msg),
+			Part: &models.MessageBodyPart{
+				Reader: r,
+				Uid:    msg.Uid,
+			},
+		}, nil)
+		return nil
+	case *types.FetchMessageFlags:
+		for _, uid := range msg.Uids {
+			flags := w.offline.Flags(uid)
+			w.worker.PostMessage(&types.MessageInfo{
+				Message: types.RespondTo(msg),
+				Info: &models.MessageInfo{
+					Flags:     flags.Flags,
+					Labels:    flags.Labels,
+					Directory: msg.Directory,
+					Uid:       uid,
+				},
+			}, nil)
+		}
+		return nil
+	case *types.FlagMessages:
+		return w.offlineFlag(msg, "flag", msg.Directory, msg.Uids,
+			msg.Flags, msg.Enable)
+	case *types.AnsweredMessages:
+		return w.offlineFlag(msg, "answer", msg.Directory, msg.Uids,
+			models.AnsweredFlag, msg.Answered)
+	case *types.DeleteMessages:
+		err := w.offline.Enqueue(&offlineOp{
+			Kind:       "delete",
+			Directory:  msg.Directory,
+			Uids:       msg.Uids,
+			MessageIds: w.offline.MessageIds(msg.Uids),
+		})
+		if err != nil {
+			return err
+		}
+		if err := w.offline.RemoveUids(msg.Directory, msg.Uids); err != nil {
+			return err
+		}
+		w.unindex(msg.Directory, msg.Uids)
+		w.worker.PostMessage(&types.MessagesDeleted{
+			Message:   types.RespondTo(msg),
+			Directory: msg.Directory,
+			Uids:      msg.Uids,
+		}, nil)
+		return nil
+	case *types.MoveMessages:
+		err := w.offline.Enqueue(&offlineOp{
+			Kind:        "move",
+			Directory:   msg.Source,
+			Destination: msg.Destination,
+			Uids:        msg.Uids,
+			MessageIds:  w.offline.MessageIds(msg.Uids),
+		})
+		if err != nil {
+			return err
+		}
+		if err := w.offline.RemoveUids(msg.Source, msg.Uids); err != nil {
+			return err
+		}
+		w.unindex(msg.Source, msg.Uids)
+		w.worker.PostMessage(&types.MessagesMoved{
+			Message:     types.RespondTo(msg),
+			Destination: msg.Destination,
+			Uids:        msg.Uids,
+		}, nil)
+		w.worker.PostMessage(&types.MessagesDeleted{
+			Message:   types.RespondTo(msg),
+			Directory: msg.Source,
+			Uids:      msg.Uids,
+		}, nil)
+		return nil
+	case *types.CopyMessages:
+		err := w.offline.Enqueue(&offlineOp{
+			Kind:        "copy",
+			Directory:   msg.Source,
+			Destination: msg.Destination,
+			Uids:        msg.Uids,
+			MessageIds:  w.offline.MessageIds(msg.Uids),
+		})
+		if err != nil {
+			return err
+		}
+		w.worker.PostMessage(&types.MessagesCopied{
+			Message:     types.RespondTo(msg),
+			Destination: msg.Destination,
+			Uids:        msg.Uids,
+		}, nil)
+		return nil
+	case *types.AppendMessage:
+		data, err := io.ReadAll(msg.Reader)
+		if err != nil {
+			return err
+		}
+		return w.offline.Enqueue(&offlineOp{
+			Kind:        "append",
+			Destination: msg.Destination,
+			Flags:       msg.Flags,
+			Date:        msg.Date,
+			Data:        data,
+		})
+	case *types.SearchDirectory:
+		uids, _, err := w.offlineSearch(msg.Directory, msg.Criteria)
+		if err != nil {
+			return err
+		}
+		w.worker.PostMessage(&types.SearchResults{
+			Message:   types.RespondTo(msg),
+			Directory: msg.Directory,
+			Criteria:  msg.Criteria,
+			Uids:      uids,
+		}, nil)
+		return nil
+	case *types.CheckMail:
+		for _, dir := range msg.Directories {
+			info := &models.DirectoryInfo{Name: dir}
+			for _, uid := range w.offline.Uids(dir) {
+				if !w.offline.HasBody(uid) {
+					continue
+				}
+				info.Exists++
+				if w.offline.Flags(uid).Flags.Has(models.SeenFlag) {
+					continue
+				}
+				info.Unseen++
+			}
+			w.worker.PostMessage(&types.DirectoryInfo{
+				Message: types.RespondTo(msg),
+				Info:    info,
+			}, nil)
+		}
+		return nil
+	}
+	return errClientNotReady
+}
+
+// offlineMessages returns the stored messages of a folder.
+func (w *IMAPWorker) offlineMessages(dir string) []rfc822.RawMessage {
+	var messages []rfc822.RawMessage
+	for _, uid := range w.offline.Uids(dir) {
+		data, ok := w.offline.Body(uid)
+		if !ok {
+			continue
+		}
+		messages = append(messages, &offlineMessage{
+			uid:   uid,
+			data:  data,
+			flags: w.offline.Flags(uid),
+		})
+	}
+	return messages
+}
+
+// offlineSearch returns the uids and infos of the stored messages of a
+// folder matching criteria.
+func (w *IMAPWorker) offlineSearch(dir string, criteria *types.SearchCriteria) (
+	[]models.UID, []*models.MessageInfo, error,
+) {
+	messages := w.offlineMessages(dir)
+	if criteria != nil {
+		uids, err := lib.Search(messages, criteria)
+		if err != nil {
+			return nil, nil, err
+		}
+		messages = slices.DeleteFunc(messages, func(m rfc822.RawMessage) bool {
+			return !slices.Contains(uids, m.UID())
+		})
+	}
+	uids := make([]models.UID, 0, len(messages))
+	infos := make([]*models.MessageInfo, 0, len(messages))
+	for _, m := range messages {
+		info, err := rfc822.MessageInfo(m)
+		if err != nil {
+			w.worker.Errorf("could not get message info: %v", err)
+			continue
+		}
+		uids = append(uids, m.UID())
+		infos = append(infos, info)
+	}
+	return uids, infos, nil
+}
+
+func (w *IMAPWorker) offlineInfo(uid models.UID) (*models.MessageInfo, error) {
+	data, ok := w.offline.Body(uid)
+	if !ok {
+		return nil, fmt.Errorf("message %s not available offline", uid)
+	}
+	info, err := rfc822.MessageInfo(&offlineMessage{
+		uid:   uid,
+		data:  data,
+		flags: w.offline.Flags(uid),
+	})
+	if err != nil {
+		return nil, err
+	}
+	info.Size = uint32(len(data))
+	switch {
+	case len(w.config.headersExclude) > 0:
+		info.RFC822Headers = lib.LimitHeaders(info.RFC822Headers, w.config.headersExclude, true)
+	case len(w.config.headers) > 0:
+		info.RFC822Headers = lib.LimitHeaders(info.RFC822Headers, w.config.headers, false)
+	}
+	return info, nil
+}
+
+func (w *IMAPWorker) offlineFlag(msg types.WorkerMessage, kind, dir string,
+	uids []models.UID, flag models.Flags, enable bool,
+) error {
+	err := w.offline.Enqueue(&offlineOp{
+		Kind:       kind,
+		Directory:  dir,
+		Uids:       uids,
+		MessageIds: w.offline.MessageIds(uids),
+		Flags:      flag,
+		Enable:     enable,
+	})
+	if err != nil {
+		return err
+	}
+	for _, uid := range uids {
+		flags := w.offline.Flags(uid)
+		if enable {
+			flags.Flags |= flag
+		} else {
+			flags.Flags &^= flag
+		}
+		if err := w.offline.PutFlags(uid, flags); err != nil {
+			return err
+		}
+		w.worker.PostMessage(&types.MessageInfo{
+			Message: types.RespondTo(msg),
+			Info: &models.MessageInfo{
+				Flags:     flags.Flags,
+				Labels:    flags.Labels,
+				Directory: dir,
+				Uid:       uid,
+			},
+			ReplaceFlags: true,
+		}, nil)
+	}
+	return nil
+}
+
+// replayOffline performs the operations queued while disconnected, in
+// order. The operations which fail are dropped, unless the connection was
+// lost again.
+func (w *IMAPWorker) replayOffline() {
+	if w.offline == nil {
+		return
+	}
+	// the folder opened while disconnected is not selected on the server
+	w.selected = &imap.MailboxStatus{}
+	keys := w.offline.Queue()
+	if len(keys) == 0 {
+		return
+	}
+	w.worker.Infof("offline: replaying %d operations", len(keys))
+	drain := w.drainUpdates()
+	defer drain.Close()
+	var dropped []string
+	defer func() {
+		// the user must know that some offline changes were lost
+		if len(dropped) > 0 {
+			w.worker.PostMessage(&types.Error{
+				Error: fmt.Errorf("offline changes not applied: %s",
+					strings.Join(dropped, "; ")),
+			}, nil)
+		}
+	}()
+	for _, key := range keys {
+		var op offlineOp
+		if w.offline.get(key, &op) {
+			if err := w.replayOp(&op); err != nil {
+				if w.client.State() == imap.LogoutState {
+					w.worker.Errorf("offline: connection lost during replay: %v", err)
+					return
+				}
+				w.worker.Warnf("offline: dropping %s operation in %s: %v",
+					op.Kind, op.Directory+op.Destination, err)
+				dropped = append(dropped, fmt.Sprintf("%s in %s: %v",
+					op.Kind, op.Directory+op.Destination, err))
+			}
+		}
+		if err := w.offline.Dequeue(key); err != nil {
+			w.worker.Errorf("offline: %v", err)
+		}
+	}
+}
+
+func (w *IMAPWorker) replayOp(op *offlineOp) error {
+	if op.Kind == "append" {
+		return w.client.Append(op.Destination, translateFlags(op.Flags),
+			op.Date, &appendLiteral{
+				Reader: bytes.NewReader(op.Data),
+				Length: len(op.Data),
+			})
+	}
+	if err := w.ensureSelected(op.Directory); err != nil {
+		return err
+	}
+	set, err := w.offlineSeqSet(op)
+	if err != nil || set.Empty() {
+		return err
+	}
+	switch op.Kind {
+	case "flag", "answer":
+		item := imap.FormatFlagsOp(imap.RemoveFlags, true)
+		if op.Enable {
+			item = imap.FormatFlagsOp(imap.AddFlags, true)
+		}
+		return w.client.UidStore(set, item, []any{flagToImap[op.Flags]}, nil)
+	case "delete":
+		item := imap.FormatFlagsOp(imap.AddFlags, true)
+		err := w.client.UidStore(set, item, []any{imap.DeletedFlag}, nil)
+		if err != nil {
+			return err
+		}
+		return w.client.Expunge(nil)
+	case "move":
+		if ok, _ := w.client.Support("MOVE"); ok {
+			return w.client.UidMove(set, op.Destination)
+		}
+		if err := w.client.UidCopy(set, op.Destination); err != nil {
+			return err
+		}
+		item := imap.FormatFlagsOp(imap.AddFlags, true)
+		err := w.client.UidStore(set, item, []any{imap.DeletedFlag}, nil)
+		if err != nil {
+			return err
+		}
+		return w.client.Expunge(nil)
+	case "copy":
+		return w.client.UidCopy(set, op.Destination)
+	}
+	return fmt.Errorf("unknown operation %q", op.Kind)
+}
+
+// offlineSeqSet returns the server UIDs of the messages of an operation.
+// When the UIDVALIDITY of the folder has changed, the messages are looked up
+// by their Message-Id.
+func (w *IMAPWorker) offlineSeqSet(op *offlineOp) (*imap.SeqSet, error) {
+	validity := fmt.Sprintf(":%d:", w.selected.UidValidity)
+	set := new(imap.SeqSet)
+	for i, uid := range op.Uids {
+		if strings.HasPrefix(string(uid), op.Directory+validity) {
+			set.AddNum(w.UidToUint32(uid))
+			continue
+		}
+		if i >= len(op.MessageIds) || op.MessageIds[i] == "" {
+			w.worker.Warnf("offline: cannot find message %s", uid)
+			continue
+		}
+		criteria := imap.NewSearchCriteria()
+		criteria.Header.Add("Message-Id", op.MessageIds[i])
+		found, err := w.client.UidSearch(criteria)
+		if err != nil {
+			return nil, err
+		}
+		set.AddNum(found...)
+	}
+	return set, nil
+}
@@ -0,0 +1,83 @@
+package imap
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"git.sr.ht/~rjarry/aerc/models"
+)
+
+func TestOfflineStore(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openOfflineStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := formatUid("INBOX", 1, 1)
+	b := formatUid("INBOX", 1, 2)
+	c := formatUid("INBOX", 1, 3)
+
+	if err := s.SetUids("INBOX", []models.UID{c, a, b}); err != nil {
+		t.Fatal(err)
+	}
+	for i, uid := range []models.UID{a, b, c} {
+		body := fmt.Sprintf("Message-Id: <%d@example.org>\r\n\r\nhello\r\n", i)
+		if err := s.PutBody(uid, []byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.PutFlags(b, offlineFlags{Flags: models.SeenFlag}); err != nil {
+		t.Fatal(err)
+	}
+	if uids := s.Uids("INBOX"); !slices.Equal(uids, []models.UID{a, b, c}) {
+		t.Errorf("unexpected uids %v", uids)
+	}
+	ids := s.MessageIds([]models.UID{b, "unknown"})
+	if !slices.Equal(ids, []string{"1@example.org", ""}) {
+		t.Errorf("unexpected message ids %v", ids)
+	}
+
+	if err := s.RemoveUids("INBOX", []models.UID{b}); err != nil {
+		t.Fatal(err)
+	}
+	if uids := s.Uids("INBOX"); !slices.Equal(uids, []models.UID{a, c}) {
+		t.Errorf("unexpected uids %v", uids)
+	}
+	if s.HasBody(b) || s.Flags(b).Flags != 0 {
+		t.Error("removed message still stored")
+	}
+
+	for _, kind := range []string{"flag", "move"} {
+		if err := s.Enqueue(&offlineOp{Kind: kind, Directory: "INBOX"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the sequence must continue after reopening the store
+	s.db.Close()
+	s, err = openOfflineStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.db.Close()
+	if err := s.Enqueue(&offlineOp{Kind: "delete", Directory: "INBOX"}); err != nil {
+		t.Fatal(err)
+	}
+	var kinds []string
+	for _, key := range s.Queue() {
+		var op offlineOp
+		if !s.get(key, &op) {
+			t.Fatalf("cannot decode %s", key)
+		}
+		kinds = append(kinds, op.Kind)
+		if err := s.Dequeue(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !slices.Equal(kinds, []string{"flag", "move", "delete"}) {
+		t.Errorf("unexpected queue %v", kinds)
+	}
+	if len(s.Queue()) != 0 {
+		t.Error("queue not empty")
+	}
+}
@@ -11,7 +11,7 @@ import (
 func (imapw *IMAPWorker) handleOpenDirectory(msg *types.OpenDirectory) error {
 	imapw.worker.Debugf("Opening %s", msg.Directory)
 
-	sel, err := imapw.client.Select(msg.Directory, false)
+	sel, err := imapw.selectMailbox(msg.Directory)
 	if err != nil {
 		return err
 	}
@@ -46,11 +46,17 @@ func (imapw *IMAPWorker) handleFetchDirectoryContents(
 
 	var err error
 	var uids []uint32
+	known := false
+	if msg.Filter == nil && !hasSortCriteria {
+		uids, known = imapw.takeUids()
+	}
 
 	// If the server supports the SORT extension, do the sorting server side
 	switch {
+	case known:
+		imapw.worker.Tracef("UID list resynchronized with CONDSTORE")
 	case imapw.caps.Sort && hasSortCriteria:
-		uids, err = imapw.client.sort.UidSort(sortCriteria, searchCriteria)
+		uids, err = imapw.client.UidSort(sortCriteria, searchCriteria)
 		if err != nil {
 			return err
 		}
@@ -74,6 +80,8 @@ func (imapw *IMAPWorker) handleFetchDirectoryContents(
 	if msg.Filter == nil {
 		// Only initialize if we are not filtering
 		imapw.seqMap.Initialize(uids)
+		imapw.queueOfflineSync(uids)
+		imapw.queueIndex(uids)
 	}
 
 	imapw.worker.PostMessage(&types.DirectoryContents{
@@ -122,7 +130,7 @@ func (imapw *IMAPWorker) handleDirectoryThreaded(
 	imapw.worker.Tracef("Fetching threaded UID list")
 
 	searchCriteria := translateSearch(msg.Filter)
-	threads, err := imapw.client.thread.UidThread(imapw.threadAlgorithm,
+	threads, err := imapw.client.UidThread(imapw.threadAlgorithm,
 		searchCriteria)
 	if err != nil {
 		return err
@@ -140,6 +148,8 @@ func (imapw *IMAPWorker) handleDirectoryThreaded(
 			})
 		}
 		imapw.seqMap.Initialize(uids)
+		imapw.queueOfflineSync(uids)
+		imapw.queueIndex(uids)
 	}
 	if msg.Context().Err() != nil {
 		return msg.Context().Err()
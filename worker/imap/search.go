@@ -2,10 +2,13 @@ package imap
 
 import (
 	"maps"
+	"slices"
 	"strings"
 
 	"github.com/emersion/go-imap"
 
+	"git.sr.ht/~rjarry/aerc/lib/log"
+	"git.sr.ht/~rjarry/aerc/models"
 	"git.sr.ht/~rjarry/aerc/worker/types"
 	"git.sr.ht/~rjarry/go-opt/v2"
 )
@@ -47,5 +50,209 @@ func translateSearch(c *types.SearchCriteria) *imap.SearchCriteria {
 			}
 		}
 	}
+	if c.Query != nil {
+		mergeSearch(criteria, translateQuery(c.Query))
+	}
 	return criteria
 }
+
+func translateQuery(q *types.Query) *imap.SearchCriteria {
+	criteria := imap.NewSearchCriteria()
+	switch q.Op {
+	case types.QueryAnd:
+		for _, o := range q.Operands {
+			mergeSearch(criteria, translateQuery(o))
+		}
+	case types.QueryOr:
+		if len(q.Operands) == 1 {
+			return translateQuery(q.Operands[0])
+		}
+		// IMAP OR only takes two keys
+		rest := &types.Query{Op: types.QueryOr, Operands: q.Operands[1:]}
+		criteria.Or = append(criteria.Or, [2]*imap.SearchCriteria{
+			translateQuery(q.Operands[0]), translateQuery(rest),
+		})
+	case types.QueryNot:
+		criteria.Not = append(criteria.Not, translateQuery(q.Operands[0]))
+	case types.QueryFrom:
+		criteria.Header.Add("From", q.Value)
+	case types.QueryTo:
+		criteria.Header.Add("To", q.Value)
+	case types.QueryCc:
+		criteria.Header.Add("Cc", q.Value)
+	case types.QuerySubject:
+		criteria.Header.Add("Subject", q.Value)
+	case types.QueryHeader:
+		criteria.Header.Add(q.Header, q.Value)
+	case types.QueryBody:
+		criteria.Body = append(criteria.Body, q.Value)
+	case types.QueryText:
+		criteria.Text = append(criteria.Text, q.Value)
+	case types.QueryFlag:
+		criteria.WithFlags = translateFlags(q.Flag)
+	case types.QueryDate:
+		criteria.SentSince = q.Start
+		criteria.SentBefore = q.End
+	}
+	return criteria
+}
+
+// mergeSearch adds the keys of src to dst. All keys of an IMAP search must
+// match.
+func mergeSearch(dst, src *imap.SearchCriteria) {
+	for k, values := range src.Header {
+		for _, v := range values {
+			dst.Header.Add(k, v)
+		}
+	}
+	dst.Body = append(dst.Body, src.Body...)
+	dst.Text = append(dst.Text, src.Text...)
+	dst.WithFlags = append(dst.WithFlags, src.WithFlags...)
+	dst.WithoutFlags = append(dst.WithoutFlags, src.WithoutFlags...)
+	dst.Not = append(dst.Not, src.Not...)
+	dst.Or = append(dst.Or, src.Or...)
+	if src.SentSince.After(dst.SentSince) {
+		dst.SentSince = src.SentSince
+	}
+	if !src.SentBefore.IsZero() &&
+		(dst.SentBefore.IsZero() || src.SentBefore.Before(dst.SentBefore)) {
+		dst.SentBefore = src.SentBefore
+	}
+}
+
+// Maximum number of messages downloaded to update the search index before
+// answering a search from it. When more messages are missing, the search is
+// performed by the server.
+const maxIndexFetch = 200
+
+// searchIndex answers a body or full text search from the local search index.
+// The other criteria are evaluated by the server. It returns false if too
+// many messages have not been indexed yet.
+func (imapw *IMAPWorker) searchIndex(msg *types.SearchDirectory) ([]models.UID, bool) {
+	c := *msg.Criteria
+	c.Terms = nil
+	c.SearchBody = false
+	c.SearchAll = false
+	uids, err := imapw.client.UidSearch(translateSearch(&c))
+	if err != nil {
+		imapw.worker.Errorf("search failed: %v", err)
+		return nil, false
+	}
+	candidates := imapw.Uint32ToUidList(uids)
+	missing := imapw.index.Missing(msg.Directory, candidates)
+	if len(missing) > maxIndexFetch {
+		imapw.worker.Debugf("search index: %d/%d messages not indexed",
+			len(missing), len(candidates))
+		return nil, false
+	}
+	if len(missing) > 0 {
+		if err := imapw.indexMissing(msg.Directory, missing); err != nil {
+			imapw.worker.Errorf("search index: %v", err)
+			return nil, false
+		}
+	}
+	found, err := imapw.index.Search(msg.Directory, msg.Criteria)
+	if err != nil {
+		imapw.worker.Errorf("search index: %v", err)
+		return nil, false
+	}
+	set := make(map[models.UID]bool, len(found))
+	for _, uid := range found {
+		set[uid] = true
+	}
+	var results []models.UID
+	for _, uid := range candidates {
+		if set[uid] {
+			results = append(results, uid)
+		}
+	}
+	return results, true
+}
+
+// indexMissing downloads messages and adds them to the search index.
+func (imapw *IMAPWorker) indexMissing(dir string, uids []models.UID) error {
+	imapw.worker.Debugf("indexing %d messages", len(uids))
+	section := &imap.BodySectionName{Peek: true}
+	items := []imap.FetchItem{imap.FetchUid, section.FetchItem()}
+	messages := make(chan *imap.Message)
+	done := make(chan error, 1)
+	go func() {
+		defer log.PanicHandler()
+		done <- imapw.client.UidFetch(imapw.UidListToSeqSet(uids), items, messages)
+	}()
+	for m := range messages {
+		r := m.GetBody(section)
+		if r == nil {
+			continue
+		}
+		uid := imapw.Uint32ToUid(m.Uid)
+		if err := imapw.index.Add(dir, uid, r); err != nil {
+			imapw.worker.Errorf("cannot index message %s: %v", uid, err)
+		}
+	}
+	return <-done
+}
+
+// queueIndex schedules the indexing of the messages which arrived in the
+// selected folder since it was last listed. The messages present when the
+// folder is listed for the first time are only indexed before searching.
+func (imapw *IMAPWorker) queueIndex(uids []uint32) {
+	if imapw.index == nil {
+		return
+	}
+	dir := imapw.selected.Name
+	last, listed := imapw.indexLast[dir]
+	var arrived []uint32
+	for _, uid := range uids {
+		if uid > last {
+			arrived = append(arrived, uid)
+		}
+	}
+	if len(arrived) == 0 {
+		return
+	}
+	imapw.indexLast[dir] = slices.Max(arrived)
+	if !listed {
+		return
+	}
+	if imapw.indexDir != dir {
+		imapw.indexDir = dir
+		imapw.indexNew = nil
+	}
+	imapw.indexNew = append(imapw.indexNew, arrived...)
+	select {
+	case imapw.indexNext <- struct{}{}:
+	default:
+	}
+}
+
+// indexArrived adds the messages queued by queueIndex to the search index.
+// It runs between actions like the offline synchronization.
+func (imapw *IMAPWorker) indexArrived() {
+	uids := imapw.Uint32ToUidList(imapw.indexNew)
+	imapw.indexNew = nil
+	if imapw.client == nil || imapw.indexDir != imapw.selected.Name {
+		return
+	}
+	missing := imapw.index.Missing(imapw.indexDir, uids)
+	if len(missing) == 0 {
+		return
+	}
+	drain := imapw.drainUpdates()
+	defer drain.Close()
+	if err := imapw.indexMissing(imapw.indexDir, missing); err != nil {
+		imapw.worker.Errorf("search index: %v", err)
+	}
+}
+
+// unindex removes deleted or moved messages from the search index.
+func (imapw *IMAPWorker) unindex(dir string, uids []models.UID) {
+	if imapw.index == nil {
+		return
+	}
+	for _, uid := range uids {
+		if err := imapw.index.Remove(dir, uid); err != nil {
+			imapw.worker.Errorf("cannot remove message %s from index: %v", uid, err)
+		}
+	}
+}
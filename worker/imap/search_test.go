@@ -1,9 +1,14 @@
 package imap
 
 import (
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/emersion/go-imap"
+
+	"git.sr.ht/~rjarry/aerc/models"
+	"git.sr.ht/~rjarry/aerc/worker/lib"
 	"git.sr.ht/~rjarry/aerc/worker/types"
 )
 
@@ -43,3 +48,107 @@ func Test_translateSearch_ByDate(t *testing.T) {
 		}
 	}
 }
+
+func Test_translateSearch_Query(t *testing.T) {
+	q, err := types.ParseQuery(
+		"(from:alice or from:bob or from:carol) and not flag:seen body:hello",
+		types.QuerySubject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc := translateSearch(&types.SearchCriteria{
+		To:    []string{"me"},
+		Query: q,
+	})
+	if sc.Header.Get("To") != "me" {
+		t.Errorf("expected To header, got %v", sc.Header)
+	}
+	if len(sc.Body) != 1 || sc.Body[0] != "hello" {
+		t.Errorf("expected body key, got %v", sc.Body)
+	}
+	if len(sc.Not) != 1 || len(sc.Not[0].WithFlags) != 1 ||
+		sc.Not[0].WithFlags[0] != imap.SeenFlag {
+		t.Errorf("expected NOT SEEN key, got %v", sc.Not)
+	}
+	if len(sc.Or) != 1 {
+		t.Fatalf("expected one OR key, got %v", sc.Or)
+	}
+	if sc.Or[0][0].Header.Get("From") != "alice" {
+		t.Errorf("unexpected first OR operand %v", sc.Or[0][0])
+	}
+	rest := sc.Or[0][1]
+	if len(rest.Or) != 1 ||
+		rest.Or[0][0].Header.Get("From") != "bob" ||
+		rest.Or[0][1].Header.Get("From") != "carol" {
+		t.Errorf("unexpected second OR operand %v", rest)
+	}
+}
+
+func TestQueueIndex(t *testing.T) {
+	idx, err := lib.OpenSearchIndex(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	imapw := &IMAPWorker{
+		selected:  &imap.MailboxStatus{Name: "INBOX"},
+		index:     idx,
+		indexLast: make(map[string]uint32),
+		indexNext: make(chan struct{}, 1),
+	}
+
+	// the messages listed first are indexed before searching
+	imapw.queueIndex([]uint32{1, 2, 3})
+	if len(imapw.indexNew) != 0 {
+		t.Errorf("unexpected messages to index: %v", imapw.indexNew)
+	}
+	imapw.queueIndex([]uint32{1, 2, 3, 5, 4})
+	if len(imapw.indexNew) != 2 || imapw.indexNew[0] != 5 || imapw.indexNew[1] != 4 {
+		t.Errorf("expected to index [5 4], got %v", imapw.indexNew)
+	}
+	if len(imapw.indexNext) != 1 {
+		t.Error("indexing of the arrived messages was not scheduled")
+	}
+	imapw.queueIndex([]uint32{1, 2, 3, 4, 5})
+	if len(imapw.indexNew) != 2 {
+		t.Errorf("messages queued twice: %v", imapw.indexNew)
+	}
+
+	// another folder is listed for the first time
+	imapw.selected = &imap.MailboxStatus{Name: "Archive"}
+	imapw.queueIndex([]uint32{10, 11})
+	if imapw.indexDir != "INBOX" || len(imapw.indexNew) != 2 {
+		t.Errorf("unexpected messages to index in %s: %v",
+			imapw.indexDir, imapw.indexNew)
+	}
+}
+
+func TestUnindex(t *testing.T) {
+	idx, err := lib.OpenSearchIndex(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	imapw := &IMAPWorker{index: idx}
+
+	msg := "Subject: Budget\r\n\r\nQuarterly budget.\r\n"
+	for _, uid := range []models.UID{"1", "2"} {
+		if err := idx.Add("INBOX", uid, strings.NewReader(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	imapw.unindex("INBOX", []models.UID{"1"})
+	if idx.Indexed("INBOX", "1") || !idx.Indexed("INBOX", "2") {
+		t.Error("unexpected indexed messages after removal")
+	}
+	found, err := idx.Search("INBOX", &types.SearchCriteria{
+		Terms:      []string{"budget"},
+		SearchBody: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0] != "2" {
+		t.Errorf("expected only message 2 to match, got %v", found)
+	}
+}
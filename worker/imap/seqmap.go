@@ -102,6 +102,21 @@ func (s *SeqMap) Pop(seqnum uint32) (uint32, bool) {
 	return uid, true
 }
 
+// Remove removes the UIDs for which match returns true and returns them.
+func (s *SeqMap) Remove(match func(uint32) bool) []uint32 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var removed []uint32
+	s.m = slices.DeleteFunc(s.m, func(uid uint32) bool {
+		if match(uid) {
+			removed = append(removed, uid)
+			return true
+		}
+		return false
+	})
+	return removed
+}
+
 // sort sorts the slice in ascending UID order. See:
 // https://datatracker.ietf.org/doc/html/rfc3501#section-2.3.1.2
 func (s *SeqMap) sort() {
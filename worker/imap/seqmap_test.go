@@ -113,4 +113,16 @@ func TestSeqMap(t *testing.T) {
 	assert.Equal(uint32(2390), o3)
 	o4, _ := seqmap.Get(4)
 	assert.Equal(uint32(32000), o4)
+
+	//
+	// Test removing by UID
+	//
+
+	removed := seqmap.Remove(func(uid uint32) bool {
+		return uid == 1982 || uid == 32000 || uid == 5
+	})
+	assert.Equal([]uint32{1982, 32000}, removed)
+	assert.Equal(2, seqmap.Size())
+	o2, _ = seqmap.Get(2)
+	assert.Equal(uint32(2390), o2)
 }
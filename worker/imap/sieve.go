@@ -0,0 +1,152 @@
+package imap
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"git.sr.ht/~rjarry/aerc/lib/auth"
+	"git.sr.ht/~rjarry/aerc/lib/log"
+	"git.sr.ht/~rjarry/aerc/lib/managesieve"
+	"git.sr.ht/~rjarry/aerc/models"
+	"git.sr.ht/~rjarry/aerc/worker/types"
+)
+
+// sieveConnect opens a new ManageSieve session. Unless configured otherwise
+// with the sieve parameter, the server is expected on the same host as the
+// IMAP server and accepts the same credentials.
+func (w *IMAPWorker) sieveConnect() (*managesieve.Client, error) {
+	protocol, mech, err := auth.ParseScheme(w.config.url)
+	if err != nil {
+		return nil, err
+	}
+	host := w.config.url.Hostname()
+	port := managesieve.Port
+	insecure := protocol == "imap+insecure"
+	creds := *w.config.url
+
+	if u := w.config.sieve; u != nil {
+		if u.Hostname() != "" {
+			host = u.Hostname()
+		}
+		if u.Port() != "" {
+			port = u.Port()
+		}
+		insecure = u.Scheme == "sieve+insecure"
+		if u.User != nil {
+			creds.User = u.User
+		}
+	}
+	if mech == "" || mech == "login" {
+		// LOGIN is not supported by ManageSieve
+		mech = "plain"
+	}
+
+	conn, err := newTCPConn(net.JoinHostPort(host, port), w.config.connection_timeout)
+	if err != nil {
+		return nil, err
+	}
+	c, err := managesieve.NewClient(conn)
+	if err != nil {
+		return nil, err
+	}
+	if !insecure {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	saslClient, err := auth.NewSaslClient(mech, &creds, w.config.name)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	if !c.SupportsAuth(mech) {
+		c.Close()
+		return nil, fmt.Errorf("sieve: %s auth not supported", mech)
+	}
+	if err := c.Authenticate(saslClient); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("sieve: %w", err)
+	}
+	return c, nil
+}
+
+func parseSieveURL(value string) (*url.URL, error) {
+	u, err := url.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "sieve", "sieve+insecure":
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if strings.Trim(u.Path, "/") != "" {
+		return nil, fmt.Errorf("unexpected path %q", u.Path)
+	}
+	return u, nil
+}
+
+// handleSieveMessage runs the ManageSieve session in the background so that
+// a slow or unreachable server does not block the IMAP worker. The Done or
+// Error response is posted once the session is over.
+func (w *IMAPWorker) handleSieveMessage(msg types.WorkerMessage) error {
+	go func() {
+		defer log.PanicHandler()
+		if err := w.sieveSession(msg); err != nil {
+			w.worker.PostMessage(&types.Error{
+				Message: types.RespondTo(msg),
+				Error:   err,
+			}, nil)
+			return
+		}
+		w.worker.PostMessage(&types.Done{
+			Message: types.RespondTo(msg),
+		}, nil)
+	}()
+	return types.ErrNoop
+}
+
+func (w *IMAPWorker) sieveSession(msg types.WorkerMessage) error {
+	c, err := w.sieveConnect()
+	if err != nil {
+		return err
+	}
+	defer c.Logout()
+
+	switch msg := msg.(type) {
+	case *types.ListSieveScripts:
+		scripts, err := c.ListScripts()
+		if err != nil {
+			return err
+		}
+		res := &types.SieveScripts{Message: types.RespondTo(msg)}
+		for _, s := range scripts {
+			res.Scripts = append(res.Scripts, models.SieveScript{
+				Name:   s.Name,
+				Active: s.Active,
+			})
+		}
+		w.worker.PostMessage(res, nil)
+	case *types.GetSieveScript:
+		script, err := c.GetScript(msg.Name)
+		if err != nil {
+			return err
+		}
+		w.worker.PostMessage(&types.SieveScript{
+			Message: types.RespondTo(msg),
+			Name:    msg.Name,
+			Script:  script,
+		}, nil)
+	case *types.PutSieveScript:
+		return c.PutScript(msg.Name, msg.Script)
+	case *types.CheckSieveScript:
+		return c.CheckScript(msg.Script)
+	case *types.ActivateSieveScript:
+		return c.SetActive(msg.Name)
+	}
+	return nil
+}
@@ -17,6 +17,7 @@ import (
 	"git.sr.ht/~rjarry/aerc/worker/handlers"
 	"git.sr.ht/~rjarry/aerc/worker/imap/extensions"
 	"git.sr.ht/~rjarry/aerc/worker/imap/extensions/xgmext"
+	"git.sr.ht/~rjarry/aerc/worker/lib"
 	"git.sr.ht/~rjarry/aerc/worker/types"
 )
 
@@ -45,9 +46,11 @@ const (
 
 type imapClient struct {
 	*client.Client
-	thread     *sortthread.ThreadClient
 	sort       *sortthread.SortClient
 	liststatus *extensions.ListStatusClient
+	condstore  *extensions.CondstoreClient
+	qresync    *extensions.QresyncClient
+	notify     *extensions.NotifyClient
 	xgmext     *xgmext.XGMExtClient
 }
 
@@ -65,9 +68,12 @@ type imapConfig struct {
 	keepalive_interval int
 	cacheEnabled       bool
 	cacheMaxAge        time.Duration
+	searchIndex        bool
 	expungePolicy      int
 	checkMail          time.Duration
 	debugLogPath       string
+	sieve              *url.URL
+	offline            bool
 }
 
 type IMAPWorker struct {
@@ -76,6 +82,7 @@ type IMAPWorker struct {
 	client    *imapClient
 	selected  *imap.MailboxStatus
 	updates   chan client.Update
+	notify    chan *imap.MailboxStatus
 	worker    types.WorkerInteractor
 	seqMap    SeqMap
 	expunger  *ExpungeHandler
@@ -84,11 +91,25 @@ type IMAPWorker struct {
 	idler    *idler
 	observer *observer
 	cache    *leveldb.DB
+	index    *lib.SearchIndex
+	offline  *offlineStore
+	sync     *offlineSync
+	syncNext chan struct{}
+
+	// highest UID listed per folder, to detect the arrival of messages
+	indexLast map[string]uint32
+	// arrived messages of indexDir which are not indexed yet
+	indexDir  string
+	indexNew  []uint32
+	indexNext chan struct{}
 
 	caps *models.Capabilities
 
 	threadAlgorithm sortthread.ThreadAlgorithm
 	liststatus      bool
+	condstore       bool
+	qresync         bool
+	mailbox         *mailboxState
 
 	noCheckMailBefore time.Time
 
@@ -98,12 +119,16 @@ type IMAPWorker struct {
 func NewIMAPWorker(worker *types.Worker) (types.Backend, error) {
 	w := &IMAPWorker{
 		updates:           make(chan client.Update, 50),
+		notify:            make(chan *imap.MailboxStatus, 50),
 		worker:            worker,
 		selected:          &imap.MailboxStatus{},
 		observer:          newObserver(worker),
 		caps:              &models.Capabilities{},
 		noCheckMailBefore: time.Now(),
 		executeIdle:       make(chan struct{}),
+		syncNext:          make(chan struct{}, 1),
+		indexLast:         make(map[string]uint32),
+		indexNext:         make(chan struct{}, 1),
 	}
 	w.idler = newIdler(worker, w.executeIdle)
 	return w, nil
@@ -113,9 +138,11 @@ func (w *IMAPWorker) newClient(c *client.Client) {
 	c.Updates = nil
 	w.client = &imapClient{
 		Client:     c,
-		thread:     sortthread.NewThreadClient(c),
 		sort:       sortthread.NewSortClient(c),
 		liststatus: extensions.NewListStatusClient(c),
+		condstore:  extensions.NewCondstoreClient(c),
+		qresync:    extensions.NewQresyncClient(c),
+		notify:     extensions.NewNotifyClient(c),
 		xgmext:     xgmext.NewXGMExtClient(c),
 	}
 	w.idler.SetClient(w.client)
@@ -141,6 +168,36 @@ func (w *IMAPWorker) newClient(c *client.Client) {
 		w.caps.Extensions = append(w.caps.Extensions, "LIST-STATUS")
 		w.worker.Debugf("Server Capability found: LIST-STATUS")
 	}
+	condstore, err := w.client.condstore.SupportCondstore()
+	if err == nil && condstore {
+		w.condstore = true
+		w.caps.Extensions = append(w.caps.Extensions, "CONDSTORE")
+		w.worker.Debugf("Server Capability found: CONDSTORE")
+	}
+	// the resynchronization state is stored in the header cache
+	w.qresync = false
+	qresync, err := w.client.qresync.SupportQresync()
+	if err == nil && qresync && w.condstore && w.cache != nil {
+		if err := w.client.qresync.Enable(); err != nil {
+			w.worker.Warnf("ENABLE QRESYNC failed: %v", err)
+		} else {
+			w.qresync = true
+			w.caps.Extensions = append(w.caps.Extensions, "QRESYNC")
+			w.worker.Debugf("Server Capability found: QRESYNC")
+		}
+	}
+	w.idler.SetStatusHandler(nil)
+	notify, err := w.client.notify.SupportNotify()
+	idle, _ := w.client.Support("IDLE")
+	if err == nil && notify && idle {
+		if err := w.client.notify.Set(); err != nil {
+			w.worker.Warnf("NOTIFY SET failed: %v", err)
+		} else {
+			w.idler.SetStatusHandler(w.queueNotifyStatus)
+			w.caps.Extensions = append(w.caps.Extensions, "NOTIFY")
+			w.worker.Debugf("Server Capability found: NOTIFY")
+		}
+	}
 	xgmext, err := w.client.Support("X-GM-EXT-1")
 	if err == nil && xgmext {
 		w.caps.Extensions = append(w.caps.Extensions, "X-GM-EXT-1")
@@ -154,16 +211,26 @@ func (w *IMAPWorker) newClient(c *client.Client) {
 
 // ensureSelected ensures that the requested directory is selected. If the
 // directory differs from the currently selected one, a SELECT is performed.
+// The sequence numbers of the updates sent by the server then refer to the
+// messages of that directory.
 func (w *IMAPWorker) ensureSelected(dir string) error {
 	if dir == "" || dir == w.selected.Name {
 		return nil
 	}
 	w.worker.Debugf("Switching from %q to %q", w.selected.Name, dir)
-	sel, err := w.client.Select(dir, false)
+	sel, err := w.selectMailbox(dir)
 	if err != nil {
 		return err
 	}
 	w.selected = sel
+	uids, known := w.knownUids()
+	if !known && sel.Messages > 0 {
+		uids, err = w.client.UidSearch(imap.NewSearchCriteria())
+		if err != nil {
+			return err
+		}
+	}
+	w.seqMap.Initialize(uids)
 	return nil
 }
 
@@ -173,7 +240,15 @@ func (w *IMAPWorker) handleMessage(msg types.WorkerMessage) error {
 		switch msg.(type) {
 		case *types.Connect, *types.Reconnect, *types.Disconnect, *types.Configure:
 			break
+		// ManageSieve uses its own connection
+		case *types.ListSieveScripts, *types.GetSieveScript,
+			*types.PutSieveScript, *types.CheckSieveScript,
+			*types.ActivateSieveScript:
+			break
 		default:
+			if w.offline != nil {
+				return w.handleOfflineMessage(msg)
+			}
 			return errClientNotReady
 		}
 	}
@@ -190,16 +265,23 @@ func (w *IMAPWorker) handleMessage(msg types.WorkerMessage) error {
 
 		c, err := w.connect()
 		if err != nil {
+			if w.offline != nil {
+				return w.goOffline(msg, err)
+			}
 			w.observer.EmitIfNotConnected()
 			return err
 		}
 
 		w.newClient(c)
+		w.replayOffline()
 
 		return nil
 	case *types.Reconnect:
 		c, err := w.connect()
 		if err != nil {
+			if w.offline != nil {
+				return w.goOffline(msg, err)
+			}
 			// Send ConnError to trigger retry from account.go
 			// (consolidates reconnection logic with other backends)
 			w.worker.PostMessage(&types.ConnError{Error: err}, nil)
@@ -207,6 +289,7 @@ func (w *IMAPWorker) handleMessage(msg types.WorkerMessage) error {
 		}
 
 		w.newClient(c)
+		w.replayOffline()
 
 		return nil
 	case *types.Disconnect:
@@ -255,6 +338,8 @@ func (w *IMAPWorker) handleMessage(msg types.WorkerMessage) error {
 		return w.handleFlagMessages(msg)
 	case *types.AnsweredMessages:
 		return w.handleAnsweredMessages(msg)
+	case *types.JunkMessages:
+		return w.handleJunkMessages(msg)
 	case *types.CopyMessages:
 		return w.handleCopyMessages(msg)
 	case *types.MoveMessages:
@@ -267,6 +352,10 @@ func (w *IMAPWorker) handleMessage(msg types.WorkerMessage) error {
 		return w.handleCheckMailMessage(msg)
 	case *types.ModifyLabels:
 		return w.handleModifyLabels(msg)
+	case *types.ListSieveScripts, *types.GetSieveScript,
+		*types.PutSieveScript, *types.CheckSieveScript,
+		*types.ActivateSieveScript:
+		return w.handleSieveMessage(msg)
 	}
 
 	return types.ErrUnsupported
@@ -313,6 +402,7 @@ func (w *IMAPWorker) handleImapUpdate(update client.Update) {
 		if int(msg.SeqNum) > w.seqMap.Size() {
 			w.seqMap.Put(msg.Uid)
 		}
+		w.updateKnownFlags(msg)
 		systemFlags, keywordFlags := translateImapFlags(msg.Flags)
 		w.worker.PostMessage(&types.MessageInfo{
 			Info: &models.MessageInfo{
@@ -348,15 +438,46 @@ func (w *IMAPWorker) handleImapUpdate(update client.Update) {
 				w.worker.Errorf("ExpungeUpdate unknown seqnum: %d", update.SeqNum)
 			}
 		}
+		w.forgetState(uid)
 		if uid != 0 {
+			dir := w.client.Mailbox().Name
+			deleted := []models.UID{w.Uint32ToUid(uid)}
+			w.unindex(dir, deleted)
 			w.worker.PostMessage(&types.MessagesDeleted{
-				Directory: w.client.Mailbox().Name,
-				Uids:      []models.UID{w.Uint32ToUid(uid)},
+				Directory: dir,
+				Uids:      deleted,
 			}, nil)
 		}
+	case *client.StatusUpdate:
+		if set, ok := extensions.Vanished(update); ok {
+			w.handleVanished(set)
+		}
 	}
 }
 
+// handleVanished removes the messages of the selected mailbox reported as
+// expunged by a VANISHED response, which replaces EXPUNGE with QRESYNC.
+func (w *IMAPWorker) handleVanished(set *imap.SeqSet) {
+	uids := w.seqMap.Remove(set.Contains)
+	if w.expunger != nil {
+		uids = append(uids, w.expunger.PopUids(set.Contains)...)
+	}
+	if len(uids) == 0 {
+		return
+	}
+	dir := w.client.Mailbox().Name
+	deleted := make([]models.UID, 0, len(uids))
+	for _, uid := range uids {
+		w.forgetState(uid)
+		deleted = append(deleted, w.Uint32ToUid(uid))
+	}
+	w.unindex(dir, deleted)
+	w.worker.PostMessage(&types.MessagesDeleted{
+		Directory: dir,
+		Uids:      deleted,
+	}, nil)
+}
+
 func (w *IMAPWorker) terminate() {
 	if w.observer != nil {
 		w.observer.Stop()
@@ -372,6 +493,7 @@ func (w *IMAPWorker) terminate() {
 
 	w.client = nil
 	w.selected = &imap.MailboxStatus{}
+	w.mailbox = nil
 
 	w.idler.SetClient(nil)
 }
@@ -453,11 +575,30 @@ func (w *IMAPWorker) Run() {
 				}, nil)
 			}
 
+			w.scheduleOfflineSync()
 			w.startIdler()
 
 		case update := <-w.updates:
 			w.handleImapUpdate(update)
 
+		case status := <-w.notify:
+			w.handleNotifyStatus(status)
+
+		case <-w.syncNext:
+			if err := w.stopIdler(); err != nil {
+				break
+			}
+			w.syncOffline()
+			w.scheduleOfflineSync()
+			w.startIdler()
+
+		case <-w.indexNext:
+			if err := w.stopIdler(); err != nil {
+				break
+			}
+			w.indexArrived()
+			w.startIdler()
+
 		case <-w.executeIdle:
 			w.idler.Execute()
 		}
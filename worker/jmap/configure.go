@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"git.sr.ht/~rjarry/aerc/worker/jmap/cache"
+	"git.sr.ht/~rjarry/aerc/worker/middleware"
 	"git.sr.ht/~rjarry/aerc/worker/types"
 )
 
@@ -54,6 +55,12 @@ func (w *JMAPWorker) handleConfigure(msg *types.Configure) error {
 		w.config.serverPing = dur
 	}
 
+	vf, err := middleware.NewVirtualFolders(w.w, msg.Config, true)
+	if err != nil {
+		return err
+	}
+	w.w = vf
+
 	return nil
 }
 
@@ -97,5 +97,58 @@ func (w *JMAPWorker) translateSearch(
 		filter.Conditions = append(filter.Conditions, headers)
 	}
 
+	if criteria.Query != nil {
+		filter.Conditions = append(filter.Conditions,
+			translateQuery(criteria.Query))
+	}
+
+	return filter
+}
+
+func translateQuery(q *types.Query) email.Filter {
+	var op jmap.Operator
+	switch q.Op {
+	case types.QueryAnd:
+		op = jmap.OperatorAND
+	case types.QueryOr:
+		op = jmap.OperatorOR
+	case types.QueryNot:
+		// NOT matches messages matching none of the conditions
+		op = jmap.OperatorNOT
+	case types.QueryFrom:
+		return &email.FilterCondition{From: q.Value}
+	case types.QueryTo:
+		return &email.FilterCondition{To: q.Value}
+	case types.QueryCc:
+		return &email.FilterCondition{Cc: q.Value}
+	case types.QuerySubject:
+		return &email.FilterCondition{Subject: q.Value}
+	case types.QueryBody:
+		return &email.FilterCondition{Body: q.Value}
+	case types.QueryText:
+		return &email.FilterCondition{Text: q.Value}
+	case types.QueryHeader:
+		return &email.FilterCondition{Header: []string{q.Header, q.Value}}
+	case types.QueryFlag:
+		filter := &email.FilterOperator{Operator: jmap.OperatorAND}
+		for kw := range flagsToKeywords(q.Flag) {
+			filter.Conditions = append(filter.Conditions,
+				&email.FilterCondition{HasKeyword: kw})
+		}
+		return filter
+	case types.QueryDate:
+		cond := new(email.FilterCondition)
+		if !q.Start.IsZero() {
+			cond.After = &q.Start
+		}
+		if !q.End.IsZero() {
+			cond.Before = &q.End
+		}
+		return cond
+	}
+	filter := &email.FilterOperator{Operator: op}
+	for _, o := range q.Operands {
+		filter.Conditions = append(filter.Conditions, translateQuery(o))
+	}
 	return filter
 }
@@ -12,12 +12,29 @@ import (
 )
 
 func (w *JMAPWorker) updateFlags(ctx context.Context, uids []models.UID, flags models.Flags, enable bool) error {
+	keywords := make(map[string]bool)
+	for kw := range flagsToKeywords(flags) {
+		keywords[kw] = enable
+	}
+	return w.updateKeywords(ctx, uids, keywords)
+}
+
+func (w *JMAPWorker) handleJunkMessages(msg *types.JunkMessages) error {
+	return w.updateKeywords(msg.Context(), msg.Uids, map[string]bool{
+		"$junk":    msg.Junk,
+		"$notjunk": !msg.Junk,
+	})
+}
+
+// updateKeywords sets the keywords mapped to true and removes those mapped to
+// false.
+func (w *JMAPWorker) updateKeywords(ctx context.Context, uids []models.UID, keywords map[string]bool) error {
 	var req jmap.Request
 	patches := make(map[jmap.ID]jmap.Patch)
 
 	for _, uid := range uids {
 		patch := jmap.Patch{}
-		for kw := range flagsToKeywords(flags) {
+		for kw, enable := range keywords {
 			path := fmt.Sprintf("keywords/%s", kw)
 			if enable {
 				patch[path] = true
@@ -53,12 +70,10 @@ func (w *JMAPWorker) updateFlags(ctx context.Context, uids []models.UID, flags m
 			// We'll get this from the update channel
 			continue
 		}
-		if enable {
-			for kw := range flagsToKeywords(flags) {
+		for kw, enable := range keywords {
+			if enable {
 				m.Keywords[kw] = true
-			}
-		} else {
-			for kw := range flagsToKeywords(flags) {
+			} else {
 				delete(m.Keywords, kw)
 			}
 		}
@@ -82,6 +97,54 @@ func (w *JMAPWorker) updateFlags(ctx context.Context, uids []models.UID, flags m
 	return nil
 }
 
+func (w *JMAPWorker) handleCopyMessages(msg *types.CopyMessages) error {
+	err := w.moveCopy(msg.Context(), msg.Uids, msg.Source, msg.Destination, false)
+	if err != nil {
+		return err
+	}
+	w.w.PostMessage(&types.MessagesCopied{
+		Message:     types.RespondTo(msg),
+		Destination: msg.Destination,
+		Uids:        msg.Uids,
+		// email ids do not depend on the mailbox
+		DestUids: msg.Uids,
+	}, nil)
+	return nil
+}
+
+func (w *JMAPWorker) handleMoveMessages(msg *types.MoveMessages) error {
+	err := w.moveCopy(msg.Context(), msg.Uids, msg.Source, msg.Destination, true)
+	if err != nil {
+		return err
+	}
+	w.w.PostMessage(&types.MessagesMoved{
+		Message:     types.RespondTo(msg),
+		Destination: msg.Destination,
+		Uids:        msg.Uids,
+		DestUids:    msg.Uids,
+	}, nil)
+	return nil
+}
+
+func (w *JMAPWorker) handleDeleteMessages(msg *types.DeleteMessages) error {
+	err := w.moveCopy(msg.Context(), msg.Uids, msg.Directory, "", true)
+	if err != nil {
+		return err
+	}
+	// Deleted messages are moved to the trash. Report it so that the
+	// deletion can be undone.
+	trash, ok := w.mbox2dir[w.roles[mailbox.RoleTrash]]
+	if ok && trash != msg.Directory {
+		w.w.PostMessage(&types.MessagesMoved{
+			Message:     types.RespondTo(msg),
+			Destination: trash,
+			Uids:        msg.Uids,
+			DestUids:    msg.Uids,
+		}, nil)
+	}
+	return nil
+}
+
 func (w *JMAPWorker) moveCopy(ctx context.Context, uids []models.UID, srcDir, destDir string, deleteSrc bool) error {
 	var req jmap.Request
 
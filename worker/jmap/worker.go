@@ -34,7 +34,7 @@ type JMAPWorker struct {
 		allMail    string
 	}
 
-	w      *types.Worker
+	w      types.WorkerInteractor
 	client *jmap.Client
 	cache  *cache.JMAPCache
 	stop   chan struct{}
@@ -140,12 +140,14 @@ func (w *JMAPWorker) handleMessage(msg types.WorkerMessage) error {
 		return w.updateFlags(msg.Context(), msg.Uids, msg.Flags, msg.Enable)
 	case *types.AnsweredMessages:
 		return w.updateFlags(msg.Context(), msg.Uids, models.AnsweredFlag, msg.Answered)
+	case *types.JunkMessages:
+		return w.handleJunkMessages(msg)
 	case *types.DeleteMessages:
-		return w.moveCopy(msg.Context(), msg.Uids, msg.Directory, "", true)
+		return w.handleDeleteMessages(msg)
 	case *types.CopyMessages:
-		return w.moveCopy(msg.Context(), msg.Uids, msg.Source, msg.Destination, false)
+		return w.handleCopyMessages(msg)
 	case *types.MoveMessages:
-		return w.moveCopy(msg.Context(), msg.Uids, msg.Source, msg.Destination, true)
+		return w.handleMoveMessages(msg)
 	case *types.ModifyLabels:
 		if w.config.useLabels {
 			return w.handleModifyLabels(msg)
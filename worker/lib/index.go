@@ -0,0 +1,255 @@
+package lib
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"strings"
+	"unicode"
+
+	"git.sr.ht/~rjarry/aerc/lib/rfc822"
+	"git.sr.ht/~rjarry/aerc/models"
+	"git.sr.ht/~rjarry/aerc/worker/types"
+	"git.sr.ht/~rjarry/go-opt/v2"
+	"github.com/emersion/go-message"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// indexTag should be updated when changing the index structure or the way
+// words are extracted from messages. The index is cleared when it changes.
+var (
+	indexTag    = []byte("0001")
+	indexTagKey = []byte("index.tag")
+)
+
+const (
+	// Words shorter or longer than these are not indexed.
+	minWordLen = 2
+	maxWordLen = 64
+	// Maximum amount of text indexed per message.
+	maxIndexedText = 1 << 20
+)
+
+// Kind of indexed words
+const (
+	bodyWord   = 'b'
+	headerWord = 'h'
+)
+
+// SearchIndex is an on-disk inverted index of the words contained in the
+// messages of an account. It allows answering body and full text searches
+// without reading all the messages of a folder.
+//
+// A word of a search term matches indexed words starting with it. Search
+// results may thus differ from a plain text search on words which are only
+// matched in the middle.
+type SearchIndex struct {
+	db *leveldb.DB
+}
+
+// OpenSearchIndex opens or creates the index stored in the path directory.
+func OpenSearchIndex(path string) (*SearchIndex, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	idx := &SearchIndex{db: db}
+	tag, err := db.Get(indexTagKey, nil)
+	if err != nil || !bytes.Equal(tag, indexTag) {
+		iter := db.NewIterator(nil, nil)
+		batch := new(leveldb.Batch)
+		for iter.Next() {
+			batch.Delete(iter.Key())
+		}
+		iter.Release()
+		batch.Put(indexTagKey, indexTag)
+		if err := db.Write(batch, nil); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return idx, nil
+}
+
+func (idx *SearchIndex) Close() error {
+	return idx.db.Close()
+}
+
+// doc.<folder>\x00<uid> => words of the message
+func docKey(folder string, uid models.UID) []byte {
+	return []byte("doc." + folder + "\x00" + string(uid))
+}
+
+// word.<folder>\x00<kind><word>\x00<uid> => nothing
+func wordPrefix(folder string, kind byte, word string) []byte {
+	return []byte("word." + folder + "\x00" + string(kind) + word)
+}
+
+func wordKey(folder string, entry string, uid models.UID) []byte {
+	return []byte("word." + folder + "\x00" + entry + "\x00" + string(uid))
+}
+
+// Indexed returns true if the message has been added to the index.
+func (idx *SearchIndex) Indexed(folder string, uid models.UID) bool {
+	ok, err := idx.db.Has(docKey(folder, uid), nil)
+	return err == nil && ok
+}
+
+// Missing returns the messages which have not been added to the index.
+func (idx *SearchIndex) Missing(folder string, uids []models.UID) []models.UID {
+	var missing []models.UID
+	for _, uid := range uids {
+		if !idx.Indexed(folder, uid) {
+			missing = append(missing, uid)
+		}
+	}
+	return missing
+}
+
+// Add indexes the words of the headers and of the text parts of a raw RFC
+// 822 message. Any previously indexed content for the same message is
+// replaced.
+func (idx *SearchIndex) Add(folder string, uid models.UID, r io.Reader) error {
+	msg, err := rfc822.ReadMessage(r)
+	if err != nil && msg == nil {
+		return err
+	}
+	words := make(map[string]struct{})
+	add := func(kind byte, text string) {
+		for _, w := range indexWords(text) {
+			words[string(kind)+w] = struct{}{}
+		}
+	}
+	dec := new(mime.WordDecoder)
+	fields := msg.Header.Fields()
+	for fields.Next() {
+		value, err := dec.DecodeHeader(fields.Value())
+		if err != nil {
+			value = fields.Value()
+		}
+		add(headerWord, value)
+	}
+	var size int
+	_ = msg.Walk(func(_ []int, e *message.Entity, err error) error {
+		if err != nil || size >= maxIndexedText {
+			return nil
+		}
+		mimeType, _, _ := e.Header.ContentType()
+		disposition, _, _ := e.Header.ContentDisposition()
+		if !strings.HasPrefix(mimeType, "text/") || disposition == "attachment" {
+			return nil
+		}
+		text, err := io.ReadAll(io.LimitReader(e.Body, int64(maxIndexedText-size)))
+		if err != nil {
+			return nil
+		}
+		size += len(text)
+		add(bodyWord, string(text))
+		return nil
+	})
+
+	batch := new(leveldb.Batch)
+	idx.removeBatch(batch, folder, uid)
+	entries := make([]string, 0, len(words))
+	for w := range words {
+		entries = append(entries, w)
+		batch.Put(wordKey(folder, w, uid), nil)
+	}
+	batch.Put(docKey(folder, uid), []byte(strings.Join(entries, "\n")))
+	return idx.db.Write(batch, nil)
+}
+
+// Remove deletes a message from the index.
+func (idx *SearchIndex) Remove(folder string, uid models.UID) error {
+	batch := new(leveldb.Batch)
+	idx.removeBatch(batch, folder, uid)
+	return idx.db.Write(batch, nil)
+}
+
+func (idx *SearchIndex) removeBatch(batch *leveldb.Batch, folder string, uid models.UID) {
+	doc, err := idx.db.Get(docKey(folder, uid), nil)
+	if err != nil {
+		return
+	}
+	for _, w := range strings.Split(string(doc), "\n") {
+		if w != "" {
+			batch.Delete(wordKey(folder, w, uid))
+		}
+	}
+	batch.Delete(docKey(folder, uid))
+}
+
+// CanSearch returns true if the index can be used to select the messages
+// containing the search terms of the criteria.
+func CanSearch(criteria *types.SearchCriteria) bool {
+	if criteria == nil || criteria.UseExtension ||
+		(!criteria.SearchBody && !criteria.SearchAll) {
+		return false
+	}
+	return len(searchWords(criteria)) > 0
+}
+
+// Search returns the messages of folder containing all the search terms of
+// the criteria. Other criteria are ignored.
+func (idx *SearchIndex) Search(
+	folder string, criteria *types.SearchCriteria,
+) ([]models.UID, error) {
+	kinds := []byte{bodyWord}
+	if criteria.SearchAll {
+		kinds = append(kinds, headerWord)
+	}
+	var result map[models.UID]struct{}
+	for _, word := range searchWords(criteria) {
+		matches := make(map[models.UID]struct{})
+		for _, kind := range kinds {
+			prefix := wordPrefix(folder, kind, word)
+			iter := idx.db.NewIterator(util.BytesPrefix(prefix), nil)
+			for iter.Next() {
+				key := iter.Key()
+				i := bytes.LastIndexByte(key, 0)
+				uid := models.UID(key[i+1:])
+				if result == nil {
+					matches[uid] = struct{}{}
+				} else if _, ok := result[uid]; ok {
+					matches[uid] = struct{}{}
+				}
+			}
+			iter.Release()
+			if err := iter.Error(); err != nil {
+				return nil, err
+			}
+		}
+		result = matches
+		if len(result) == 0 {
+			break
+		}
+	}
+	uids := make([]models.UID, 0, len(result))
+	for uid := range result {
+		uids = append(uids, uid)
+	}
+	return uids, nil
+}
+
+func searchWords(criteria *types.SearchCriteria) []string {
+	var words []string
+	args := opt.LexArgs(strings.Join(criteria.Terms, " "))
+	for _, term := range args.Args() {
+		words = append(words, indexWords(term)...)
+	}
+	return words
+}
+
+// indexWords splits text into lower case words made of letters and digits.
+func indexWords(text string) []string {
+	var words []string
+	for _, w := range strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len(w) >= minWordLen && len(w) <= maxWordLen {
+			words = append(words, strings.ToLower(w))
+		}
+	}
+	return words
+}
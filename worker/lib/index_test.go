@@ -0,0 +1,101 @@
+package lib
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~rjarry/aerc/models"
+	"git.sr.ht/~rjarry/aerc/worker/types"
+)
+
+func TestSearchIndex(t *testing.T) {
+	idx, err := OpenSearchIndex(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	messages := map[models.UID]string{
+		"1": "Subject: Meeting\r\nFrom: alice@example.com\r\n\r\n" +
+			"Let's discuss the quarterly budget tomorrow.\r\n",
+		"2": "Subject: Lunch\r\nFrom: bob@example.com\r\n" +
+			"Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+			"--b\r\nContent-Type: text/plain\r\n\r\nBudget for lunch?\r\n" +
+			"--b\r\nContent-Type: text/plain\r\n" +
+			"Content-Disposition: attachment; filename=a.txt\r\n\r\n" +
+			"secret attachment\r\n--b--\r\n",
+		"3": "Subject: =?utf-8?q?Caf=C3=A9?=\r\nFrom: carol@example.com\r\n\r\n" +
+			"Nothing to see here.\r\n",
+	}
+	for uid, msg := range messages {
+		if err := idx.Add("INBOX", uid, strings.NewReader(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !idx.Indexed("INBOX", "1") || idx.Indexed("Archive", "1") {
+		t.Fatal("unexpected indexed state")
+	}
+	missing := idx.Missing("INBOX", []models.UID{"1", "2", "3", "4"})
+	if len(missing) != 1 || missing[0] != "4" {
+		t.Errorf("unexpected missing messages: %v", missing)
+	}
+
+	search := func(body bool, terms ...string) string {
+		uids, err := idx.Search("INBOX", &types.SearchCriteria{
+			SearchBody: body,
+			SearchAll:  !body,
+			Terms:      terms,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+		var s []string
+		for _, uid := range uids {
+			s = append(s, string(uid))
+		}
+		return strings.Join(s, ",")
+	}
+	tests := []struct {
+		body   bool
+		terms  []string
+		expect string
+	}{
+		{true, []string{"budget"}, "1,2"},
+		{true, []string{"BUDG"}, "1,2"},
+		{true, []string{"budget lunch"}, "2"},
+		{true, []string{"budget", "tomorrow"}, "1"},
+		{true, []string{"secret"}, ""},
+		{true, []string{"meeting"}, ""},
+		{false, []string{"meeting"}, "1"},
+		{false, []string{"café"}, "3"},
+		{false, []string{"example.com"}, "1,2,3"},
+	}
+	for _, test := range tests {
+		if res := search(test.body, test.terms...); res != test.expect {
+			t.Errorf("%v: expected %q, got %q", test.terms, test.expect, res)
+		}
+	}
+
+	// replace and remove
+	err = idx.Add("INBOX", "1", strings.NewReader("Subject: x\r\n\r\nlunch\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := search(true, "budget"); res != "2" {
+		t.Errorf("expected 2 after update, got %q", res)
+	}
+	if err := idx.Remove("INBOX", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if res := search(true, "lunch"); res != "1" {
+		t.Errorf("expected 1 after removal, got %q", res)
+	}
+	if !CanSearch(&types.SearchCriteria{SearchBody: true, Terms: []string{"ab cd"}}) {
+		t.Error("expected body search to use the index")
+	}
+	if CanSearch(&types.SearchCriteria{Terms: []string{"lunch"}}) {
+		t.Error("expected subject search to not use the index")
+	}
+}
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"fmt"
 	"io"
 	"strings"
 	"unicode"
@@ -59,36 +60,15 @@ func SearchMessage(message rfc822.RawMessage, criteria *types.SearchCriteria,
 	}
 	switch {
 	case parts&BODY > 0:
-		path := lib.FindFirstNonMultipart(info.BodyStructure, nil)
-		reader, err := message.NewReader()
+		text, err = messageBody(message, info)
 		if err != nil {
 			return false, err
 		}
-		defer reader.Close()
-		msg, err := rfc822.ReadMessage(reader)
-		if err != nil {
-			return false, err
-		}
-		part, err := rfc822.FetchEntityPartReader(msg, path)
-		if err != nil {
-			return false, err
-		}
-		bytes, err := io.ReadAll(part)
-		if err != nil {
-			return false, err
-		}
-		text = string(bytes)
 	case parts&ALL > 0:
-		reader, err := message.NewReader()
+		text, err = messageText(message)
 		if err != nil {
 			return false, err
 		}
-		defer reader.Close()
-		bytes, err := io.ReadAll(reader)
-		if err != nil {
-			return false, err
-		}
-		text = string(bytes)
 	default:
 		text = info.Envelope.Subject
 	}
@@ -138,9 +118,136 @@ func SearchMessage(message rfc822.RawMessage, criteria *types.SearchCriteria,
 			}
 		}
 	}
+	if criteria.Query != nil {
+		m := &queryMessage{raw: message, info: info}
+		if parts&FLAGS > 0 {
+			m.flags = &flags
+		}
+		return m.match(criteria.Query)
+	}
 	return true, nil
 }
 
+// messageBody returns the first non-multipart part of a message.
+func messageBody(message rfc822.RawMessage, info *models.MessageInfo) (string, error) {
+	path := lib.FindFirstNonMultipart(info.BodyStructure, nil)
+	reader, err := message.NewReader()
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	msg, err := rfc822.ReadMessage(reader)
+	if err != nil {
+		return "", err
+	}
+	part, err := rfc822.FetchEntityPartReader(msg, path)
+	if err != nil {
+		return "", err
+	}
+	bytes, err := io.ReadAll(part)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes), nil
+}
+
+// messageText returns the entire raw message.
+func messageText(message rfc822.RawMessage) (string, error) {
+	reader, err := message.NewReader()
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	bytes, err := io.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes), nil
+}
+
+// queryMessage evaluates a types.Query on a message. The flags, body and
+// text of the message are only read when needed.
+type queryMessage struct {
+	raw   rfc822.RawMessage
+	info  *models.MessageInfo
+	flags *models.Flags
+	body  *string
+	text  *string
+}
+
+func (m *queryMessage) match(q *types.Query) (bool, error) {
+	switch q.Op {
+	case types.QueryAnd:
+		for _, o := range q.Operands {
+			if ok, err := m.match(o); err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case types.QueryOr:
+		for _, o := range q.Operands {
+			if ok, err := m.match(o); err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	case types.QueryNot:
+		ok, err := m.match(q.Operands[0])
+		return !ok, err
+	case types.QueryFrom:
+		return containsSmartCase(m.info.RFC822Headers.Get("From"), q.Value), nil
+	case types.QueryTo:
+		return containsSmartCase(m.info.RFC822Headers.Get("To"), q.Value), nil
+	case types.QueryCc:
+		return containsSmartCase(m.info.RFC822Headers.Get("Cc"), q.Value), nil
+	case types.QueryHeader:
+		return containsSmartCase(m.info.RFC822Headers.Get(q.Header), q.Value), nil
+	case types.QuerySubject:
+		return containsSmartCase(m.info.Envelope.Subject, q.Value), nil
+	case types.QueryBody:
+		if m.body == nil {
+			body, err := messageBody(m.raw, m.info)
+			if err != nil {
+				return false, err
+			}
+			m.body = &body
+		}
+		return containsSmartCase(*m.body, q.Value), nil
+	case types.QueryText:
+		if m.text == nil {
+			text, err := messageText(m.raw)
+			if err != nil {
+				return false, err
+			}
+			m.text = &text
+		}
+		return containsSmartCase(*m.text, q.Value), nil
+	case types.QueryFlag:
+		if m.flags == nil {
+			flags, err := m.raw.ModelFlags()
+			if err != nil {
+				return false, err
+			}
+			m.flags = &flags
+		}
+		return m.flags.Has(q.Flag), nil
+	case types.QueryDate:
+		date, err := m.info.RFC822Headers.Date()
+		if err != nil {
+			log.Errorf("Failed to get date from header: %v", err)
+			return false, nil
+		}
+		if !q.Start.IsZero() && date.Before(q.Start) {
+			return false, nil
+		}
+		if !q.End.IsZero() && date.After(q.End) {
+			return false, nil
+		}
+		return true, nil
+	}
+	return false, fmt.Errorf("unsupported query operator %d", q.Op)
+}
+
 // containsSmartCase is a smarter version of strings.Contains for searching.
 // Is case-insensitive unless substr contains an upper case character
 func containsSmartCase(s string, substr string) bool {
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 
 	"github.com/emersion/go-maildir"
 
@@ -32,23 +33,27 @@ func NewContainer(dir string, maildirpp bool) (*Container, error) {
 	}, nil
 }
 
-// SyncNewMail adds emails from new to cur, tracking them
-func (c *Container) SyncNewMail(dir maildir.Dir) error {
+// SyncNewMail adds emails from new to cur, tracking them. It returns the UIDs
+// of the moved emails.
+func (c *Container) SyncNewMail(dir maildir.Dir) ([]models.UID, error) {
 	unseen, err := dir.Unseen()
 	if err != nil {
-		return err
+		return nil, err
 	}
+	uids := make([]models.UID, 0, len(unseen))
 	for _, msg := range unseen {
-		c.recentUIDS[models.UID(msg.Key())] = struct{}{}
+		uid := models.UID(msg.Key())
+		c.recentUIDS[uid] = struct{}{}
+		uids = append(uids, uid)
 	}
-	return nil
+	return uids, nil
 }
 
 // OpenDirectory opens an existing maildir in the container by name, moves new
 // messages into cur, and registers the new keys in the UIDStore.
 func (c *Container) OpenDirectory(name string) (maildir.Dir, error) {
 	dir := c.Store.Dir(name)
-	if err := c.SyncNewMail(dir); err != nil {
+	if _, err := c.SyncNewMail(dir); err != nil {
 		return dir, err
 	}
 	return dir, nil
@@ -115,45 +120,63 @@ func (c *Container) DeleteAll(d maildir.Dir, uids []models.UID) ([]models.UID, e
 
 func (c *Container) CopyAll(
 	dest maildir.Dir, src maildir.Dir, uids []models.UID,
-) error {
+) ([]models.UID, error) {
+	var copies []models.UID
 	for _, uid := range uids {
-		if err := c.copyMessage(dest, src, uid); err != nil {
-			return fmt.Errorf("could not copy message %s: %w", uid, err)
+		key, err := c.copyMessage(dest, src, uid)
+		if err != nil {
+			return copies, fmt.Errorf("could not copy message %s: %w", uid, err)
 		}
+		copies = append(copies, key)
 	}
-	return nil
+	return copies, nil
 }
 
 func (c *Container) copyMessage(
 	dest maildir.Dir, src maildir.Dir, uid models.UID,
-) error {
+) (models.UID, error) {
 	msg, err := src.MessageByKey(string(uid))
 	if err != nil {
-		return fmt.Errorf("failed to retrieve message %q: %w", uid, err)
+		return "", fmt.Errorf("failed to retrieve message %q: %w", uid, err)
 	}
-	_, err = msg.CopyTo(dest)
-	return err
+	copied, err := msg.CopyTo(dest)
+	if err != nil {
+		return "", err
+	}
+	return models.UID(copied.Key()), nil
 }
 
-func (c *Container) MoveAll(dest maildir.Dir, src maildir.Dir, uids []models.UID) ([]models.UID, error) {
-	var success []models.UID
+// MoveAll moves messages from src to dest. It returns the UIDs of the
+// messages that were moved and their new UIDs in dest.
+func (c *Container) MoveAll(
+	dest maildir.Dir, src maildir.Dir, uids []models.UID,
+) ([]models.UID, []models.UID, error) {
+	var success, destUids []models.UID
 	for _, uid := range uids {
-		if err := c.moveMessage(dest, src, uid); err != nil {
-			return success, fmt.Errorf("could not move message %s: %w", uid, err)
+		key, err := c.moveMessage(dest, src, uid)
+		if err != nil {
+			return success, destUids, fmt.Errorf("could not move message %s: %w", uid, err)
 		}
 		success = append(success, uid)
+		destUids = append(destUids, key)
 	}
-	return success, nil
+	return success, destUids, nil
 }
 
-func (c *Container) moveMessage(dest maildir.Dir, src maildir.Dir, uid models.UID) error {
+func (c *Container) moveMessage(
+	dest maildir.Dir, src maildir.Dir, uid models.UID,
+) (models.UID, error) {
 	msg, err := src.MessageByKey(string(uid))
 	if err != nil {
-		return fmt.Errorf("failed to retrieve message %q: %w", uid, err)
+		return "", fmt.Errorf("failed to retrieve message %q: %w", uid, err)
 	}
 	path := msg.Filename()
 	// Remove encoded UID information from the key to prevent sync issues
 	name := lib.StripUIDFromMessageFilename(filepath.Base(path))
 	destPath := filepath.Join(string(dest), "cur", name)
-	return os.Rename(path, destPath)
+	if err := os.Rename(path, destPath); err != nil {
+		return "", err
+	}
+	key, _, _ := strings.Cut(name, ":")
+	return models.UID(key), nil
 }
@@ -24,6 +24,15 @@ func (w *Worker) search(
 	if err != nil {
 		return nil, err
 	}
+	if w.index != nil && lib.CanSearch(criteria) {
+		// only read the messages containing the search terms
+		indexed, err := w.searchIndex(ctx, dir, keys, criteria)
+		if err != nil {
+			w.worker.Errorf("search index: %v", err)
+		} else {
+			keys = indexed
+		}
+	}
 
 	var matchedUids []models.UID
 	mu := sync.Mutex{}
@@ -70,3 +79,92 @@ func (w *Worker) searchKey(
 	}
 	return lib.SearchMessage(message, criteria, parts)
 }
+
+// searchIndex adds the messages missing from the search index and returns
+// the keys of the messages which contain the search terms.
+func (w *Worker) searchIndex(
+	ctx context.Context, dir maildir.Dir, keys []models.UID,
+	criteria *types.SearchCriteria,
+) ([]models.UID, error) {
+	missing := w.index.Missing(string(dir), keys)
+	if len(missing) > 0 {
+		w.worker.Debugf("indexing %d messages", len(missing))
+	}
+	wg := sync.WaitGroup{}
+	limit := make(chan struct{}, runtime.NumCPU()*2)
+	for _, key := range missing {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return nil, context.Canceled
+		case limit <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(key models.UID) {
+			defer log.PanicHandler()
+			defer wg.Done()
+			if err := w.indexKey(dir, key); err != nil {
+				w.worker.Errorf("Failed to index key %s: %v", key, err)
+			}
+			<-limit
+		}(key)
+	}
+	wg.Wait()
+
+	uids, err := w.index.Search(string(dir), criteria)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[models.UID]bool, len(uids))
+	for _, uid := range uids {
+		found[uid] = true
+	}
+	var matched []models.UID
+	for _, key := range keys {
+		if found[key] {
+			matched = append(matched, key)
+		}
+	}
+	return matched, nil
+}
+
+func (w *Worker) indexKey(dir maildir.Dir, key models.UID) error {
+	message, err := w.c.Message(dir, key)
+	if err != nil {
+		return err
+	}
+	r, err := message.NewReader()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return w.index.Add(string(dir), key, r)
+}
+
+// indexNew adds the messages which arrived in dir to the search index in the
+// background.
+func (w *Worker) indexNew(dir maildir.Dir, keys []models.UID) {
+	if w.index == nil || len(keys) == 0 {
+		return
+	}
+	go func() {
+		defer log.PanicHandler()
+		for _, key := range keys {
+			if err := w.indexKey(dir, key); err != nil {
+				w.worker.Errorf("Failed to index key %s: %v", key, err)
+			}
+		}
+	}()
+}
+
+// unindex removes deleted or moved messages from the search index.
+func (w *Worker) unindex(dir maildir.Dir, keys []models.UID) {
+	if w.index == nil {
+		return
+	}
+	for _, key := range keys {
+		if err := w.index.Remove(string(dir), key); err != nil {
+			w.worker.Errorf("Failed to remove key %s from index: %v", key, err)
+		}
+	}
+}
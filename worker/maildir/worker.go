@@ -14,6 +14,7 @@ import (
 	"runtime"
 	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -52,6 +53,7 @@ type Worker struct {
 	capabilities    *models.Capabilities
 	headers         []string
 	headersExclude  []string
+	index           *lib.SearchIndex
 }
 
 // NewWorker creates a new maildir worker with the provided worker.
@@ -156,11 +158,12 @@ func (w *Worker) handleFSEvent() {
 	if w.selected == nil {
 		return
 	}
-	err := w.c.SyncNewMail(*w.selected)
+	uids, err := w.c.SyncNewMail(*w.selected)
 	if err != nil {
 		w.worker.Errorf("could not move new to cur : %v", err)
 		return
 	}
+	w.indexNew(*w.selected, uids)
 
 	w.selectedInfo = w.getDirectoryInfo(w.selectedName)
 	w.worker.PostMessage(&types.DirectoryInfo{
@@ -359,6 +362,20 @@ func (w *Worker) handleConfigure(msg *types.Configure) error {
 	w.headersExclude = msg.Config.HeadersExclude
 	w.worker.Debugf("configured base maildir: %s", dir)
 
+	if value, ok := msg.Config.Params["search-index"]; ok {
+		enable, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid search-index value %v: %w", value, err)
+		}
+		if enable {
+			p := xdg.CachePath("aerc", "index", msg.Config.Name)
+			w.index, err = lib.OpenSearchIndex(p)
+			if err != nil {
+				w.worker.Errorf("failed opening search index at %s: %v", p, err)
+			}
+		}
+	}
+
 	if name, ok := msg.Config.Params["folder-map"]; ok {
 		file := xdg.ExpandHome(name)
 		f, err := os.Open(file)
@@ -373,6 +390,12 @@ func (w *Worker) handleConfigure(msg *types.Configure) error {
 		w.worker = middleware.NewFolderMapper(w.worker, fmap, order)
 	}
 
+	vf, err := middleware.NewVirtualFolders(w.worker, msg.Config, true)
+	if err != nil {
+		return err
+	}
+	w.worker = vf
+
 	return nil
 }
 
@@ -400,10 +423,11 @@ func (w *Worker) handleListDirectories(msg *types.ListDirectories) error {
 			},
 		}, nil)
 
-		err := w.c.SyncNewMail(dir)
+		uids, err := w.c.SyncNewMail(dir)
 		if err != nil {
 			w.err(msg, fmt.Errorf("could not sync new mail: %w", err))
 		}
+		w.indexNew(dir, uids)
 
 		w.worker.PostMessage(&types.DirectoryInfo{
 			Info: w.getDirectoryInfo(name),
@@ -757,6 +781,12 @@ func (w *Worker) handleFetchFullMessages(msg *types.FetchFullMessages) error {
 		if err != nil {
 			return err
 		}
+		if w.index != nil && !w.index.Indexed(string(dir), uid) {
+			err := w.index.Add(string(dir), uid, bytes.NewReader(b))
+			if err != nil {
+				w.worker.Errorf("could not index message %s: %v", uid, err)
+			}
+		}
 		w.worker.PostMessage(&types.FullMessage{
 			Message: types.RespondTo(msg),
 			Content: &models.FullMessage{
@@ -771,6 +801,7 @@ func (w *Worker) handleFetchFullMessages(msg *types.FetchFullMessages) error {
 func (w *Worker) handleDeleteMessages(msg *types.DeleteMessages) error {
 	dir := w.dir(msg.Directory)
 	deleted, err := w.c.DeleteAll(dir, msg.Uids)
+	w.unindex(dir, deleted)
 	if len(deleted) > 0 {
 		w.worker.PostMessage(&types.MessagesDeleted{
 			Message:   types.RespondTo(msg),
@@ -874,7 +905,8 @@ func (w *Worker) handleFlagMessages(msg *types.FlagMessages) error {
 func (w *Worker) handleCopyMessages(msg *types.CopyMessages) error {
 	src := w.dir(msg.Source)
 	dest := w.c.Store.Dir(msg.Destination)
-	err := w.c.CopyAll(dest, src, msg.Uids)
+	copies, err := w.c.CopyAll(dest, src, msg.Uids)
+	w.indexNew(dest, copies)
 	if err != nil {
 		return err
 	}
@@ -882,6 +914,7 @@ func (w *Worker) handleCopyMessages(msg *types.CopyMessages) error {
 		Message:     types.RespondTo(msg),
 		Destination: msg.Destination,
 		Uids:        msg.Uids,
+		DestUids:    copies,
 	}, nil)
 	return nil
 }
@@ -889,11 +922,14 @@ func (w *Worker) handleCopyMessages(msg *types.CopyMessages) error {
 func (w *Worker) handleMoveMessages(msg *types.MoveMessages) error {
 	src := w.dir(msg.Source)
 	dest := w.c.Store.Dir(msg.Destination)
-	moved, err := w.c.MoveAll(dest, src, msg.Uids)
+	moved, destUids, err := w.c.MoveAll(dest, src, msg.Uids)
+	w.unindex(src, moved)
+	w.indexNew(dest, destUids)
 	w.worker.PostMessage(&types.MessagesMoved{
 		Message:     types.RespondTo(msg),
 		Destination: msg.Destination,
 		Uids:        moved,
+		DestUids:    destUids,
 	}, nil)
 	w.worker.PostMessage(&types.MessagesDeleted{
 		Message:   types.RespondTo(msg),
@@ -906,16 +942,21 @@ func (w *Worker) handleMoveMessages(msg *types.MoveMessages) error {
 func (w *Worker) handleAppendMessage(msg *types.AppendMessage) error {
 	// since we are the "master" maildir process, we can modify the maildir directly
 	dest := w.c.Store.Dir(msg.Destination)
-	_, writer, err := dest.Create(lib.ToMaildirFlags(msg.Flags))
+	m, writer, err := dest.Create(lib.ToMaildirFlags(msg.Flags))
 	if err != nil {
 		return fmt.Errorf("could not create message at %s: %w",
 			msg.Destination, err)
 	}
-	defer writer.Close()
 	if _, err := io.Copy(writer, msg.Reader); err != nil {
+		writer.Close()
+		return fmt.Errorf(
+			"could not write message to destination: %w", err)
+	}
+	if err := writer.Close(); err != nil {
 		return fmt.Errorf(
 			"could not write message to destination: %w", err)
 	}
+	w.indexNew(dest, []models.UID{models.UID(m.Key())})
 	w.worker.PostMessage(&types.DirectoryInfo{
 		Info: w.getDirectoryInfo(msg.Destination),
 	}, nil)
@@ -1004,10 +1045,11 @@ func (w *Worker) handleCheckMail(msg *types.CheckMail) {
 				w.err(msg, fmt.Errorf("failed listing directories: %w", err))
 			}
 			for name, dir := range dirs {
-				err := w.c.SyncNewMail(dir)
+				uids, err := w.c.SyncNewMail(dir)
 				if err != nil {
 					w.err(msg, fmt.Errorf("could not sync new mail: %w", err))
 				}
+				w.indexNew(dir, uids)
 				dirInfo := w.getDirectoryInfo(name)
 				w.worker.PostMessage(&types.DirectoryInfo{
 					Info: dirInfo,
@@ -15,6 +15,7 @@ import (
 	"git.sr.ht/~rjarry/aerc/models"
 	"git.sr.ht/~rjarry/aerc/worker/handlers"
 	"git.sr.ht/~rjarry/aerc/worker/lib"
+	"git.sr.ht/~rjarry/aerc/worker/middleware"
 	"git.sr.ht/~rjarry/aerc/worker/types"
 )
 
@@ -26,7 +27,7 @@ type mboxWorker struct {
 	data   *mailboxContainer
 	name   string
 	folder *container
-	worker *types.Worker
+	worker types.WorkerInteractor
 
 	capabilities   *models.Capabilities
 	headers        []string
@@ -108,6 +109,12 @@ func (w *mboxWorker) handleMessage(msg types.WorkerMessage) error {
 		} else {
 			w.worker.Debugf("configured with mbox file %s", dir)
 		}
+		vf, err := middleware.NewVirtualFolders(w.worker, msg.Config, true)
+		if err != nil {
+			reterr = err
+			break
+		}
+		w.worker = vf
 
 	case *types.Connect, *types.Reconnect, *types.Disconnect:
 		// No-op
@@ -118,6 +118,8 @@ func (f *folderMapper) ProcessAction(msg types.WorkerMessage) types.WorkerMessag
 		msg.Directory = f.incoming(msg, msg.Directory)
 	case *types.ForwardedMessages:
 		msg.Directory = f.incoming(msg, msg.Directory)
+	case *types.JunkMessages:
+		msg.Directory = f.incoming(msg, msg.Directory)
 	}
 
 	return f.WorkerInteractor.ProcessAction(msg)
@@ -167,6 +169,8 @@ func (f *folderMapper) PostMessage(msg types.WorkerMessage, cb func(m types.Work
 			msg.Directory = f.outgoing(msg, msg.Directory)
 		case *types.ForwardedMessages:
 			msg.Directory = f.outgoing(msg, msg.Directory)
+		case *types.JunkMessages:
+			msg.Directory = f.outgoing(msg, msg.Directory)
 		}
 	case *types.CheckMailDirectories:
 		for i := range msg.Directories {
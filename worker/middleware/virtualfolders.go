@@ -0,0 +1,581 @@
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"git.sr.ht/~rjarry/aerc/config"
+	"git.sr.ht/~rjarry/aerc/lib/xdg"
+	"git.sr.ht/~rjarry/aerc/models"
+	"git.sr.ht/~rjarry/aerc/worker/lib"
+	"git.sr.ht/~rjarry/aerc/worker/types"
+)
+
+// virtualFolder is a saved search presented as a regular folder.
+type virtualFolder struct {
+	name string
+	// folder in which messages are searched
+	folder   string
+	criteria *types.SearchCriteria
+	// messages last listed in the virtual folder
+	uids map[models.UID]struct{}
+
+	// message counts and pending searches updating them
+	info     models.DirectoryInfo
+	counting int
+	dirty    bool
+	stale    bool
+}
+
+// combine restricts the given criteria to the messages of the virtual
+// folder.
+func (f *virtualFolder) combine(c *types.SearchCriteria) *types.SearchCriteria {
+	if c == nil {
+		return f.criteria
+	}
+	return f.criteria.Combine(c)
+}
+
+// virtualRequest is an action targeting a virtual folder which has been
+// redirected to its base folder.
+type virtualRequest struct {
+	folder *virtualFolder
+	// original criteria of the action
+	criteria *types.SearchCriteria
+}
+
+// virtualCount is a search issued to count the messages of a virtual folder.
+type virtualCount struct {
+	folder *virtualFolder
+	unseen bool
+}
+
+type virtualFolders struct {
+	sync.Mutex
+	types.WorkerInteractor
+	folders  map[string]*virtualFolder
+	order    []string
+	requests map[int64]*virtualRequest
+	counts   map[int64]*virtualCount
+	// the backend can search any folder without opening it
+	searchAny bool
+	// folder open in the backend, as named in the ui and by the backend
+	// which differ when a folder-map is used
+	selected       string
+	selectedSource string
+}
+
+// ids of the actions posted by the middleware itself, negative to avoid
+// clashing with the ids of the ui actions
+var lastVirtualId int64
+
+// NewVirtualFolders loads the virtual folders of an account. The base worker
+// is returned as is when none are configured. searchAny must only be set for
+// backends which search the requested folder without opening it: the counts
+// of the virtual folders are then also kept up to date when their base folder
+// is not the open one.
+func NewVirtualFolders(
+	base types.WorkerInteractor, acct *config.AccountConfig, searchAny bool,
+) (types.WorkerInteractor, error) {
+	if acct.VirtualFolders == "" {
+		return base, nil
+	}
+	f, err := os.Open(xdg.ExpandHome(acct.VirtualFolders))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	queries, order, err := lib.ParseFolderMap(bufio.NewReader(f))
+	if err != nil {
+		return nil, err
+	}
+	base.Infof("loading worker middleware: virtualfolders")
+	v := &virtualFolders{
+		WorkerInteractor: base,
+		folders:          make(map[string]*virtualFolder),
+		order:            order,
+		requests:         make(map[int64]*virtualRequest),
+		counts:           make(map[int64]*virtualCount),
+		searchAny:        searchAny,
+	}
+	for _, name := range order {
+		folder, err := parseVirtualFolder(name, queries[name], acct.Default)
+		if err != nil {
+			return nil, fmt.Errorf("virtual-folders: %s: %w", name, err)
+		}
+		v.folders[name] = folder
+	}
+	return v, nil
+}
+
+// parseVirtualFolder parses a query optionally starting with a folder:<name>
+// term which selects the base folder of the virtual folder.
+func parseVirtualFolder(name, value, defaultFolder string) (*virtualFolder, error) {
+	folder := defaultFolder
+	value = strings.TrimSpace(value)
+	if rest, ok := strings.CutPrefix(value, "folder:"); ok {
+		if quoted, ok := strings.CutPrefix(rest, `"`); ok {
+			folder, value, ok = strings.Cut(quoted, `"`)
+			if !ok {
+				return nil, errors.New("unterminated quoted string")
+			}
+		} else {
+			folder, value, _ = strings.Cut(rest, " ")
+		}
+	}
+	if folder == "" {
+		return nil, errors.New("empty folder name")
+	}
+	if folder == name {
+		return nil, errors.New("virtual folder cannot search itself")
+	}
+	query, err := types.ParseQuery(value, types.QuerySubject)
+	if err != nil {
+		return nil, err
+	}
+	return &virtualFolder{
+		name:     name,
+		folder:   folder,
+		criteria: &types.SearchCriteria{Query: query},
+		uids:     make(map[models.UID]struct{}),
+	}, nil
+}
+
+func (v *virtualFolders) Unwrap() types.WorkerInteractor {
+	return v.WorkerInteractor
+}
+
+// request returns the virtual folder named dir and records the action so
+// that its responses are attributed to that folder.
+func (v *virtualFolders) request(
+	msg types.WorkerMessage, dir string, criteria *types.SearchCriteria,
+) *virtualFolder {
+	f, ok := v.folders[dir]
+	if !ok {
+		return nil
+	}
+	v.requests[msg.GetId()] = &virtualRequest{folder: f, criteria: criteria}
+	return f
+}
+
+func (v *virtualFolders) ProcessAction(msg types.WorkerMessage) types.WorkerMessage {
+	v.Lock()
+	switch msg := msg.(type) {
+	case *types.CheckMail:
+		// base folders are checked on their own
+		dirs := make([]string, 0, len(msg.Directories))
+		for _, dir := range msg.Directories {
+			if _, ok := v.folders[dir]; !ok {
+				dirs = append(dirs, dir)
+			}
+		}
+		msg.Directories = dirs
+	case *types.OpenDirectory:
+		if f := v.request(msg, msg.Directory, nil); f != nil {
+			msg.Directory = f.folder
+		}
+		v.selected = msg.Directory
+	case *types.FetchDirectoryContents:
+		if f := v.request(msg, msg.Directory, msg.Filter); f != nil {
+			msg.Directory = f.folder
+			msg.Filter = f.combine(msg.Filter)
+		}
+	case *types.FetchDirectoryThreaded:
+		if f := v.request(msg, msg.Directory, msg.Filter); f != nil {
+			msg.Directory = f.folder
+			msg.Filter = f.combine(msg.Filter)
+		}
+	case *types.SearchDirectory:
+		if c, ok := v.counts[msg.GetId()]; ok {
+			// the selection changed since the count was requested
+			if !v.searchAny && v.selected != c.folder.folder {
+				c.folder.stale = true
+			}
+		} else if f := v.request(msg, msg.Directory, msg.Criteria); f != nil {
+			msg.Directory = f.folder
+			msg.Criteria = f.combine(msg.Criteria)
+		}
+	case *types.FetchMessageHeaders:
+		if f := v.request(msg, msg.Directory, nil); f != nil {
+			msg.Directory = f.folder
+		}
+	case *types.FetchFullMessages:
+		if f := v.request(msg, msg.Directory, nil); f != nil {
+			msg.Directory = f.folder
+		}
+	case *types.FetchMessageBodyPart:
+		if f := v.request(msg, msg.Directory, nil); f != nil {
+			msg.Directory = f.folder
+		}
+	case *types.FetchMessageFlags:
+		if f := v.request(msg, msg.Directory, nil); f != nil {
+			msg.Directory = f.folder
+		}
+	case *types.DeleteMessages:
+		if f := v.request(msg, msg.Directory, nil); f != nil {
+			msg.Directory = f.folder
+		}
+	case *types.FlagMessages:
+		if f := v.request(msg, msg.Directory, nil); f != nil {
+			msg.Directory = f.folder
+		}
+	case *types.AnsweredMessages:
+		if f := v.request(msg, msg.Directory, nil); f != nil {
+			msg.Directory = f.folder
+		}
+	case *types.ForwardedMessages:
+		if f := v.request(msg, msg.Directory, nil); f != nil {
+			msg.Directory = f.folder
+		}
+	case *types.JunkMessages:
+		if f := v.request(msg, msg.Directory, nil); f != nil {
+			msg.Directory = f.folder
+		}
+	case *types.CopyMessages:
+		if f := v.request(msg, msg.Source, nil); f != nil {
+			msg.Source = f.folder
+		}
+	case *types.MoveMessages:
+		if f := v.request(msg, msg.Source, nil); f != nil {
+			msg.Source = f.folder
+		}
+	}
+	v.Unlock()
+
+	msg = v.WorkerInteractor.ProcessAction(msg)
+
+	if msg, ok := msg.(*types.OpenDirectory); ok {
+		// inner middlewares may have renamed the folder
+		v.Lock()
+		v.selectedSource = msg.Directory
+		v.Unlock()
+	}
+	return msg
+}
+
+// restore renames a processed action back to its virtual folder.
+func (r *virtualRequest) restore(msg types.WorkerMessage) {
+	name := r.folder.name
+	switch msg := msg.(type) {
+	case *types.OpenDirectory:
+		msg.Directory = name
+	case *types.FetchDirectoryContents:
+		msg.Directory = name
+		msg.Filter = r.criteria
+	case *types.FetchDirectoryThreaded:
+		msg.Directory = name
+		msg.Filter = r.criteria
+	case *types.SearchDirectory:
+		msg.Directory = name
+		msg.Criteria = r.criteria
+	case *types.FetchMessageHeaders:
+		msg.Directory = name
+	case *types.FetchFullMessages:
+		msg.Directory = name
+	case *types.FetchMessageBodyPart:
+		msg.Directory = name
+	case *types.FetchMessageFlags:
+		msg.Directory = name
+	case *types.DeleteMessages:
+		msg.Directory = name
+	case *types.FlagMessages:
+		msg.Directory = name
+	case *types.AnsweredMessages:
+		msg.Directory = name
+	case *types.ForwardedMessages:
+		msg.Directory = name
+	case *types.JunkMessages:
+		msg.Directory = name
+	case *types.CopyMessages:
+		msg.Source = name
+	case *types.MoveMessages:
+		msg.Source = name
+	}
+}
+
+func (v *virtualFolders) PostMessage(msg types.WorkerMessage, cb func(m types.WorkerMessage)) {
+	var before, after, actions []types.WorkerMessage
+	forward := true
+
+	v.Lock()
+	var req *virtualRequest
+	if r := msg.InResponseTo(); r != nil {
+		if c, ok := v.counts[r.GetId()]; ok {
+			actions = v.counted(c, msg, &after)
+			forward = false
+		}
+		req = v.requests[r.GetId()]
+		if isFinal(msg) {
+			delete(v.requests, r.GetId())
+			if req != nil {
+				req.restore(r)
+			}
+		}
+	}
+	if forward {
+		if req != nil {
+			after = v.outgoingVirtual(req, msg)
+		} else {
+			before, after, actions = v.outgoing(msg)
+		}
+	}
+	v.Unlock()
+
+	for _, m := range before {
+		v.WorkerInteractor.PostMessage(m, nil)
+	}
+	if forward {
+		v.WorkerInteractor.PostMessage(msg, cb)
+	}
+	for _, m := range after {
+		v.WorkerInteractor.PostMessage(m, nil)
+	}
+	if len(actions) > 0 {
+		// the worker goroutine may be the one calling PostMessage
+		go func() {
+			for _, a := range actions {
+				v.Actions() <- a
+			}
+		}()
+	}
+}
+
+func isFinal(msg types.WorkerMessage) bool {
+	switch msg.(type) {
+	case *types.Done, *types.Error, *types.Unsupported, *types.Cancelled:
+		return true
+	}
+	return false
+}
+
+// outgoingVirtual renames the responses to actions on a virtual folder.
+// Flag and deletion updates are also reported for the base folder.
+func (v *virtualFolders) outgoingVirtual(
+	req *virtualRequest, msg types.WorkerMessage,
+) []types.WorkerMessage {
+	f := req.folder
+	var extra []types.WorkerMessage
+	switch msg := msg.(type) {
+	case *types.DirectoryContents:
+		msg.Directory = f.name
+		msg.Filter = req.criteria
+		f.uids = make(map[models.UID]struct{}, len(msg.Uids))
+		for _, uid := range msg.Uids {
+			f.uids[uid] = struct{}{}
+		}
+	case *types.DirectoryThreaded:
+		msg.Directory = f.name
+		msg.Filter = req.criteria
+		f.uids = make(map[models.UID]struct{})
+		for _, t := range msg.Threads {
+			_ = t.Walk(func(t *types.Thread, _ int, _ error) error {
+				f.uids[t.Uid] = struct{}{}
+				return nil
+			})
+		}
+	case *types.SearchResults:
+		msg.Directory = f.name
+		msg.Criteria = req.criteria
+	case *types.MessageInfo:
+		if msg.Info == nil {
+			break
+		}
+		if isFlagUpdate(msg) {
+			extra = append(extra, copyMessageInfo(msg, msg.Info.Directory))
+		}
+		msg.Info.Directory = f.name
+	case *types.MessagesDeleted:
+		extra = append(extra, &types.MessagesDeleted{
+			Directory: msg.Directory,
+			Uids:      msg.Uids,
+		})
+		msg.Directory = f.name
+		for _, uid := range msg.Uids {
+			delete(f.uids, uid)
+		}
+	}
+	return extra
+}
+
+// outgoing reports the virtual folders along with the backend folders,
+// refreshes the counts of the virtual folders when their base folder changes
+// and forwards updates of the selected folder to its virtual folders.
+func (v *virtualFolders) outgoing(
+	msg types.WorkerMessage,
+) (before, after, actions []types.WorkerMessage) {
+	switch msg := msg.(type) {
+	case *types.Done:
+		if _, ok := msg.InResponseTo().(*types.ListDirectories); ok {
+			for _, name := range v.order {
+				before = append(before, &types.Directory{
+					Dir: &models.Directory{Name: name},
+				})
+			}
+		}
+	case *types.DirectoryInfo:
+		if msg.Info == nil {
+			break
+		}
+		dir := v.selected
+		if v.searchAny {
+			dir = v.displayName(msg.Info.Name)
+		} else if !v.isSelected(msg.Info.Name) {
+			break
+		}
+		for _, name := range v.order {
+			f := v.folders[name]
+			if f.folder == dir {
+				actions = append(actions, v.refresh(f)...)
+			}
+		}
+	case *types.MessageInfo:
+		if msg.Info == nil || !isFlagUpdate(msg) || !v.isSelected(msg.Info.Directory) {
+			break
+		}
+		for _, name := range v.order {
+			f := v.folders[name]
+			if _, ok := f.uids[msg.Info.Uid]; ok && f.folder == v.selected {
+				after = append(after, copyMessageInfo(msg, f.name))
+			}
+		}
+	case *types.MessagesDeleted:
+		if !v.isSelected(msg.Directory) {
+			break
+		}
+		for _, name := range v.order {
+			f := v.folders[name]
+			if f.folder != v.selected {
+				continue
+			}
+			var uids []models.UID
+			for _, uid := range msg.Uids {
+				if _, ok := f.uids[uid]; ok {
+					uids = append(uids, uid)
+					delete(f.uids, uid)
+				}
+			}
+			if len(uids) > 0 {
+				after = append(after, &types.MessagesDeleted{
+					Directory: f.name,
+					Uids:      uids,
+				})
+			}
+		}
+	}
+	return before, after, actions
+}
+
+// isSelected returns true if a backend folder name refers to the open
+// folder.
+func (v *virtualFolders) isSelected(name string) bool {
+	if v.selectedSource != "" {
+		return name == v.selectedSource
+	}
+	return name == v.selected
+}
+
+// displayName returns the name of a backend folder as known by the ui. Inner
+// middlewares only rename the folders of the messages once this one has
+// processed them.
+func (v *virtualFolders) displayName(name string) string {
+	for w := v.WorkerInteractor; w != nil; w = w.Unwrap() {
+		if m, ok := w.(*folderMapper); ok {
+			return m.outgoing(nil, name)
+		}
+	}
+	return name
+}
+
+// isFlagUpdate returns true for message updates which are not the result of
+// fetching headers, such as flag changes.
+func isFlagUpdate(msg *types.MessageInfo) bool {
+	switch msg.InResponseTo().(type) {
+	case nil, *types.FlagMessages, *types.AnsweredMessages,
+		*types.ForwardedMessages, *types.JunkMessages:
+		return true
+	}
+	return false
+}
+
+func copyMessageInfo(msg *types.MessageInfo, dir string) *types.MessageInfo {
+	info := *msg.Info
+	info.Directory = dir
+	return &types.MessageInfo{
+		Info:         &info,
+		NeedsFlags:   msg.NeedsFlags,
+		ReplaceFlags: msg.ReplaceFlags,
+	}
+}
+
+// refresh returns the searches counting the messages of a virtual folder.
+// Unless the backend can search any folder, searches are only run in the
+// folder open in the backend: some backends always search the open folder or
+// need to open the searched folder.
+func (v *virtualFolders) refresh(f *virtualFolder) []types.WorkerMessage {
+	if f.counting > 0 {
+		f.dirty = true
+		return nil
+	}
+	f.dirty = false
+	f.stale = false
+	f.counting = 2
+	all := &types.SearchDirectory{
+		Directory: f.folder,
+		Criteria:  f.criteria,
+	}
+	unseen := &types.SearchDirectory{
+		Directory: f.folder,
+		Criteria: f.criteria.Combine(&types.SearchCriteria{
+			WithoutFlags: models.SeenFlag,
+		}),
+	}
+	all.SetId(atomic.AddInt64(&lastVirtualId, -1))
+	unseen.SetId(atomic.AddInt64(&lastVirtualId, -1))
+	v.counts[all.GetId()] = &virtualCount{folder: f}
+	v.counts[unseen.GetId()] = &virtualCount{folder: f, unseen: true}
+	return []types.WorkerMessage{all, unseen}
+}
+
+// counted processes a response to a counting search. The counts of the
+// virtual folder are reported once both searches are complete.
+func (v *virtualFolders) counted(
+	c *virtualCount, msg types.WorkerMessage, after *[]types.WorkerMessage,
+) []types.WorkerMessage {
+	f := c.folder
+	switch msg := msg.(type) {
+	case *types.SearchResults:
+		if c.unseen {
+			f.info.Unseen = len(msg.Uids)
+		} else {
+			f.info.Exists = len(msg.Uids)
+		}
+		return nil
+	case *types.Error:
+		v.Errorf("virtual folder %s: %v", f.name, msg.Error)
+		f.stale = true
+	case *types.Unsupported, *types.Cancelled:
+		f.stale = true
+	case *types.Done:
+	default:
+		return nil
+	}
+	delete(v.counts, msg.InResponseTo().GetId())
+	f.counting--
+	if f.counting > 0 {
+		return nil
+	}
+	if !f.stale {
+		info := f.info
+		info.Name = f.name
+		*after = append(*after, &types.DirectoryInfo{Info: &info})
+	}
+	if f.dirty && (v.searchAny || f.folder == v.selected) {
+		return v.refresh(f)
+	}
+	return nil
+}
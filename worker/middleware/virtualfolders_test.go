@@ -0,0 +1,215 @@
+package middleware
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"git.sr.ht/~rjarry/aerc/config"
+	"git.sr.ht/~rjarry/aerc/models"
+	"git.sr.ht/~rjarry/aerc/worker/types"
+)
+
+func TestParseVirtualFolder(t *testing.T) {
+	tests := []struct {
+		value  string
+		folder string
+		query  string
+		err    bool
+	}{
+		{"not flag:seen", "INBOX", "not flag:seen", false},
+		{"folder:Lists from:bob", "Lists", `from:"bob"`, false},
+		{`folder:"Sent Items" to:alice`, "Sent Items", `to:"alice"`, false},
+		{`folder:"Sent Items to:alice`, "", "", true},
+		{"folder:Lists", "", "", true},
+		{"folder:Saved flag:flagged", "", "", true},
+	}
+	for _, test := range tests {
+		f, err := parseVirtualFolder("Saved", test.value, "INBOX")
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: expected error", test.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.value, err)
+			continue
+		}
+		if f.folder != test.folder {
+			t.Errorf("%q: expected folder %q, got %q",
+				test.value, test.folder, f.folder)
+		}
+		if q := f.criteria.Query.String(); q != test.query {
+			t.Errorf("%q: expected query %q, got %q", test.value, test.query, q)
+		}
+	}
+}
+
+func newTestVirtualFolders(t *testing.T, searchAny bool) (
+	types.WorkerInteractor, *types.Worker, func() types.WorkerMessage,
+) {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "virtual-folders")
+	err := os.WriteFile(file, []byte(
+		"Unread = not flag:seen\nOld = folder:Archive flag:seen\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := make(chan types.WorkerMessage, 16)
+	base := types.NewWorker("test", messages)
+	w, err := NewVirtualFolders(base, &config.AccountConfig{
+		Default:        "INBOX",
+		VirtualFolders: file,
+	}, searchAny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := func() types.WorkerMessage {
+		select {
+		case msg := <-messages:
+			return msg
+		default:
+			return nil
+		}
+	}
+	return w, base, received
+}
+
+// countVirtualFolder reports the directory info of a base folder and answers
+// the counting searches, if any, that it triggers.
+func countVirtualFolder(
+	t *testing.T, w types.WorkerInteractor, base *types.Worker, folder string,
+) bool {
+	t.Helper()
+	w.PostMessage(&types.DirectoryInfo{
+		Info: &models.DirectoryInfo{Name: folder},
+	}, nil)
+	for i := 0; i < 2; i++ {
+		var search *types.SearchDirectory
+		select {
+		case action := <-base.Actions():
+			search, _ = action.(*types.SearchDirectory)
+		case <-time.After(100 * time.Millisecond):
+		}
+		if search == nil {
+			return false
+		}
+		if search.Directory != folder {
+			t.Fatalf("expected counting search of %s, got %#v", folder, search)
+		}
+		w.ProcessAction(search)
+		uids := []models.UID{"1", "2", "3"}
+		if search.Criteria.WithoutFlags.Has(models.SeenFlag) {
+			uids = uids[:1]
+		}
+		w.PostMessage(&types.SearchResults{
+			Message:   types.RespondTo(search),
+			Directory: folder,
+			Uids:      uids,
+		}, nil)
+		w.PostMessage(&types.Done{Message: types.RespondTo(search)}, nil)
+	}
+	return true
+}
+
+func TestVirtualFolders(t *testing.T) {
+	w, base, received := newTestVirtualFolders(t, false)
+	action := func(msg types.WorkerMessage, id int64) {
+		msg.SetId(id)
+		w.ProcessAction(msg)
+	}
+
+	w.PostMessage(&types.Done{
+		Message: types.RespondTo(&types.ListDirectories{}),
+	}, nil)
+	for _, name := range []string{"Unread", "Old"} {
+		if dir, ok := received().(*types.Directory); !ok || dir.Dir.Name != name {
+			t.Errorf("expected virtual folder %s to be listed, got %#v", name, dir)
+		}
+	}
+	if _, ok := received().(*types.Done); !ok {
+		t.Errorf("expected listing to be done")
+	}
+
+	open := &types.OpenDirectory{Directory: "Unread"}
+	action(open, 1)
+	if open.Directory != "INBOX" {
+		t.Errorf("expected INBOX to be opened, got %q", open.Directory)
+	}
+
+	fetch := &types.FetchDirectoryContents{Directory: "Unread"}
+	action(fetch, 2)
+	if fetch.Directory != "INBOX" || fetch.Filter == nil ||
+		fetch.Filter.Query == nil {
+		t.Fatalf("expected search of INBOX, got %#v", fetch)
+	}
+	w.PostMessage(&types.DirectoryContents{
+		Message:   types.RespondTo(fetch),
+		Directory: "INBOX",
+		Uids:      []models.UID{"1", "2"},
+	}, nil)
+	if msg, ok := received().(*types.DirectoryContents); !ok ||
+		msg.Directory != "Unread" {
+		t.Errorf("expected contents of Unread, got %#v", msg)
+	}
+	w.PostMessage(&types.Done{Message: types.RespondTo(fetch)}, nil)
+	received()
+	if fetch.Directory != "Unread" || fetch.Filter != nil {
+		t.Errorf("expected action to be restored, got %#v", fetch)
+	}
+
+	// flag updates of the base folder are forwarded to the virtual folder
+	w.PostMessage(&types.MessageInfo{
+		Info: &models.MessageInfo{Directory: "INBOX", Uid: "2"},
+	}, nil)
+	for _, dir := range []string{"INBOX", "Unread"} {
+		msg, ok := received().(*types.MessageInfo)
+		if !ok || msg.Info.Directory != dir {
+			t.Errorf("expected message update of %s, got %#v", dir, msg)
+		}
+	}
+
+	// counts are updated when the open base folder reports its own
+	if !countVirtualFolder(t, w, base, "INBOX") {
+		t.Fatal("expected counting searches of INBOX")
+	}
+	received()
+	info, ok := received().(*types.DirectoryInfo)
+	if !ok || info.Info.Name != "Unread" ||
+		info.Info.Exists != 3 || info.Info.Unseen != 1 {
+		t.Errorf("expected counts of Unread, got %#v", info)
+	}
+
+	// the backend would have to open the base folder to search it
+	if countVirtualFolder(t, w, base, "Archive") {
+		t.Error("unexpected counting searches of Archive which is not open")
+	}
+	received()
+	if msg := received(); msg != nil {
+		t.Errorf("unexpected message %#v", msg)
+	}
+}
+
+func TestVirtualFolders_SearchAny(t *testing.T) {
+	w, base, received := newTestVirtualFolders(t, true)
+
+	open := &types.OpenDirectory{Directory: "INBOX"}
+	open.SetId(1)
+	w.ProcessAction(open)
+
+	// counts are updated even when the base folder is not open
+	if !countVirtualFolder(t, w, base, "Archive") {
+		t.Fatal("expected counting searches of Archive")
+	}
+	received()
+	info, ok := received().(*types.DirectoryInfo)
+	if !ok || info.Info.Name != "Old" ||
+		info.Info.Exists != 3 || info.Info.Unseen != 1 {
+		t.Errorf("expected counts of Old, got %#v", info)
+	}
+	if msg := received(); msg != nil {
+		t.Errorf("unexpected message %#v", msg)
+	}
+}
@@ -99,9 +99,57 @@ func translate(crit *types.SearchCriteria) string {
 		}
 	}
 
+	if crit.Query != nil {
+		base.and(translateQuery(crit.Query))
+	}
+
 	return base.s
 }
 
+func translateQuery(q *types.Query) string {
+	var b queryBuilder
+	switch q.Op {
+	case types.QueryAnd:
+		for _, o := range q.Operands {
+			b.and(translateQuery(o))
+		}
+	case types.QueryOr:
+		for _, o := range q.Operands {
+			b.or(translateQuery(o))
+		}
+	case types.QueryNot:
+		b.s = "not (" + translateQuery(q.Operands[0]) + ")"
+	case types.QueryFrom:
+		b.s = "from:" + opt.QuoteArg(q.Value)
+	case types.QueryTo:
+		b.s = "to:" + opt.QuoteArg(q.Value)
+	case types.QueryCc:
+		b.s = "cc:" + opt.QuoteArg(q.Value)
+	case types.QuerySubject:
+		b.s = "subject:" + opt.QuoteArg(q.Value)
+	case types.QueryBody:
+		b.s = "body:" + opt.QuoteArg(q.Value)
+	case types.QueryText:
+		b.s = opt.QuoteArg(q.Value)
+	case types.QueryHeader:
+		// only works for headers indexed with a custom prefix of the
+		// same name, see index.header in notmuch-config(1)
+		b.s = strings.ToLower(q.Header) + ":" + opt.QuoteArg(q.Value)
+	case types.QueryFlag:
+		b.s = getParsedFlag(q.Flag, false)
+	case types.QueryDate:
+		var start, end string
+		if !q.Start.IsZero() {
+			start = fmt.Sprintf("@%d", q.Start.Unix())
+		}
+		if !q.End.IsZero() {
+			end = fmt.Sprintf("@%d", q.End.Unix())
+		}
+		b.s = "date:" + start + ".." + end
+	}
+	return b.s
+}
+
 func getParsedFlag(flag models.Flags, inverse bool) string {
 	name := "tag:" + flagToTag[flag]
 	if flagToInvert[flag] {
@@ -24,6 +24,7 @@ import (
 	"git.sr.ht/~rjarry/aerc/models"
 	"git.sr.ht/~rjarry/aerc/worker/handlers"
 	"git.sr.ht/~rjarry/aerc/worker/lib"
+	"git.sr.ht/~rjarry/aerc/worker/middleware"
 	notmuch "git.sr.ht/~rjarry/aerc/worker/notmuch/lib"
 	"git.sr.ht/~rjarry/aerc/worker/types"
 	"github.com/emersion/go-maildir"
@@ -34,7 +35,7 @@ func init() {
 }
 
 type worker struct {
-	w                   *types.Worker
+	w                   types.WorkerInteractor
 	nmStateChange       chan bool
 	query               string
 	currentQueryName    string
@@ -256,6 +257,12 @@ func (w *worker) handleConfigure(msg *types.Configure) error {
 		w.mfs = types.Refuse
 	}
 
+	vf, err := middleware.NewVirtualFolders(w.w, msg.Config, false)
+	if err != nil {
+		return err
+	}
+	w.w = vf
+
 	return nil
 }
 
@@ -833,6 +840,8 @@ func (w *worker) handleCopyMessages(msg *types.CopyMessages) error {
 		Message:     types.RespondTo(msg),
 		Destination: msg.Destination,
 		Uids:        msg.Uids,
+		// notmuch UIDs are message ids, they do not depend on the folder
+		DestUids: msg.Uids,
 	}, nil)
 	return nil
 }
@@ -868,6 +877,12 @@ func (w *worker) handleMoveMessages(msg *types.MoveMessages) error {
 			return err
 		}
 	}
+	w.w.PostMessage(&types.MessagesMoved{
+		Message:     types.RespondTo(msg),
+		Destination: msg.Destination,
+		Uids:        msg.Uids,
+		DestUids:    msg.Uids,
+	}, nil)
 	w.w.PostMessage(&types.MessagesDeleted{
 		Message:   types.RespondTo(msg),
 		Directory: msg.Source,
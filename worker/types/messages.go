@@ -85,6 +85,13 @@ type ConnError struct {
 	Error error
 }
 
+// Offline is sent instead of ConnError by backends which serve messages
+// from a local store while disconnected.
+type Offline struct {
+	Message
+	Error error
+}
+
 type Unsupported struct {
 	Message
 }
@@ -219,6 +226,15 @@ type ForwardedMessages struct {
 	Uids      []models.UID
 }
 
+// JunkMessages sets the $Junk keyword on messages and removes $NotJunk, or
+// the reverse. Backends without keywords respond with Unsupported.
+type JunkMessages struct {
+	Message
+	Junk      bool
+	Directory string
+	Uids      []models.UID
+}
+
 type CopyMessages struct {
 	Message
 	Source            string
@@ -258,6 +274,33 @@ type StartSendingMessage struct {
 	CopyTo []string
 }
 
+type ListSieveScripts struct {
+	Message
+}
+
+type GetSieveScript struct {
+	Message
+	Name string
+}
+
+// Upload a script. The server refuses it if it contains errors.
+type PutSieveScript struct {
+	Message
+	Name   string
+	Script string
+}
+
+type CheckSieveScript struct {
+	Message
+	Script string
+}
+
+// Make a script the active one. An empty Name deactivates all scripts.
+type ActivateSieveScript struct {
+	Message
+	Name string
+}
+
 // Messages
 
 type Directory struct {
@@ -313,12 +356,18 @@ type MessagesCopied struct {
 	Message
 	Destination string
 	Uids        []models.UID
+	// UIDs of the messages in Destination, in the same order as Uids.
+	// Nil if the backend could not determine them.
+	DestUids []models.UID
 }
 
 type MessagesMoved struct {
 	Message
 	Destination string
 	Uids        []models.UID
+	// UIDs of the messages in Destination, in the same order as Uids.
+	// Nil if the backend could not determine them.
+	DestUids []models.UID
 }
 
 type ModifyLabels struct {
@@ -334,6 +383,17 @@ type LabelList struct {
 	Labels []string
 }
 
+type SieveScripts struct {
+	Message
+	Scripts []models.SieveScript
+}
+
+type SieveScript struct {
+	Message
+	Name   string
+	Script string
+}
+
 type CheckMailDirectories struct {
 	Message
 	Directories []string
@@ -0,0 +1,326 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"git.sr.ht/~rjarry/aerc/lib/parse"
+	"git.sr.ht/~rjarry/aerc/models"
+)
+
+type QueryOp int
+
+const (
+	QueryAnd QueryOp = iota
+	QueryOr
+	QueryNot
+	QueryFrom
+	QueryTo
+	QueryCc
+	QuerySubject
+	QueryBody
+	// entire text of the message
+	QueryText
+	QueryHeader
+	QueryFlag
+	QueryDate
+)
+
+// Query is a node of a boolean search expression. And, Or and Not nodes
+// combine their Operands. Other nodes match a single property of messages.
+type Query struct {
+	Op       QueryOp
+	Operands []*Query
+	// Header name of QueryHeader nodes
+	Header string
+	// Searched text of address, subject, body, text and header nodes
+	Value string
+	// Flag of QueryFlag nodes
+	Flag models.Flags
+	// Date range of QueryDate nodes. Either may be zero.
+	Start time.Time
+	End   time.Time
+}
+
+var queryFields = map[string]QueryOp{
+	"from":    QueryFrom,
+	"to":      QueryTo,
+	"cc":      QueryCc,
+	"subject": QuerySubject,
+	"body":    QueryBody,
+	"text":    QueryText,
+	"header":  QueryHeader,
+	"flag":    QueryFlag,
+	"date":    QueryDate,
+}
+
+var queryFlags = map[string]models.Flags{
+	"seen":      models.SeenFlag,
+	"answered":  models.AnsweredFlag,
+	"forwarded": models.ForwardedFlag,
+	"flagged":   models.FlaggedFlag,
+	"draft":     models.DraftFlag,
+}
+
+// ParseQuery parses a boolean search expression such as:
+//
+//	(from:alice or from:bob) and not flag:seen and date:this_week
+//
+// Terms are combined with the and, or and not operators and grouped with
+// parentheses. Adjacent terms are implicitly combined with and. Terms
+// without a known field: prefix are compiled into op nodes, which must be
+// one of QuerySubject, QueryBody or QueryText.
+func ParseQuery(s string, op QueryOp) (*Query, error) {
+	tokens, err := lexQuery(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens, op: op}
+	q, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t != nil {
+		return nil, fmt.Errorf("unexpected %q", t.value)
+	}
+	if q == nil {
+		return nil, errors.New("empty query")
+	}
+	return q, nil
+}
+
+type queryToken struct {
+	value string
+	// quoted strings are never operators
+	quoted bool
+	// strings quoted from their beginning have no field prefix
+	literal bool
+}
+
+func lexQuery(s string) ([]queryToken, error) {
+	var tokens []queryToken
+	var cur strings.Builder
+	inToken, quoted, literal := false, false, false
+	flush := func() {
+		if inToken {
+			tokens = append(tokens, queryToken{
+				value: cur.String(), quoted: quoted, literal: literal,
+			})
+		}
+		cur.Reset()
+		inToken, quoted, literal = false, false, false
+	}
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == ' ' || r == '\t' || r == '\n':
+			flush()
+		case r == '(' || r == ')':
+			flush()
+			tokens = append(tokens, queryToken{value: string(r)})
+		case r == '"':
+			literal = !inToken
+			inToken, quoted = true, true
+			end := -1
+			for j := i + 1; j < len(runes); j++ {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+					cur.WriteRune(runes[j])
+					continue
+				}
+				if runes[j] == r {
+					end = j
+					break
+				}
+				cur.WriteRune(runes[j])
+			}
+			if end < 0 {
+				return nil, errors.New("unterminated quoted string")
+			}
+			i = end
+		default:
+			inToken = true
+			cur.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens, nil
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+	op     QueryOp
+}
+
+func (p *queryParser) peek() *queryToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+// isOperator returns true if the next token is the given keyword.
+func (p *queryParser) isOperator(keyword string) bool {
+	t := p.peek()
+	return t != nil && !t.quoted && strings.EqualFold(t.value, keyword)
+}
+
+func (p *queryParser) parseOr() (*Query, error) {
+	q, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	operands := []*Query{q}
+	for p.isOperator("or") {
+		p.pos++
+		q, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, q)
+	}
+	if len(operands) == 1 {
+		return operands[0], nil
+	}
+	return &Query{Op: QueryOr, Operands: operands}, nil
+}
+
+func (p *queryParser) parseAnd() (*Query, error) {
+	var operands []*Query
+	for {
+		t := p.peek()
+		if t == nil || (!t.quoted && t.value == ")") || p.isOperator("or") {
+			break
+		}
+		if p.isOperator("and") {
+			if len(operands) == 0 {
+				return nil, errors.New("missing operand before \"and\"")
+			}
+			p.pos++
+		}
+		q, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, q)
+	}
+	switch len(operands) {
+	case 0:
+		if t := p.peek(); t != nil {
+			return nil, fmt.Errorf("unexpected %q", t.value)
+		}
+		return nil, errors.New("missing operand")
+	case 1:
+		return operands[0], nil
+	}
+	return &Query{Op: QueryAnd, Operands: operands}, nil
+}
+
+func (p *queryParser) parseUnary() (*Query, error) {
+	t := p.peek()
+	switch {
+	case t == nil:
+		return nil, errors.New("missing operand")
+	case p.isOperator("not"):
+		p.pos++
+		q, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Query{Op: QueryNot, Operands: []*Query{q}}, nil
+	case !t.quoted && t.value == "(":
+		p.pos++
+		q, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.peek(); t == nil || t.quoted || t.value != ")" {
+			return nil, errors.New("missing closing parenthesis")
+		}
+		p.pos++
+		return q, nil
+	case !t.quoted && t.value == ")":
+		return nil, errors.New("unexpected \")\"")
+	}
+	p.pos++
+	return p.parseTerm(t)
+}
+
+func (p *queryParser) parseTerm(t *queryToken) (*Query, error) {
+	field, value, found := strings.Cut(t.value, ":")
+	op, known := queryFields[strings.ToLower(field)]
+	if t.literal || !found || !known {
+		return &Query{Op: p.op, Value: t.value}, nil
+	}
+	q := &Query{Op: op, Value: value}
+	switch op {
+	case QueryHeader:
+		name, value, found := strings.Cut(value, ":")
+		if !found || name == "" {
+			return nil, fmt.Errorf("%q: expected header:<name>:<value>", t.value)
+		}
+		q.Header = name
+		q.Value = strings.TrimSpace(value)
+	case QueryFlag:
+		f, ok := queryFlags[strings.ToLower(value)]
+		if !ok {
+			return nil, fmt.Errorf("%q: unknown flag", value)
+		}
+		q.Flag = f
+		q.Value = ""
+	case QueryDate:
+		start, end, err := parse.DateRange(value)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", t.value, err)
+		}
+		q.Start = start
+		q.End = end
+		q.Value = ""
+	}
+	return q, nil
+}
+
+// String returns the query in a normalized form.
+func (q *Query) String() string {
+	switch q.Op {
+	case QueryAnd, QueryOr:
+		sep := " and "
+		if q.Op == QueryOr {
+			sep = " or "
+		}
+		parts := make([]string, 0, len(q.Operands))
+		for _, o := range q.Operands {
+			parts = append(parts, o.String())
+		}
+		return "(" + strings.Join(parts, sep) + ")"
+	case QueryNot:
+		return "not " + q.Operands[0].String()
+	case QueryHeader:
+		return fmt.Sprintf("header:%q", q.Header+":"+q.Value)
+	case QueryFlag:
+		for name, f := range queryFlags {
+			if f == q.Flag {
+				return "flag:" + name
+			}
+		}
+	case QueryDate:
+		var start, end string
+		if !q.Start.IsZero() {
+			start = q.Start.Format("2006-01-02")
+		}
+		if !q.End.IsZero() {
+			end = q.End.Format("2006-01-02")
+		}
+		return "date:" + start + ".." + end
+	}
+	for name, op := range queryFields {
+		if op == q.Op {
+			return fmt.Sprintf("%s:%q", name, q.Value)
+		}
+	}
+	return fmt.Sprintf("%q", q.Value)
+}
@@ -0,0 +1,57 @@
+package types
+
+import (
+	"testing"
+
+	"git.sr.ht/~rjarry/aerc/models"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query  string
+		expect string
+	}{
+		{"hello", `body:"hello"`},
+		{"hello world", `(body:"hello" and body:"world")`},
+		{`"hello world"`, `body:"hello world"`},
+		{
+			"(from:alice or from:bob) and not flag:seen",
+			`((from:"alice" or from:"bob") and not flag:seen)`,
+		},
+		{"a or b c", `(body:"a" or (body:"b" and body:"c"))`},
+		{"a OR b AND NOT c", `(body:"a" or (body:"b" and not body:"c"))`},
+		{`from:"Alice Smith" "or"`, `(from:"Alice Smith" and body:"or")`},
+		{`"subject:x"`, `body:"subject:x"`},
+		{"header:List-Id:aerc-devel", `header:"List-Id:aerc-devel"`},
+		{"date:2024-01-01..2024-02-01", "date:2024-01-01..2024-02-01"},
+		{"re:foo", `body:"re:foo"`},
+		{"not (a or b)", `not (body:"a" or body:"b")`},
+	}
+	for _, test := range tests {
+		q, err := ParseQuery(test.query, QueryBody)
+		if err != nil {
+			t.Errorf("%s: %v", test.query, err)
+			continue
+		}
+		if res := q.String(); res != test.expect {
+			t.Errorf("%s: expected %s, got %s", test.query, test.expect, res)
+		}
+	}
+
+	for _, query := range []string{
+		"", "(a", "a)", "a and", "or a", "not", `"a`, "flag:unknown",
+		"date:notadate", "header:novalue",
+	} {
+		if _, err := ParseQuery(query, QueryBody); err == nil {
+			t.Errorf("%q: expected error", query)
+		}
+	}
+
+	q, err := ParseQuery("flag:flagged", QuerySubject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Op != QueryFlag || q.Flag != models.FlaggedFlag {
+		t.Errorf("unexpected query: %#v", q)
+	}
+}
@@ -21,6 +21,8 @@ type SearchCriteria struct {
 	SearchAll    bool
 	Terms        []string
 	UseExtension bool
+	// Boolean expression which must also match, if not nil
+	Query *Query
 }
 
 func (c *SearchCriteria) PrepareHeader() {
@@ -65,6 +67,13 @@ func (c *SearchCriteria) Combine(other *SearchCriteria) *SearchCriteria {
 	cc := make([]string, len(c.Cc)+len(other.Cc))
 	copy(cc[:len(c.Cc)], c.Cc)
 	copy(cc[len(c.Cc):], other.Cc)
+	query := c.Query
+	switch {
+	case query == nil:
+		query = other.Query
+	case other.Query != nil:
+		query = &Query{Op: QueryAnd, Operands: []*Query{c.Query, other.Query}}
+	}
 	return &SearchCriteria{
 		WithFlags:    c.WithFlags | other.WithFlags,
 		WithoutFlags: c.WithoutFlags | other.WithoutFlags,
@@ -77,5 +86,6 @@ func (c *SearchCriteria) Combine(other *SearchCriteria) *SearchCriteria {
 		SearchBody:   c.SearchBody || other.SearchBody,
 		SearchAll:    c.SearchAll || other.SearchAll,
 		Terms:        append(c.Terms, other.Terms...),
+		Query:        query,
 	}
 }